@@ -0,0 +1,76 @@
+package casbin
+
+import (
+	"errors"
+	"strconv"
+
+	"github.com/casbin/casbin/v2/model"
+	"github.com/casbin/casbin/v2/persist"
+	"github.com/tbellembois/gochimitheque/datastores"
+	"github.com/tbellembois/gochimitheque/models"
+)
+
+// errReadOnlyAdapter is returned when casbin tries to write policies,
+// they are written by the datastore.
+var errReadOnlyAdapter = errors.New("read only adapter, permissions are managed by the datastore")
+
+// Adapter is a read only casbin adapter loading the policies
+// from the datastore permissions and roles permissions.
+type Adapter struct {
+	datastore datastores.Datastore
+}
+
+// NewAdapter returns an adapter for the given datastore.
+func NewAdapter(datastore datastores.Datastore) *Adapter {
+	return &Adapter{datastore: datastore}
+}
+
+// permissionToPolicy returns the casbin policy of the permission p.
+func permissionToPolicy(p models.Permission) []string {
+	return []string{
+		strconv.Itoa(p.Person.PersonID),
+		p.PermissionPermName,
+		p.PermissionItemName,
+		strconv.Itoa(p.PermissionEntityID),
+	}
+}
+
+// LoadPolicy loads all the policies.
+func (a *Adapter) LoadPolicy(m model.Model) error {
+	var (
+		ps  []models.Permission
+		err error
+	)
+
+	if ps, err = a.datastore.GetEffectivePermissions(); err != nil {
+		return err
+	}
+
+	for _, p := range ps {
+		if err = persist.LoadPolicyArray(append([]string{"p"}, permissionToPolicy(p)...), m); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// SavePolicy is not supported.
+func (a *Adapter) SavePolicy(m model.Model) error {
+	return errReadOnlyAdapter
+}
+
+// AddPolicy is not supported.
+func (a *Adapter) AddPolicy(sec string, ptype string, rule []string) error {
+	return errReadOnlyAdapter
+}
+
+// RemovePolicy is not supported.
+func (a *Adapter) RemovePolicy(sec string, ptype string, rule []string) error {
+	return errReadOnlyAdapter
+}
+
+// RemoveFilteredPolicy is not supported.
+func (a *Adapter) RemoveFilteredPolicy(sec string, ptype string, fieldIndex int, fieldValues ...string) error {
+	return errReadOnlyAdapter
+}
@@ -0,0 +1,79 @@
+package casbin
+
+import (
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/tbellembois/gochimitheque/datastores"
+)
+
+const (
+	// matcherCacheTTL bounds the staleness of a cached matcher result
+	// if a change is not followed by an invalidation.
+	matcherCacheTTL = 5 * time.Minute
+	// matcherCacheMaxSize is the number of cached results
+	// above which the cache is emptied.
+	matcherCacheMaxSize = 100000
+)
+
+type matcherCacheEntry struct {
+	match   bool
+	expires time.Time
+}
+
+// matcherCache caches the custom matchers results.
+// The generation is incremented on invalidation so that a result
+// computed before an invalidation is not cached after it.
+var matcherCache = struct {
+	sync.RWMutex
+	generation uint64
+	entries    map[string]matcherCacheEntry
+}{
+	entries: make(map[string]matcherCacheEntry),
+}
+
+// cachedMatch returns the cached result of the matcher name with the given args
+// or calls match and caches its result.
+func cachedMatch(name string, args []string, match func() bool) bool {
+	key := name + "|" + strings.Join(args, "|")
+
+	matcherCache.RLock()
+	entry, ok := matcherCache.entries[key]
+	generation := matcherCache.generation
+	matcherCache.RUnlock()
+
+	if ok && time.Now().Before(entry.expires) {
+		return entry.match
+	}
+
+	m := match()
+
+	matcherCache.Lock()
+	if matcherCache.generation == generation {
+		if len(matcherCache.entries) >= matcherCacheMaxSize {
+			matcherCache.entries = make(map[string]matcherCacheEntry)
+		}
+
+		matcherCache.entries[key] = matcherCacheEntry{match: m, expires: time.Now().Add(matcherCacheTTL)}
+	}
+	matcherCache.Unlock()
+
+	return m
+}
+
+// The datastore invalidates the cache after the commit
+// of a change the matchers results depend on.
+func init() {
+	datastores.OnAuthorizationChange(InvalidateMatcherCache)
+}
+
+// InvalidateMatcherCache empties the matchers cache.
+// It is called after a change of the storages, store locations,
+// products tenants, people admin status or entities memberships.
+func InvalidateMatcherCache() {
+	matcherCache.Lock()
+	matcherCache.generation++
+	matcherCache.entries = make(map[string]matcherCacheEntry)
+	matcherCache.Unlock()
+}
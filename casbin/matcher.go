@@ -15,6 +15,7 @@ func matchPeople(datastore datastores.Datastore, personID string, itemID string,
 	var (
 		pid, iid int
 		err      error
+		m        bool
 		ent      []models.Entity
 	)
 
@@ -35,6 +36,20 @@ func matchPeople(datastore datastores.Datastore, personID string, itemID string,
 		return false
 	}
 
+	// -1 is a permission on the people of all the person entities
+	if entityID == "-1" {
+		if len(ent) == 0 {
+			return false
+		}
+
+		if m, err = datastore.DoesPersonBelongsTo(pid, ent); err != nil {
+			logger.Log.Error("matchPeople: " + err.Error())
+			return false
+		}
+
+		return m
+	}
+
 	found := false
 
 	for _, e := range ent {
@@ -53,7 +68,9 @@ func MatchPeopleFuncWrapper(datastore datastores.Datastore) func(args ...interfa
 		itemID := args[1].(string)
 		entityID := args[2].(string)
 
-		return (bool)(matchPeople(datastore, personID, itemID, entityID)), nil
+		return cachedMatch("matchPeople", []string{personID, itemID, entityID}, func() bool {
+			return matchPeople(datastore, personID, itemID, entityID)
+		}), nil
 	}
 }
 
@@ -86,7 +103,8 @@ func matchStorelocation(datastore datastores.Datastore, personID string, itemID
 		return false
 	}
 
-	if strconv.Itoa(storelocation.EntityID) != entityID {
+	// -1 is a permission on the store locations of all the person entities
+	if entityID != "-1" && strconv.Itoa(storelocation.EntityID) != entityID {
 		return false
 	}
 
@@ -106,7 +124,9 @@ func MatchStorelocationFuncWrapper(datastore datastores.Datastore) func(args ...
 		itemID := args[1].(string)
 		entityID := args[2].(string)
 
-		return (bool)(matchStorelocation(datastore, personID, itemID, entityID)), nil
+		return cachedMatch("matchStorelocation", []string{personID, itemID, entityID}, func() bool {
+			return matchStorelocation(datastore, personID, itemID, entityID)
+		}), nil
 	}
 }
 
@@ -133,7 +153,8 @@ func matchStorage(datastore datastores.Datastore, personID string, itemID string
 		return false
 	}
 
-	if strconv.Itoa(ent.EntityID) != entityID {
+	// -1 is a permission on the storages of all the person entities
+	if entityID != "-1" && strconv.Itoa(ent.EntityID) != entityID {
 		return false
 	}
 
@@ -153,7 +174,9 @@ func MatchStorageFuncWrapper(datastore datastores.Datastore) func(args ...interf
 		itemID := args[1].(string)
 		entityID := args[2].(string)
 
-		return (bool)(matchStorage(datastore, personID, itemID, entityID)), nil
+		return cachedMatch("matchStorage", []string{personID, itemID, entityID}, func() bool {
+			return matchStorage(datastore, personID, itemID, entityID)
+		}), nil
 	}
 }
 
@@ -189,6 +212,73 @@ func MatchEntityFuncWrapper(datastore datastores.Datastore) func(args ...interfa
 		personID := args[0].(string)
 		entityID := args[1].(string)
 
-		return (bool)(matchEntity(datastore, personID, entityID)), nil
+		return cachedMatch("matchEntity", []string{personID, entityID}, func() bool {
+			return matchEntity(datastore, personID, entityID)
+		}), nil
+	}
+}
+
+func matchProduct(datastore datastores.Datastore, personID string, itemID string) bool {
+	var (
+		pid, iid int
+		err      error
+		m        bool
+		tenant   sql.NullInt64
+	)
+
+	// product cards are shared by all entities
+	if !datastore.IsMultiTenant() {
+		return true
+	}
+
+	if pid, err = strconv.Atoi(personID); err != nil {
+		logger.Log.Error("matchProduct: " + err.Error())
+		return false
+	}
+
+	if iid, err = strconv.Atoi(itemID); err != nil {
+		logger.Log.Error("matchProduct: " + err.Error())
+		return false
+	}
+
+	if tenant, err = datastore.GetProductTenant(iid); err != nil && err != sql.ErrNoRows {
+		logger.Log.Error("matchProduct: " + err.Error())
+		return false
+	}
+
+	if err == sql.ErrNoRows {
+		return false
+	}
+
+	// shared catalog
+	if !tenant.Valid {
+		return true
+	}
+
+	if m, err = datastore.IsPersonAdmin(pid); err != nil {
+		logger.Log.Error("matchProduct: " + err.Error())
+		return false
+	}
+
+	if !m {
+		if m, err = datastore.DoesPersonBelongsTo(pid, []models.Entity{{EntityID: int(tenant.Int64)}}); err != nil {
+			logger.Log.Error("matchProduct: " + err.Error())
+			return false
+		}
+	}
+
+	logger.Log.WithFields(logrus.Fields{"personId": personID, "itemId": itemID, "m": m}).Debug("matchProduct")
+
+	return m
+}
+
+func MatchProductFuncWrapper(datastore datastores.Datastore) func(args ...interface{}) (interface{}, error) {
+	return func(args ...interface{}) (interface{}, error) {
+		personID := args[0].(string)
+		itemID := args[1].(string)
+
+		return cachedMatch("matchProduct", []string{personID, itemID}, func() bool {
+			return matchProduct(datastore, personID, itemID)
+		}), nil
 	}
 }
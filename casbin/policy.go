@@ -3,12 +3,13 @@ package casbin
 import (
 	_ "embed"
 	"os"
+	"strconv"
 
 	"github.com/casbin/casbin/v2"
 	"github.com/casbin/casbin/v2/model"
-	jsonadapter "github.com/casbin/json-adapter/v2"
 	"github.com/tbellembois/gochimitheque/datastores"
 	"github.com/tbellembois/gochimitheque/logger"
+	"github.com/tbellembois/gochimitheque/models"
 )
 
 var (
@@ -16,19 +17,12 @@ var (
 	embedModel string
 )
 
-func InitCasbinPolicy(datastore datastores.Datastore) (enforcer *casbin.Enforcer) {
+// InitCasbinPolicy returns an enforcer safe for concurrent use
+// with the policies loaded from the datastore.
+func InitCasbinPolicy(datastore datastores.Datastore) (enforcer *casbin.SyncedEnforcer) {
 	var (
-		jsonAdapterData []byte
-		err             error
-	)
-
-	if jsonAdapterData, err = datastore.ToCasbinJSONAdapter(); err != nil {
-		logger.Log.Error("error getting json adapter data: " + err.Error())
-		os.Exit(1)
-	}
-
-	var (
-		m model.Model
+		m   model.Model
+		err error
 	)
 
 	if m, err = model.NewModelFromString(embedModel); err != nil {
@@ -36,21 +30,64 @@ func InitCasbinPolicy(datastore datastores.Datastore) (enforcer *casbin.Enforcer
 		os.Exit(1)
 	}
 
-	a := jsonadapter.NewAdapter(&jsonAdapterData)
-	if enforcer, err = casbin.NewEnforcer(m, a); err != nil {
+	if enforcer, err = casbin.NewSyncedEnforcer(m, NewAdapter(datastore)); err != nil {
 		logger.Log.Error("enforcer creation error: " + err.Error())
 		os.Exit(1)
 	}
 
+	// the policies are written by the datastore,
+	// the enforcer is only updated in memory
+	enforcer.EnableAutoSave(false)
+
 	enforcer.AddFunction("matchStorage", MatchStorageFuncWrapper(datastore))
 	enforcer.AddFunction("matchStorelocation", MatchStorelocationFuncWrapper(datastore))
 	enforcer.AddFunction("matchPeople", MatchPeopleFuncWrapper(datastore))
 	enforcer.AddFunction("matchEntity", MatchEntityFuncWrapper(datastore))
+	enforcer.AddFunction("matchProduct", MatchProductFuncWrapper(datastore))
 
-	if err = enforcer.LoadPolicy(); err != nil {
-		logger.Log.Error("enforcer policy load error: " + err.Error())
-		os.Exit(1)
+	return
+}
+
+// ReloadPersonPolicies replaces the enforcer policies of the people
+// with the given ids by their current datastore permissions.
+// The policies are replaced at once so that a concurrent enforcement
+// does not see a person without its policies.
+func ReloadPersonPolicies(enforcer *casbin.SyncedEnforcer, datastore datastores.Datastore, personIDs ...int) error {
+	var (
+		ps       []models.Permission
+		policies [][]string
+		err      error
+	)
+
+	if len(personIDs) == 0 {
+		return nil
 	}
 
-	return
+	if ps, err = datastore.GetEffectivePermissions(personIDs...); err != nil {
+		return err
+	}
+
+	for _, p := range ps {
+		policies = append(policies, permissionToPolicy(p))
+	}
+
+	enforcer.GetLock().Lock()
+	defer enforcer.GetLock().Unlock()
+
+	for _, id := range personIDs {
+		if _, err = enforcer.Enforcer.RemoveFilteredPolicy(0, strconv.Itoa(id)); err != nil {
+			return err
+		}
+	}
+
+	if len(policies) > 0 {
+		if _, err = enforcer.Enforcer.AddPoliciesEx(policies); err != nil {
+			return err
+		}
+	}
+
+	// the matchers results depend on the people memberships
+	InvalidateMatcherCache()
+
+	return nil
 }
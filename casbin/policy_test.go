@@ -0,0 +1,243 @@
+package casbin
+
+import (
+	"database/sql"
+	"path/filepath"
+	"testing"
+
+	"github.com/tbellembois/gochimitheque/datastores"
+	"github.com/tbellembois/gochimitheque/models"
+)
+
+// policyFixtures are two entities A (2) and B (3) with a store location
+// and a storage each, and people with the permissions:
+//
+//	20 member of A: the default products r -1 and products w -1
+//	21 member of A: storages r A, entities r -1
+//	22 member of A: storages w -1
+//	23 member of all the entities: storages r -1
+//	24 member of A: a role with storages w and products w for A
+//	25 member of A: storages b A
+//	26 member of A: people r -1
+//	27 member of B: storages r B, entities r -1
+const policyFixtures = `INSERT INTO entity (entity_id, entity_name, entity_description) VALUES (2, 'A', ''), (3, 'B', '');
+INSERT INTO storelocation (storelocation_id, storelocation_name, storelocation_fullpath, entity) VALUES (10, 'la', 'A/la', 2), (11, 'lb', 'B/lb', 3);
+INSERT INTO name (name_id, name_label) VALUES (1000, 'POLICY TEST');
+INSERT INTO empiricalformula (empiricalformula_id, empiricalformula_label) VALUES (1000, 'C2H6O');
+INSERT INTO product (product_id, name, empiricalformula, person) VALUES (1000, 1000, 1000, 1);
+INSERT INTO storage (storage_id, storage_creationdate, storage_modificationdate, person, product, storelocation) VALUES
+	(100, '2026-01-01', '2026-01-01', 1, 1000, 10),
+	(101, '2026-01-01', '2026-01-01', 1, 1000, 11);
+INSERT INTO person (person_id, person_email, person_password, person_allentities) VALUES
+	(20, 'p20@test', '', 0), (21, 'p21@test', '', 0), (22, 'p22@test', '', 0), (23, 'p23@test', '', 1),
+	(24, 'p24@test', '', 0), (25, 'p25@test', '', 0), (26, 'p26@test', '', 0), (27, 'p27@test', '', 0);
+INSERT INTO personentities (personentities_person_id, personentities_entity_id) VALUES
+	(20, 2), (21, 2), (22, 2), (24, 2), (25, 2), (26, 2), (27, 3);
+INSERT INTO permission (person, permission_perm_name, permission_item_name, permission_entity_id) VALUES
+	(20, 'r', 'products', -1), (20, 'w', 'products', -1),
+	(21, 'r', 'storages', 2), (21, 'r', 'entities', -1),
+	(22, 'w', 'storages', -1),
+	(23, 'r', 'storages', -1),
+	(25, 'b', 'storages', 2),
+	(26, 'r', 'people', -1),
+	(27, 'r', 'storages', 3), (27, 'r', 'entities', -1);
+INSERT INTO role (role_id, role_name) VALUES (1000, 'policy test');
+INSERT INTO rolepermission (role, rolepermission_perm_name, rolepermission_item_name) VALUES (1000, 'w', 'storages'), (1000, 'w', 'products');
+INSERT INTO personrole (person, role, personrole_entity_id) VALUES (24, 1000, 2);`
+
+func TestEnforce(t *testing.T) {
+	db, err := datastores.NewSQLiteDBstore(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err = db.CreateDatabase(); err != nil {
+		t.Fatal(err)
+	}
+
+	db.MustExec(policyFixtures)
+
+	InvalidateMatcherCache()
+
+	enforcer := InitCasbinPolicy(db)
+
+	tests := []struct {
+		person string
+		action string
+		item   string
+		id     string
+		want   bool
+	}{
+		// admin
+		{"1", "w", "storages", "101", true},
+		{"1", "all", "entities", "3", true},
+		// products permissions do not grant storages
+		{"20", "r", "products", "", true},
+		{"20", "w", "products", "-2", true},
+		{"20", "w", "products", "1000", true},
+		{"20", "r", "storages", "100", false},
+		{"20", "w", "storages", "100", false},
+		{"20", "r", "storages", "", false},
+		{"20", "r", "storelocations", "10", false},
+		// storages of an entity
+		{"21", "r", "storages", "", true},
+		{"21", "r", "storages", "-2", true},
+		{"21", "r", "storages", "100", true},
+		{"21", "r", "storages", "101", false},
+		{"21", "b", "storages", "100", false},
+		{"21", "w", "storages", "100", false},
+		{"21", "w", "storages", "", false},
+		{"21", "r", "storelocations", "10", true},
+		{"21", "r", "storelocations", "11", false},
+		{"21", "w", "storelocations", "10", false},
+		{"21", "r", "entities", "2", true},
+		{"21", "r", "entities", "3", false},
+		{"21", "w", "products", "", false},
+		// -1 is all the person entities only
+		{"22", "w", "storages", "", true},
+		{"22", "w", "storages", "100", true},
+		{"22", "r", "storages", "100", true},
+		{"22", "w", "storages", "101", false},
+		{"22", "r", "storelocations", "10", true},
+		{"22", "r", "storelocations", "11", false},
+		// member of all the entities
+		{"23", "r", "storages", "100", true},
+		{"23", "r", "storages", "101", true},
+		{"23", "w", "storages", "101", false},
+		{"23", "r", "entities", "3", true},
+		{"23", "w", "entities", "3", false},
+		// roles, the products permissions are for all the entities
+		{"24", "w", "storages", "100", true},
+		{"24", "w", "storages", "101", false},
+		{"24", "w", "products", "-2", true},
+		{"24", "r", "storelocations", "10", true},
+		// borrow level
+		{"25", "r", "storages", "100", true},
+		{"25", "b", "storages", "100", true},
+		{"25", "b", "storages", "", true},
+		{"25", "w", "storages", "100", false},
+		{"25", "b", "storages", "101", false},
+		// people of the person entities
+		{"26", "r", "people", "", true},
+		{"26", "r", "people", "21", true},
+		{"26", "r", "people", "27", false},
+		{"26", "w", "people", "21", false},
+		{"26", "r", "storages", "100", false},
+		// other entity
+		{"27", "r", "storages", "101", true},
+		{"27", "r", "storages", "100", false},
+		// items without permission
+		{"21", "r", "savedsearches", "", true},
+		{"21", "r", "unknown", "", false},
+	}
+
+	for _, tt := range tests {
+		got, err := enforcer.Enforce(tt.person, tt.action, tt.item, tt.id)
+		if err != nil {
+			t.Errorf("Enforce(%s, %s, %s, %q) error: %s", tt.person, tt.action, tt.item, tt.id, err)
+			continue
+		}
+
+		if got != tt.want {
+			t.Errorf("Enforce(%s, %s, %s, %q) = %t, want %t", tt.person, tt.action, tt.item, tt.id, got, tt.want)
+		}
+	}
+}
+
+func TestReloadPersonPolicies(t *testing.T) {
+	db, err := datastores.NewSQLiteDBstore(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err = db.CreateDatabase(); err != nil {
+		t.Fatal(err)
+	}
+
+	db.MustExec(policyFixtures)
+
+	InvalidateMatcherCache()
+
+	enforcer := InitCasbinPolicy(db)
+
+	enforce := func(want bool) {
+		t.Helper()
+
+		if got, err := enforcer.Enforce("21", "w", "storages", "100"); err != nil || got != want {
+			t.Errorf("Enforce(21, w, storages, 100) = %t, %v, want %t", got, err, want)
+		}
+	}
+
+	enforce(false)
+
+	// a new permission
+	db.MustExec(`UPDATE permission SET permission_perm_name = 'w' WHERE person = 21`)
+	enforce(false)
+
+	if err = ReloadPersonPolicies(enforcer, db, 21); err != nil {
+		t.Fatal(err)
+	}
+
+	enforce(true)
+
+	// the storage moved to an entity the person is not a member of
+	db.MustExec(`UPDATE storage SET storelocation = 11 WHERE storage_id = 100`)
+	InvalidateMatcherCache()
+	enforce(false)
+
+	// a removed permission
+	db.MustExec(`UPDATE storage SET storelocation = 10 WHERE storage_id = 100`)
+	db.MustExec(`DELETE FROM permission WHERE person = 21`)
+
+	if err = ReloadPersonPolicies(enforcer, db, 21); err != nil {
+		t.Fatal(err)
+	}
+
+	enforce(false)
+
+	// the other people policies are kept
+	if got, _ := enforcer.Enforce("22", "w", "storages", "100"); !got {
+		t.Errorf("Enforce(22, w, storages, 100) = false after reloading the person 21 policies")
+	}
+}
+
+func TestMatcherCacheInvalidation(t *testing.T) {
+	db, err := datastores.NewSQLiteDBstore(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err = db.CreateDatabase(); err != nil {
+		t.Fatal(err)
+	}
+
+	db.MustExec(policyFixtures)
+
+	InvalidateMatcherCache()
+
+	enforcer := InitCasbinPolicy(db)
+
+	enforce := func(want bool) {
+		t.Helper()
+
+		for _, item := range [][2]string{{"storelocations", "11"}, {"storages", "101"}} {
+			if got, err := enforcer.Enforce("21", "r", item[0], item[1]); err != nil || got != want {
+				t.Errorf("Enforce(21, r, %s, %s) = %t, %v, want %t", item[0], item[1], got, err, want)
+			}
+		}
+	}
+
+	enforce(false)
+
+	// the store location of the entity B is moved to the entity A,
+	// the datastore invalidates the cached results at commit
+	if err = db.UpdateStoreLocation(models.StoreLocation{
+		StoreLocationID:   sql.NullInt64{Int64: 11, Valid: true},
+		StoreLocationName: sql.NullString{String: "lb", Valid: true},
+		Entity:            models.Entity{EntityID: 2},
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	enforce(true)
+}
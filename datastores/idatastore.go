@@ -1,12 +1,15 @@
 package datastores
 
 import (
+	"database/sql"
 	"net/http"
+	"time"
 
 	"github.com/jmoiron/sqlx"
 	"github.com/steambap/captcha"
 	"github.com/tbellembois/gochimitheque/models"
 	"github.com/tbellembois/gochimitheque/request"
+	"github.com/tbellembois/gochimitheque/units"
 )
 
 // Datastore is an interface to be implemented
@@ -18,7 +21,15 @@ type Datastore interface {
 
 	CreateDatabase() error
 	Import(url string) error
-	ToCasbinJSONAdapter() ([]byte, error)
+
+	// multi-tenant mode
+	SetMultiTenant(multiTenant bool)
+	IsMultiTenant() bool
+	GetProductTenant(id int) (sql.NullInt64, error)
+	GetPersonDefaultTenant(personID int) (sql.NullInt64, error)
+	ShareProduct(id int) error
+	ShareSupplier(id int) error
+	ShareProducer(id int) error
 
 	GetWelcomeAnnounce() (models.WelcomeAnnounce, error)
 	UpdateWelcomeAnnounce(w models.WelcomeAnnounce) error
@@ -31,6 +42,59 @@ type Datastore interface {
 	CreateProductBookmark(pr models.Product, pe models.Person) error
 	DeleteProductBookmark(pr models.Product, pe models.Person) error
 	IsProductBookmark(pr models.Product, pe models.Person) (bool, error)
+	GetProductDuplicates(productID int) ([]models.ProductDuplicate, error)
+	GetProductMerges() ([]models.ProductMerge, error)
+	MergeProducts(id int, mergedIDs []int, personID int) error
+
+	// saved searches
+	GetSavedSearches(personID int) ([]models.SavedSearch, error)
+	GetSubscribedSavedSearches() ([]models.SavedSearch, error)
+	GetSavedSearch(id int) (models.SavedSearch, error)
+	CreateSavedSearch(s models.SavedSearch) (int64, error)
+	UpdateSavedSearch(s models.SavedSearch) error
+	UpdateSavedSearchLastIDs(id int, lastProductID, lastStorageID int64) error
+	DeleteSavedSearch(id int) error
+	GetLastProductAndStorageIDs() (int64, int64, error)
+
+	// sessions
+	GetPersonSessions(personID int) ([]models.Session, error)
+	GetSession(uid string) (models.Session, error)
+	CreateSession(s models.Session) (int64, error)
+	RefreshSession(uid string, refreshHash string, lastSeen time.Time, expiration time.Time) error
+	DeleteSession(id int) error
+	DeletePersonSessions(personID int) error
+	DeleteExpiredSessions() error
+
+	// device tokens
+	GetPersonDeviceTokens(personID int) ([]models.DeviceToken, error)
+	GetDeviceToken(uid string) (models.DeviceToken, error)
+	CreateDeviceToken(t models.DeviceToken) (int64, error)
+	UseDeviceToken(uid string, lastUsed time.Time) error
+	DeleteDeviceToken(id int) error
+	DeletePersonDeviceTokens(personID int) error
+	DeleteExpiredDeviceTokens() error
+
+	// failed authentications and audit log
+	GetLoginFailure(kind string, value string) (models.LoginFailure, error)
+	GetLockedLoginFailures(t time.Time) ([]models.LoginFailure, error)
+	SaveLoginFailure(f models.LoginFailure) error
+	DeleteLoginFailure(kind string, value string) error
+	GetAuditLogs(f request.Filter) ([]models.AuditLog, int, error)
+	CreateAuditLog(a models.AuditLog) error
+
+	// second factor
+	GetPersonTOTP(personID int) (models.PersonTOTP, error)
+	SavePersonTOTP(t models.PersonTOTP) error
+	DeletePersonTOTP(personID int) error
+	SetPersonTOTPRecoveryCodes(personID int, hashes []string) error
+	UsePersonTOTPRecoveryCode(personID int, hash string) (bool, error)
+	CountPersonTOTPRecoveryCodes(personID int) (int, error)
+	IsPersonTOTPRequiredByRole(personID int) (bool, error)
+
+	// password reset links
+	GetPasswordReset(hash string) (models.PasswordReset, error)
+	CreatePasswordReset(pr models.PasswordReset) error
+	DeletePersonPasswordResets(personID int) error
 
 	// GetCasNumbers(request.Filter) ([]models.CasNumber, int, error)
 	// GetCasNumber(id int) (models.CasNumber, error)
@@ -103,12 +167,29 @@ type Datastore interface {
 	GetStorage(id int) (models.Storage, error)
 	GetStoragesUnits(request.Filter) ([]models.Unit, int, error)
 	GetStorageEntity(id int) (models.Entity, error)
-	DeleteStorage(id int) error
-	ArchiveStorage(id int) error
-	RestoreStorage(id int) error
+	DeleteStorage(id int, personID int) error
+	ArchiveStorage(id int, personID int) error
+	RestoreStorage(id int, personID int) error
 	CreateUpdateStorage(s models.Storage, itemNumber int, update bool) (int64, error)
 	ToogleStorageBorrowing(s models.Storage) error
 	UpdateAllQRCodes() error
+	SplitStorage(id int, aliquots []models.Aliquot, personID int) ([]int64, error)
+	GetStorageLineage(id int) (models.StorageLineage, error)
+	CreatePreparation(p models.Preparation, s models.Storage) (int64, error)
+	GetPreparation(storageID int) (models.Preparation, error)
+
+	// controlled substances register
+	GetControlledRegister(entityID int, from, to time.Time) ([]models.ControlledRegisterEntry, error)
+	GetControlledRegisterBalances(entityID int, date time.Time) ([]models.ControlledRegisterBalance, error)
+	VerifyControlledRegister(entityID int) (models.ControlledRegisterCheck, error)
+
+	// recalls
+	GetRecalls() ([]models.Recall, error)
+	GetManagerRecalls(personID int) ([]models.Recall, error)
+	GetRecall(id int) (models.Recall, error)
+	CreateRecall(r models.Recall) (int64, error)
+	AcknowledgeRecall(id int, personID int, date time.Time) error
+	DeleteRecall(id int) error
 
 	// store locations
 	GetStoreLocations(request.Filter) ([]models.StoreLocation, int, error)
@@ -119,6 +200,10 @@ type Datastore interface {
 	UpdateStoreLocation(s models.StoreLocation) error
 	HasStorelocationStorage(id int) (bool, error)
 
+	// units conversions
+	GetConversionUnits() (map[int64]units.Unit, error)
+	ConvertQuantity(q float64, from int, to int, p models.Product) (float64, error)
+
 	// entities
 	ComputeStockEntity(p models.Product, r *http.Request) []models.StoreLocation
 
@@ -130,19 +215,21 @@ type Datastore interface {
 	UpdateEntity(e models.Entity) error
 	HasEntityMember(id int) (bool, error)
 	HasEntityStorelocation(id int) (bool, error)
+	HasEntityTenantCards(id int) (bool, error)
 
 	// people
 	GetPeople(request.Filter) ([]models.Person, int, error)
 	GetPerson(id int) (models.Person, error)
 	GetPersonByEmail(email string) (models.Person, error)
 	GetPersonPermissions(id int) ([]models.Permission, error)
+	GetEffectivePermissions(personIDs ...int) ([]models.Permission, error)
+	GetPersonRoles(id int) ([]models.PersonRole, error)
 	GetPersonEntities(loggedpersonID int, id int) ([]models.Entity, error)
 	GetPersonManageEntities(id int) ([]models.Entity, error)
 	DoesPersonBelongsTo(id int, entities []models.Entity) (bool, error)
 	CreatePerson(p models.Person) (int64, error)
 	UpdatePerson(p models.Person) error
 	UpdatePersonPassword(p models.Person) error
-	UpdatePersonAESKey(p models.Person) error
 	DeletePerson(id int) error
 	GetAdmins() ([]models.Person, error)
 	IsPersonAdmin(id int) (bool, error)
@@ -151,6 +238,14 @@ type Datastore interface {
 	IsPersonManager(id int) (bool, error)
 	HasPersonReadRestrictedProductPermission(id int) (bool, error)
 
+	// roles
+	GetRoles() ([]models.Role, error)
+	GetRole(id int) (models.Role, error)
+	CreateRole(r models.Role) (int64, error)
+	UpdateRole(r models.Role) error
+	DeleteRole(id int) error
+	GetRolePeople(id int) ([]int, error)
+
 	// captcha
 	InsertCaptcha(string, *captcha.Data) error
 	ValidateCaptcha(token string, text string) (bool, error)
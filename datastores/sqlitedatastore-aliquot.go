@@ -0,0 +1,248 @@
+package datastores
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	qrcode "github.com/skip2/go-qrcode"
+	"github.com/tbellembois/gochimitheque/logger"
+	"github.com/tbellembois/gochimitheque/models"
+)
+
+// ErrInsufficientQuantity is returned when the aliquots exceed the source storage quantity.
+var ErrInsufficientQuantity = errors.New("the aliquots exceed the storage quantity")
+
+// SplitStorage splits the storage with the given id into the aliquots,
+// decrementing its quantity. The aliquots inherit the storage product, batch number,
+// dates, supplier and recall, their barecode is the storage one with a "-<n>" suffix.
+// It returns the ids of the created storages.
+func (db *SQLiteDataStore) SplitStorage(id int, aliquots []models.Aliquot, personID int) (ids []int64, err error) {
+	var (
+		tx        *sql.Tx
+		res       sql.Result
+		sqlr      string
+		productID int
+		quantity  sql.NullFloat64
+		barecode  sql.NullString
+		total     float64
+	)
+
+	logger.Log.WithFields(logrus.Fields{"id": id, "aliquots": aliquots}).Debug("SplitStorage")
+
+	if tx, err = db.Begin(); err != nil {
+		return nil, err
+	}
+
+	defer func() {
+		if err != nil {
+			logger.Log.Error(err)
+			if rbErr := tx.Rollback(); rbErr != nil {
+				logger.Log.Error(rbErr)
+				err = rbErr
+
+				return
+			}
+
+			return
+		}
+
+		err = commitAuthorizationChange(tx)
+	}()
+
+	sqlr = `SELECT product, storage_quantity, storage_barecode FROM storage WHERE storage_id = ? AND storage IS NULL`
+	if err = tx.QueryRow(sqlr, id).Scan(&productID, &quantity, &barecode); err != nil {
+		return
+	}
+
+	for _, a := range aliquots {
+		total += a.StorageQuantity
+	}
+
+	if !quantity.Valid || total > quantity.Float64 {
+		err = ErrInsufficientQuantity
+		return
+	}
+
+	// Numbering the aliquots after the existing ones.
+	prefix := barecode.String
+	if prefix == "" {
+		prefix = strconv.Itoa(id)
+	}
+
+	var (
+		rows *sql.Rows
+		last int
+	)
+
+	if rows, err = tx.Query(`SELECT storage_barecode FROM storage WHERE storage_parent = ? AND storage IS NULL`, id); err != nil {
+		return
+	}
+
+	for rows.Next() {
+		var b sql.NullString
+		if err = rows.Scan(&b); err != nil {
+			rows.Close()
+			return
+		}
+
+		if n, e := strconv.Atoi(strings.TrimPrefix(b.String, prefix+"-")); e == nil && n > last {
+			last = n
+		}
+	}
+
+	rows.Close()
+
+	now := time.Now()
+
+	// Decrementing the source, keeping an history of it.
+	if err = createStorageHistory(tx, int64(id)); err != nil {
+		return
+	}
+
+	sqlr = `UPDATE storage SET storage_quantity = ?, storage_modificationdate = ?, person = ? WHERE storage_id = ?`
+	if _, err = tx.Exec(sqlr, quantity.Float64-total, now, personID, id); err != nil {
+		return
+	}
+
+	if err = registerStorage(tx, int64(id), models.RegisterSplit, personID); err != nil {
+		return
+	}
+
+	for i, a := range aliquots {
+		sqlr = `INSERT INTO storage (storage_creationdate,
+		storage_modificationdate,
+		storage_entrydate,
+		storage_openingdate,
+		storage_expirationdate,
+		storage_reference,
+		storage_batchnumber,
+		storage_quantity,
+		storage_barecode,
+		storage_todestroy,
+		storage_archive,
+		storage_concentration,
+		person,
+		product,
+		storelocation,
+		unit_quantity,
+		unit_concentration,
+		supplier,
+		storage_recall,
+		storage_parent) SELECT ?,
+				?,
+				storage_entrydate,
+				storage_openingdate,
+				storage_expirationdate,
+				storage_reference,
+				storage_batchnumber,
+				?,
+				?,
+				false,
+				false,
+				storage_concentration,
+				?,
+				product,
+				?,
+				unit_quantity,
+				unit_concentration,
+				supplier,
+				storage_recall,
+				storage_id FROM storage WHERE storage_id = ?`
+		if res, err = tx.Exec(sqlr, now, now, a.StorageQuantity, fmt.Sprintf("%s-%d", prefix, last+i+1), personID, a.StoreLocationID, id); err != nil {
+			return
+		}
+
+		var childID int64
+
+		if childID, err = res.LastInsertId(); err != nil {
+			return
+		}
+
+		var png []byte
+
+		if png, err = qrcode.Encode(strconv.FormatInt(childID, 10), qrcode.Medium, 512); err != nil {
+			return
+		}
+
+		if _, err = tx.Exec(`UPDATE storage SET storage_qrcode=? WHERE storage_id=?`, png, childID); err != nil {
+			return
+		}
+
+		if err = registerStorage(tx, childID, models.RegisterSplit, personID); err != nil {
+			return
+		}
+
+		ids = append(ids, childID)
+	}
+
+	// updating the product full text search index
+	if err = updateProductFTS(tx, productID); err != nil {
+		return
+	}
+
+	return ids, nil
+}
+
+// GetStorageLineage returns the lineage tree of the storage with the given id,
+// from the storage it has been split from first to all its aliquots.
+func (db *SQLiteDataStore) GetStorageLineage(id int) (models.StorageLineage, error) {
+	var (
+		err      error
+		storages []*models.StorageLineage
+	)
+
+	logger.Log.WithFields(logrus.Fields{"id": id}).Debug("GetStorageLineage")
+
+	sqlr := `WITH RECURSIVE
+	ancestor(storage_id, storage_parent) AS (
+		SELECT storage_id, storage_parent FROM storage WHERE storage_id = ?
+		UNION
+		SELECT storage.storage_id, storage.storage_parent FROM storage JOIN ancestor ON storage.storage_id = ancestor.storage_parent
+	),
+	lineage(storage_id) AS (
+		SELECT storage_id FROM ancestor WHERE storage_parent IS NULL
+		UNION
+		SELECT storage.storage_id FROM storage JOIN lineage ON storage.storage_parent = lineage.storage_id
+		WHERE storage.storage IS NULL
+	)
+	SELECT s.storage_id,
+	s.storage_parent,
+	s.storage_barecode,
+	s.storage_batchnumber,
+	s.storage_quantity,
+	s.storage_archive,
+	unit.unit_label,
+	storelocation.storelocation_fullpath
+	FROM lineage
+	JOIN storage s ON s.storage_id = lineage.storage_id
+	JOIN storelocation ON s.storelocation = storelocation.storelocation_id
+	LEFT JOIN unit ON s.unit_quantity = unit.unit_id
+	ORDER BY s.storage_id`
+	if err = db.Select(&storages, sqlr, id); err != nil {
+		return models.StorageLineage{}, err
+	}
+
+	if len(storages) == 0 {
+		return models.StorageLineage{}, sql.ErrNoRows
+	}
+
+	// Building the tree, the parents have lower ids than their children.
+	byID := make(map[int64]*models.StorageLineage, len(storages))
+	for _, s := range storages {
+		s.StorageCurrent = s.StorageID == int64(id)
+		byID[s.StorageID] = s
+
+		if s.StorageParentID.Valid {
+			if p, ok := byID[s.StorageParentID.Int64]; ok {
+				p.Children = append(p.Children, s)
+			}
+		}
+	}
+
+	return *storages[0], nil
+}
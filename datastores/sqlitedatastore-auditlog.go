@@ -0,0 +1,70 @@
+package datastores
+
+import (
+	"github.com/doug-martin/goqu/v9"
+	"github.com/sirupsen/logrus"
+	"github.com/tbellembois/gochimitheque/logger"
+	"github.com/tbellembois/gochimitheque/models"
+	"github.com/tbellembois/gochimitheque/request"
+)
+
+// GetAuditLogs returns the audit log events, the latest first,
+// filtered by account email or event with the filter search.
+func (db *SQLiteDataStore) GetAuditLogs(f request.Filter) ([]models.AuditLog, int, error) {
+	var (
+		err         error
+		sqlr, sqlc  string
+		args, argsc []interface{}
+		count       int
+		logs        []models.AuditLog
+	)
+
+	dialect := goqu.Dialect("sqlite3")
+	tableAuditLog := goqu.T("auditlog")
+
+	sQuery := dialect.From(tableAuditLog)
+
+	if f.Search != "" {
+		search := "%" + f.Search + "%"
+		sQuery = sQuery.Where(goqu.Or(
+			goqu.I("auditlog_personemail").Like(search),
+			goqu.I("auditlog_event").Like(search),
+		))
+	}
+
+	if sqlc, argsc, err = sQuery.Select(goqu.COUNT("*")).ToSQL(); err != nil {
+		return nil, 0, err
+	}
+
+	if sqlr, args, err = sQuery.Order(goqu.I("auditlog_date").Desc()).Limit(uint(f.Limit)).Offset(uint(f.Offset)).ToSQL(); err != nil {
+		return nil, 0, err
+	}
+
+	if err = db.Select(&logs, sqlr, args...); err != nil {
+		return nil, 0, err
+	}
+
+	if err = db.Get(&count, sqlc, argsc...); err != nil {
+		return nil, 0, err
+	}
+
+	return logs, count, nil
+}
+
+// CreateAuditLog records the event a.
+func (db *SQLiteDataStore) CreateAuditLog(a models.AuditLog) error {
+	logger.Log.WithFields(logrus.Fields{"a": a}).Debug("CreateAuditLog")
+
+	sqlr := `INSERT INTO auditlog(auditlog_date, auditlog_event, auditlog_personemail, auditlog_ip, auditlog_details, auditlog_author)
+	VALUES (?, ?, ?, ?, ?, ?)`
+
+	_, err := db.Exec(sqlr,
+		a.AuditLogDate.UTC(),
+		a.AuditLogEvent,
+		a.AuditLogPersonEmail,
+		a.AuditLogIP,
+		a.AuditLogDetails,
+		a.AuditLogAuthor)
+
+	return err
+}
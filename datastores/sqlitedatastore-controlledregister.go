@@ -0,0 +1,397 @@
+package datastores
+
+import (
+	"database/sql"
+	"math"
+	"sort"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/tbellembois/gochimitheque/logger"
+	"github.com/tbellembois/gochimitheque/models"
+)
+
+// registerKey identifies a balance of a controlled substances register.
+type registerKey struct {
+	entity  int
+	product int
+	unit    string
+}
+
+// registerStorage appends to the registers of the entities the entries bringing
+// the registered quantities of the storage with the given id to its current
+// quantity, or to zero if it is archived or deleted. Only the storages of the
+// classified products are registered.
+// The event is derived from the change if empty.
+func registerStorage(tx *sql.Tx, storageID int64, event string, personID int) error {
+	var (
+		err         error
+		rows        *sql.Rows
+		target      *registerKey
+		quantity    sql.NullFloat64
+		unit        sql.NullString
+		archive     bool
+		barecode    sql.NullString
+		entityName  string
+		productName string
+		regulation  sql.NullString
+		personEmail string
+	)
+
+	logger.Log.WithFields(logrus.Fields{"storageID": storageID, "event": event}).Debug("registerStorage")
+
+	// the current state of the storage
+	sqlr := `SELECT storage_quantity, unit.unit_label, storage_archive, storage_barecode,
+	storage.product, name.name_label, storelocation.entity, entity.entity_name
+	FROM storage
+	JOIN product ON storage.product = product.product_id
+	JOIN name ON product.name = name.name_id
+	JOIN storelocation ON storage.storelocation = storelocation.storelocation_id
+	JOIN entity ON storelocation.entity = entity.entity_id
+	LEFT JOIN unit ON storage.unit_quantity = unit.unit_id
+	WHERE storage_id = ? AND storage.storage IS NULL`
+
+	k := registerKey{}
+
+	err = tx.QueryRow(sqlr, storageID).Scan(&quantity, &unit, &archive, &barecode, &k.product, &productName, &k.entity, &entityName)
+
+	switch {
+	case err == sql.ErrNoRows:
+		// deleted storage
+	case err != nil:
+		return err
+	case quantity.Valid && quantity.Float64 != 0 && !archive:
+		k.unit = unit.String
+		target = &k
+	}
+
+	// the registered quantities of the storage
+	registered := make(map[registerKey]float64)
+	last := make(map[registerKey]models.ControlledRegisterEntry)
+
+	sqlr = `SELECT controlledregister_entity, controlledregister_entityname, controlledregister_product, controlledregister_productname,
+	controlledregister_unit, controlledregister_barecode, controlledregister_quantity
+	FROM controlledregister
+	WHERE controlledregister_storage = ?
+	ORDER BY controlledregister_id`
+	if rows, err = tx.Query(sqlr, storageID); err != nil {
+		return err
+	}
+
+	for rows.Next() {
+		var e models.ControlledRegisterEntry
+
+		if err = rows.Scan(&e.EntityID, &e.EntityName, &e.ProductID, &e.ProductName, &e.UnitLabel, &e.StorageBarecode, &e.ControlledRegisterQuantity); err != nil {
+			rows.Close()
+			return err
+		}
+
+		rk := registerKey{entity: e.EntityID, product: e.ProductID, unit: e.UnitLabel}
+		registered[rk] += e.ControlledRegisterQuantity
+		last[rk] = e
+	}
+
+	rows.Close()
+
+	if err = rows.Err(); err != nil {
+		return err
+	}
+
+	// the changes, outgoing quantities first
+	var keys []registerKey
+
+	for rk, q := range registered {
+		if target == nil || rk != *target {
+			if math.Abs(q) > 1e-9 {
+				keys = append(keys, rk)
+			}
+		}
+	}
+
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].entity != keys[j].entity {
+			return keys[i].entity < keys[j].entity
+		}
+
+		if keys[i].product != keys[j].product {
+			return keys[i].product < keys[j].product
+		}
+
+		return keys[i].unit < keys[j].unit
+	})
+
+	if target != nil {
+		keys = append(keys, *target)
+	}
+
+	if len(keys) == 0 {
+		return nil
+	}
+
+	if err = tx.QueryRow(`SELECT person_email FROM person WHERE person_id = ?`, personID).Scan(&personEmail); err != nil {
+		return err
+	}
+
+	now := time.Now().UTC()
+
+	for _, rk := range keys {
+		// only the currently classified products are registered
+		regulation = sql.NullString{}
+		if err = tx.QueryRow(`SELECT product_regulation FROM product WHERE product_id = ?`, rk.product).Scan(&regulation); err != nil && err != sql.ErrNoRows {
+			return err
+		}
+
+		if !regulation.Valid || regulation.String == "" {
+			continue
+		}
+
+		e := models.ControlledRegisterEntry{
+			ControlledRegisterDate: now,
+			EntityID:               rk.entity,
+			StorageID:              storageID,
+			ProductID:              rk.product,
+			ProductRegulation:      regulation.String,
+			UnitLabel:              rk.unit,
+			PersonEmail:            personEmail,
+		}
+
+		if target != nil && rk == *target {
+			e.ControlledRegisterQuantity = quantity.Float64 - registered[rk]
+			e.EntityName = entityName
+			e.ProductName = productName
+			e.StorageBarecode = barecode
+		} else {
+			e.ControlledRegisterQuantity = -registered[rk]
+			e.EntityName = last[rk].EntityName
+			e.ProductName = last[rk].ProductName
+			e.StorageBarecode = last[rk].StorageBarecode
+		}
+
+		if math.Abs(e.ControlledRegisterQuantity) <= 1e-9 {
+			continue
+		}
+
+		e.ControlledRegisterEvent = event
+		if e.ControlledRegisterEvent == "" {
+			e.ControlledRegisterEvent = registerEvent(rk, target, registered, e.ControlledRegisterQuantity)
+		}
+
+		if err = appendRegisterEntry(tx, e); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// registerEvent returns the event of a change of quantity q of the key rk
+// of a storage updated to target.
+func registerEvent(rk registerKey, target *registerKey, registered map[registerKey]float64, q float64) string {
+	if len(registered) == 0 {
+		return models.RegisterAcquisition
+	}
+
+	// moved to another entity
+	for k, rq := range registered {
+		if math.Abs(rq) <= 1e-9 || target == nil {
+			continue
+		}
+
+		if (rk == k && rk.entity != target.entity) || (rk == *target && k.entity != target.entity) {
+			return models.RegisterTransfer
+		}
+	}
+
+	if q < 0 && (target == nil || rk == *target) {
+		return models.RegisterUse
+	}
+
+	return models.RegisterAdjustment
+}
+
+// appendRegisterEntry chains the entry e to the register of its entity,
+// computing its balance, sequence and hash.
+func appendRegisterEntry(tx *sql.Tx, e models.ControlledRegisterEntry) error {
+	var (
+		err     error
+		balance sql.NullFloat64
+	)
+
+	sqlr := `SELECT controlledregister_sequence, controlledregister_hash FROM controlledregister
+	WHERE controlledregister_entity = ?
+	ORDER BY controlledregister_sequence DESC LIMIT 1`
+	if err = tx.QueryRow(sqlr, e.EntityID).Scan(&e.ControlledRegisterSequence, &e.ControlledRegisterPreviousHash); err != nil && err != sql.ErrNoRows {
+		return err
+	}
+
+	e.ControlledRegisterSequence++
+
+	sqlr = `SELECT controlledregister_balance FROM controlledregister
+	WHERE controlledregister_entity = ? AND controlledregister_product = ? AND controlledregister_unit = ?
+	ORDER BY controlledregister_sequence DESC LIMIT 1`
+	if err = tx.QueryRow(sqlr, e.EntityID, e.ProductID, e.UnitLabel).Scan(&balance); err != nil && err != sql.ErrNoRows {
+		return err
+	}
+
+	e.ControlledRegisterBalance = balance.Float64 + e.ControlledRegisterQuantity
+	e.ControlledRegisterHash = e.ComputeHash()
+
+	sqlr = `INSERT INTO controlledregister (controlledregister_sequence,
+	controlledregister_date,
+	controlledregister_event,
+	controlledregister_entity,
+	controlledregister_entityname,
+	controlledregister_storage,
+	controlledregister_barecode,
+	controlledregister_product,
+	controlledregister_productname,
+	controlledregister_regulation,
+	controlledregister_quantity,
+	controlledregister_unit,
+	controlledregister_balance,
+	controlledregister_personemail,
+	controlledregister_previoushash,
+	controlledregister_hash) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
+	_, err = tx.Exec(sqlr,
+		e.ControlledRegisterSequence,
+		e.ControlledRegisterDate,
+		e.ControlledRegisterEvent,
+		e.EntityID,
+		e.EntityName,
+		e.StorageID,
+		e.StorageBarecode,
+		e.ProductID,
+		e.ProductName,
+		e.ProductRegulation,
+		e.ControlledRegisterQuantity,
+		e.UnitLabel,
+		e.ControlledRegisterBalance,
+		e.PersonEmail,
+		e.ControlledRegisterPreviousHash,
+		e.ControlledRegisterHash)
+
+	return err
+}
+
+// registerProductStorages registers the storages of the product with the given id,
+// once it is classified.
+func registerProductStorages(tx *sql.Tx, productID int, event string, personID int) error {
+	var (
+		err  error
+		ids  []int64
+		rows *sql.Rows
+	)
+
+	if rows, err = tx.Query(`SELECT storage_id FROM storage WHERE product = ? AND storage IS NULL`, productID); err != nil {
+		return err
+	}
+
+	for rows.Next() {
+		var id int64
+		if err = rows.Scan(&id); err != nil {
+			rows.Close()
+			return err
+		}
+
+		ids = append(ids, id)
+	}
+
+	rows.Close()
+
+	if err = rows.Err(); err != nil {
+		return err
+	}
+
+	for _, id := range ids {
+		if err = registerStorage(tx, id, event, personID); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// GetControlledRegister returns the register entries of the entity with the given id
+// recorded from the date from (included) to the date to (excluded).
+func (db *SQLiteDataStore) GetControlledRegister(entityID int, from time.Time, to time.Time) ([]models.ControlledRegisterEntry, error) {
+	var (
+		entries []models.ControlledRegisterEntry
+		err     error
+	)
+
+	logger.Log.WithFields(logrus.Fields{"entityID": entityID, "from": from, "to": to}).Debug("GetControlledRegister")
+
+	sqlr := `SELECT * FROM controlledregister
+	WHERE controlledregister_entity = ? AND controlledregister_date >= ? AND controlledregister_date < ?
+	ORDER BY controlledregister_sequence`
+	if err = db.Select(&entries, sqlr, entityID, from.UTC(), to.UTC()); err != nil {
+		return nil, err
+	}
+
+	return entries, nil
+}
+
+// GetControlledRegisterBalances returns the balances of the register of the entity
+// with the given id before the date, the zero balances excluded.
+func (db *SQLiteDataStore) GetControlledRegisterBalances(entityID int, date time.Time) ([]models.ControlledRegisterBalance, error) {
+	var (
+		balances []models.ControlledRegisterBalance
+		err      error
+	)
+
+	sqlr := `SELECT c.controlledregister_product,
+	c.controlledregister_productname,
+	c.controlledregister_regulation,
+	c.controlledregister_unit,
+	c.controlledregister_balance
+	FROM controlledregister c
+	WHERE c.controlledregister_entity = ? AND c.controlledregister_sequence = (SELECT MAX(l.controlledregister_sequence) FROM controlledregister l
+		WHERE l.controlledregister_entity = c.controlledregister_entity
+		AND l.controlledregister_product = c.controlledregister_product
+		AND l.controlledregister_unit = c.controlledregister_unit
+		AND l.controlledregister_date < ?)
+	AND c.controlledregister_balance <> 0
+	ORDER BY c.controlledregister_productname, c.controlledregister_unit`
+	if err = db.Select(&balances, sqlr, entityID, date.UTC()); err != nil {
+		return nil, err
+	}
+
+	return balances, nil
+}
+
+// VerifyControlledRegister checks the sequence and hash chain of the register
+// of the entity with the given id.
+func (db *SQLiteDataStore) VerifyControlledRegister(entityID int) (models.ControlledRegisterCheck, error) {
+	var (
+		c       models.ControlledRegisterCheck
+		entries []models.ControlledRegisterEntry
+		err     error
+	)
+
+	sqlr := `SELECT * FROM controlledregister
+	WHERE controlledregister_entity = ?
+	ORDER BY controlledregister_sequence`
+	if err = db.Select(&entries, sqlr, entityID); err != nil {
+		return c, err
+	}
+
+	c.Valid = true
+	c.Entries = len(entries)
+
+	previous := ""
+
+	for i, e := range entries {
+		if e.ControlledRegisterSequence != i+1 || e.ControlledRegisterPreviousHash != previous || e.ComputeHash() != e.ControlledRegisterHash {
+			c.Valid = false
+			c.BrokenSequence = i + 1
+
+			break
+		}
+
+		previous = e.ControlledRegisterHash
+	}
+
+	c.LastHash = previous
+
+	return c, nil
+}
@@ -0,0 +1,302 @@
+package datastores
+
+import (
+	"database/sql"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/tbellembois/gochimitheque/models"
+)
+
+// newTestRegister returns a datastore with a register of three entries
+// for the entity 1 and one entry for the entity 2.
+func newTestRegister(t *testing.T) *SQLiteDataStore {
+	t.Helper()
+
+	db, err := NewSQLiteDBstore(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err = db.CreateDatabase(); err != nil {
+		t.Fatal(err)
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	date := time.Date(2026, 1, 2, 3, 4, 5, 6, time.UTC)
+
+	for _, e := range []models.ControlledRegisterEntry{
+		{EntityID: 1, StorageID: 1, ProductID: 1, ControlledRegisterEvent: models.RegisterAcquisition, ControlledRegisterQuantity: 500},
+		{EntityID: 1, StorageID: 1, ProductID: 1, ControlledRegisterEvent: models.RegisterUse, ControlledRegisterQuantity: -120.5},
+		{EntityID: 2, StorageID: 2, ProductID: 1, ControlledRegisterEvent: models.RegisterAcquisition, ControlledRegisterQuantity: 1},
+		{EntityID: 1, StorageID: 3, ProductID: 2, ControlledRegisterEvent: models.RegisterAcquisition, ControlledRegisterQuantity: 2.5},
+	} {
+		e.ControlledRegisterDate = date
+		e.EntityName = "entity"
+		e.StorageBarecode = sql.NullString{String: "S1", Valid: true}
+		e.ProductName = "ethanol"
+		e.ProductRegulation = models.RegulationPrecursor1
+		e.UnitLabel = "mL"
+		e.PersonEmail = "admin@chimitheque.fr"
+
+		if err = appendRegisterEntry(tx, e); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err = tx.Commit(); err != nil {
+		t.Fatal(err)
+	}
+
+	return db
+}
+
+func TestVerifyControlledRegister(t *testing.T) {
+	tests := []struct {
+		name   string
+		tamper string // SQL statements run with the append-only triggers dropped
+		valid  bool
+		broken int
+	}{
+		{"untampered", "", true, 0},
+		{"edited quantity", `UPDATE controlledregister SET controlledregister_quantity = 400 WHERE controlledregister_entity = 1 AND controlledregister_sequence = 1`, false, 1},
+		{"edited person", `UPDATE controlledregister SET controlledregister_personemail = 'nobody@chimitheque.fr' WHERE controlledregister_entity = 1 AND controlledregister_sequence = 2`, false, 2},
+		{"edited hash", `UPDATE controlledregister SET controlledregister_hash = controlledregister_previoushash WHERE controlledregister_entity = 1 AND controlledregister_sequence = 2`, false, 2},
+		{"deleted entry", `DELETE FROM controlledregister WHERE controlledregister_entity = 1 AND controlledregister_sequence = 2`, false, 2},
+		{"other entity edited", `UPDATE controlledregister SET controlledregister_quantity = 2 WHERE controlledregister_entity = 2`, true, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := newTestRegister(t)
+
+			if tt.tamper != "" {
+				db.MustExec(`DROP TRIGGER controlledregister_noupdate; DROP TRIGGER controlledregister_nodelete;`)
+				db.MustExec(tt.tamper)
+			}
+
+			c, err := db.VerifyControlledRegister(1)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if c.Valid != tt.valid || c.BrokenSequence != tt.broken {
+				t.Errorf("VerifyControlledRegister() = %+v, want valid %t and broken sequence %d", c, tt.valid, tt.broken)
+			}
+
+			if tt.tamper == "" && c.Entries != 3 {
+				t.Errorf("VerifyControlledRegister() entries = %d, want 3", c.Entries)
+			}
+		})
+	}
+}
+
+func TestControlledRegisterAppendOnly(t *testing.T) {
+	db := newTestRegister(t)
+
+	for _, sqlr := range []string{
+		`UPDATE controlledregister SET controlledregister_quantity = 400 WHERE controlledregister_sequence = 1`,
+		`DELETE FROM controlledregister WHERE controlledregister_sequence = 1`,
+	} {
+		if _, err := db.Exec(sqlr); err == nil {
+			t.Errorf("%s succeeded on the append-only register", sqlr)
+		}
+	}
+
+	var balance float64
+	if err := db.Get(&balance, `SELECT controlledregister_balance FROM controlledregister WHERE controlledregister_entity = 1 AND controlledregister_sequence = 2`); err != nil {
+		t.Fatal(err)
+	}
+
+	if balance != 379.5 {
+		t.Errorf("balance = %g, want 379.5", balance)
+	}
+}
+
+func TestRegisterStorage(t *testing.T) {
+	db, err := NewSQLiteDBstore(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err = db.CreateDatabase(); err != nil {
+		t.Fatal(err)
+	}
+
+	db.MustExec(`INSERT INTO entity (entity_id, entity_name, entity_description) VALUES (10, 'REGISTER A', ''), (11, 'REGISTER B', '');
+INSERT INTO storelocation (storelocation_id, storelocation_name, storelocation_canstore, entity) VALUES (10, 'A', 1, 10), (11, 'B', 1, 11);
+INSERT INTO name (name_id, name_label) VALUES (1000, 'REGISTER TEST');
+INSERT INTO product (product_id, name, product_regulation, person) VALUES (1000, 1000, 'precursor1', 1), (1001, 1000, 'precursor1', 1), (1002, 1000, NULL, 1);`)
+
+	var unitID int64
+	if err = db.Get(&unitID, `SELECT unit_id FROM unit WHERE unit_label = 'mL'`); err != nil {
+		t.Fatal(err)
+	}
+
+	storage := func(productID int, storeLocationID int64, entityID int, quantity float64) models.Storage {
+		s := models.Storage{
+			StorageQuantity:         sql.NullFloat64{Float64: quantity, Valid: true},
+			StorageCreationDate:     time.Now(),
+			StorageModificationDate: time.Now(),
+			UnitQuantity:            models.Unit{UnitID: sql.NullInt64{Int64: unitID, Valid: true}},
+		}
+		s.PersonID = 1
+		s.ProductID = productID
+		s.StoreLocationID = sql.NullInt64{Int64: storeLocationID, Valid: true}
+		s.EntityID = entityID
+
+		return s
+	}
+
+	type entry struct {
+		entity   int
+		product  int
+		event    string
+		quantity float64
+	}
+
+	// check checks the register entries appended since the last call.
+	var seen int
+
+	check := func(step string, want ...entry) {
+		t.Helper()
+
+		var got []entry
+
+		rows, err := db.Query(`SELECT controlledregister_entity, controlledregister_product, controlledregister_event, controlledregister_quantity
+		FROM controlledregister ORDER BY controlledregister_id LIMIT -1 OFFSET ?`, seen)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			var e entry
+			if err = rows.Scan(&e.entity, &e.product, &e.event, &e.quantity); err != nil {
+				t.Fatal(err)
+			}
+
+			got = append(got, e)
+		}
+
+		seen += len(got)
+
+		if len(got) != len(want) {
+			t.Fatalf("%s: entries = %+v, want %+v", step, got, want)
+		}
+
+		for i := range want {
+			if got[i] != want[i] {
+				t.Errorf("%s: entry %d = %+v, want %+v", step, i, got[i], want[i])
+			}
+		}
+	}
+
+	// acquisition
+	s := storage(1000, 10, 10, 500)
+
+	id, err := db.CreateUpdateStorage(s, 1, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	check("create", entry{10, 1000, models.RegisterAcquisition, 500})
+
+	// the storages of the unclassified products are not registered
+	if _, err = db.CreateUpdateStorage(storage(1002, 10, 10, 500), 1, false); err != nil {
+		t.Fatal(err)
+	}
+
+	check("unclassified")
+
+	// the event of an update is derived from the change
+	s.StorageID = sql.NullInt64{Int64: id, Valid: true}
+
+	for _, u := range []struct {
+		step            string
+		quantity        float64
+		storeLocationID int64
+		want            []entry
+	}{
+		{"unchanged", 500, 10, nil},
+		{"use", 400, 10, []entry{{10, 1000, models.RegisterUse, -100}}},
+		{"adjustment", 450, 10, []entry{{10, 1000, models.RegisterAdjustment, 50}}},
+		{"transfer", 450, 11, []entry{{10, 1000, models.RegisterTransfer, -450}, {11, 1000, models.RegisterTransfer, 450}}},
+	} {
+		s.StorageQuantity.Float64 = u.quantity
+		s.StoreLocationID.Int64 = u.storeLocationID
+
+		if _, err = db.CreateUpdateStorage(s, 1, true); err != nil {
+			t.Fatal(err)
+		}
+
+		check(u.step, u.want...)
+	}
+
+	// split
+	ids, err := db.SplitStorage(int(id), []models.Aliquot{{StorageQuantity: 100, StoreLocationID: 11}}, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	check("split", entry{11, 1000, models.RegisterSplit, -100}, entry{11, 1000, models.RegisterSplit, 100})
+
+	// deletion
+	if err = db.DeleteStorage(int(ids[0]), 1); err != nil {
+		t.Fatal(err)
+	}
+
+	check("delete", entry{11, 1000, models.RegisterDestruction, -100})
+
+	// merge
+	if _, err = db.CreateUpdateStorage(storage(1001, 10, 10, 20), 1, false); err != nil {
+		t.Fatal(err)
+	}
+
+	check("create merged", entry{10, 1001, models.RegisterAcquisition, 20})
+
+	if err = db.MergeProducts(1000, []int{1001}, 1); err != nil {
+		t.Fatal(err)
+	}
+
+	check("merge", entry{10, 1001, models.RegisterMerge, -20}, entry{10, 1000, models.RegisterMerge, 20})
+
+	// the balances and the chains
+	for _, b := range []struct {
+		entity int
+		want   map[int]float64
+	}{
+		{10, map[int]float64{1000: 20, 1001: 0}},
+		{11, map[int]float64{1000: 350}},
+	} {
+		balances, err := db.GetControlledRegisterBalances(b.entity, time.Now().Add(time.Minute))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		got := make(map[int]float64)
+		for _, cb := range balances {
+			got[cb.ProductID] = cb.Balance
+		}
+
+		for p, q := range b.want {
+			if got[p] != q {
+				t.Errorf("entity %d product %d balance = %g, want %g", b.entity, p, got[p], q)
+			}
+		}
+
+		c, err := db.VerifyControlledRegister(b.entity)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !c.Valid {
+			t.Errorf("VerifyControlledRegister(%d) = %+v, want valid", b.entity, c)
+		}
+	}
+}
@@ -0,0 +1,125 @@
+package datastores
+
+import (
+	"time"
+
+	"github.com/doug-martin/goqu/v9"
+	"github.com/sirupsen/logrus"
+	"github.com/tbellembois/gochimitheque/logger"
+	"github.com/tbellembois/gochimitheque/models"
+)
+
+func deviceTokensQuery() *goqu.SelectDataset {
+	dialect := goqu.Dialect("sqlite3")
+	tableDeviceToken := goqu.T("devicetoken")
+
+	return dialect.From(tableDeviceToken.As("d")).Join(
+		goqu.T("person"),
+		goqu.On(goqu.Ex{
+			"d.person": goqu.I("person.person_id"),
+		}),
+	).Select(
+		goqu.I("d.devicetoken_id"),
+		goqu.I("d.devicetoken_uid"),
+		goqu.I("d.devicetoken_hash"),
+		goqu.I("d.devicetoken_name"),
+		goqu.I("d.devicetoken_creationdate"),
+		goqu.I("d.devicetoken_expirationdate"),
+		goqu.I("d.devicetoken_lastuseddate"),
+		goqu.I("person.person_id").As(goqu.C("person.person_id")),
+		goqu.I("person.person_email").As(goqu.C("person.person_email")),
+	).Order(goqu.I("d.devicetoken_creationdate").Desc())
+}
+
+// GetPersonDeviceTokens returns the device tokens of the person with the given id.
+func (db *SQLiteDataStore) GetPersonDeviceTokens(personID int) ([]models.DeviceToken, error) {
+	var (
+		err    error
+		sqlr   string
+		args   []interface{}
+		tokens []models.DeviceToken
+	)
+
+	logger.Log.WithFields(logrus.Fields{"personID": personID}).Debug("GetPersonDeviceTokens")
+
+	if sqlr, args, err = deviceTokensQuery().Where(goqu.I("d.person").Eq(personID)).ToSQL(); err != nil {
+		return nil, err
+	}
+
+	if err = db.Select(&tokens, sqlr, args...); err != nil {
+		return nil, err
+	}
+
+	return tokens, nil
+}
+
+// GetDeviceToken returns the device token with the given uid.
+func (db *SQLiteDataStore) GetDeviceToken(uid string) (models.DeviceToken, error) {
+	var (
+		err   error
+		sqlr  string
+		args  []interface{}
+		token models.DeviceToken
+	)
+
+	if sqlr, args, err = deviceTokensQuery().Where(goqu.I("d.devicetoken_uid").Eq(uid)).ToSQL(); err != nil {
+		return models.DeviceToken{}, err
+	}
+
+	if err = db.Get(&token, sqlr, args...); err != nil {
+		return models.DeviceToken{}, err
+	}
+
+	return token, nil
+}
+
+// CreateDeviceToken creates the device token t.
+func (db *SQLiteDataStore) CreateDeviceToken(t models.DeviceToken) (int64, error) {
+	sqlr := `INSERT INTO devicetoken(devicetoken_uid, devicetoken_hash, devicetoken_name, devicetoken_creationdate, devicetoken_expirationdate, person)
+	VALUES (?, ?, ?, ?, ?, ?)`
+
+	res, err := db.Exec(sqlr,
+		t.DeviceTokenUID,
+		t.DeviceTokenHash,
+		t.DeviceTokenName,
+		t.DeviceTokenCreationDate.UTC(),
+		t.DeviceTokenExpirationDate.UTC(),
+		t.PersonID)
+	if err != nil {
+		return 0, err
+	}
+
+	return res.LastInsertId()
+}
+
+// UseDeviceToken sets the last used date of the device token with the given uid.
+func (db *SQLiteDataStore) UseDeviceToken(uid string, lastUsed time.Time) error {
+	sqlr := `UPDATE devicetoken SET devicetoken_lastuseddate = ? WHERE devicetoken_uid = ?`
+	_, err := db.Exec(sqlr, lastUsed.UTC(), uid)
+
+	return err
+}
+
+// DeleteDeviceToken deletes the device token with the given id.
+func (db *SQLiteDataStore) DeleteDeviceToken(id int) error {
+	sqlr := `DELETE FROM devicetoken WHERE devicetoken_id = ?`
+	_, err := db.Exec(sqlr, id)
+
+	return err
+}
+
+// DeletePersonDeviceTokens deletes the device tokens of the person with the given id.
+func (db *SQLiteDataStore) DeletePersonDeviceTokens(personID int) error {
+	sqlr := `DELETE FROM devicetoken WHERE person = ?`
+	_, err := db.Exec(sqlr, personID)
+
+	return err
+}
+
+// DeleteExpiredDeviceTokens deletes the device tokens that can not be used anymore.
+func (db *SQLiteDataStore) DeleteExpiredDeviceTokens() error {
+	sqlr := `DELETE FROM devicetoken WHERE devicetoken_expirationdate < ?`
+	_, err := db.Exec(sqlr, time.Now().UTC())
+
+	return err
+}
@@ -47,7 +47,7 @@ func (db *SQLiteDataStore) GetEntities(f request.Filter) ([]models.Entity, int,
 		entityTable.As("e"),
 		personTable.As("p"),
 	).Join(
-		goqu.T("permission").As("perm"),
+		goqu.T("effectivepermission").As("perm"),
 		goqu.On(
 			goqu.Ex{
 				"perm.person":               f.LoggedPersonID,
@@ -317,6 +317,20 @@ func (db *SQLiteDataStore) DeleteEntity(id int) error {
 		return err
 	}
 
+	// Recalls acknowledgements.
+	sQuery = dialect.From(goqu.T("recallacknowledgement")).Where(
+		goqu.I("entity").Eq(id),
+	).Delete()
+
+	if sqlr, args, err = sQuery.ToSQL(); err != nil {
+		logger.Log.Error(err)
+		return err
+	}
+
+	if _, err = db.Exec(sqlr, args...); err != nil {
+		return err
+	}
+
 	// LDAP groups.
 	sQuery = dialect.From(tableEntityLDAPGroups).Where(
 		goqu.I("entityldapgroups_entity_id").Eq(id),
@@ -331,6 +345,20 @@ func (db *SQLiteDataStore) DeleteEntity(id int) error {
 		return err
 	}
 
+	// Roles.
+	sQuery = dialect.From(goqu.T("personrole")).Where(
+		goqu.I("personrole_entity_id").Eq(id),
+	).Delete()
+
+	if sqlr, args, err = sQuery.ToSQL(); err != nil {
+		logger.Log.Error(err)
+		return err
+	}
+
+	if _, err = db.Exec(sqlr, args...); err != nil {
+		return err
+	}
+
 	// Entity.
 	sQuery = dialect.From(tableEntity).Where(
 		goqu.I("entity_id").Eq(id),
@@ -345,6 +373,8 @@ func (db *SQLiteDataStore) DeleteEntity(id int) error {
 		return err
 	}
 
+	authorizationChanged()
+
 	return nil
 }
 
@@ -379,7 +409,7 @@ func (db *SQLiteDataStore) CreateEntity(e models.Entity) (lastInsertID int64, er
 			return
 		}
 
-		err = tx.Commit()
+		err = commitAuthorizationChange(tx)
 	}()
 
 	iQuery := dialect.Insert(tableEntity).Rows(
@@ -549,7 +579,7 @@ func (db *SQLiteDataStore) UpdateEntity(e models.Entity) (err error) {
 			return
 		}
 
-		err = tx.Commit()
+		err = commitAuthorizationChange(tx)
 	}()
 
 	var (
@@ -0,0 +1,237 @@
+package datastores
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"unicode"
+
+	"github.com/tbellembois/gochimitheque/logger"
+)
+
+// fts5 is true if the linked SQLite library has the FTS5 extension, enabled with
+// the sqlite_fts5 build tag. It is set by CreateDatabase. Without it the searches
+// fall back to LIKE conditions and the full text search indexes are not maintained.
+var fts5 bool
+
+// ftsSchema creates the full text search indexes.
+const ftsSchema = `CREATE VIRTUAL TABLE IF NOT EXISTS productfts USING fts5(
+	productfts_names,
+	productfts_numbers,
+	productfts_formulas,
+	productfts_tags,
+	productfts_remarks,
+	productfts_storagecomments,
+	tokenize = 'unicode61 remove_diacritics 2',
+	prefix = '2 3');
+INSERT INTO productfts (productfts, rank) VALUES ('rank', 'bm25(10.0, 5.0, 5.0, 2.0, 1.0, 1.0)');
+
+CREATE VIRTUAL TABLE IF NOT EXISTS namefts USING fts5(
+	name_label,
+	content = 'name',
+	content_rowid = 'name_id',
+	tokenize = 'unicode61 remove_diacritics 2',
+	prefix = '2 3');
+
+CREATE TRIGGER IF NOT EXISTS namefts_insert AFTER INSERT ON name BEGIN
+	INSERT INTO namefts (rowid, name_label) VALUES (new.name_id, new.name_label);
+END;
+CREATE TRIGGER IF NOT EXISTS namefts_delete AFTER DELETE ON name BEGIN
+	INSERT INTO namefts (namefts, rowid, name_label) VALUES ('delete', old.name_id, old.name_label);
+END;
+CREATE TRIGGER IF NOT EXISTS namefts_update AFTER UPDATE ON name BEGIN
+	INSERT INTO namefts (namefts, rowid, name_label) VALUES ('delete', old.name_id, old.name_label);
+	INSERT INTO namefts (rowid, name_label) VALUES (new.name_id, new.name_label);
+END;`
+
+// ftsTriggersDrop stops the names full text search index maintenance,
+// the name table can not be written to without FTS5 otherwise.
+const ftsTriggersDrop = `DROP TRIGGER IF EXISTS namefts_insert;
+DROP TRIGGER IF EXISTS namefts_delete;
+DROP TRIGGER IF EXISTS namefts_update;`
+
+// createFTS creates and fills the full text search indexes if SQLite has FTS5,
+// and stops their maintenance otherwise. The indexes not maintained
+// by a previous run without FTS5 are rebuilt.
+func (db *SQLiteDataStore) createFTS() error {
+	var (
+		err      error
+		triggers int
+		c        int
+	)
+
+	if !fts5 {
+		logger.Log.Warn("  sqlite3 compiled without FTS5 (sqlite_fts5 build tag), full text search disabled")
+
+		_, err = db.Exec(ftsTriggersDrop)
+
+		return err
+	}
+
+	if err = db.Get(&triggers, `SELECT count(*) FROM sqlite_master WHERE type = 'trigger' AND name = 'namefts_insert'`); err != nil {
+		return err
+	}
+
+	if _, err = db.Exec(ftsSchema); err != nil {
+		return err
+	}
+
+	if triggers == 0 {
+		logger.Log.Info("  building names full text search index")
+
+		if _, err = db.Exec(`INSERT INTO namefts (namefts) VALUES ('rebuild')`); err != nil {
+			return err
+		}
+	} else if err = db.Get(&c, `SELECT count(*) FROM productfts`); err != nil {
+		return err
+	}
+
+	if triggers == 0 || c == 0 {
+		logger.Log.Info("  building products full text search index")
+
+		return rebuildProductFTS(db)
+	}
+
+	return nil
+}
+
+// execer is implemented by sql.DB, sql.Tx and their sqlx counterparts.
+type execer interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+}
+
+// productFTSSelect selects the indexed columns of the products
+// selected by the appended WHERE clause.
+const productFTSSelect = `SELECT p.product_id,
+	name.name_label || ' ' || IFNULL((SELECT group_concat(n.name_label, ' ') FROM productsynonyms
+		JOIN name AS n ON productsynonyms.productsynonyms_name_id = n.name_id
+		WHERE productsynonyms.productsynonyms_product_id = p.product_id), '') AS productfts_names,
+	IFNULL(casnumber.casnumber_label, '') || ' ' || IFNULL(cenumber.cenumber_label, '') AS productfts_numbers,
+	IFNULL(empiricalformula.empiricalformula_label, '') || ' ' || IFNULL(linearformula.linearformula_label, '') AS productfts_formulas,
+	IFNULL((SELECT group_concat(tag.tag_label, ' ') FROM producttags
+		JOIN tag ON producttags.producttags_tag_id = tag.tag_id
+		WHERE producttags.producttags_product_id = p.product_id), '') AS productfts_tags,
+	IFNULL(p.product_specificity, '') || ' ' || IFNULL(p.product_remark, '') AS productfts_remarks,
+	IFNULL((SELECT group_concat(storage.storage_comment, ' ') FROM storage
+		WHERE storage.product = p.product_id AND storage.storage IS NULL), '') AS productfts_storagecomments
+	FROM product AS p
+	JOIN name ON p.name = name.name_id
+	LEFT JOIN casnumber ON p.casnumber = casnumber.casnumber_id
+	LEFT JOIN cenumber ON p.cenumber = cenumber.cenumber_id
+	LEFT JOIN empiricalformula ON p.empiricalformula = empiricalformula.empiricalformula_id
+	LEFT JOIN linearformula ON p.linearformula = linearformula.linearformula_id`
+
+// productFTSInsert inserts into the full text search index the products
+// selected by the appended WHERE clause.
+const productFTSInsert = `INSERT INTO productfts (rowid,
+	productfts_names,
+	productfts_numbers,
+	productfts_formulas,
+	productfts_tags,
+	productfts_remarks,
+	productfts_storagecomments) ` + productFTSSelect
+
+// productSearchSQL returns a request selecting the ids of the products whose indexed
+// columns contain every word of the search, and its named parameters.
+// It is used instead of the full text search index without FTS5.
+func productSearchSQL(search string) (string, map[string]interface{}) {
+	var conditions []string
+
+	m := make(map[string]interface{})
+
+	for i, p := range likePatterns(search) {
+		name := fmt.Sprintf("searchword%d", i)
+		m[name] = p
+
+		conditions = append(conditions, `productfts_text LIKE :`+name+` ESCAPE '\'`)
+	}
+
+	return `SELECT product_id FROM (SELECT product_id, productfts_names || ' ' || productfts_numbers || ' ' || productfts_formulas || ' ' ||
+	productfts_tags || ' ' || productfts_remarks || ' ' || productfts_storagecomments AS productfts_text
+	FROM (` + productFTSSelect + `)) WHERE ` + strings.Join(conditions, " AND "), m
+}
+
+// updateProductFTS refreshes the full text search index of the product with the given id.
+func updateProductFTS(e execer, id int) error {
+	if !fts5 {
+		return nil
+	}
+
+	if err := deleteProductFTS(e, id); err != nil {
+		return err
+	}
+
+	_, err := e.Exec(productFTSInsert+` WHERE p.product_id = ?`, id)
+
+	return err
+}
+
+// deleteProductFTS removes the product with the given id from the full text search index.
+func deleteProductFTS(e execer, id int) error {
+	if !fts5 {
+		return nil
+	}
+
+	_, err := e.Exec(`DELETE FROM productfts WHERE rowid = ?`, id)
+
+	return err
+}
+
+// rebuildProductFTS rebuilds the whole products full text search index.
+func rebuildProductFTS(e execer) error {
+	if !fts5 {
+		return nil
+	}
+
+	if _, err := e.Exec(`DELETE FROM productfts`); err != nil {
+		return err
+	}
+
+	_, err := e.Exec(productFTSInsert)
+
+	return err
+}
+
+// ftsQuery converts a request.Filter search into a FTS5 query
+// matching every word of the search as a prefix.
+// It returns an empty string if there is nothing to search.
+func ftsQuery(search string) string {
+	var terms []string
+
+	for _, w := range searchWords(search) {
+		terms = append(terms, `"`+strings.ReplaceAll(w, `"`, `""`)+`"*`)
+	}
+
+	return strings.Join(terms, " ")
+}
+
+// likePatterns returns the LIKE patterns, to be used with ESCAPE '\', matching
+// each word of a request.Filter search, for the searches without FTS5.
+func likePatterns(search string) []string {
+	var patterns []string
+
+	for _, w := range searchWords(search) {
+		patterns = append(patterns, queryPattern(w, true))
+	}
+
+	return patterns
+}
+
+// searchWords returns the words of a request.Filter search.
+func searchWords(search string) []string {
+	var words []string
+
+	search = strings.TrimPrefix(search, "%")
+	search = strings.TrimSuffix(search, "%")
+
+	for _, w := range strings.Fields(search) {
+		// words without letters or digits are not indexed
+		if strings.IndexFunc(w, func(r rune) bool { return unicode.IsLetter(r) || unicode.IsDigit(r) }) == -1 {
+			continue
+		}
+
+		words = append(words, w)
+	}
+
+	return words
+}
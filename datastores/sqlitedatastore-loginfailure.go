@@ -0,0 +1,85 @@
+package datastores
+
+import (
+	"time"
+
+	"github.com/doug-martin/goqu/v9"
+	"github.com/sirupsen/logrus"
+	"github.com/tbellembois/gochimitheque/logger"
+	"github.com/tbellembois/gochimitheque/models"
+)
+
+// GetLoginFailure returns the failed authentications of the account (kind "email")
+// or of the client IP (kind "ip") value.
+func (db *SQLiteDataStore) GetLoginFailure(kind string, value string) (models.LoginFailure, error) {
+	var (
+		err  error
+		sqlr string
+		args []interface{}
+		f    models.LoginFailure
+	)
+
+	dialect := goqu.Dialect("sqlite3")
+	tableLoginFailure := goqu.T("loginfailure")
+
+	if sqlr, args, err = dialect.From(tableLoginFailure).Where(
+		goqu.I("loginfailure_kind").Eq(kind),
+		goqu.I("loginfailure_value").Eq(value),
+	).ToSQL(); err != nil {
+		return models.LoginFailure{}, err
+	}
+
+	if err = db.Get(&f, sqlr, args...); err != nil {
+		return models.LoginFailure{}, err
+	}
+
+	return f, nil
+}
+
+// GetLockedLoginFailures returns the accounts and client IPs locked out at the time t.
+func (db *SQLiteDataStore) GetLockedLoginFailures(t time.Time) ([]models.LoginFailure, error) {
+	var fs []models.LoginFailure
+
+	sqlr := `SELECT * FROM loginfailure WHERE loginfailure_lockeduntil > ? ORDER BY loginfailure_lockeduntil DESC`
+
+	if err := db.Select(&fs, sqlr, t.UTC()); err != nil {
+		return nil, err
+	}
+
+	return fs, nil
+}
+
+// SaveLoginFailure creates or updates the failed authentications f.
+func (db *SQLiteDataStore) SaveLoginFailure(f models.LoginFailure) error {
+	logger.Log.WithFields(logrus.Fields{"f": f}).Debug("SaveLoginFailure")
+
+	var lockedUntil interface{}
+	if f.LoginFailureLockedUntil.Valid {
+		lockedUntil = f.LoginFailureLockedUntil.Time.UTC()
+	}
+
+	sqlr := `INSERT INTO loginfailure(loginfailure_kind, loginfailure_value, loginfailure_count, loginfailure_lastdate, loginfailure_lockeduntil)
+	VALUES (?, ?, ?, ?, ?)
+	ON CONFLICT(loginfailure_kind, loginfailure_value) DO UPDATE SET
+	loginfailure_count = excluded.loginfailure_count,
+	loginfailure_lastdate = excluded.loginfailure_lastdate,
+	loginfailure_lockeduntil = excluded.loginfailure_lockeduntil`
+
+	_, err := db.Exec(sqlr,
+		f.LoginFailureKind,
+		f.LoginFailureValue,
+		f.LoginFailureCount,
+		f.LoginFailureLastDate.UTC(),
+		lockedUntil)
+
+	return err
+}
+
+// DeleteLoginFailure resets the failed authentications of the account
+// or client IP value.
+func (db *SQLiteDataStore) DeleteLoginFailure(kind string, value string) error {
+	sqlr := `DELETE FROM loginfailure WHERE loginfailure_kind = ? AND loginfailure_value = ?`
+	_, err := db.Exec(sqlr, kind, value)
+
+	return err
+}
@@ -0,0 +1,41 @@
+package datastores
+
+import (
+	"github.com/sirupsen/logrus"
+	"github.com/tbellembois/gochimitheque/logger"
+	"github.com/tbellembois/gochimitheque/models"
+)
+
+// GetPasswordReset returns the password reset link with the given token hash.
+func (db *SQLiteDataStore) GetPasswordReset(hash string) (models.PasswordReset, error) {
+	var pr models.PasswordReset
+
+	sqlr := `SELECT passwordreset_id, passwordreset_hash, passwordreset_expirationdate, person FROM passwordreset WHERE passwordreset_hash = ?`
+	if err := db.Get(&pr, sqlr, hash); err != nil {
+		return models.PasswordReset{}, err
+	}
+
+	return pr, nil
+}
+
+// CreatePasswordReset creates the password reset link pr
+// and deletes the former links of the person.
+func (db *SQLiteDataStore) CreatePasswordReset(pr models.PasswordReset) error {
+	logger.Log.WithFields(logrus.Fields{"person": pr.PersonID}).Debug("CreatePasswordReset")
+
+	if err := db.DeletePersonPasswordResets(pr.PersonID); err != nil {
+		return err
+	}
+
+	sqlr := `INSERT INTO passwordreset(passwordreset_hash, passwordreset_expirationdate, person) VALUES (?, ?, ?)`
+	_, err := db.Exec(sqlr, pr.PasswordResetHash, pr.PasswordResetExpirationDate.UTC(), pr.PersonID)
+
+	return err
+}
+
+// DeletePersonPasswordResets deletes the password reset links of the person with the given id.
+func (db *SQLiteDataStore) DeletePersonPasswordResets(personID int) error {
+	_, err := db.Exec(`DELETE FROM passwordreset WHERE person = ?`, personID)
+
+	return err
+}
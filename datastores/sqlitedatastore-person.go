@@ -15,7 +15,8 @@ import (
 	"golang.org/x/crypto/bcrypt"
 )
 
-// ValidateCaptcha validate the text entered with the given token.
+// ValidateCaptcha validate the text entered with the given token
+// and deletes the captcha if valid.
 func (db *SQLiteDataStore) ValidateCaptcha(token string, text string) (bool, error) {
 	var (
 		err   error
@@ -43,7 +44,16 @@ func (db *SQLiteDataStore) ValidateCaptcha(token string, text string) (bool, err
 		return false, err
 	}
 
-	return count != 0, nil
+	if count == 0 {
+		return false, nil
+	}
+
+	// a captcha can be used once
+	if _, err = db.Exec(`DELETE FROM captcha WHERE captcha_token = ?`, token); err != nil {
+		return false, err
+	}
+
+	return true, nil
 }
 
 // InsertCaptcha generates and stores a unique captcha with a token
@@ -110,7 +120,7 @@ func (db *SQLiteDataStore) GetPeople(f request.Filter) ([]models.Person, int, er
 	switch {
 	case f.Entity != -1:
 		joinClause = dialect.From(tablePerson.As("p"), tableEntity.As("e")).Join(
-			goqu.T("personentities"),
+			goqu.T("effectivepersonentities").As("personentities"),
 			goqu.On(
 				goqu.Ex{
 					"personentities.personentities_person_id": goqu.I("p.person_id"),
@@ -126,7 +136,7 @@ func (db *SQLiteDataStore) GetPeople(f request.Filter) ([]models.Person, int, er
 		)
 	case !isadmin:
 		joinClause = dialect.From(tablePerson.As("p"), tableEntity.As("e")).Join(
-			goqu.T("personentities"),
+			goqu.T("effectivepersonentities").As("personentities"),
 			goqu.On(
 				goqu.Ex{
 					"personentities.personentities_person_id": goqu.I("p.person_id"),
@@ -140,7 +150,7 @@ func (db *SQLiteDataStore) GetPeople(f request.Filter) ([]models.Person, int, er
 				},
 			),
 		).Join(
-			goqu.T("permission").As("perm"),
+			goqu.T("effectivepermission").As("perm"),
 			goqu.On(
 				goqu.Ex{
 					"perm.person":               f.LoggedPersonID,
@@ -179,6 +189,7 @@ func (db *SQLiteDataStore) GetPeople(f request.Filter) ([]models.Person, int, er
 	if selectSQL, selectArgs, err = joinClause.Select(
 		goqu.I("p.person_id"),
 		goqu.I("p.person_email"),
+		goqu.I("p.person_allentities"),
 	).GroupBy(goqu.I("p.person_id")).Order(orderClause).Limit(uint(f.Limit)).Offset(uint(f.Offset)).ToSQL(); err != nil {
 		return nil, 0, err
 	}
@@ -210,7 +221,7 @@ func (db *SQLiteDataStore) GetPerson(id int) (models.Person, error) {
 		goqu.I("person_id"),
 		goqu.I("person_email"),
 		goqu.I("person_password"),
-		goqu.I("person_aeskey"),
+		goqu.I("person_allentities"),
 	)
 
 	var (
@@ -245,7 +256,7 @@ func (db *SQLiteDataStore) GetPersonByEmail(email string) (models.Person, error)
 		goqu.I("person_id"),
 		goqu.I("person_email"),
 		goqu.I("person_password"),
-		goqu.I("person_aeskey"),
+		goqu.I("person_allentities"),
 	)
 
 	var (
@@ -267,6 +278,42 @@ func (db *SQLiteDataStore) GetPersonByEmail(email string) (models.Person, error)
 	return person, nil
 }
 
+// GetEffectivePermissions returns the permissions and the roles permissions
+// of the people with the given ids, of everybody if no id is given.
+func (db *SQLiteDataStore) GetEffectivePermissions(personIDs ...int) ([]models.Permission, error) {
+	dialect := goqu.Dialect("sqlite3")
+	tableEffectivePermission := goqu.T("effectivepermission")
+
+	sQuery := dialect.From(tableEffectivePermission).Select(
+		goqu.I("person").As(goqu.C("person.person_id")),
+		goqu.I("permission_perm_name"),
+		goqu.I("permission_item_name"),
+		goqu.I("permission_entity_id"),
+	)
+
+	if len(personIDs) > 0 {
+		sQuery = sQuery.Where(goqu.I("person").In(personIDs))
+	}
+
+	var (
+		err         error
+		sqlr        string
+		args        []interface{}
+		permissions []models.Permission
+	)
+
+	if sqlr, args, err = sQuery.ToSQL(); err != nil {
+		logger.Log.Error(err)
+		return nil, err
+	}
+
+	if err = db.Select(&permissions, sqlr, args...); err != nil {
+		return nil, err
+	}
+
+	return permissions, nil
+}
+
 // GetPersonPermissions return person permissions.
 func (db *SQLiteDataStore) GetPersonPermissions(id int) ([]models.Permission, error) {
 	dialect := goqu.Dialect("sqlite3")
@@ -343,7 +390,7 @@ func (db *SQLiteDataStore) GetPersonEntities(loggedPersonID int, personID int) (
 	dialect := goqu.Dialect("sqlite3")
 	tablePerson := goqu.T("person")
 	tableEntity := goqu.T("entity")
-	tablePersonentities := goqu.T("personentities")
+	tablePersonentities := goqu.T("effectivepersonentities")
 
 	// Is the logged user an admin?
 	var isadmin bool
@@ -360,7 +407,7 @@ func (db *SQLiteDataStore) GetPersonEntities(loggedPersonID int, personID int) (
 			tablePerson.As("p"),
 			tablePersonentities.As("pe"),
 		).Join(
-			goqu.T("permission").As("perm"),
+			goqu.T("effectivepermission").As("perm"),
 			goqu.On(
 				goqu.Or(
 					goqu.And(
@@ -455,7 +502,7 @@ func (db *SQLiteDataStore) DoesPersonBelongsTo(id int, entities []models.Entity)
 	)
 
 	dialect := goqu.Dialect("sqlite3")
-	tablePersonentities := goqu.T("personentities")
+	tablePersonentities := goqu.T("effectivepersonentities")
 
 	var entityIds []int
 	for _, i := range entities {
@@ -514,7 +561,7 @@ func (db *SQLiteDataStore) DeletePerson(id int) (err error) {
 			return
 		}
 
-		err = tx.Commit()
+		err = commitAuthorizationChange(tx)
 	}()
 
 	// Getting the admin.
@@ -558,6 +605,25 @@ func (db *SQLiteDataStore) DeletePerson(id int) (err error) {
 		return
 	}
 
+	// Updating preparations and recalls ownership to admin.
+	for _, t := range []string{"preparation", "recall"} {
+		if sqlr, args, err = dialect.Update(goqu.T(t)).Set(
+			goqu.Record{
+				"person": admin.PersonID,
+			},
+		).Where(
+			goqu.I("person").Eq(id),
+		).ToSQL(); err != nil {
+			logger.Log.Errorf("prepare update %s ownership: %s", t, err)
+			return
+		}
+
+		if _, err = tx.Exec(sqlr, args...); err != nil {
+			logger.Log.Errorf("update %s ownership: %s", t, err)
+			return
+		}
+	}
+
 	// Deleting entity membership.
 	if sqlr, args, err = dialect.From(goqu.T("personentities")).Where(
 		goqu.I("personentities_person_id").Eq(id),
@@ -598,6 +664,47 @@ func (db *SQLiteDataStore) DeletePerson(id int) (err error) {
 		return
 	}
 
+	// Remove roles.
+	if sqlr, args, err = dialect.From(goqu.T("personrole")).Where(
+		goqu.I("person").Eq(id),
+	).Delete().ToSQL(); err != nil {
+		logger.Log.Errorf("prepare remove roles: %s", err)
+		return
+	}
+
+	if _, err = tx.Exec(sqlr, args...); err != nil {
+		logger.Log.Errorf("remove roles: %s", err)
+		return
+	}
+
+	// Remove sessions.
+	if sqlr, args, err = dialect.From(goqu.T("session")).Where(
+		goqu.I("person").Eq(id),
+	).Delete().ToSQL(); err != nil {
+		logger.Log.Errorf("prepare remove sessions: %s", err)
+		return
+	}
+
+	if _, err = tx.Exec(sqlr, args...); err != nil {
+		logger.Log.Errorf("remove sessions: %s", err)
+		return
+	}
+
+	// Remove second factor, password reset links, device tokens and recalls acknowledgements.
+	for _, t := range []string{"persontotp", "totprecoverycode", "passwordreset", "devicetoken", "recallacknowledgement"} {
+		if sqlr, args, err = dialect.From(goqu.T(t)).Where(
+			goqu.I("person").Eq(id),
+		).Delete().ToSQL(); err != nil {
+			logger.Log.Errorf("prepare remove %s: %s", t, err)
+			return
+		}
+
+		if _, err = tx.Exec(sqlr, args...); err != nil {
+			logger.Log.Errorf("remove %s: %s", t, err)
+			return
+		}
+	}
+
 	// Remove borrowings.
 	if sqlr, args, err = dialect.From(goqu.T("borrowing")).Where(
 		goqu.I("borrower").Eq(id),
@@ -624,6 +731,19 @@ func (db *SQLiteDataStore) DeletePerson(id int) (err error) {
 		return
 	}
 
+	// Remove saved searches.
+	if sqlr, args, err = dialect.From(goqu.T("savedsearch")).Where(
+		goqu.I("person").Eq(id),
+	).Delete().ToSQL(); err != nil {
+		logger.Log.Errorf("prepare remove saved searches: %s", err)
+		return
+	}
+
+	if _, err = tx.Exec(sqlr, args...); err != nil {
+		logger.Log.Errorf("remove saved searches: %s", err)
+		return
+	}
+
 	// Remove person.
 	if sqlr, args, err = dialect.From(tablePerson).Where(
 		goqu.I("person_id").Eq(id),
@@ -670,14 +790,14 @@ func (db *SQLiteDataStore) CreatePerson(p models.Person) (lastInsertID int64, er
 			return
 		}
 
-		err = tx.Commit()
+		err = commitAuthorizationChange(tx)
 	}()
 
 	iQuery := dialect.Insert(tablePerson).Rows(
 		goqu.Record{
-			"person_email":    strings.ToLower(p.PersonEmail),
-			"person_password": p.PersonPassword,
-			"person_aeskey":   p.PersonAESKey,
+			"person_email":       strings.ToLower(p.PersonEmail),
+			"person_password":    p.PersonPassword,
+			"person_allentities": p.PersonAllEntities,
 		},
 	)
 
@@ -731,6 +851,11 @@ func (db *SQLiteDataStore) CreatePerson(p models.Person) (lastInsertID int64, er
 		return
 	}
 
+	// Inserting roles.
+	if err = db.insertPersonRoles(p, tx); err != nil {
+		return
+	}
+
 	return
 }
 
@@ -768,35 +893,6 @@ func (db *SQLiteDataStore) UpdatePersonPassword(p models.Person) error {
 	return nil
 }
 
-// UpdatePersonAESKey updates the given person AES key.
-func (db *SQLiteDataStore) UpdatePersonAESKey(p models.Person) error {
-	var (
-		err  error
-		sqlr string
-		args []interface{}
-	)
-
-	dialect := goqu.Dialect("sqlite3")
-	tablePerson := goqu.T("person")
-
-	if sqlr, args, err = dialect.Update(tablePerson).Set(
-		goqu.Record{
-			"person_aeskey": p.PersonAESKey,
-		},
-	).Where(
-		goqu.I("person_id").Eq(p.PersonID),
-	).ToSQL(); err != nil {
-		logger.Log.Error(err)
-		return err
-	}
-
-	if _, err = db.Exec(sqlr, args...); err != nil {
-		return err
-	}
-
-	return nil
-}
-
 // UpdatePerson updates the given person.
 // The password is not updated.
 func (db *SQLiteDataStore) UpdatePerson(p models.Person) (err error) {
@@ -827,12 +923,13 @@ func (db *SQLiteDataStore) UpdatePerson(p models.Person) (err error) {
 			return
 		}
 
-		err = tx.Commit()
+		err = commitAuthorizationChange(tx)
 	}()
 
 	if sqlr, args, err = dialect.Update(tablePerson).Set(
 		goqu.Record{
-			"person_email": strings.ToLower(p.PersonEmail),
+			"person_email":       strings.ToLower(p.PersonEmail),
+			"person_allentities": p.PersonAllEntities,
 		},
 	).Where(
 		goqu.I("person_id").Eq(p.PersonID),
@@ -869,6 +966,18 @@ func (db *SQLiteDataStore) UpdatePerson(p models.Person) (err error) {
 		return
 	}
 
+	// Lazily deleting former roles.
+	if sqlr, args, err = dialect.From(goqu.T("personrole")).Where(
+		goqu.I("person").Eq(p.PersonID),
+	).Delete().ToSQL(); err != nil {
+		logger.Log.Error(err)
+		return
+	}
+
+	if _, err = tx.Exec(sqlr, args...); err != nil {
+		return
+	}
+
 	// Updating person entities.
 	for _, entity := range p.Entities {
 		if sqlr, args, err = dialect.Insert(goqu.T("personentities")).Rows(
@@ -905,6 +1014,11 @@ func (db *SQLiteDataStore) UpdatePerson(p models.Person) (err error) {
 		return
 	}
 
+	// Inserting roles.
+	if err = db.insertPersonRoles(p, tx); err != nil {
+		return
+	}
+
 	return
 }
 
@@ -959,7 +1073,7 @@ func (db *SQLiteDataStore) HasPersonReadRestrictedProductPermission(id int) (boo
 	)
 
 	dialect := goqu.Dialect("sqlite3")
-	tablePermission := goqu.T("permission")
+	tablePermission := goqu.T("effectivepermission").As("permission")
 
 	sQuery := dialect.From(tablePermission).Select(
 		goqu.COUNT("*"),
@@ -1058,6 +1172,8 @@ func (db *SQLiteDataStore) UnsetPersonAdmin(id int) error {
 		return err
 	}
 
+	authorizationChanged()
+
 	return nil
 }
 
@@ -1087,6 +1203,8 @@ func (db *SQLiteDataStore) SetPersonAdmin(id int) error {
 		return err
 	}
 
+	authorizationChanged()
+
 	return nil
 }
 
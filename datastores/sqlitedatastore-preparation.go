@@ -0,0 +1,222 @@
+package datastores
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/tbellembois/gochimitheque/logger"
+	"github.com/tbellembois/gochimitheque/models"
+)
+
+// CreatePreparation creates the prepared storage s and its preparation p,
+// decrementing the quantities used from the source storages.
+// It returns the id of the prepared storage.
+func (db *SQLiteDataStore) CreatePreparation(p models.Preparation, s models.Storage) (storageID int64, err error) {
+	var (
+		tx   *sql.Tx
+		res  sql.Result
+		sqlr string
+	)
+
+	logger.Log.WithFields(logrus.Fields{"p": p, "s": s}).Debug("CreatePreparation")
+
+	if tx, err = db.Begin(); err != nil {
+		return 0, err
+	}
+
+	defer func() {
+		if err != nil {
+			logger.Log.Error(err)
+			if rbErr := tx.Rollback(); rbErr != nil {
+				logger.Log.Error(rbErr)
+				err = rbErr
+
+				return
+			}
+
+			return
+		}
+
+		err = commitAuthorizationChange(tx)
+	}()
+
+	now := time.Now()
+
+	// Decrementing the sources, keeping an history of them.
+	for i, ps := range p.Sources {
+		var (
+			productID   int64
+			quantity    sql.NullFloat64
+			barecode    sql.NullString
+			batchNumber sql.NullString
+			productName string
+			unit        sql.NullString
+		)
+
+		sqlr = `SELECT storage.product, storage_quantity, storage_barecode, storage_batchnumber, name.name_label, unit.unit_label FROM storage
+		JOIN product ON storage.product = product.product_id
+		JOIN name ON product.name = name.name_id
+		LEFT JOIN unit ON storage.unit_quantity = unit.unit_id
+		WHERE storage_id = ? AND storage IS NULL`
+		if err = tx.QueryRow(sqlr, ps.StorageID.Int64).Scan(&productID, &quantity, &barecode, &batchNumber, &productName, &unit); err != nil {
+			return
+		}
+
+		if !quantity.Valid || ps.PreparationSourceQuantity > quantity.Float64 {
+			err = ErrInsufficientQuantity
+			return
+		}
+
+		if err = createStorageHistory(tx, ps.StorageID.Int64); err != nil {
+			return
+		}
+
+		sqlr = `UPDATE storage SET storage_quantity = ?, storage_modificationdate = ?, person = ? WHERE storage_id = ?`
+		if _, err = tx.Exec(sqlr, quantity.Float64-ps.PreparationSourceQuantity, now, p.PersonID, ps.StorageID.Int64); err != nil {
+			return
+		}
+
+		if err = updateProductFTS(tx, int(productID)); err != nil {
+			return
+		}
+
+		if err = registerStorage(tx, ps.StorageID.Int64, models.RegisterUse, p.PersonID); err != nil {
+			return
+		}
+
+		p.Sources[i].PreparationSourceUnit = unit.String
+		p.Sources[i].PreparationSourceBarecode = barecode.String
+		p.Sources[i].PreparationSourceBatchNumber = batchNumber.String
+		p.Sources[i].PreparationSourceProductName = productName
+		p.Sources[i].ProductID = sql.NullInt64{Valid: true, Int64: productID}
+	}
+
+	// Creating the prepared storage.
+	s.StorageCreationDate = now
+	s.StorageModificationDate = now
+
+	if storageID, err = db.createUpdateStorage(tx, s, 1, false); err != nil {
+		return
+	}
+
+	if err = registerStorage(tx, storageID, models.RegisterPreparation, p.PersonID); err != nil {
+		return
+	}
+
+	// Recording the preparation.
+	sqlr = `INSERT INTO preparation (preparation_date, preparation_solvent, preparation_comment, person, storage) VALUES (?, ?, ?, ?, ?)`
+	if res, err = tx.Exec(sqlr, now, p.PreparationSolvent, p.PreparationComment, p.PersonID, storageID); err != nil {
+		return
+	}
+
+	var preparationID int64
+
+	if preparationID, err = res.LastInsertId(); err != nil {
+		return
+	}
+
+	for _, ps := range p.Sources {
+		sqlr = `INSERT INTO preparationsource (preparationsource_quantity,
+		preparationsource_unit,
+		preparationsource_barecode,
+		preparationsource_batchnumber,
+		preparationsource_productname,
+		preparation,
+		storage,
+		product) VALUES (?, ?, ?, ?, ?, ?, ?, ?)`
+		if _, err = tx.Exec(sqlr,
+			ps.PreparationSourceQuantity,
+			ps.PreparationSourceUnit,
+			ps.PreparationSourceBarecode,
+			ps.PreparationSourceBatchNumber,
+			ps.PreparationSourceProductName,
+			preparationID,
+			ps.StorageID,
+			ps.ProductID); err != nil {
+			return
+		}
+	}
+
+	return storageID, nil
+}
+
+// GetPreparation returns the preparation of the prepared storage with the given id,
+// with the hazards of its sources products.
+func (db *SQLiteDataStore) GetPreparation(storageID int) (models.Preparation, error) {
+	var (
+		p    models.Preparation
+		sqlr string
+		err  error
+	)
+
+	logger.Log.WithFields(logrus.Fields{"storageID": storageID}).Debug("GetPreparation")
+
+	sqlr = `SELECT preparation_id,
+	preparation_date,
+	preparation_solvent,
+	preparation_comment,
+	preparation.storage,
+	person.person_id AS "person.person_id",
+	person.person_email AS "person.person_email"
+	FROM preparation
+	JOIN person ON preparation.person = person.person_id
+	WHERE preparation.storage = ?`
+	if err = db.Get(&p, sqlr, storageID); err != nil {
+		return models.Preparation{}, err
+	}
+
+	sqlr = `SELECT preparationsource_id,
+	preparationsource_quantity,
+	preparationsource_unit,
+	preparationsource_barecode,
+	preparationsource_batchnumber,
+	preparationsource_productname,
+	storage,
+	product
+	FROM preparationsource
+	WHERE preparation = ?
+	ORDER BY preparationsource_id`
+	if err = db.Select(&p.Sources, sqlr, p.PreparationID); err != nil {
+		return models.Preparation{}, err
+	}
+
+	// Hazards of the sources products.
+	sources := `SELECT product FROM preparationsource WHERE preparation = ? AND product IS NOT NULL`
+
+	sqlr = `SELECT DISTINCT symbol_id, symbol_label, symbol_image FROM symbol
+	JOIN productsymbols ON productsymbols.productsymbols_symbol_id = symbol.symbol_id
+	WHERE productsymbols.productsymbols_product_id IN (` + sources + `)
+	ORDER BY symbol_label`
+	if err = db.Select(&p.Symbols, sqlr, p.PreparationID); err != nil {
+		return models.Preparation{}, err
+	}
+
+	sqlr = `SELECT DISTINCT hazardstatement_id, hazardstatement_label, hazardstatement_reference, hazardstatement_cmr FROM hazardstatement
+	JOIN producthazardstatements ON producthazardstatements.producthazardstatements_hazardstatement_id = hazardstatement.hazardstatement_id
+	WHERE producthazardstatements.producthazardstatements_product_id IN (` + sources + `)
+	ORDER BY hazardstatement_reference`
+	if err = db.Select(&p.HazardStatements, sqlr, p.PreparationID); err != nil {
+		return models.Preparation{}, err
+	}
+
+	sqlr = `SELECT DISTINCT precautionarystatement_id, precautionarystatement_label, precautionarystatement_reference FROM precautionarystatement
+	JOIN productprecautionarystatements ON productprecautionarystatements.productprecautionarystatements_precautionarystatement_id = precautionarystatement.precautionarystatement_id
+	WHERE productprecautionarystatements.productprecautionarystatements_product_id IN (` + sources + `)
+	ORDER BY precautionarystatement_reference`
+	if err = db.Select(&p.PrecautionaryStatements, sqlr, p.PreparationID); err != nil {
+		return models.Preparation{}, err
+	}
+
+	// "danger" prevails over "warning".
+	sqlr = `SELECT signalword_id, signalword_label FROM signalword
+	JOIN product ON product.signalword = signalword.signalword_id
+	WHERE product.product_id IN (` + sources + `)
+	ORDER BY signalword_label = 'danger' DESC
+	LIMIT 1`
+	if err = db.Get(&p.SignalWord, sqlr, p.PreparationID); err != nil && err != sql.ErrNoRows {
+		return models.Preparation{}, err
+	}
+
+	return p, nil
+}
@@ -18,10 +18,15 @@ func (db *SQLiteDataStore) GetProducers(f request.Filter) ([]models.Producer, in
 		count                            int
 		exactSearch, countSQL, selectSQL string
 		countArgs, selectArgs            []interface{}
+		tenantRestricted                 bool
 	)
 
 	logger.Log.WithFields(logrus.Fields{"f": f}).Debug("GetProducers")
 
+	if tenantRestricted, err = db.isTenantRestricted(f.LoggedPersonID); err != nil {
+		return nil, 0, err
+	}
+
 	exactSearch = f.Search
 	exactSearch = strings.TrimPrefix(exactSearch, "%")
 	exactSearch = strings.TrimSuffix(exactSearch, "%")
@@ -36,6 +41,10 @@ func (db *SQLiteDataStore) GetProducers(f request.Filter) ([]models.Producer, in
 		goqu.I("producer_label").Like(f.Search),
 	)
 
+	if tenantRestricted {
+		joinClause = joinClause.Where(tenantExpression("producer_tenant", f.LoggedPersonID))
+	}
+
 	if countSQL, countArgs, err = joinClause.Select(
 		goqu.COUNT(goqu.I("producer_id").Distinct()),
 	).ToSQL(); err != nil {
@@ -45,6 +54,7 @@ func (db *SQLiteDataStore) GetProducers(f request.Filter) ([]models.Producer, in
 	if selectSQL, selectArgs, err = joinClause.Select(
 		goqu.I("producer_id"),
 		goqu.I("producer_label"),
+		goqu.I("producer_tenant"),
 	).Order(
 		goqu.L("INSTR(producer_label, ?)", exactSearch).Asc(),
 		goqu.C("producer_label").Asc(),
@@ -199,7 +209,8 @@ func (db *SQLiteDataStore) CreateProducer(p models.Producer) (lastInsertID int64
 
 	iQuery := dialect.Insert(tableProducer).Rows(
 		goqu.Record{
-			"producer_label": p.ProducerLabel,
+			"producer_label":  p.ProducerLabel,
+			"producer_tenant": p.ProducerTenant,
 		},
 	)
 
@@ -225,10 +236,15 @@ func (db *SQLiteDataStore) GetProducerRefs(f request.Filter) ([]models.ProducerR
 		count                            int
 		exactSearch, countSQL, selectSQL string
 		countArgs, selectArgs            []interface{}
+		tenantRestricted                 bool
 	)
 
 	logger.Log.WithFields(logrus.Fields{"f": f}).Debug("GetProducerRefs")
 
+	if tenantRestricted, err = db.isTenantRestricted(f.LoggedPersonID); err != nil {
+		return nil, 0, err
+	}
+
 	if f.OrderBy == "" {
 		f.OrderBy = "producerref_id"
 	}
@@ -247,6 +263,9 @@ func (db *SQLiteDataStore) GetProducerRefs(f request.Filter) ([]models.ProducerR
 	if f.Producer != -1 {
 		whereAnd = append(whereAnd, goqu.I("producerref.producer").Eq(f.Producer))
 	}
+	if tenantRestricted {
+		whereAnd = append(whereAnd, tenantExpression("producer.producer_tenant", f.LoggedPersonID))
+	}
 
 	joinClause := dialect.From(
 		producerrefTable,
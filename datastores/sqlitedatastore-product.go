@@ -12,9 +12,11 @@ import (
 	_ "github.com/doug-martin/goqu/v9/dialect/sqlite3"
 	"github.com/jmoiron/sqlx"
 	"github.com/sirupsen/logrus"
+	"github.com/tbellembois/gochimitheque/formula"
 	"github.com/tbellembois/gochimitheque/logger"
 	"github.com/tbellembois/gochimitheque/models"
 	"github.com/tbellembois/gochimitheque/request"
+	"github.com/tbellembois/gochimitheque/smiles"
 )
 
 // IsProductBookmark returns true if there is a bookmark for the product pr for the person pe.
@@ -145,10 +147,28 @@ func (db *SQLiteDataStore) GetProducts(f request.Filter, public bool) ([]models.
 		rperm                              bool
 		isadmin                            bool
 		wg                                 sync.WaitGroup
+		querySQL                           string
+		queryArgs                          map[string]interface{}
+		fts                                string
+		searchSQL                          string
+		searchArgs                         map[string]interface{}
 	)
 
 	logger.Log.WithFields(logrus.Fields{"f": f}).Debug("GetProducts")
 
+	fts = ftsQuery(f.Search)
+
+	// without FTS5, the products containing every word of the search
+	if !fts5 && fts != "" {
+		searchSQL, searchArgs = productSearchSQL(f.Search)
+		fts = ""
+	}
+
+	// most relevant first when searching
+	if f.OrderBy == "" && fts != "" {
+		f.OrderBy = "fts.fts_rank"
+	}
+
 	if f.OrderBy == "" {
 		f.OrderBy = "product_id"
 	}
@@ -183,6 +203,18 @@ func (db *SQLiteDataStore) GetProducts(f request.Filter, public bool) ([]models.
 	p.product_temperature,
 	p.product_number_per_carton,
 	p.product_number_per_bag,
+	p.product_un_number,
+	p.product_packing_group,
+	p.product_hazard_labels,
+	p.product_transport_category,
+	p.product_density,
+	p.product_molarmass,
+	p.product_smiles,
+	p.product_canonicalsmiles,
+	p.product_inchi,
+	p.product_inchikey,
+	p.product_regulation,
+	p.product_tenant,
 	linearformula.linearformula_id AS "linearformula.linearformula_id",
 	linearformula.linearformula_label AS "linearformula.linearformula_label",
 	empiricalformula.empiricalformula_id AS "empiricalformula.empiricalformula_id",
@@ -208,7 +240,9 @@ func (db *SQLiteDataStore) GetProducts(f request.Filter, public bool) ([]models.
 	ut.unit_id AS "unit_temperature.unit_id",
 	ut.unit_label AS "unit_temperature.unit_label",
 	category.category_id AS "category.category_id",
-	category.category_label AS "category.category_label"
+	category.category_label AS "category.category_label",
+	adrclass.adrclass_id AS "adrclass.adrclass_id",
+	adrclass.adrclass_label AS "adrclass.adrclass_label"
 	`)
 
 	if !public {
@@ -221,6 +255,10 @@ func (db *SQLiteDataStore) GetProducts(f request.Filter, public bool) ([]models.
 
 	// common parts
 	comreq.WriteString(" FROM product as p")
+	// full text search
+	if fts != "" {
+		comreq.WriteString(" JOIN (SELECT rowid AS fts_product_id, rank AS fts_rank FROM productfts WHERE productfts MATCH :fts) AS fts ON fts.fts_product_id = p.product_id")
+	}
 	// CMR
 	if f.CasNumberCmr {
 		comreq.WriteString(" LEFT JOIN producthazardstatements ON producthazardstatements.producthazardstatements_product_id = p.product_id")
@@ -234,6 +272,8 @@ func (db *SQLiteDataStore) GetProducts(f request.Filter, public bool) ([]models.
 	} else {
 		comreq.WriteString(" LEFT JOIN category ON p.category = category.category_id")
 	}
+	// get adrclass
+	comreq.WriteString(" LEFT JOIN adrclass ON p.adrclass = adrclass.adrclass_id")
 	// get unit_temperature
 	comreq.WriteString(" LEFT JOIN unit ut ON p.unit_temperature = ut.unit_id")
 	// get producerref
@@ -298,7 +338,7 @@ func (db *SQLiteDataStore) GetProducts(f request.Filter, public bool) ([]models.
 
 	// filter by permissions
 	if !public {
-		comreq.WriteString(` JOIN permission AS perm ON
+		comreq.WriteString(` JOIN effectivepermission AS perm ON
 	perm.person = :personid and 
 	(perm.permission_item_name in ("all", "products")) and 
 	(perm.permission_perm_name in ("all", "r", "w"))
@@ -331,6 +371,34 @@ func (db *SQLiteDataStore) GetProducts(f request.Filter, public bool) ([]models.
 		comreq.WriteString(" AND p.product_specificity = :product_specificity")
 	}
 
+	if f.AdrClass != -1 {
+		comreq.WriteString(" AND adrclass.adrclass_id = :adrclass")
+	}
+
+	if f.UNNumber != "" {
+		comreq.WriteString(" AND p.product_un_number = :product_un_number")
+	}
+
+	if f.PackingGroup != "" {
+		comreq.WriteString(" AND p.product_packing_group = :product_packing_group")
+	}
+
+	if f.InChIKey != "" {
+		comreq.WriteString(" AND p.product_inchikey = :inchikey")
+	}
+
+	if f.SMILES != "" {
+		comreq.WriteString(" AND p.product_canonicalsmiles = :smiles")
+	}
+
+	if f.MolarMassMin != -1 {
+		comreq.WriteString(" AND p.product_molarmass >= :molarmass_min")
+	}
+
+	if f.MolarMassMax != -1 {
+		comreq.WriteString(" AND p.product_molarmass <= :molarmass_max")
+	}
+
 	// search form parameters
 	if f.Name != -1 {
 		comreq.WriteString(" AND (name.name_id = :name")
@@ -408,11 +476,39 @@ func (db *SQLiteDataStore) GetProducts(f request.Filter, public bool) ([]models.
 		comreq.WriteString(" AND signalword.signalword_id = :signalword")
 	}
 
+	if searchSQL != "" {
+		comreq.WriteString(" AND p.product_id IN (" + searchSQL + ")")
+	}
+
+	// advanced search query
+	if f.Query != nil {
+		// the storage terms only match the storages the person can see
+		queryPersonID := -1
+		if public || !isadmin {
+			queryPersonID = f.LoggedPersonID
+		}
+
+		if querySQL, queryArgs, err = productQuerySQL(f.Query, queryPersonID); err != nil {
+			return nil, 0, err
+		}
+
+		comreq.WriteString(" AND p.product_id IN (" + querySQL + ")")
+	}
+
 	// filter restricted product
 	if !rperm {
 		comreq.WriteString(" AND p.product_restricted = false")
 	}
 
+	// multi-tenant mode: shared catalog and person entities cards only
+	if db.multiTenant {
+		if public {
+			comreq.WriteString(" AND p.product_tenant IS NULL")
+		} else if !isadmin {
+			comreq.WriteString(" AND " + tenantSQL("p.product_tenant"))
+		}
+	}
+
 	// show bio/chem/consu
 	switch {
 	case !f.ShowChem && !f.ShowBio && f.ShowConsu:
@@ -455,24 +551,38 @@ func (db *SQLiteDataStore) GetProducts(f request.Filter, public bool) ([]models.
 
 	// building argument map
 	m := map[string]interface{}{
-		"search":              f.Search,
-		"personid":            f.LoggedPersonID,
-		"order":               f.Order,
-		"limit":               f.Limit,
-		"offset":              f.Offset,
-		"entity":              f.Entity,
-		"product":             f.Product,
-		"storelocation":       f.Storelocation,
-		"name":                f.Name,
-		"casnumber":           f.CasNumber,
-		"empiricalformula":    f.EmpiricalFormula,
-		"product_specificity": f.ProductSpecificity,
-		"storage_barecode":    f.StorageBarecode,
-		"storage_batchnumber": f.StorageBatchNumber,
-		"custom_name_part_of": "%" + f.CustomNamePartOf + "%",
-		"signalword":          f.SignalWord,
-		"producerref":         f.ProducerRef,
-		"category":            f.Category,
+		"search":                f.Search,
+		"fts":                   fts,
+		"personid":              f.LoggedPersonID,
+		"order":                 f.Order,
+		"limit":                 f.Limit,
+		"offset":                f.Offset,
+		"entity":                f.Entity,
+		"product":               f.Product,
+		"storelocation":         f.Storelocation,
+		"name":                  f.Name,
+		"casnumber":             f.CasNumber,
+		"empiricalformula":      f.EmpiricalFormula,
+		"product_specificity":   f.ProductSpecificity,
+		"storage_barecode":      f.StorageBarecode,
+		"storage_batchnumber":   f.StorageBatchNumber,
+		"custom_name_part_of":   "%" + f.CustomNamePartOf + "%",
+		"signalword":            f.SignalWord,
+		"producerref":           f.ProducerRef,
+		"category":              f.Category,
+		"adrclass":              f.AdrClass,
+		"product_un_number":     f.UNNumber,
+		"product_packing_group": f.PackingGroup,
+		"molarmass_min":         f.MolarMassMin,
+		"molarmass_max":         f.MolarMassMax,
+		"inchikey":              f.InChIKey,
+		"smiles":                f.SMILES,
+	}
+	for k, v := range queryArgs {
+		m[k] = v
+	}
+	for k, v := range searchArgs {
+		m[k] = v
 	}
 
 	// Select.
@@ -750,7 +860,7 @@ func (db *SQLiteDataStore) GetProducts(f request.Filter, public bool) ([]models.
 					reqsc.WriteString("SELECT count(DISTINCT storage_id) from storage")
 					reqsc.WriteString(" JOIN storelocation ON storage.storelocation = storelocation.storelocation_id")
 					reqsc.WriteString(" JOIN entity ON storelocation.entity = entity.entity_id")
-					reqsc.WriteString(" JOIN personentities ON (entity.entity_id = personentities.personentities_entity_id) AND")
+					reqsc.WriteString(" JOIN effectivepersonentities AS personentities ON (entity.entity_id = personentities.personentities_entity_id) AND")
 					reqsc.WriteString(" (personentities.personentities_person_id = ?)")
 					reqsc.WriteString(" WHERE storage.product = ? AND storage.storage IS NULL AND storage.storage_archive == false")
 
@@ -758,7 +868,7 @@ func (db *SQLiteDataStore) GetProducts(f request.Filter, public bool) ([]models.
 					reqasc.WriteString("SELECT count(DISTINCT storage_id) from storage")
 					reqasc.WriteString(" JOIN storelocation ON storage.storelocation = storelocation.storelocation_id")
 					reqasc.WriteString(" JOIN entity ON storelocation.entity = entity.entity_id")
-					reqasc.WriteString(" JOIN personentities ON (entity.entity_id = personentities.personentities_entity_id) AND")
+					reqasc.WriteString(" JOIN effectivepersonentities AS personentities ON (entity.entity_id = personentities.personentities_entity_id) AND")
 					reqasc.WriteString(" (personentities.personentities_person_id = ?)")
 					reqasc.WriteString(" WHERE storage.product = ? AND storage.storage_archive == true")
 
@@ -825,6 +935,18 @@ func (db *SQLiteDataStore) GetProduct(id int) (models.Product, error) {
 	product_temperature,
 	product_number_per_carton,
 	product_number_per_bag,
+	product_un_number,
+	product_packing_group,
+	product_hazard_labels,
+	product_transport_category,
+	product_density,
+	product_molarmass,
+	product_smiles,
+	product_canonicalsmiles,
+	product_inchi,
+	product_inchikey,
+	product_regulation,
+	product_tenant,
 	linearformula.linearformula_id AS "linearformula.linearformula_id",
 	linearformula.linearformula_label AS "linearformula.linearformula_label",
 	empiricalformula.empiricalformula_id AS "empiricalformula.empiricalformula_id",
@@ -849,7 +971,9 @@ func (db *SQLiteDataStore) GetProduct(id int) (models.Product, error) {
 	ut.unit_id AS "unit_temperature.unit_id",
 	ut.unit_label AS "unit_temperature.unit_label",
 	category.category_id AS "category.category_id",
-	category.category_label AS "category.category_label"
+	category.category_label AS "category.category_label",
+	adrclass.adrclass_id AS "adrclass.adrclass_id",
+	adrclass.adrclass_label AS "adrclass.adrclass_label"
 	FROM product
 	JOIN name ON product.name = name.name_id
 	LEFT JOIN casnumber ON product.casnumber = casnumber.casnumber_id
@@ -860,6 +984,7 @@ func (db *SQLiteDataStore) GetProduct(id int) (models.Product, error) {
 	LEFT JOIN physicalstate ON product.physicalstate = physicalstate.physicalstate_id
 	LEFT JOIN signalword ON product.signalword = signalword.signalword_id
 	LEFT JOIN category ON product.category = category.category_id
+	LEFT JOIN adrclass ON product.adrclass = adrclass.adrclass_id
 	LEFT JOIN unit ut ON product.unit_temperature = ut.unit_id
 	LEFT JOIN producerref ON product.producerref = producerref.producerref_id
 	LEFT JOIN producer ON producerref.producer = producer.producer_id
@@ -1007,12 +1132,33 @@ func (db *SQLiteDataStore) DeleteProduct(id int) error {
 		return err
 	}
 
+	// keeping the preparations the product has been used for
+	sqlr = `UPDATE preparationsource SET product = NULL WHERE preparationsource.product = (?)`
+	if _, err = db.Exec(sqlr, id); err != nil {
+		return err
+	}
+
+	// keeping the recalls and merges of the product
+	for _, t := range []string{"recall", "productmerge"} {
+		sqlr = `UPDATE ` + t + ` SET product = NULL WHERE ` + t + `.product = (?)`
+		if _, err = db.Exec(sqlr, id); err != nil {
+			return err
+		}
+	}
+
 	// deleting product
 	sqlr = `DELETE FROM product WHERE product_id = ?`
 	if _, err = db.Exec(sqlr, id); err != nil {
 		return err
 	}
 
+	// deleting full text search index
+	if err = deleteProductFTS(db, id); err != nil {
+		return err
+	}
+
+	authorizationChanged()
+
 	return nil
 }
 
@@ -1047,7 +1193,7 @@ func (db *SQLiteDataStore) CreateUpdateProduct(p models.Product, update bool) (l
 			return
 		}
 
-		err = tx.Commit()
+		err = commitAuthorizationChange(tx)
 	}()
 
 	// if CasNumberID = -1 then it is a new cas
@@ -1404,9 +1550,105 @@ func (db *SQLiteDataStore) CreateUpdateProduct(p models.Product, update bool) (l
 		insertCols["product_molformula"] = nil
 	}
 
+	if p.ProductUNNumber.Valid {
+		insertCols["product_un_number"] = p.ProductUNNumber.String
+	} else {
+		insertCols["product_un_number"] = nil
+	}
+
+	if p.ProductPackingGroup.Valid {
+		insertCols["product_packing_group"] = p.ProductPackingGroup.String
+	} else {
+		insertCols["product_packing_group"] = nil
+	}
+
+	if p.ProductHazardLabels.Valid {
+		insertCols["product_hazard_labels"] = p.ProductHazardLabels.String
+	} else {
+		insertCols["product_hazard_labels"] = nil
+	}
+
+	if p.ProductTransportCategory.Valid {
+		insertCols["product_transport_category"] = p.ProductTransportCategory.Int64
+	} else {
+		insertCols["product_transport_category"] = nil
+	}
+
+	if p.ProductDensity.Valid {
+		insertCols["product_density"] = p.ProductDensity.Float64
+	} else {
+		insertCols["product_density"] = nil
+	}
+
+	// the molar mass is computed from the empirical formula if it can be parsed
+	if p.EmpiricalFormulaID.Valid {
+		var eflabel string
+
+		if err = tx.QueryRow(`SELECT empiricalformula_label FROM empiricalformula WHERE empiricalformula_id = ?`, p.EmpiricalFormulaID.Int64).Scan(&eflabel); err != nil {
+			return
+		}
+
+		if m, ferr := formula.MolarMass(eflabel); ferr == nil {
+			p.ProductMolarMass = sql.NullFloat64{Float64: m, Valid: true}
+		}
+	}
+
+	if p.ProductMolarMass.Valid {
+		insertCols["product_molarmass"] = p.ProductMolarMass.Float64
+	} else {
+		insertCols["product_molarmass"] = nil
+	}
+
+	// the canonical SMILES is the one searched
+	if p.ProductSMILES.Valid {
+		insertCols["product_smiles"] = p.ProductSMILES.String
+
+		if cs, serr := smiles.CanonicalSMILES(p.ProductSMILES.String); serr == nil {
+			insertCols["product_canonicalsmiles"] = cs
+		} else {
+			insertCols["product_canonicalsmiles"] = nil
+		}
+	} else {
+		insertCols["product_smiles"] = nil
+		insertCols["product_canonicalsmiles"] = nil
+	}
+
+	if p.ProductInChI.Valid {
+		insertCols["product_inchi"] = p.ProductInChI.String
+	} else {
+		insertCols["product_inchi"] = nil
+	}
+
+	if p.ProductInChIKey.Valid {
+		insertCols["product_inchikey"] = p.ProductInChIKey.String
+	} else {
+		insertCols["product_inchikey"] = nil
+	}
+
+	if p.ProductRegulation.Valid {
+		insertCols["product_regulation"] = p.ProductRegulation.String
+	} else {
+		insertCols["product_regulation"] = nil
+	}
+
+	if p.AdrClassID.Valid {
+		insertCols["adrclass"] = int(p.AdrClassID.Int64)
+	} else {
+		insertCols["adrclass"] = nil
+	}
+
 	insertCols["name"] = p.NameID
 	insertCols["person"] = p.PersonID
 
+	// the tenant is only changed when sharing the product
+	if !update {
+		if p.ProductTenant.Valid {
+			insertCols["product_tenant"] = p.ProductTenant.Int64
+		} else {
+			insertCols["product_tenant"] = nil
+		}
+	}
+
 	if update {
 		iQuery := dialect.Update(tableProduct).Set(insertCols).Where(goqu.I("product_id").Eq(p.ProductID))
 		if sqlr, args, err = iQuery.ToSQL(); err != nil {
@@ -1554,5 +1796,18 @@ func (db *SQLiteDataStore) CreateUpdateProduct(p models.Product, update bool) (l
 		}
 	}
 
+	// updating the full text search index
+	if err = updateProductFTS(tx, p.ProductID); err != nil {
+		logger.Log.Error("error updating productfts")
+		return
+	}
+
+	// registering the storages of a newly classified product
+	if update && p.ProductRegulation.Valid {
+		if err = registerProductStorages(tx, p.ProductID, models.RegisterInventory, p.PersonID); err != nil {
+			return
+		}
+	}
+
 	return
 }
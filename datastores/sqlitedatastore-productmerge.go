@@ -0,0 +1,267 @@
+package datastores
+
+import (
+	"database/sql"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/tbellembois/gochimitheque/logger"
+	"github.com/tbellembois/gochimitheque/models"
+)
+
+// normalizedLabel is the SQL expression of the normalized label l to compare names:
+// lowercase, without spaces, hyphens, commas and quotes.
+func normalizedLabel(l string) string {
+	return `lower(replace(replace(replace(replace(` + l + `, ' ', ''), '-', ''), ',', ''), '''', ''))`
+}
+
+// GetProductDuplicates returns the pairs of products of the same tenant and specificity
+// matching by normalized name or synonym, CAS number or producer reference.
+// The empirical formula is only an additional criterion as isomers share it.
+// If productID is not 0 only the pairs of this product are returned.
+func (db *SQLiteDataStore) GetProductDuplicates(productID int) ([]models.ProductDuplicate, error) {
+	var (
+		duplicates []models.ProductDuplicate
+		err        error
+	)
+
+	logger.Log.WithFields(logrus.Fields{"productID": productID}).Debug("GetProductDuplicates")
+
+	sqlr := `WITH
+	productname(product_id, label, kind) AS (
+		SELECT product_id, ` + normalizedLabel("name_label") + `, 'name' FROM product
+		JOIN name ON product.name = name.name_id
+		UNION
+		SELECT productsynonyms_product_id, ` + normalizedLabel("name_label") + `, 'synonym' FROM productsynonyms
+		JOIN name ON productsynonyms.productsynonyms_name_id = name.name_id
+	),
+	pair(a, b, criterion) AS (
+		SELECT DISTINCT n1.product_id, n2.product_id, CASE WHEN n1.kind = 'name' AND n2.kind = 'name' THEN 'name' ELSE 'synonym' END
+		FROM productname n1 JOIN productname n2 ON n1.label = n2.label AND n1.product_id < n2.product_id
+		UNION ALL
+		SELECT p1.product_id, p2.product_id, 'casnumber'
+		FROM product p1 JOIN product p2 ON p1.casnumber = p2.casnumber AND p1.product_id < p2.product_id
+		UNION ALL
+		SELECT p1.product_id, p2.product_id, 'empiricalformula'
+		FROM product p1 JOIN product p2 ON p1.empiricalformula = p2.empiricalformula AND p1.product_id < p2.product_id
+		UNION ALL
+		SELECT p1.product_id, p2.product_id, 'producerref'
+		FROM product p1 JOIN product p2 ON p1.producerref = p2.producerref AND p1.product_id < p2.product_id
+	)
+	SELECT pa.product_id,
+	na.name_label,
+	pa.product_specificity,
+	ca.casnumber_label,
+	pb.product_id AS duplicate_id,
+	nb.name_label AS duplicate_name_label,
+	cb.casnumber_label AS duplicate_casnumber_label,
+	group_concat(DISTINCT criterion) AS duplicate_criteria
+	FROM pair
+	JOIN product pa ON pair.a = pa.product_id
+	JOIN product pb ON pair.b = pb.product_id
+	JOIN name na ON pa.name = na.name_id
+	JOIN name nb ON pb.name = nb.name_id
+	LEFT JOIN casnumber ca ON pa.casnumber = ca.casnumber_id
+	LEFT JOIN casnumber cb ON pb.casnumber = cb.casnumber_id
+	WHERE pa.product_tenant IS pb.product_tenant
+	AND lower(trim(ifnull(pa.product_specificity, ''))) = lower(trim(ifnull(pb.product_specificity, '')))
+	AND (? = 0 OR pa.product_id = ? OR pb.product_id = ?)
+	GROUP BY pa.product_id, pb.product_id
+	HAVING sum(criterion <> 'empiricalformula') > 0
+	ORDER BY count(DISTINCT criterion) DESC, pa.product_id, pb.product_id`
+	if err = db.Select(&duplicates, sqlr, productID, productID, productID); err != nil {
+		return nil, err
+	}
+
+	for i := range duplicates {
+		duplicates[i].DuplicateCriteria = strings.Split(duplicates[i].DuplicateCriteriaCSV, ",")
+	}
+
+	return duplicates, nil
+}
+
+// GetProductMerges returns the products merges, the latest first.
+func (db *SQLiteDataStore) GetProductMerges() ([]models.ProductMerge, error) {
+	var (
+		merges []models.ProductMerge
+		err    error
+	)
+
+	logger.Log.Debug("GetProductMerges")
+
+	sqlr := `SELECT productmerge_id,
+	productmerge_date,
+	productmerge_mergedid,
+	productmerge_mergedname,
+	productmerge_mergedcasnumber,
+	productmerge_mergedspecificity,
+	productmerge_mergedstoragecount,
+	productmerge.product,
+	name.name_label,
+	person.person_id AS "person.person_id",
+	person.person_email AS "person.person_email"
+	FROM productmerge
+	JOIN person ON productmerge.person = person.person_id
+	LEFT JOIN product ON productmerge.product = product.product_id
+	LEFT JOIN name ON product.name = name.name_id
+	ORDER BY productmerge_date DESC`
+	if err = db.Select(&merges, sqlr); err != nil {
+		return nil, err
+	}
+
+	return merges, nil
+}
+
+// MergeProducts merges the products with the mergedIDs into the product with the given id:
+// their storages, bookmarks, synonyms, tags, supplier references, preparations and recalls
+// are moved to the product, their names become synonyms of the product and they are deleted.
+// Each merge is recorded.
+func (db *SQLiteDataStore) MergeProducts(id int, mergedIDs []int, personID int) (err error) {
+	var (
+		tx     *sql.Tx
+		sqlr   string
+		nameID int
+	)
+
+	logger.Log.WithFields(logrus.Fields{"id": id, "mergedIDs": mergedIDs}).Debug("MergeProducts")
+
+	if tx, err = db.Begin(); err != nil {
+		return err
+	}
+
+	defer func() {
+		if err != nil {
+			logger.Log.Error(err)
+			if rbErr := tx.Rollback(); rbErr != nil {
+				logger.Log.Error(rbErr)
+				err = rbErr
+
+				return
+			}
+
+			return
+		}
+
+		err = commitAuthorizationChange(tx)
+	}()
+
+	if err = tx.QueryRow(`SELECT name FROM product WHERE product_id = ?`, id).Scan(&nameID); err != nil {
+		return
+	}
+
+	now := time.Now()
+
+	for _, m := range mergedIDs {
+		if m == id {
+			continue
+		}
+
+		// Recording the merge.
+		sqlr = `INSERT INTO productmerge (productmerge_date,
+		productmerge_mergedid,
+		productmerge_mergedname,
+		productmerge_mergedcasnumber,
+		productmerge_mergedspecificity,
+		productmerge_mergedstoragecount,
+		person,
+		product) SELECT ?,
+			product_id,
+			name.name_label,
+			ifnull(casnumber.casnumber_label, ''),
+			ifnull(product_specificity, ''),
+			(SELECT count(*) FROM storage WHERE storage.product = product_id AND storage.storage IS NULL),
+			?,
+			? FROM product
+			JOIN name ON product.name = name.name_id
+			LEFT JOIN casnumber ON product.casnumber = casnumber.casnumber_id
+			WHERE product_id = ?`
+
+		var res sql.Result
+
+		if res, err = tx.Exec(sqlr, now, personID, id, m); err != nil {
+			return
+		}
+
+		var n int64
+
+		if n, err = res.RowsAffected(); err != nil {
+			return
+		}
+
+		if n == 0 {
+			err = sql.ErrNoRows
+			return
+		}
+
+		// Moving the storages, including their history.
+		if _, err = tx.Exec(`UPDATE storage SET product = ? WHERE product = ?`, id, m); err != nil {
+			return
+		}
+
+		if err = registerProductStorages(tx, id, models.RegisterMerge, personID); err != nil {
+			return
+		}
+
+		// Moving the bookmarks, once per person.
+		sqlr = `DELETE FROM bookmark WHERE product = ? AND person IN (SELECT person FROM bookmark WHERE product = ?)`
+		if _, err = tx.Exec(sqlr, m, id); err != nil {
+			return
+		}
+
+		if _, err = tx.Exec(`UPDATE bookmark SET product = ? WHERE product = ?`, id, m); err != nil {
+			return
+		}
+
+		// The merged product name and synonyms become synonyms.
+		sqlr = `INSERT OR IGNORE INTO productsynonyms (productsynonyms_product_id, productsynonyms_name_id)
+		SELECT ?, name FROM product WHERE product_id = ? AND name <> ?
+		UNION
+		SELECT ?, productsynonyms_name_id FROM productsynonyms WHERE productsynonyms_product_id = ? AND productsynonyms_name_id <> ?`
+		if _, err = tx.Exec(sqlr, id, m, nameID, id, m, nameID); err != nil {
+			return
+		}
+
+		// Moving the tags and supplier references.
+		sqlr = `INSERT OR IGNORE INTO producttags (producttags_product_id, producttags_tag_id)
+		SELECT ?, producttags_tag_id FROM producttags WHERE producttags_product_id = ?`
+		if _, err = tx.Exec(sqlr, id, m); err != nil {
+			return
+		}
+
+		sqlr = `INSERT OR IGNORE INTO productsupplierrefs (productsupplierrefs_product_id, productsupplierrefs_supplierref_id)
+		SELECT ?, productsupplierrefs_supplierref_id FROM productsupplierrefs WHERE productsupplierrefs_product_id = ?`
+		if _, err = tx.Exec(sqlr, id, m); err != nil {
+			return
+		}
+
+		// Moving the references kept by value.
+		for _, t := range []string{"preparationsource", "recall", "productmerge"} {
+			if _, err = tx.Exec(`UPDATE `+t+` SET product = ? WHERE product = ?`, id, m); err != nil {
+				return
+			}
+		}
+
+		// Deleting the merged product.
+		for _, t := range []string{"productsynonyms", "producttags", "productsupplierrefs", "productsymbols", "productclassofcompound", "producthazardstatements", "productprecautionarystatements"} {
+			if _, err = tx.Exec(`DELETE FROM `+t+` WHERE `+t+`_product_id = ?`, m); err != nil {
+				return
+			}
+		}
+
+		if _, err = tx.Exec(`DELETE FROM product WHERE product_id = ?`, m); err != nil {
+			return
+		}
+
+		if err = deleteProductFTS(tx, m); err != nil {
+			return
+		}
+	}
+
+	// updating the product full text search index
+	if err = updateProductFTS(tx, id); err != nil {
+		return
+	}
+
+	return nil
+}
@@ -0,0 +1,350 @@
+package datastores
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/doug-martin/goqu/v9"
+	"github.com/doug-martin/goqu/v9/exp"
+	"github.com/tbellembois/gochimitheque/request"
+)
+
+// productQuerySQL returns a request selecting the ids of the products
+// matching the query q, and its named parameters.
+// The storage terms only match the storages of the entities of the person
+// personID, of all the entities if personID is -1.
+func productQuerySQL(q *request.QueryNode, personID int) (string, map[string]interface{}, error) {
+	var (
+		expr exp.Expression
+		err  error
+	)
+
+	if expr, err = queryExpression(q, goqu.I("qp.product_id"), nil, personID); err != nil {
+		return "", nil, err
+	}
+
+	dialect := goqu.Dialect("sqlite3")
+
+	return namedQuerySQL(dialect.From(goqu.T("product").As("qp")).Select(goqu.I("qp.product_id")).Where(expr))
+}
+
+// storageQuerySQL returns a request selecting the ids of the storages
+// matching the query q, and its named parameters.
+func storageQuerySQL(q *request.QueryNode) (string, map[string]interface{}, error) {
+	var (
+		expr exp.Expression
+		err  error
+	)
+
+	if expr, err = queryExpression(q, goqu.I("qs.product"), goqu.I("qs.storage_id"), -1); err != nil {
+		return "", nil, err
+	}
+
+	dialect := goqu.Dialect("sqlite3")
+
+	return namedQuerySQL(dialect.From(goqu.T("storage").As("qs")).Select(goqu.I("qs.storage_id")).Where(expr))
+}
+
+// namedQuerySQL renders the dataset replacing the "?" placeholders
+// with :query0, :query1... named parameters so that the request can be
+// embedded into the sqlx named requests.
+func namedQuerySQL(ds *goqu.SelectDataset) (string, map[string]interface{}, error) {
+	var (
+		sqlr string
+		args []interface{}
+		sb   strings.Builder
+		err  error
+	)
+
+	if sqlr, args, err = ds.Prepared(true).ToSQL(); err != nil {
+		return "", nil, err
+	}
+
+	m := make(map[string]interface{})
+	i := 0
+
+	for _, r := range sqlr {
+		if r != '?' {
+			sb.WriteRune(r)
+			continue
+		}
+
+		if i >= len(args) {
+			return "", nil, fmt.Errorf("query placeholders and arguments mismatch")
+		}
+
+		name := fmt.Sprintf("query%d", i)
+		m[name] = args[i]
+
+		sb.WriteString(":" + name)
+
+		i++
+	}
+
+	return sb.String(), m, nil
+}
+
+// queryExpression converts the query node n into a goqu expression.
+// productID is the product id column to restrict,
+// storageID the storage id column or nil when searching products,
+// personID the person whose entities storages are searched when searching products, -1 for all.
+func queryExpression(n *request.QueryNode, productID exp.IdentifierExpression, storageID exp.IdentifierExpression, personID int) (exp.Expression, error) {
+	var (
+		expr  exp.Expression
+		exprs []exp.Expression
+		err   error
+	)
+
+	switch n.Operator {
+	case request.QueryAnd, request.QueryOr:
+		for _, c := range n.Children {
+			if expr, err = queryExpression(c, productID, storageID, personID); err != nil {
+				return nil, err
+			}
+
+			exprs = append(exprs, expr)
+		}
+
+		if n.Operator == request.QueryAnd {
+			return goqu.And(exprs...), nil
+		}
+
+		return goqu.Or(exprs...), nil
+	case request.QueryNot:
+		if expr, err = queryExpression(n.Children[0], productID, storageID, personID); err != nil {
+			return nil, err
+		}
+
+		return goqu.L("NOT (?)", expr), nil
+	}
+
+	// product term
+	if ds := queryProductTermDataset(n); ds != nil {
+		return productID.In(ds), nil
+	}
+
+	// storage term
+	ds, err := queryStorageTermDataset(n)
+	if err != nil {
+		return nil, err
+	}
+
+	if storageID != nil {
+		return storageID.In(ds.Select(goqu.I("storage.storage_id"))), nil
+	}
+
+	// products having at least one matching (non history) storage
+	ds = ds.Where(goqu.I("storage.storage").IsNull())
+
+	// not revealing the storages of the other entities
+	if personID != -1 {
+		dialect := goqu.Dialect("sqlite3")
+
+		ds = ds.Where(goqu.I("storage.storelocation").In(dialect.From(goqu.T("storelocation").As("vsl")).
+			Join(goqu.T("effectivepersonentities").As("vpe"), goqu.On(goqu.I("vpe.personentities_entity_id").Eq(goqu.I("vsl.entity")))).
+			Where(goqu.I("vpe.personentities_person_id").Eq(personID)).
+			Select(goqu.I("vsl.storelocation_id"))))
+	}
+
+	return productID.In(ds.Select(goqu.I("storage.product"))), nil
+}
+
+// queryPattern returns the LIKE pattern of the term value v, to be used
+// with ESCAPE '\'. The % and _ of v are escaped and its * wildcards converted.
+// If contains is true the value can be matched anywhere.
+func queryPattern(v string, contains bool) string {
+	v = strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(v)
+
+	if strings.Contains(v, "*") {
+		return strings.ReplaceAll(v, "*", "%")
+	}
+
+	if contains {
+		return "%" + v + "%"
+	}
+
+	return v
+}
+
+// queryLike returns the condition of the column c matching the term value v.
+func queryLike(c exp.IdentifierExpression, v string, contains bool) exp.Expression {
+	return goqu.L(`? LIKE ? ESCAPE '\'`, c, queryPattern(v, contains))
+}
+
+// queryProductTermDataset returns a dataset selecting the ids of the products
+// matching the term n, or nil if n is not a product term.
+func queryProductTermDataset(n *request.QueryNode) *goqu.SelectDataset {
+	dialect := goqu.Dialect("sqlite3")
+	product := dialect.From(goqu.T("product")).Select(goqu.I("product.product_id"))
+
+	switch n.Qualifier {
+	case "name":
+		return product.
+			Join(goqu.T("name"), goqu.On(goqu.I("product.name").Eq(goqu.I("name.name_id")))).
+			Where(queryLike(goqu.I("name.name_label"), n.Value, true)).
+			Union(dialect.From(goqu.T("productsynonyms")).
+				Join(goqu.T("name"), goqu.On(goqu.I("productsynonyms.productsynonyms_name_id").Eq(goqu.I("name.name_id")))).
+				Where(queryLike(goqu.I("name.name_label"), n.Value, true)).
+				Select(goqu.I("productsynonyms.productsynonyms_product_id")))
+	case "cas":
+		return product.
+			Join(goqu.T("casnumber"), goqu.On(goqu.I("product.casnumber").Eq(goqu.I("casnumber.casnumber_id")))).
+			Where(queryLike(goqu.I("casnumber.casnumber_label"), n.Value, false))
+	case "ce":
+		return product.
+			Join(goqu.T("cenumber"), goqu.On(goqu.I("product.cenumber").Eq(goqu.I("cenumber.cenumber_id")))).
+			Where(queryLike(goqu.I("cenumber.cenumber_label"), n.Value, false))
+	case "formula":
+		return product.
+			Join(goqu.T("empiricalformula"), goqu.On(goqu.I("product.empiricalformula").Eq(goqu.I("empiricalformula.empiricalformula_id")))).
+			Where(queryLike(goqu.I("empiricalformula.empiricalformula_label"), n.Value, false))
+	case "hs":
+		return dialect.From(goqu.T("producthazardstatements")).
+			Join(goqu.T("hazardstatement"), goqu.On(goqu.I("producthazardstatements.producthazardstatements_hazardstatement_id").Eq(goqu.I("hazardstatement.hazardstatement_id")))).
+			Where(queryLike(goqu.I("hazardstatement.hazardstatement_reference"), n.Value, false)).
+			Select(goqu.I("producthazardstatements.producthazardstatements_product_id"))
+	case "ps":
+		return dialect.From(goqu.T("productprecautionarystatements")).
+			Join(goqu.T("precautionarystatement"), goqu.On(goqu.I("productprecautionarystatements.productprecautionarystatements_precautionarystatement_id").Eq(goqu.I("precautionarystatement.precautionarystatement_id")))).
+			Where(queryLike(goqu.I("precautionarystatement.precautionarystatement_reference"), n.Value, false)).
+			Select(goqu.I("productprecautionarystatements.productprecautionarystatements_product_id"))
+	case "tag":
+		return dialect.From(goqu.T("producttags")).
+			Join(goqu.T("tag"), goqu.On(goqu.I("producttags.producttags_tag_id").Eq(goqu.I("tag.tag_id")))).
+			Where(queryLike(goqu.I("tag.tag_label"), n.Value, false)).
+			Select(goqu.I("producttags.producttags_product_id"))
+	case "category":
+		return product.
+			Join(goqu.T("category"), goqu.On(goqu.I("product.category").Eq(goqu.I("category.category_id")))).
+			Where(queryLike(goqu.I("category.category_label"), n.Value, false))
+	case "state":
+		return product.
+			Join(goqu.T("physicalstate"), goqu.On(goqu.I("product.physicalstate").Eq(goqu.I("physicalstate.physicalstate_id")))).
+			Where(queryLike(goqu.I("physicalstate.physicalstate_label"), n.Value, false))
+	case "molarmass":
+		return product.Where(queryNumberRange(goqu.I("product.product_molarmass"), n.Range)...)
+	case "is":
+		switch n.Value {
+		case "cmr":
+			return product.
+				Join(goqu.T("casnumber"), goqu.On(goqu.I("product.casnumber").Eq(goqu.I("casnumber.casnumber_id")))).
+				Where(goqu.I("casnumber.casnumber_cmr").IsNotNull()).
+				Union(dialect.From(goqu.T("producthazardstatements")).
+					Join(goqu.T("hazardstatement"), goqu.On(goqu.I("producthazardstatements.producthazardstatements_hazardstatement_id").Eq(goqu.I("hazardstatement.hazardstatement_id")))).
+					Where(
+						goqu.I("hazardstatement.hazardstatement_cmr").IsNotNull(),
+						goqu.I("hazardstatement.hazardstatement_cmr").Neq(""),
+					).
+					Select(goqu.I("producthazardstatements.producthazardstatements_product_id")))
+		case "restricted":
+			return product.Where(goqu.I("product.product_restricted").IsTrue())
+		case "radioactive":
+			return product.Where(goqu.I("product.product_radioactive").IsTrue())
+		case "controlled":
+			return product.Where(goqu.I("product.product_regulation").IsNotNull())
+		}
+	}
+
+	return nil
+}
+
+// queryStorageTermDataset returns a dataset from the storage table
+// restricted to the storages matching the term n.
+func queryStorageTermDataset(n *request.QueryNode) (*goqu.SelectDataset, error) {
+	dialect := goqu.Dialect("sqlite3")
+	storage := dialect.From(goqu.T("storage"))
+
+	switch n.Qualifier {
+	case "location":
+		return storage.
+			Join(goqu.T("storelocation"), goqu.On(goqu.I("storage.storelocation").Eq(goqu.I("storelocation.storelocation_id")))).
+			Where(queryLike(goqu.I("storelocation.storelocation_fullpath"), n.Value, true)), nil
+	case "entity":
+		return storage.
+			Join(goqu.T("storelocation"), goqu.On(goqu.I("storage.storelocation").Eq(goqu.I("storelocation.storelocation_id")))).
+			Join(goqu.T("entity"), goqu.On(goqu.I("storelocation.entity").Eq(goqu.I("entity.entity_id")))).
+			Where(queryLike(goqu.I("entity.entity_name"), n.Value, true)), nil
+	case "supplier":
+		return storage.
+			Join(goqu.T("supplier"), goqu.On(goqu.I("storage.supplier").Eq(goqu.I("supplier.supplier_id")))).
+			Where(queryLike(goqu.I("supplier.supplier_label"), n.Value, true)), nil
+	case "batch":
+		return storage.Where(queryLike(goqu.I("storage.storage_batchnumber"), n.Value, true)), nil
+	case "barecode":
+		return storage.Where(queryLike(goqu.I("storage.storage_barecode"), n.Value, true)), nil
+	case "quantity":
+		return storage.Where(queryNumberRange(goqu.I("storage.storage_quantity"), n.Range)...), nil
+	case "entrydate", "exitdate", "openingdate", "expirationdate":
+		return storage.Where(queryDateRange(goqu.I("storage.storage_"+n.Qualifier), n.Range)...), nil
+	case "is":
+		switch n.Value {
+		case "archived":
+			return storage.Where(goqu.I("storage.storage_archive").IsTrue()), nil
+		case "todestroy":
+			return storage.Where(goqu.I("storage.storage_todestroy").IsTrue()), nil
+		case "borrowed":
+			return storage.Where(goqu.I("storage.storage_id").In(dialect.From(goqu.T("borrowing")).Select(goqu.I("borrowing.storage")))), nil
+		}
+	}
+
+	return nil, fmt.Errorf("unsupported query term %s:%s", n.Qualifier, n.Value)
+}
+
+// queryNumberRange returns the conditions of the range r on the column c.
+func queryNumberRange(c exp.IdentifierExpression, r *request.QueryRange) []exp.Expression {
+	var exprs []exp.Expression
+
+	if r.Min != "" {
+		min, _ := strconv.ParseFloat(r.Min, 64)
+
+		if r.MinExclusive {
+			exprs = append(exprs, c.Gt(min))
+		} else {
+			exprs = append(exprs, c.Gte(min))
+		}
+	}
+
+	if r.Max != "" {
+		max, _ := strconv.ParseFloat(r.Max, 64)
+
+		if r.MaxExclusive {
+			exprs = append(exprs, c.Lt(max))
+		} else {
+			exprs = append(exprs, c.Lte(max))
+		}
+	}
+
+	return exprs
+}
+
+// queryDateRange returns the conditions of the range r on the datetime column c.
+// Bounds are days, an inclusive upper bound then covers the whole day.
+func queryDateRange(c exp.IdentifierExpression, r *request.QueryRange) []exp.Expression {
+	var exprs []exp.Expression
+
+	nextDay := func(d string) string {
+		t, _ := time.Parse(request.QueryDateFormat, d)
+
+		return t.AddDate(0, 0, 1).Format(request.QueryDateFormat)
+	}
+
+	if r.Min != "" {
+		if r.MinExclusive {
+			exprs = append(exprs, c.Gte(nextDay(r.Min)))
+		} else {
+			exprs = append(exprs, c.Gte(r.Min))
+		}
+	}
+
+	if r.Max != "" {
+		if r.MaxExclusive {
+			exprs = append(exprs, c.Lt(r.Max))
+		} else {
+			exprs = append(exprs, c.Lt(nextDay(r.Max)))
+		}
+	}
+
+	return exprs
+}
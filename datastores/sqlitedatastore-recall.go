@@ -0,0 +1,247 @@
+package datastores
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/tbellembois/gochimitheque/logger"
+	"github.com/tbellembois/gochimitheque/models"
+)
+
+// recallsSelect selects the recalls with their storages and acknowledgements counts.
+const recallsSelect = `SELECT recall_id,
+	recall_date,
+	recall_batchnumber,
+	recall_comment,
+	recall.product,
+	name.name_label,
+	recall.supplier,
+	supplier.supplier_label,
+	person.person_id AS "person.person_id",
+	person.person_email AS "person.person_email",
+	(SELECT count(*) FROM storage WHERE storage_recall = recall_id AND storage IS NULL) AS recall_storagecount,
+	(SELECT count(*) FROM recallacknowledgement WHERE recall = recall_id AND recallacknowledgement_date IS NOT NULL) AS recall_acknowledgedcount,
+	(SELECT count(*) FROM recallacknowledgement WHERE recall = recall_id) AS recall_acknowledgementcount
+	FROM recall
+	JOIN person ON recall.person = person.person_id
+	LEFT JOIN product ON recall.product = product.product_id
+	LEFT JOIN name ON product.name = name.name_id
+	LEFT JOIN supplier ON recall.supplier = supplier.supplier_id`
+
+// GetRecalls returns the recalls, the latest first.
+func (db *SQLiteDataStore) GetRecalls() ([]models.Recall, error) {
+	var (
+		recalls []models.Recall
+		err     error
+	)
+
+	logger.Log.Debug("GetRecalls")
+
+	if err = db.Select(&recalls, recallsSelect+` ORDER BY recall_date DESC`); err != nil {
+		return nil, err
+	}
+
+	return recalls, nil
+}
+
+// GetManagerRecalls returns the recalls to be acknowledged by the manager with the given id,
+// the latest first.
+func (db *SQLiteDataStore) GetManagerRecalls(personID int) ([]models.Recall, error) {
+	var (
+		recalls []models.Recall
+		err     error
+	)
+
+	logger.Log.WithFields(logrus.Fields{"personID": personID}).Debug("GetManagerRecalls")
+
+	sqlr := recallsSelect + ` WHERE recall_id IN (SELECT recall FROM recallacknowledgement WHERE person = ?)
+	ORDER BY recall_date DESC`
+	if err = db.Select(&recalls, sqlr, personID); err != nil {
+		return nil, err
+	}
+
+	return recalls, nil
+}
+
+// GetRecall returns the recall with the given id, its storages and acknowledgements.
+func (db *SQLiteDataStore) GetRecall(id int) (models.Recall, error) {
+	var (
+		r    models.Recall
+		sqlr string
+		err  error
+	)
+
+	logger.Log.WithFields(logrus.Fields{"id": id}).Debug("GetRecall")
+
+	if err = db.Get(&r, recallsSelect+` WHERE recall_id = ?`, id); err != nil {
+		return models.Recall{}, err
+	}
+
+	sqlr = `SELECT storage_id,
+	storage_barecode,
+	storage_quantity,
+	unit.unit_label,
+	storelocation.storelocation_fullpath,
+	entity.entity_id,
+	entity.entity_name
+	FROM storage
+	JOIN storelocation ON storage.storelocation = storelocation.storelocation_id
+	JOIN entity ON storelocation.entity = entity.entity_id
+	LEFT JOIN unit ON storage.unit_quantity = unit.unit_id
+	WHERE storage_recall = ? AND storage IS NULL
+	ORDER BY entity.entity_name, storelocation.storelocation_fullpath`
+	if err = db.Select(&r.Storages, sqlr, id); err != nil {
+		return models.Recall{}, err
+	}
+
+	sqlr = `SELECT recallacknowledgement_date,
+	entity.entity_id,
+	entity.entity_name,
+	person.person_id,
+	person.person_email
+	FROM recallacknowledgement
+	JOIN entity ON recallacknowledgement.entity = entity.entity_id
+	JOIN person ON recallacknowledgement.person = person.person_id
+	WHERE recall = ?
+	ORDER BY entity.entity_name, person.person_email`
+	if err = db.Select(&r.Acknowledgements, sqlr, id); err != nil {
+		return models.Recall{}, err
+	}
+
+	return r, nil
+}
+
+// CreateRecall creates the recall r and flags the matching active storages of all the entities,
+// the managers of their entities have to acknowledge it.
+// It returns the id of the recall.
+func (db *SQLiteDataStore) CreateRecall(r models.Recall) (lastInsertID int64, err error) {
+	var (
+		tx   *sql.Tx
+		res  sql.Result
+		sqlr string
+	)
+
+	logger.Log.WithFields(logrus.Fields{"r": r}).Debug("CreateRecall")
+
+	if tx, err = db.Begin(); err != nil {
+		return 0, err
+	}
+
+	defer func() {
+		if err != nil {
+			logger.Log.Error(err)
+			if rbErr := tx.Rollback(); rbErr != nil {
+				logger.Log.Error(rbErr)
+				err = rbErr
+
+				return
+			}
+
+			return
+		}
+
+		err = tx.Commit()
+	}()
+
+	sqlr = `INSERT INTO recall (recall_date, recall_batchnumber, recall_comment, person, product, supplier) VALUES (?, ?, ?, ?, ?, ?)`
+	if res, err = tx.Exec(sqlr, r.RecallDate, r.RecallBatchNumber, r.RecallComment, r.PersonID, r.ProductID, r.SupplierID); err != nil {
+		return
+	}
+
+	if lastInsertID, err = res.LastInsertId(); err != nil {
+		return
+	}
+
+	// Flagging the active storages of the batch, the batch numbers are compared case insensitively.
+	sqlr = `UPDATE storage SET storage_recall = ?
+	WHERE storage IS NULL
+	AND (storage_archive IS NULL OR storage_archive = false)
+	AND product = ?
+	AND (? IS NULL OR supplier = ?)
+	AND lower(trim(storage_batchnumber)) = lower(trim(?))`
+	if _, err = tx.Exec(sqlr, lastInsertID, r.ProductID, r.SupplierID, r.SupplierID, r.RecallBatchNumber); err != nil {
+		return
+	}
+
+	sqlr = `INSERT INTO recallacknowledgement (recall, entity, person)
+	SELECT DISTINCT ?, entitypeople.entitypeople_entity_id, entitypeople.entitypeople_person_id FROM entitypeople
+	WHERE entitypeople.entitypeople_entity_id IN (SELECT storelocation.entity FROM storage
+		JOIN storelocation ON storage.storelocation = storelocation.storelocation_id
+		WHERE storage.storage_recall = ? AND storage.storage IS NULL)`
+	if _, err = tx.Exec(sqlr, lastInsertID, lastInsertID); err != nil {
+		return
+	}
+
+	return lastInsertID, nil
+}
+
+// AcknowledgeRecall records the acknowledgement of the recall with the given id
+// by the manager with the given id for all its entities.
+// It returns sql.ErrNoRows if the manager does not have to acknowledge it.
+func (db *SQLiteDataStore) AcknowledgeRecall(id int, personID int, date time.Time) error {
+	var (
+		res sql.Result
+		n   int64
+		err error
+	)
+
+	logger.Log.WithFields(logrus.Fields{"id": id, "personID": personID}).Debug("AcknowledgeRecall")
+
+	sqlr := `UPDATE recallacknowledgement SET recallacknowledgement_date = ?
+	WHERE recall = ? AND person = ? AND recallacknowledgement_date IS NULL`
+	if res, err = db.Exec(sqlr, date, id, personID); err != nil {
+		return err
+	}
+
+	if n, err = res.RowsAffected(); err != nil {
+		return err
+	}
+
+	if n == 0 {
+		return sql.ErrNoRows
+	}
+
+	return nil
+}
+
+// DeleteRecall deletes the recall with the given id, removing the recall flag of its storages.
+func (db *SQLiteDataStore) DeleteRecall(id int) (err error) {
+	var tx *sql.Tx
+
+	logger.Log.WithFields(logrus.Fields{"id": id}).Debug("DeleteRecall")
+
+	if tx, err = db.Begin(); err != nil {
+		return err
+	}
+
+	defer func() {
+		if err != nil {
+			logger.Log.Error(err)
+			if rbErr := tx.Rollback(); rbErr != nil {
+				logger.Log.Error(rbErr)
+				err = rbErr
+
+				return
+			}
+
+			return
+		}
+
+		err = tx.Commit()
+	}()
+
+	if _, err = tx.Exec(`UPDATE storage SET storage_recall = NULL WHERE storage_recall = ?`, id); err != nil {
+		return
+	}
+
+	if _, err = tx.Exec(`DELETE FROM recallacknowledgement WHERE recall = ?`, id); err != nil {
+		return
+	}
+
+	if _, err = tx.Exec(`DELETE FROM recall WHERE recall_id = ?`, id); err != nil {
+		return
+	}
+
+	return nil
+}
@@ -0,0 +1,300 @@
+package datastores
+
+import (
+	"database/sql"
+
+	"github.com/doug-martin/goqu/v9"
+	"github.com/jmoiron/sqlx"
+	"github.com/sirupsen/logrus"
+	"github.com/tbellembois/gochimitheque/logger"
+	"github.com/tbellembois/gochimitheque/models"
+)
+
+// Roles permissions are expanded for their assignees
+// by the effectivepermission view.
+
+// GetRoles returns the roles with their permissions.
+func (db *SQLiteDataStore) GetRoles() ([]models.Role, error) {
+	var (
+		err   error
+		roles []models.Role
+	)
+
+	if err = db.Select(&roles, `SELECT role_id, role_name, role_requiretotp FROM role ORDER BY role_name`); err != nil {
+		return nil, err
+	}
+
+	for i := range roles {
+		if roles[i].RolePermissions, err = db.getRolePermissions(roles[i].RoleID); err != nil {
+			return nil, err
+		}
+	}
+
+	return roles, nil
+}
+
+// GetRole returns the role with the given id and its permissions.
+func (db *SQLiteDataStore) GetRole(id int) (models.Role, error) {
+	var (
+		err  error
+		role models.Role
+	)
+
+	logger.Log.WithFields(logrus.Fields{"id": id}).Debug("GetRole")
+
+	if err = db.Get(&role, `SELECT role_id, role_name, role_requiretotp FROM role WHERE role_id = ?`, id); err != nil {
+		return models.Role{}, err
+	}
+
+	if role.RolePermissions, err = db.getRolePermissions(id); err != nil {
+		return models.Role{}, err
+	}
+
+	return role, nil
+}
+
+func (db *SQLiteDataStore) getRolePermissions(id int) ([]*models.RolePermission, error) {
+	var (
+		err             error
+		rolepermissions []*models.RolePermission
+	)
+
+	sqlr := `SELECT rolepermission_perm_name, rolepermission_item_name FROM rolepermission
+	WHERE role = ? ORDER BY rolepermission_item_name`
+	if err = db.Select(&rolepermissions, sqlr, id); err != nil {
+		return nil, err
+	}
+
+	return rolepermissions, nil
+}
+
+// CreateRole creates the role r and its permissions.
+func (db *SQLiteDataStore) CreateRole(r models.Role) (lastInsertID int64, err error) {
+	var tx *sqlx.Tx
+
+	logger.Log.WithFields(logrus.Fields{"r": r}).Debug("CreateRole")
+
+	if tx, err = db.Beginx(); err != nil {
+		return
+	}
+
+	defer func() {
+		if err != nil {
+			logger.Log.Error(err)
+
+			if rbErr := tx.Rollback(); rbErr != nil {
+				logger.Log.Error(rbErr)
+				err = rbErr
+			}
+
+			return
+		}
+
+		err = tx.Commit()
+	}()
+
+	dialect := goqu.Dialect("sqlite3")
+
+	var (
+		sqlr string
+		args []interface{}
+		res  sql.Result
+	)
+
+	if sqlr, args, err = dialect.Insert(goqu.T("role")).Rows(
+		goqu.Record{
+			"role_name":        r.RoleName,
+			"role_requiretotp": r.RoleRequireTOTP,
+		},
+	).ToSQL(); err != nil {
+		return
+	}
+
+	if res, err = tx.Exec(sqlr, args...); err != nil {
+		return
+	}
+
+	if lastInsertID, err = res.LastInsertId(); err != nil {
+		return
+	}
+
+	r.RoleID = int(lastInsertID)
+
+	err = db.insertRolePermissions(r, tx)
+
+	return
+}
+
+// UpdateRole renames the role r and replaces its permissions,
+// the change applies to every person the role is assigned to.
+func (db *SQLiteDataStore) UpdateRole(r models.Role) (err error) {
+	var tx *sqlx.Tx
+
+	logger.Log.WithFields(logrus.Fields{"r": r}).Debug("UpdateRole")
+
+	if tx, err = db.Beginx(); err != nil {
+		return
+	}
+
+	defer func() {
+		if err != nil {
+			logger.Log.Error(err)
+
+			if rbErr := tx.Rollback(); rbErr != nil {
+				logger.Log.Error(rbErr)
+				err = rbErr
+			}
+
+			return
+		}
+
+		err = tx.Commit()
+	}()
+
+	if _, err = tx.Exec(`UPDATE role SET role_name = ?, role_requiretotp = ? WHERE role_id = ?`, r.RoleName, r.RoleRequireTOTP, r.RoleID); err != nil {
+		return
+	}
+
+	// Lazily deleting former permissions.
+	if _, err = tx.Exec(`DELETE FROM rolepermission WHERE role = ?`, r.RoleID); err != nil {
+		return
+	}
+
+	err = db.insertRolePermissions(r, tx)
+
+	return
+}
+
+// DeleteRole deletes the role with the given id
+// and unassigns it.
+func (db *SQLiteDataStore) DeleteRole(id int) (err error) {
+	var tx *sqlx.Tx
+
+	logger.Log.WithFields(logrus.Fields{"id": id}).Debug("DeleteRole")
+
+	if tx, err = db.Beginx(); err != nil {
+		return
+	}
+
+	defer func() {
+		if err != nil {
+			logger.Log.Error(err)
+
+			if rbErr := tx.Rollback(); rbErr != nil {
+				logger.Log.Error(rbErr)
+				err = rbErr
+			}
+
+			return
+		}
+
+		err = tx.Commit()
+	}()
+
+	for _, sqlr := range []string{
+		`DELETE FROM personrole WHERE role = ?`,
+		`DELETE FROM rolepermission WHERE role = ?`,
+		`DELETE FROM role WHERE role_id = ?`,
+	} {
+		if _, err = tx.Exec(sqlr, id); err != nil {
+			return
+		}
+	}
+
+	return
+}
+
+// GetRolePeople returns the ids of the people
+// the role with the given id is assigned to.
+func (db *SQLiteDataStore) GetRolePeople(id int) ([]int, error) {
+	var (
+		err error
+		ids []int
+	)
+
+	if err = db.Select(&ids, `SELECT DISTINCT person FROM personrole WHERE role = ?`, id); err != nil {
+		return nil, err
+	}
+
+	return ids, nil
+}
+
+// GetPersonRoles returns the roles assigned to the person with the given id.
+func (db *SQLiteDataStore) GetPersonRoles(id int) ([]models.PersonRole, error) {
+	var (
+		err         error
+		personroles []models.PersonRole
+	)
+
+	sqlr := `SELECT personrole.personrole_entity_id,
+	role.role_id AS "role.role_id",
+	role.role_name AS "role.role_name",
+	role.role_requiretotp AS "role.role_requiretotp"
+	FROM personrole
+	JOIN role ON personrole.role = role.role_id
+	WHERE personrole.person = ?
+	ORDER BY role.role_name, personrole.personrole_entity_id`
+	if err = db.Select(&personroles, sqlr, id); err != nil {
+		return nil, err
+	}
+
+	return personroles, nil
+}
+
+func (db *SQLiteDataStore) insertRolePermissions(r models.Role, tx *sqlx.Tx) error {
+	var (
+		sqlr string
+		args []interface{}
+		err  error
+	)
+
+	dialect := goqu.Dialect("sqlite3")
+
+	for _, rp := range r.RolePermissions {
+		if sqlr, args, err = dialect.Insert(goqu.T("rolepermission")).Rows(
+			goqu.Record{
+				"role":                     r.RoleID,
+				"rolepermission_perm_name": rp.RolePermissionPermName,
+				"rolepermission_item_name": rp.RolePermissionItemName,
+			},
+		).OnConflict(goqu.DoNothing()).ToSQL(); err != nil {
+			return err
+		}
+
+		if _, err = tx.Exec(sqlr, args...); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// insertPersonRoles assigns the p roles,
+// the former assignments must have been deleted.
+func (db *SQLiteDataStore) insertPersonRoles(p models.Person, tx *sqlx.Tx) error {
+	var (
+		sqlr string
+		args []interface{}
+		err  error
+	)
+
+	dialect := goqu.Dialect("sqlite3")
+
+	for _, pr := range p.Roles {
+		if sqlr, args, err = dialect.Insert(goqu.T("personrole")).Rows(
+			goqu.Record{
+				"person":               p.PersonID,
+				"role":                 pr.RoleID,
+				"personrole_entity_id": pr.PersonRoleEntityID,
+			},
+		).OnConflict(goqu.DoNothing()).ToSQL(); err != nil {
+			return err
+		}
+
+		if _, err = tx.Exec(sqlr, args...); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
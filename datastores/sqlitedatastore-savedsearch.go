@@ -0,0 +1,194 @@
+package datastores
+
+import (
+	"database/sql"
+
+	"github.com/doug-martin/goqu/v9"
+	"github.com/sirupsen/logrus"
+	"github.com/tbellembois/gochimitheque/logger"
+	"github.com/tbellembois/gochimitheque/models"
+)
+
+func savedSearchesQuery() *goqu.SelectDataset {
+	dialect := goqu.Dialect("sqlite3")
+	tableSavedSearch := goqu.T("savedsearch")
+
+	return dialect.From(tableSavedSearch.As("s")).Join(
+		goqu.T("person"),
+		goqu.On(goqu.Ex{
+			"s.person": goqu.I("person.person_id"),
+		}),
+	).Select(
+		goqu.I("s.savedsearch_id"),
+		goqu.I("s.savedsearch_name"),
+		goqu.I("s.savedsearch_query"),
+		goqu.I("s.savedsearch_subscribed"),
+		goqu.I("s.savedsearch_lastproduct_id"),
+		goqu.I("s.savedsearch_laststorage_id"),
+		goqu.I("person.person_id").As(goqu.C("person.person_id")),
+		goqu.I("person.person_email").As(goqu.C("person.person_email")),
+	).Order(goqu.I("s.savedsearch_name").Asc())
+}
+
+// GetSavedSearches returns the saved searches of the person with the given id.
+func (db *SQLiteDataStore) GetSavedSearches(personID int) ([]models.SavedSearch, error) {
+	var (
+		err           error
+		sqlr          string
+		args          []interface{}
+		savedsearches []models.SavedSearch
+	)
+
+	logger.Log.WithFields(logrus.Fields{"personID": personID}).Debug("GetSavedSearches")
+
+	if sqlr, args, err = savedSearchesQuery().Where(goqu.I("s.person").Eq(personID)).ToSQL(); err != nil {
+		return nil, err
+	}
+
+	if err = db.Select(&savedsearches, sqlr, args...); err != nil {
+		return nil, err
+	}
+
+	return savedsearches, nil
+}
+
+// GetSubscribedSavedSearches returns the saved searches subscribed by their owner.
+func (db *SQLiteDataStore) GetSubscribedSavedSearches() ([]models.SavedSearch, error) {
+	var (
+		err           error
+		sqlr          string
+		args          []interface{}
+		savedsearches []models.SavedSearch
+	)
+
+	if sqlr, args, err = savedSearchesQuery().Where(goqu.I("s.savedsearch_subscribed").IsTrue()).ToSQL(); err != nil {
+		return nil, err
+	}
+
+	if err = db.Select(&savedsearches, sqlr, args...); err != nil {
+		return nil, err
+	}
+
+	return savedsearches, nil
+}
+
+// GetSavedSearch returns the saved search with the given id.
+func (db *SQLiteDataStore) GetSavedSearch(id int) (models.SavedSearch, error) {
+	var (
+		err         error
+		sqlr        string
+		args        []interface{}
+		savedsearch models.SavedSearch
+	)
+
+	if sqlr, args, err = savedSearchesQuery().Where(goqu.I("s.savedsearch_id").Eq(id)).ToSQL(); err != nil {
+		return models.SavedSearch{}, err
+	}
+
+	if err = db.Get(&savedsearch, sqlr, args...); err != nil {
+		return models.SavedSearch{}, err
+	}
+
+	return savedsearch, nil
+}
+
+// CreateSavedSearch creates the saved search s.
+// Only the products and storages created afterwards
+// will be notified to the subscribers.
+func (db *SQLiteDataStore) CreateSavedSearch(s models.SavedSearch) (lastInsertID int64, err error) {
+	var (
+		sqlr          string
+		args          []interface{}
+		res           sql.Result
+		lastProductID int64
+		lastStorageID int64
+	)
+
+	if lastProductID, lastStorageID, err = db.GetLastProductAndStorageIDs(); err != nil {
+		return
+	}
+
+	dialect := goqu.Dialect("sqlite3")
+	tableSavedSearch := goqu.T("savedsearch")
+
+	iQuery := dialect.Insert(tableSavedSearch).Rows(
+		goqu.Record{
+			"savedsearch_name":           s.SavedSearchName,
+			"savedsearch_query":          s.SavedSearchQuery,
+			"savedsearch_subscribed":     s.SavedSearchSubscribed,
+			"savedsearch_lastproduct_id": lastProductID,
+			"savedsearch_laststorage_id": lastStorageID,
+			"person":                     s.PersonID,
+		},
+	)
+
+	if sqlr, args, err = iQuery.ToSQL(); err != nil {
+		return
+	}
+
+	if res, err = db.Exec(sqlr, args...); err != nil {
+		return
+	}
+
+	return res.LastInsertId()
+}
+
+// UpdateSavedSearch updates the name, query and subscription of the saved search s.
+func (db *SQLiteDataStore) UpdateSavedSearch(s models.SavedSearch) error {
+	var (
+		err  error
+		sqlr string
+		args []interface{}
+	)
+
+	dialect := goqu.Dialect("sqlite3")
+	tableSavedSearch := goqu.T("savedsearch")
+
+	uQuery := dialect.Update(tableSavedSearch).Set(
+		goqu.Record{
+			"savedsearch_name":       s.SavedSearchName,
+			"savedsearch_query":      s.SavedSearchQuery,
+			"savedsearch_subscribed": s.SavedSearchSubscribed,
+		},
+	).Where(goqu.I("savedsearch_id").Eq(s.SavedSearchID.Int64))
+
+	if sqlr, args, err = uQuery.ToSQL(); err != nil {
+		return err
+	}
+
+	_, err = db.Exec(sqlr, args...)
+
+	return err
+}
+
+// UpdateSavedSearchLastIDs sets the last product and storage ids notified
+// for the saved search with the given id.
+func (db *SQLiteDataStore) UpdateSavedSearchLastIDs(id int, lastProductID, lastStorageID int64) error {
+	sqlr := `UPDATE savedsearch SET savedsearch_lastproduct_id = ?, savedsearch_laststorage_id = ? WHERE savedsearch_id = ?`
+	_, err := db.Exec(sqlr, lastProductID, lastStorageID, id)
+
+	return err
+}
+
+// DeleteSavedSearch deletes the saved search with the given id.
+func (db *SQLiteDataStore) DeleteSavedSearch(id int) error {
+	sqlr := `DELETE FROM savedsearch WHERE savedsearch_id = ?`
+	_, err := db.Exec(sqlr, id)
+
+	return err
+}
+
+// GetLastProductAndStorageIDs returns the greatest product and storage ids.
+func (db *SQLiteDataStore) GetLastProductAndStorageIDs() (lastProductID int64, lastStorageID int64, err error) {
+	var p, s sql.NullInt64
+
+	if err = db.Get(&p, `SELECT MAX(product_id) FROM product`); err != nil {
+		return
+	}
+
+	if err = db.Get(&s, `SELECT MAX(storage_id) FROM storage`); err != nil {
+		return
+	}
+
+	return p.Int64, s.Int64, nil
+}
@@ -6,6 +6,7 @@ import (
 	"strings"
 
 	"github.com/doug-martin/goqu/v9"
+	"github.com/doug-martin/goqu/v9/exp"
 	"github.com/jmoiron/sqlx"
 	"github.com/sirupsen/logrus"
 	"github.com/tbellembois/gochimitheque/logger"
@@ -33,6 +34,24 @@ func GetByMany[T models.Searchable](searchable T, db *sqlx.DB, filter *request.F
 	).Where(
 		goqu.I(searchable.GetTextFieldName()).Like(filter.Search),
 	)
+	orderClause := []exp.OrderedExpression{
+		goqu.L(fmt.Sprintf("INSTR(%s, ?)", searchable.GetTextFieldName()), exactSearch).Asc(),
+		goqu.C(searchable.GetTextFieldName()).Asc(),
+	}
+
+	// Full text search, most relevant first.
+	if fts, ok := any(searchable).(models.FullTextSearchable); ok && fts5 && ftsQuery(filter.Search) != "" {
+		joinClause = dialect.From(
+			searchable.GetTableName(),
+		).Join(
+			goqu.L(fmt.Sprintf("(SELECT rowid AS fts_id, rank AS fts_rank FROM %[1]s WHERE %[1]s MATCH ?)", fts.GetFTSTableName()), ftsQuery(filter.Search)).As("fts"),
+			goqu.On(goqu.I("fts.fts_id").Eq(goqu.I(searchable.GetIDFieldName()))),
+		)
+		orderClause = []exp.OrderedExpression{
+			goqu.I("fts.fts_rank").Asc(),
+			goqu.C(searchable.GetTextFieldName()).Asc(),
+		}
+	}
 
 	if countSQL, countArgs, err = joinClause.Select(
 		goqu.COUNT(goqu.I(searchable.GetIDFieldName()).Distinct()),
@@ -41,10 +60,9 @@ func GetByMany[T models.Searchable](searchable T, db *sqlx.DB, filter *request.F
 	}
 
 	if selectSQL, selectArgs, err = joinClause.Select(
-		goqu.I("*"),
+		goqu.T(searchable.GetTableName()).All(),
 	).Order(
-		goqu.L(fmt.Sprintf("INSTR(%s, ?)", searchable.GetTextFieldName()), exactSearch).Asc(),
-		goqu.C(searchable.GetTextFieldName()).Asc(),
+		orderClause...,
 	).Limit(
 		uint(filter.Limit),
 	).Offset(
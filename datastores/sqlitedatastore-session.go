@@ -0,0 +1,129 @@
+package datastores
+
+import (
+	"time"
+
+	"github.com/doug-martin/goqu/v9"
+	"github.com/sirupsen/logrus"
+	"github.com/tbellembois/gochimitheque/logger"
+	"github.com/tbellembois/gochimitheque/models"
+)
+
+func sessionsQuery() *goqu.SelectDataset {
+	dialect := goqu.Dialect("sqlite3")
+	tableSession := goqu.T("session")
+
+	return dialect.From(tableSession.As("s")).Join(
+		goqu.T("person"),
+		goqu.On(goqu.Ex{
+			"s.person": goqu.I("person.person_id"),
+		}),
+	).Select(
+		goqu.I("s.session_id"),
+		goqu.I("s.session_uid"),
+		goqu.I("s.session_refreshhash"),
+		goqu.I("s.session_creationdate"),
+		goqu.I("s.session_lastseendate"),
+		goqu.I("s.session_expirationdate"),
+		goqu.I("s.session_useragent"),
+		goqu.I("s.session_ip"),
+		goqu.I("person.person_id").As(goqu.C("person.person_id")),
+		goqu.I("person.person_email").As(goqu.C("person.person_email")),
+	).Order(goqu.I("s.session_lastseendate").Desc())
+}
+
+// GetPersonSessions returns the sessions of the person with the given id.
+func (db *SQLiteDataStore) GetPersonSessions(personID int) ([]models.Session, error) {
+	var (
+		err      error
+		sqlr     string
+		args     []interface{}
+		sessions []models.Session
+	)
+
+	logger.Log.WithFields(logrus.Fields{"personID": personID}).Debug("GetPersonSessions")
+
+	if sqlr, args, err = sessionsQuery().Where(goqu.I("s.person").Eq(personID)).ToSQL(); err != nil {
+		return nil, err
+	}
+
+	if err = db.Select(&sessions, sqlr, args...); err != nil {
+		return nil, err
+	}
+
+	return sessions, nil
+}
+
+// GetSession returns the session with the given uid.
+func (db *SQLiteDataStore) GetSession(uid string) (models.Session, error) {
+	var (
+		err     error
+		sqlr    string
+		args    []interface{}
+		session models.Session
+	)
+
+	if sqlr, args, err = sessionsQuery().Where(goqu.I("s.session_uid").Eq(uid)).ToSQL(); err != nil {
+		return models.Session{}, err
+	}
+
+	if err = db.Get(&session, sqlr, args...); err != nil {
+		return models.Session{}, err
+	}
+
+	return session, nil
+}
+
+// CreateSession creates the session s.
+func (db *SQLiteDataStore) CreateSession(s models.Session) (int64, error) {
+	sqlr := `INSERT INTO session(session_uid, session_refreshhash, session_creationdate, session_lastseendate, session_expirationdate, session_useragent, session_ip, person)
+	VALUES (?, ?, ?, ?, ?, ?, ?, ?)`
+
+	res, err := db.Exec(sqlr,
+		s.SessionUID,
+		s.SessionRefreshHash,
+		s.SessionCreationDate.UTC(),
+		s.SessionLastSeenDate.UTC(),
+		s.SessionExpirationDate.UTC(),
+		s.SessionUserAgent,
+		s.SessionIP,
+		s.PersonID)
+	if err != nil {
+		return 0, err
+	}
+
+	return res.LastInsertId()
+}
+
+// RefreshSession sets the refresh token secret hash, last seen and expiration dates
+// of the session with the given uid.
+func (db *SQLiteDataStore) RefreshSession(uid string, refreshHash string, lastSeen time.Time, expiration time.Time) error {
+	sqlr := `UPDATE session SET session_refreshhash = ?, session_lastseendate = ?, session_expirationdate = ? WHERE session_uid = ?`
+	_, err := db.Exec(sqlr, refreshHash, lastSeen.UTC(), expiration.UTC(), uid)
+
+	return err
+}
+
+// DeleteSession deletes the session with the given id.
+func (db *SQLiteDataStore) DeleteSession(id int) error {
+	sqlr := `DELETE FROM session WHERE session_id = ?`
+	_, err := db.Exec(sqlr, id)
+
+	return err
+}
+
+// DeletePersonSessions deletes the sessions of the person with the given id.
+func (db *SQLiteDataStore) DeletePersonSessions(personID int) error {
+	sqlr := `DELETE FROM session WHERE person = ?`
+	_, err := db.Exec(sqlr, personID)
+
+	return err
+}
+
+// DeleteExpiredSessions deletes the sessions that can not be refreshed anymore.
+func (db *SQLiteDataStore) DeleteExpiredSessions() error {
+	sqlr := `DELETE FROM session WHERE session_expirationdate < ?`
+	_, err := db.Exec(sqlr, time.Now().UTC())
+
+	return err
+}
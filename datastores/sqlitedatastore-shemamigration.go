@@ -1,6 +1,6 @@
 package datastores
 
-var versionToMigration = []string{migrationOne, migrationTwo, migrationThree, migrationFour, migrationFive, migrationSix, migrationSeven, migrationEight}
+var versionToMigration = []string{migrationOne, migrationTwo, migrationThree, migrationFour, migrationFive, migrationSix, migrationSeven, migrationEight, migrationNine, migrationTen, migrationEleven, migrationTwelve, migrationThirteen, migrationFourteen, migrationFifteen, migrationSixteen, migrationSeventeen, migrationEighteen, migrationNineteen, migrationTwenty, migrationTwentyOne, migrationTwentyTwo, migrationTwentyThree, migrationTwentyFour, migrationTwentyFive, migrationTwentySix}
 
 var migrationOne = `BEGIN TRANSACTION;
 
@@ -525,3 +525,484 @@ INSERT INTO hazardstatement (hazardstatement_label, hazardstatement_reference) V
 PRAGMA user_version=8;
 COMMIT;
 PRAGMA foreign_keys=on;`
+
+var migrationNine = `PRAGMA foreign_keys=off;
+
+BEGIN TRANSACTION;
+
+CREATE TABLE IF NOT EXISTS adrclass (
+	adrclass_id integer PRIMARY KEY,
+	adrclass_label string NOT NULL UNIQUE,
+	adrclass_description string);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_adrclass ON adrclass(adrclass_label);
+
+INSERT INTO adrclass (adrclass_label, adrclass_description) VALUES ('1', 'Explosive substances and articles');
+INSERT INTO adrclass (adrclass_label, adrclass_description) VALUES ('2', 'Gases');
+INSERT INTO adrclass (adrclass_label, adrclass_description) VALUES ('3', 'Flammable liquids');
+INSERT INTO adrclass (adrclass_label, adrclass_description) VALUES ('4.1', 'Flammable solids, self-reactive substances, polymerizing substances and solid desensitized explosives');
+INSERT INTO adrclass (adrclass_label, adrclass_description) VALUES ('4.2', 'Substances liable to spontaneous combustion');
+INSERT INTO adrclass (adrclass_label, adrclass_description) VALUES ('4.3', 'Substances which, in contact with water, emit flammable gases');
+INSERT INTO adrclass (adrclass_label, adrclass_description) VALUES ('5.1', 'Oxidizing substances');
+INSERT INTO adrclass (adrclass_label, adrclass_description) VALUES ('5.2', 'Organic peroxides');
+INSERT INTO adrclass (adrclass_label, adrclass_description) VALUES ('6.1', 'Toxic substances');
+INSERT INTO adrclass (adrclass_label, adrclass_description) VALUES ('6.2', 'Infectious substances');
+INSERT INTO adrclass (adrclass_label, adrclass_description) VALUES ('7', 'Radioactive material');
+INSERT INTO adrclass (adrclass_label, adrclass_description) VALUES ('8', 'Corrosive substances');
+INSERT INTO adrclass (adrclass_label, adrclass_description) VALUES ('9', 'Miscellaneous dangerous substances and articles');
+
+ALTER TABLE product ADD product_un_number string;
+ALTER TABLE product ADD product_packing_group string;
+ALTER TABLE product ADD product_hazard_labels string;
+ALTER TABLE product ADD product_transport_category integer;
+ALTER TABLE product ADD adrclass integer REFERENCES adrclass(adrclass_id);
+
+PRAGMA user_version=9;
+COMMIT;
+PRAGMA foreign_keys=on;`
+
+var migrationTen = `PRAGMA foreign_keys=off;
+
+BEGIN TRANSACTION;
+
+-- the products and names full text search indexes are created
+-- by the datastore when SQLite has the FTS5 extension
+
+PRAGMA user_version=10;
+COMMIT;
+PRAGMA foreign_keys=on;`
+
+var migrationEleven = `PRAGMA foreign_keys=off;
+
+BEGIN TRANSACTION;
+
+CREATE TABLE IF NOT EXISTS savedsearch (
+	savedsearch_id integer PRIMARY KEY,
+	savedsearch_name string NOT NULL,
+	savedsearch_query string NOT NULL,
+	savedsearch_subscribed boolean default 0,
+	savedsearch_lastproduct_id integer NOT NULL default 0,
+	savedsearch_laststorage_id integer NOT NULL default 0,
+	person integer NOT NULL,
+	FOREIGN KEY(person) references person(person_id));
+CREATE UNIQUE INDEX IF NOT EXISTS idx_savedsearch ON savedsearch(person, savedsearch_name);
+
+PRAGMA user_version=11;
+COMMIT;
+PRAGMA foreign_keys=on;`
+
+var migrationTwelve = `PRAGMA foreign_keys=off;
+
+BEGIN TRANSACTION;
+
+-- multi-tenant mode: NULL = shared catalog, else the owner entity
+ALTER TABLE product ADD product_tenant integer REFERENCES entity(entity_id);
+ALTER TABLE supplier ADD supplier_tenant integer REFERENCES entity(entity_id);
+ALTER TABLE producer ADD producer_tenant integer REFERENCES entity(entity_id);
+
+PRAGMA user_version=12;
+COMMIT;
+PRAGMA foreign_keys=on;`
+
+var migrationThirteen = `PRAGMA foreign_keys=off;
+
+BEGIN TRANSACTION;
+
+-- named roles, sets of item/perm pairs assigned to people for an entity
+CREATE TABLE IF NOT EXISTS role (
+	role_id integer PRIMARY KEY,
+	role_name string NOT NULL);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_role ON role(role_name);
+
+CREATE TABLE IF NOT EXISTS rolepermission (
+	role integer NOT NULL,
+	rolepermission_perm_name string NOT NULL,
+	rolepermission_item_name string NOT NULL,
+	PRIMARY KEY(role, rolepermission_item_name, rolepermission_perm_name),
+	FOREIGN KEY(role) references role(role_id));
+
+CREATE TABLE IF NOT EXISTS personrole (
+	person integer NOT NULL,
+	role integer NOT NULL,
+	personrole_entity_id integer NOT NULL,
+	PRIMARY KEY(person, role, personrole_entity_id),
+	FOREIGN KEY(person) references person(person_id),
+	FOREIGN KEY(role) references role(role_id));
+CREATE INDEX IF NOT EXISTS idx_personrole_role ON personrole(role);
+
+-- permissions of the people and permissions of their roles,
+-- product permissions are not for a given entity
+CREATE VIEW IF NOT EXISTS effectivepermission AS
+SELECT person,
+	permission_perm_name,
+	permission_item_name,
+	permission_entity_id
+FROM permission
+UNION
+SELECT personrole.person,
+	rolepermission.rolepermission_perm_name,
+	rolepermission.rolepermission_item_name,
+	CASE WHEN rolepermission.rolepermission_item_name IN ('products', 'rproducts') THEN -1 ELSE personrole.personrole_entity_id END
+FROM personrole
+JOIN rolepermission ON rolepermission.role = personrole.role;
+
+PRAGMA user_version=13;
+COMMIT;
+PRAGMA foreign_keys=on;`
+
+var migrationFourteen = `PRAGMA foreign_keys=off;
+
+BEGIN TRANSACTION;
+
+-- members of all the entities, including the future ones
+ALTER TABLE person ADD person_allentities boolean NOT NULL DEFAULT 0;
+
+CREATE VIEW IF NOT EXISTS effectivepersonentities AS
+SELECT personentities_person_id,
+	personentities_entity_id
+FROM personentities
+UNION
+SELECT person.person_id,
+	entity.entity_id
+FROM person, entity
+WHERE person.person_allentities = 1;
+
+-- the members of all the entities can see all the entities
+DROP VIEW IF EXISTS effectivepermission;
+CREATE VIEW effectivepermission AS
+SELECT person,
+	permission_perm_name,
+	permission_item_name,
+	permission_entity_id
+FROM permission
+UNION
+SELECT personrole.person,
+	rolepermission.rolepermission_perm_name,
+	rolepermission.rolepermission_item_name,
+	CASE WHEN rolepermission.rolepermission_item_name IN ('products', 'rproducts') THEN -1 ELSE personrole.personrole_entity_id END
+FROM personrole
+JOIN rolepermission ON rolepermission.role = personrole.role
+UNION
+SELECT person_id,
+	'r',
+	'entities',
+	-1
+FROM person
+WHERE person_allentities = 1;
+
+PRAGMA user_version=14;
+COMMIT;
+PRAGMA foreign_keys=on;`
+
+var migrationFifteen = `PRAGMA foreign_keys=off;
+
+BEGIN TRANSACTION;
+
+-- server side sessions, the refresh token secret is stored hashed
+CREATE TABLE IF NOT EXISTS session (
+	session_id integer PRIMARY KEY,
+	session_uid string NOT NULL,
+	session_refreshhash string NOT NULL,
+	session_creationdate datetime NOT NULL,
+	session_lastseendate datetime NOT NULL,
+	session_expirationdate datetime NOT NULL,
+	session_useragent string NOT NULL DEFAULT '',
+	session_ip string NOT NULL DEFAULT '',
+	person integer NOT NULL,
+	FOREIGN KEY(person) references person(person_id));
+CREATE UNIQUE INDEX IF NOT EXISTS idx_session_uid ON session(session_uid);
+CREATE INDEX IF NOT EXISTS idx_session_person ON session(person);
+
+PRAGMA user_version=15;
+COMMIT;
+PRAGMA foreign_keys=on;`
+
+var migrationSixteen = `BEGIN TRANSACTION;
+
+-- failed authentications per account (kind email) and per client ip (kind ip)
+CREATE TABLE IF NOT EXISTS loginfailure (
+	loginfailure_kind string NOT NULL,
+	loginfailure_value string NOT NULL,
+	loginfailure_count integer NOT NULL DEFAULT 0,
+	loginfailure_lastdate datetime NOT NULL,
+	loginfailure_lockeduntil datetime,
+	PRIMARY KEY(loginfailure_kind, loginfailure_value));
+
+-- security events, people are referenced by email to keep the events of deleted people
+CREATE TABLE IF NOT EXISTS auditlog (
+	auditlog_id integer PRIMARY KEY,
+	auditlog_date datetime NOT NULL,
+	auditlog_event string NOT NULL,
+	auditlog_personemail string NOT NULL DEFAULT '',
+	auditlog_ip string NOT NULL DEFAULT '',
+	auditlog_details string NOT NULL DEFAULT '',
+	auditlog_author string NOT NULL DEFAULT '');
+CREATE INDEX IF NOT EXISTS idx_auditlog_date ON auditlog(auditlog_date);
+
+PRAGMA user_version=16;
+COMMIT;`
+
+var migrationSeventeen = `PRAGMA foreign_keys=off;
+
+BEGIN TRANSACTION;
+
+-- TOTP second factor, pending until the first code is validated
+CREATE TABLE IF NOT EXISTS persontotp (
+	person integer PRIMARY KEY,
+	persontotp_secret string NOT NULL,
+	persontotp_enabled boolean NOT NULL DEFAULT 0,
+	persontotp_laststep integer NOT NULL DEFAULT 0,
+	FOREIGN KEY(person) references person(person_id));
+
+-- single use recovery codes, stored hashed
+CREATE TABLE IF NOT EXISTS totprecoverycode (
+	totprecoverycode_id integer PRIMARY KEY,
+	totprecoverycode_hash string NOT NULL,
+	person integer NOT NULL,
+	FOREIGN KEY(person) references person(person_id));
+CREATE INDEX IF NOT EXISTS idx_totprecoverycode_person ON totprecoverycode(person);
+
+-- the people with the role must use a second factor
+ALTER TABLE role ADD role_requiretotp boolean NOT NULL DEFAULT 0;
+
+PRAGMA user_version=17;
+COMMIT;
+PRAGMA foreign_keys=on;`
+
+var migrationEighteen = `PRAGMA foreign_keys=off;
+
+BEGIN TRANSACTION;
+
+-- single use password reset links, the token is stored hashed
+CREATE TABLE IF NOT EXISTS passwordreset (
+	passwordreset_id integer PRIMARY KEY,
+	passwordreset_hash string NOT NULL,
+	passwordreset_expirationdate datetime NOT NULL,
+	person integer NOT NULL,
+	FOREIGN KEY(person) references person(person_id));
+CREATE UNIQUE INDEX IF NOT EXISTS idx_passwordreset_hash ON passwordreset(passwordreset_hash);
+
+PRAGMA user_version=18;
+COMMIT;
+PRAGMA foreign_keys=on;`
+
+var migrationNineteen = `PRAGMA foreign_keys=off;
+
+BEGIN TRANSACTION;
+
+-- revocable login tokens of the people devices, the token secret is stored hashed
+CREATE TABLE IF NOT EXISTS devicetoken (
+	devicetoken_id integer PRIMARY KEY,
+	devicetoken_uid string NOT NULL,
+	devicetoken_hash string NOT NULL,
+	devicetoken_name string NOT NULL DEFAULT '',
+	devicetoken_creationdate datetime NOT NULL,
+	devicetoken_expirationdate datetime NOT NULL,
+	devicetoken_lastuseddate datetime,
+	person integer NOT NULL,
+	FOREIGN KEY(person) references person(person_id));
+CREATE UNIQUE INDEX IF NOT EXISTS idx_devicetoken_uid ON devicetoken(devicetoken_uid);
+CREATE INDEX IF NOT EXISTS idx_devicetoken_person ON devicetoken(person);
+
+-- removing the keys of the former encrypted password QR codes
+ALTER TABLE person DROP COLUMN person_aeskey;
+
+PRAGMA user_version=19;
+COMMIT;
+PRAGMA foreign_keys=on;`
+
+var migrationTwenty = `PRAGMA foreign_keys=off;
+
+BEGIN TRANSACTION;
+
+-- the storage an aliquot has been split from
+ALTER TABLE storage ADD storage_parent integer REFERENCES storage(storage_id);
+CREATE INDEX IF NOT EXISTS idx_storage_parent ON storage(storage_parent);
+
+PRAGMA user_version=20;
+COMMIT;
+PRAGMA foreign_keys=on;`
+
+var migrationTwentyOne = `PRAGMA foreign_keys=off;
+
+BEGIN TRANSACTION;
+
+-- solutions prepared from source storages, the prepared storage holds
+-- the final volume and concentration
+CREATE TABLE IF NOT EXISTS preparation (
+	preparation_id integer PRIMARY KEY,
+	preparation_date datetime NOT NULL,
+	preparation_solvent string NOT NULL DEFAULT '',
+	preparation_comment string,
+	person integer NOT NULL,
+	storage integer NOT NULL,
+	FOREIGN KEY(person) references person(person_id),
+	FOREIGN KEY(storage) references storage(storage_id));
+CREATE UNIQUE INDEX IF NOT EXISTS idx_preparation_storage ON preparation(storage);
+
+-- the sources are also described by value to keep the traceability of deleted storages
+CREATE TABLE IF NOT EXISTS preparationsource (
+	preparationsource_id integer PRIMARY KEY,
+	preparationsource_quantity float NOT NULL,
+	preparationsource_unit string NOT NULL DEFAULT '',
+	preparationsource_barecode string NOT NULL DEFAULT '',
+	preparationsource_batchnumber string NOT NULL DEFAULT '',
+	preparationsource_productname string NOT NULL DEFAULT '',
+	preparation integer NOT NULL,
+	storage integer,
+	product integer,
+	FOREIGN KEY(preparation) references preparation(preparation_id),
+	FOREIGN KEY(storage) references storage(storage_id),
+	FOREIGN KEY(product) references product(product_id));
+CREATE INDEX IF NOT EXISTS idx_preparationsource_preparation ON preparationsource(preparation);
+CREATE INDEX IF NOT EXISTS idx_preparationsource_storage ON preparationsource(storage);
+
+PRAGMA user_version=21;
+COMMIT;
+PRAGMA foreign_keys=on;`
+
+var migrationTwentyTwo = `PRAGMA foreign_keys=off;
+
+BEGIN TRANSACTION;
+
+-- supplier batch recalls, the recalled storages reference their recall
+CREATE TABLE IF NOT EXISTS recall (
+	recall_id integer PRIMARY KEY,
+	recall_date datetime NOT NULL,
+	recall_batchnumber string NOT NULL,
+	recall_comment string,
+	person integer NOT NULL,
+	product integer,
+	supplier integer,
+	FOREIGN KEY(person) references person(person_id),
+	FOREIGN KEY(product) references product(product_id),
+	FOREIGN KEY(supplier) references supplier(supplier_id));
+
+ALTER TABLE storage ADD storage_recall integer REFERENCES recall(recall_id);
+CREATE INDEX IF NOT EXISTS idx_storage_recall ON storage(storage_recall);
+
+-- acknowledgement of the recall by the managers of the entities of the recalled storages
+CREATE TABLE IF NOT EXISTS recallacknowledgement (
+	recallacknowledgement_date datetime,
+	recall integer NOT NULL,
+	entity integer NOT NULL,
+	person integer NOT NULL,
+	PRIMARY KEY(recall, entity, person),
+	FOREIGN KEY(recall) references recall(recall_id),
+	FOREIGN KEY(entity) references entity(entity_id),
+	FOREIGN KEY(person) references person(person_id));
+CREATE INDEX IF NOT EXISTS idx_recallacknowledgement_person ON recallacknowledgement(person);
+
+PRAGMA user_version=22;
+COMMIT;
+PRAGMA foreign_keys=on;`
+
+var migrationTwentyThree = `PRAGMA foreign_keys=off;
+
+BEGIN TRANSACTION;
+
+-- products merged into another one, the merged product is described by value as it is deleted
+CREATE TABLE IF NOT EXISTS productmerge (
+	productmerge_id integer PRIMARY KEY,
+	productmerge_date datetime NOT NULL,
+	productmerge_mergedid integer NOT NULL,
+	productmerge_mergedname string NOT NULL DEFAULT '',
+	productmerge_mergedcasnumber string NOT NULL DEFAULT '',
+	productmerge_mergedspecificity string NOT NULL DEFAULT '',
+	productmerge_mergedstoragecount integer NOT NULL DEFAULT 0,
+	person integer NOT NULL,
+	product integer,
+	FOREIGN KEY(person) references person(person_id),
+	FOREIGN KEY(product) references product(product_id));
+CREATE INDEX IF NOT EXISTS idx_productmerge_product ON productmerge(product);
+
+PRAGMA user_version=23;
+COMMIT;
+PRAGMA foreign_keys=on;`
+
+var migrationTwentyFour = `PRAGMA foreign_keys=off;
+
+BEGIN TRANSACTION;
+
+-- physical properties for the units conversions
+ALTER TABLE product ADD product_density real;
+ALTER TABLE product ADD product_molarmass real;
+
+-- multipliers to the reference unit
+UPDATE unit SET unit_multiplier=0.1 WHERE unit_label='dm';
+UPDATE unit SET unit_multiplier=0.01 WHERE unit_label='cm';
+
+INSERT OR IGNORE INTO unit (unit_label, unit_multiplier, unit_type) VALUES ('M', 1, 'concentration');
+UPDATE unit SET unit=(SELECT unit_id FROM unit WHERE unit_label='M'), unit_multiplier=0.001 WHERE unit_label='mM';
+UPDATE unit SET unit=(SELECT unit_id FROM unit WHERE unit_label='M'), unit_multiplier=0.000001 WHERE unit_label='µM';
+UPDATE unit SET unit=(SELECT unit_id FROM unit WHERE unit_label='M'), unit_multiplier=0.000000001 WHERE unit_label='nM';
+
+UPDATE unit SET unit=NULL, unit_multiplier=1 WHERE unit_label='g/L';
+UPDATE unit SET unit=(SELECT unit_id FROM unit WHERE unit_label='g/L'), unit_multiplier=0.001 WHERE unit_label='mg/L';
+UPDATE unit SET unit=(SELECT unit_id FROM unit WHERE unit_label='g/L'), unit_multiplier=0.000001 WHERE unit_label='µg/L';
+UPDATE unit SET unit=(SELECT unit_id FROM unit WHERE unit_label='g/L'), unit_multiplier=0.000000001 WHERE unit_label='ng/L';
+
+-- amount of substance
+INSERT OR IGNORE INTO unit (unit_label, unit_multiplier, unit_type) VALUES ('mol', 1, 'quantity'), ('mmol', 0.001, 'quantity'), ('µmol', 0.000001, 'quantity');
+UPDATE unit SET unit=(SELECT unit_id FROM unit WHERE unit_label='mol') WHERE unit_label IN ('mmol', 'µmol');
+
+PRAGMA user_version=24;
+COMMIT;
+PRAGMA foreign_keys=on;`
+
+var migrationTwentyFive = `PRAGMA foreign_keys=off;
+
+BEGIN TRANSACTION;
+
+-- chemical structure identifiers
+ALTER TABLE product ADD product_smiles string;
+ALTER TABLE product ADD product_canonicalsmiles string;
+ALTER TABLE product ADD product_inchi string;
+ALTER TABLE product ADD product_inchikey string;
+CREATE INDEX IF NOT EXISTS idx_product_canonicalsmiles ON product(product_canonicalsmiles);
+CREATE INDEX IF NOT EXISTS idx_product_inchikey ON product(product_inchikey);
+
+PRAGMA user_version=25;
+COMMIT;
+PRAGMA foreign_keys=on;`
+
+var migrationTwentySix = `PRAGMA foreign_keys=off;
+
+BEGIN TRANSACTION;
+
+-- regulatory classification of the controlled substances
+ALTER TABLE product ADD product_regulation string;
+
+-- append-only controlled substances register, entity, storage, product
+-- and person are copied to outlive their deletion
+CREATE TABLE IF NOT EXISTS controlledregister (
+	controlledregister_id integer PRIMARY KEY,
+	controlledregister_sequence integer NOT NULL,
+	controlledregister_date datetime NOT NULL,
+	controlledregister_event string NOT NULL,
+	controlledregister_entity integer NOT NULL,
+	controlledregister_entityname string NOT NULL,
+	controlledregister_storage integer NOT NULL,
+	controlledregister_barecode string,
+	controlledregister_product integer NOT NULL,
+	controlledregister_productname string NOT NULL,
+	controlledregister_regulation string NOT NULL,
+	controlledregister_quantity real NOT NULL,
+	controlledregister_unit string NOT NULL,
+	controlledregister_balance real NOT NULL,
+	controlledregister_personemail string NOT NULL,
+	controlledregister_previoushash string NOT NULL,
+	controlledregister_hash string NOT NULL);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_controlledregister_sequence ON controlledregister(controlledregister_entity, controlledregister_sequence);
+CREATE INDEX IF NOT EXISTS idx_controlledregister_storage ON controlledregister(controlledregister_storage);
+CREATE TRIGGER IF NOT EXISTS controlledregister_noupdate BEFORE UPDATE ON controlledregister
+BEGIN
+	SELECT RAISE(ABORT, 'the controlled substances register is append-only');
+END;
+CREATE TRIGGER IF NOT EXISTS controlledregister_nodelete BEFORE DELETE ON controlledregister
+BEGIN
+	SELECT RAISE(ABORT, 'the controlled substances register is append-only');
+END;
+
+PRAGMA user_version=26;
+COMMIT;
+PRAGMA foreign_keys=on;`
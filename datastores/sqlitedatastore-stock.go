@@ -10,6 +10,7 @@ import (
 	"github.com/tbellembois/gochimitheque/logger"
 	"github.com/tbellembois/gochimitheque/models"
 	"github.com/tbellembois/gochimitheque/request"
+	"github.com/tbellembois/gochimitheque/units"
 )
 
 type SyncStoreLocation struct {
@@ -192,6 +193,103 @@ func (db *SQLiteDataStore) computeStockStorelocation(p models.Product, s *SyncSt
 	return currentStock
 }
 
+// computeStockStorelocationConverted returns the quantity of product p in the store location s and its children
+// converted into the unit u, and the number of storages which quantity could not be converted.
+func (db *SQLiteDataStore) computeStockStorelocationConverted(p models.Product, s *SyncStoreLocation, u models.Unit, us map[int64]units.Unit, mu *sync.Mutex) (float64, int) {
+	var (
+		err                   error
+		currentStock          float64
+		totalStock            float64
+		unconverted           int
+		storelocationChildren []models.StoreLocation
+		sqlr                  string
+		args                  []interface{}
+	)
+
+	dialect := goqu.Dialect("sqlite3")
+	t := goqu.T("storage")
+
+	// Getting the store location storages quantities.
+	sQuery := dialect.From(t).Where(
+		goqu.I("storage.storelocation").Eq(s.Storelocation.StoreLocationID.Int64),
+		goqu.I("storage.storage").IsNull(),
+		goqu.I("storage.storage_quantity").IsNotNull(),
+		goqu.I("storage.unit_quantity").IsNotNull(),
+		goqu.I("storage.storage_archive").IsFalse(),
+		goqu.I("storage.product").Eq(p.ProductID),
+	).Select(
+		goqu.I("storage.storage_quantity"),
+		goqu.I("storage.unit_quantity"),
+	)
+
+	if sqlr, args, err = sQuery.ToSQL(); err != nil {
+		logger.Log.Error(err)
+		return 0, 0
+	}
+
+	var quantities []struct {
+		Quantity float64 `db:"storage_quantity"`
+		Unit     int64   `db:"unit_quantity"`
+	}
+
+	mu.Lock()
+	if err = db.Select(&quantities, sqlr, args...); err != nil {
+		logger.Log.Error(err)
+		mu.Unlock()
+		return 0, 0
+	}
+	mu.Unlock()
+
+	to := us[u.UnitID.Int64]
+
+	for _, q := range quantities {
+		var c float64
+
+		if c, err = units.Convert(q.Quantity, us[q.Unit], to, productSubstance(p)); err != nil {
+			unconverted++
+			continue
+		}
+
+		currentStock += c
+	}
+
+	// totalStock is initialized with currentStock
+	// and increased later while processing the children.
+	totalStock = currentStock
+
+	logger.Log.WithFields(logrus.Fields{
+		"p.ProductID":         p.ProductID,
+		"s.StoreLocationName": s.Storelocation.StoreLocationName,
+		"currentStock":        currentStock,
+		"unconverted":         unconverted,
+	}).Debug("computeStockStorelocationConverted")
+
+	mu.Lock()
+	if storelocationChildren, err = db.GetStoreLocationChildren(int(s.Storelocation.StoreLocationID.Int64)); err != nil {
+		logger.Log.Error(err)
+		mu.Unlock()
+		return 0, 0
+	}
+	mu.Unlock()
+
+	for i := range storelocationChildren {
+		s.Storelocation.Children = append(s.Storelocation.Children, &storelocationChildren[i])
+
+		childStock, childUnconverted := db.computeStockStorelocationConverted(p, &SyncStoreLocation{
+			Storelocation: &storelocationChildren[i],
+		}, u, us, mu)
+
+		totalStock += childStock
+		unconverted += childUnconverted
+	}
+
+	s.mu.Lock()
+	s.Storelocation.Stocks = append(s.Storelocation.Stocks, models.Stock{Total: totalStock, Current: currentStock, Unit: u, Unconverted: unconverted})
+	s.mu.Unlock()
+
+	return totalStock, unconverted
+}
+
 // computeStockStorelocationNoUnit returns the quantity of product p with no unit in the store location s.
 func (db *SQLiteDataStore) computeStockStorelocationNoUnit(p models.Product, s *SyncStoreLocation, mu *sync.Mutex) float64 {
 	var (
@@ -302,11 +400,14 @@ func (db *SQLiteDataStore) computeStockStorelocationNoUnit(p models.Product, s *
 }
 
 // ComputeStockEntity returns the root store locations of the entity(ies) of the loggued user.
-// Each store location has a Stocks []models.Stock field containing the stocks of the product p for each unit.
+// Each store location has a Stocks []models.Stock field containing the stocks of the product p for each unit,
+// or for the "unit" request parameter unit only, the quantities of the other units being converted into it.
 func (db *SQLiteDataStore) ComputeStockEntity(p models.Product, r *http.Request) []models.StoreLocation {
 
 	var (
-		units              []models.Unit // reference units
+		refunits           []models.Unit // reference units
+		us                 map[int64]units.Unit
+		convertUnit        *models.Unit // requested unit
 		syncstorelocations []SyncStoreLocation
 		entities           []models.Entity
 		eids               []int
@@ -350,11 +451,30 @@ func (db *SQLiteDataStore) ComputeStockEntity(p models.Product, r *http.Request)
 		return []models.StoreLocation{}
 	}
 
-	if err = db.Select(&units, sqlr, args...); err != nil {
+	if err = db.Select(&refunits, sqlr, args...); err != nil {
 		logger.Log.Error(err)
 		return []models.StoreLocation{}
 	}
 
+	// Converting the quantities into the requested unit.
+	if filter.Unit != -1 {
+		if us, err = db.GetConversionUnits(); err != nil {
+			logger.Log.Error(err)
+			return []models.StoreLocation{}
+		}
+
+		u, ok := us[int64(filter.Unit)]
+		if !ok {
+			logger.Log.Errorf("unknown unit %d", filter.Unit)
+			return []models.StoreLocation{}
+		}
+
+		convertUnit = &models.Unit{
+			UnitID:    sql.NullInt64{Int64: int64(filter.Unit), Valid: true},
+			UnitLabel: sql.NullString{String: u.Label, Valid: true},
+		}
+	}
+
 	// Getting the root store locations.
 	t = goqu.T("storelocation")
 	sQuery := dialect.From(t).Where(
@@ -389,13 +509,24 @@ func (db *SQLiteDataStore) ComputeStockEntity(p models.Product, r *http.Request)
 
 	// Computing stocks for storages with units.
 	for i := range syncstorelocations {
-		for j := range units {
+		if convertUnit != nil {
+			wg.Add(1)
+
+			go func(sl *SyncStoreLocation) {
+				db.computeStockStorelocationConverted(p, sl, *convertUnit, us, mu)
+				wg.Done()
+			}(&syncstorelocations[i])
+
+			continue
+		}
+
+		for j := range refunits {
 			wg.Add(1)
 
 			go func(u models.Unit, sl *SyncStoreLocation) {
 				db.computeStockStorelocation(p, sl, u, mu)
 				wg.Done()
-			}(units[j], &syncstorelocations[i])
+			}(refunits[j], &syncstorelocations[i])
 		}
 	}
 	// Computing stocks for storages without units.
@@ -122,6 +122,11 @@ func (db *SQLiteDataStore) GetStorages(f request.Filter) ([]models.Storage, int,
 		snstmt                                    *sqlx.NamedStmt
 		err                                       error
 		isadmin                                   bool
+		querySQL                                  string
+		queryArgs                                 map[string]interface{}
+		fts                                       string
+		searchSQL                                 string
+		searchArgs                                map[string]interface{}
 	)
 
 	logger.Log.WithFields(logrus.Fields{"f": f}).Debug("GetStorages")
@@ -160,6 +165,8 @@ func (db *SQLiteDataStore) GetStorages(f request.Filter) ([]models.Storage, int,
 		s.storage_number_of_carton,
 		s.storage_number_of_bag,
 		s.storage_number_of_unit,
+		s.storage_parent,
+		s.storage_recall,
 		storage.storage_id AS "storage.storage_id",
 		uq.unit_id AS "unit_quantity.unit_id",
 		uq.unit_label AS "unit_quantity.unit_label",
@@ -173,6 +180,8 @@ func (db *SQLiteDataStore) GetStorages(f request.Filter) ([]models.Storage, int,
 		product.product_specificity AS "product.product_specificity",
 		product.product_number_per_carton AS "product.product_number_per_carton",
 		product.product_number_per_bag AS "product.product_number_per_bag",
+		product.product_density AS "product.product_density",
+		product.product_molarmass AS "product.product_molarmass",
         producerref.producerref_id AS "product.producerref.producerref_id",
 		producerref.producerref_label AS "product.producerref.producerref_label",
 		name.name_id AS "product.name.name_id",
@@ -262,12 +271,12 @@ func (db *SQLiteDataStore) GetStorages(f request.Filter) ([]models.Storage, int,
 
 	// filter by entities
 	if !isadmin {
-		comreq.WriteString(` JOIN personentities ON (personentities_entity_id = storelocation.entity AND personentities_person_id = :personid)`)
+		comreq.WriteString(` JOIN effectivepersonentities ON (personentities_entity_id = storelocation.entity AND personentities_person_id = :personid)`)
 	}
 
 	// filter by permissions
-	comreq.WriteString(` JOIN permission AS perm, entity as e ON
-	perm.person = :personid and (perm.permission_item_name in ("all", "storages")) and (perm.permission_perm_name in ("all", "r", "w")) and (perm.permission_entity_id in (-1, e.entity_id))
+	comreq.WriteString(` JOIN effectivepermission AS perm, entity as e ON
+	perm.person = :personid and (perm.permission_item_name in ("all", "storages")) and (perm.permission_perm_name in ("all", "r", "b", "w")) and (perm.permission_entity_id in (-1, e.entity_id))
 	`)
 	comreq.WriteString(" WHERE 1")
 	if len(f.Ids) > 0 {
@@ -380,6 +389,31 @@ func (db *SQLiteDataStore) GetStorages(f request.Filter) ([]models.Storage, int,
 		comreq.WriteString(" AND signalword.signalword_id = :signalword")
 	}
 
+	// full text search
+	if fts = ftsQuery(f.Search); fts != "" {
+		if fts5 {
+			comreq.WriteString(" AND s.product IN (SELECT rowid FROM productfts WHERE productfts MATCH :fts)")
+		} else {
+			searchSQL, searchArgs = productSearchSQL(f.Search)
+			comreq.WriteString(" AND s.product IN (" + searchSQL + ")")
+		}
+	}
+
+	// advanced search query
+	if f.Query != nil {
+		if querySQL, queryArgs, err = storageQuerySQL(f.Query); err != nil {
+			return nil, 0, err
+		}
+
+		comreq.WriteString(" AND s.storage_id IN (" + querySQL + ")")
+	}
+
+	// multi-tenant mode: storages of shared products
+	// or of products of the storage entity only
+	if db.multiTenant && !isadmin {
+		comreq.WriteString(" AND (product.product_tenant IS NULL OR product.product_tenant = storelocation.entity)")
+	}
+
 	// show bio/chem/consu
 	switch {
 	case !f.ShowChem && !f.ShowBio && f.ShowConsu:
@@ -421,6 +455,7 @@ func (db *SQLiteDataStore) GetStorages(f request.Filter) ([]models.Storage, int,
 	m := map[string]interface{}{
 		"ids":                 f.Ids,
 		"search":              f.Search,
+		"fts":                 fts,
 		"personid":            f.LoggedPersonID,
 		"order":               f.Order,
 		"limit":               f.Limit,
@@ -440,6 +475,13 @@ func (db *SQLiteDataStore) GetStorages(f request.Filter) ([]models.Storage, int,
 		"category":            f.Category,
 	}
 
+	for k, v := range queryArgs {
+		m[k] = v
+	}
+	for k, v := range searchArgs {
+		m[k] = v
+	}
+
 	logger.Log.Debug(presreq.String() + comreq.String() + postsreq.String())
 	logger.Log.Debug(m)
 
@@ -465,6 +507,15 @@ func (db *SQLiteDataStore) GetStorages(f request.Filter) ([]models.Storage, int,
 		}
 	}
 
+	//
+	// converting the quantities into the requested unit
+	//
+	if f.Unit != -1 {
+		if err = db.convertStorages(storages, f.Unit); err != nil {
+			return nil, 0, err
+		}
+	}
+
 	//
 	// getting number of history for each storage
 	//
@@ -617,6 +668,8 @@ func (db *SQLiteDataStore) GetStorage(id int) (models.Storage, error) {
 	storage.storage_number_of_carton,
 	storage.storage_number_of_bag,
 	storage.storage_number_of_unit,
+	storage.storage_parent,
+	storage.storage_recall,
 	uq.unit_id AS "unit_quantity.unit_id",
 	uq.unit_label AS "unit_quantity.unit_label",
 	uc.unit_id AS "unit_concentration.unit_id",
@@ -629,6 +682,8 @@ func (db *SQLiteDataStore) GetStorage(id int) (models.Storage, error) {
 	name.name_label AS "product.name.name_label",
 	product.product_id AS "product.product_id",
 	product.product_number_per_carton AS "product.product_number_per_carton",
+	product.product_density AS "product.product_density",
+	product.product_molarmass AS "product.product_molarmass",
 	producerref.producerref_id AS "product.producerref.producerref_id",
 	casnumber.casnumber_id AS "product.casnumber.casnumber_id",
 	casnumber.casnumber_label AS "product.casnumber.casnumber_label",
@@ -691,95 +746,146 @@ func (db *SQLiteDataStore) GetStorageEntity(id int) (models.Entity, error) {
 }
 
 // DeleteStorage deletes the storages with the given id.
-func (db *SQLiteDataStore) DeleteStorage(id int) error {
+// The deletion is recorded as a destruction by the person personID
+// in the controlled substances register.
+func (db *SQLiteDataStore) DeleteStorage(id int, personID int) (err error) {
 	logger.Log.WithFields(logrus.Fields{"id": id}).Debug("DeleteStorage")
 
 	var (
-		sqlr string
-		err  error
+		sqlr      string
+		productID int
+		tx        *sql.Tx
 	)
 
+	if tx, err = db.Begin(); err != nil {
+		return err
+	}
+
+	defer func() {
+		if err != nil {
+			logger.Log.Error(err)
+			if rbErr := tx.Rollback(); rbErr != nil {
+				logger.Log.Error(rbErr)
+				err = rbErr
+
+				return
+			}
+
+			return
+		}
+
+		err = commitAuthorizationChange(tx)
+	}()
+
 	// Delete history first.
 	sqlr = `DELETE FROM storage 
 	WHERE storage = ?`
-	if _, err = db.Exec(sqlr, id); err != nil {
+	if _, err = tx.Exec(sqlr, id); err != nil {
 		return err
 	}
 
-	sqlr = `DELETE FROM storage 
-	WHERE storage_id = ?`
-	if _, err = db.Exec(sqlr, id); err != nil {
+	// Keep the aliquots split from the storage.
+	sqlr = `UPDATE storage SET storage_parent = NULL 
+	WHERE storage_parent = ?`
+	if _, err = tx.Exec(sqlr, id); err != nil {
 		return err
 	}
 
-	return nil
-}
+	// Delete the preparation of the storage, keeping the preparations it has been used for.
+	sqlr = `DELETE FROM preparationsource 
+	WHERE preparation IN (SELECT preparation_id FROM preparation WHERE storage = ?)`
+	if _, err = tx.Exec(sqlr, id); err != nil {
+		return err
+	}
 
-// ArchiveStorage archives the storages with the given id.
-func (db *SQLiteDataStore) ArchiveStorage(id int) error {
-	var (
-		sqlr string
-		err  error
-	)
+	sqlr = `DELETE FROM preparation 
+	WHERE storage = ?`
+	if _, err = tx.Exec(sqlr, id); err != nil {
+		return err
+	}
 
-	sqlr = `UPDATE storage SET storage_archive = true 
-	WHERE storage_id = ?`
+	sqlr = `UPDATE preparationsource SET storage = NULL 
+	WHERE storage = ?`
+	if _, err = tx.Exec(sqlr, id); err != nil {
+		return err
+	}
 
-	if _, err = db.Exec(sqlr, id); err != nil {
+	// Get the product before deleting the storage.
+	if err = tx.QueryRow(`SELECT product FROM storage WHERE storage_id = ?`, id).Scan(&productID); err != nil {
 		return err
 	}
 
-	sqlr = `UPDATE storage SET storage_archive = true 
-	WHERE storage.storage = ?`
+	sqlr = `DELETE FROM storage 
+	WHERE storage_id = ?`
+	if _, err = tx.Exec(sqlr, id); err != nil {
+		return err
+	}
 
-	if _, err = db.Exec(sqlr, id); err != nil {
+	if err = updateProductFTS(tx, productID); err != nil {
 		return err
 	}
 
-	return nil
+	return registerStorage(tx, int64(id), models.RegisterDestruction, personID)
+}
+
+// ArchiveStorage archives the storages with the given id.
+func (db *SQLiteDataStore) ArchiveStorage(id int, personID int) error {
+	return db.setStorageArchive(id, true, models.RegisterArchive, personID)
 }
 
 // RestoreStorage restores (unarchive) the storages with the given id.
-func (db *SQLiteDataStore) RestoreStorage(id int) error {
+func (db *SQLiteDataStore) RestoreStorage(id int, personID int) error {
+	return db.setStorageArchive(id, false, models.RegisterRestore, personID)
+}
+
+// setStorageArchive archives or restores the storage with the given id and its history,
+// recording the event by the person personID in the controlled substances register.
+func (db *SQLiteDataStore) setStorageArchive(id int, archive bool, event string, personID int) (err error) {
 	var (
 		sqlr string
-		err  error
+		tx   *sql.Tx
 	)
 
-	sqlr = `UPDATE storage SET storage_archive = false 
+	if tx, err = db.Begin(); err != nil {
+		return err
+	}
+
+	defer func() {
+		if err != nil {
+			logger.Log.Error(err)
+			if rbErr := tx.Rollback(); rbErr != nil {
+				logger.Log.Error(rbErr)
+				err = rbErr
+
+				return
+			}
+
+			return
+		}
+
+		err = tx.Commit()
+	}()
+
+	sqlr = `UPDATE storage SET storage_archive = ? 
 	WHERE storage_id = ?`
 
-	if _, err = db.Exec(sqlr, id); err != nil {
+	if _, err = tx.Exec(sqlr, archive, id); err != nil {
 		return err
 	}
 
-	sqlr = `UPDATE storage SET storage_archive = false 
+	sqlr = `UPDATE storage SET storage_archive = ? 
 	WHERE storage.storage = ?`
 
-	if _, err = db.Exec(sqlr, id); err != nil {
+	if _, err = tx.Exec(sqlr, archive, id); err != nil {
 		return err
 	}
 
-	return nil
+	return registerStorage(tx, int64(id), event, personID)
 }
 
 // CreateStorage creates a new storage.
 func (db *SQLiteDataStore) CreateUpdateStorage(s models.Storage, itemNumber int, update bool) (lastInsertID int64, err error) {
-	var (
-		v            driver.Value
-		tx           *sql.Tx
-		sqlr         string
-		res          sql.Result
-		args         []interface{}
-		prefix       string
-		major, minor string
-	)
-
-	// Default major.
-	major = strconv.Itoa(s.ProductID)
-
-	dialect := goqu.Dialect("sqlite3")
-	tableStorage := goqu.T("storage")
+	var tx *sql.Tx
 
 	if tx, err = db.Begin(); err != nil {
 		return 0, err
@@ -798,59 +904,43 @@ func (db *SQLiteDataStore) CreateUpdateStorage(s models.Storage, itemNumber int,
 			return
 		}
 
-		err = tx.Commit()
+		err = commitAuthorizationChange(tx)
 	}()
 
+	if lastInsertID, err = db.createUpdateStorage(tx, s, itemNumber, update); err != nil {
+		return
+	}
+
+	// registering the storage of a classified product
+	if update {
+		err = registerStorage(tx, s.StorageID.Int64, "", s.PersonID)
+	} else {
+		err = registerStorage(tx, lastInsertID, models.RegisterAcquisition, s.PersonID)
+	}
+
+	return
+}
+
+// createUpdateStorage insert/update the storage s in the transaction tx.
+func (db *SQLiteDataStore) createUpdateStorage(tx *sql.Tx, s models.Storage, itemNumber int, update bool) (lastInsertID int64, err error) {
+	var (
+		v            driver.Value
+		sqlr         string
+		res          sql.Result
+		args         []interface{}
+		prefix       string
+		major, minor string
+	)
+
+	// Default major.
+	major = strconv.Itoa(s.ProductID)
+
+	dialect := goqu.Dialect("sqlite3")
+	tableStorage := goqu.T("storage")
+
 	if update {
 		// create an history of the storage
-		sqlr = `INSERT into storage (storage_creationdate, 
-		storage_modificationdate,
-		storage_entrydate, 
-		storage_exitdate, 
-		storage_openingdate, 
-		storage_expirationdate,
-		storage_comment,
-		storage_reference,
-		storage_batchnumber,
-		storage_quantity,
-		storage_barecode,
-		storage_todestroy,
-		storage_archive,
-		storage_concentration,
-		storage_number_of_unit,
-		storage_number_of_bag,
-		storage_number_of_carton,
-		person,
-		product,
-		storelocation,
-		unit_quantity,
-		unit_concentration,
-		supplier,
-		storage) select storage_creationdate, 
-				storage_modificationdate,
-				storage_entrydate, 
-				storage_exitdate, 
-				storage_openingdate, 
-				storage_expirationdate,
-				storage_comment,
-				storage_reference,
-				storage_batchnumber,
-				storage_quantity,
-				storage_barecode,
-				storage_todestroy,
-				storage_archive,
-				storage_concentration,
-				storage_number_of_unit,
-				storage_number_of_bag,
-				storage_number_of_carton,
-				person,
-				product,
-				storelocation,
-				unit_quantity,
-				unit_concentration,
-				supplier,
-				? FROM storage WHERE storage_id = ?`
-		if _, err = tx.Exec(sqlr, s.StorageID, s.StorageID); err != nil {
+		if err = createStorageHistory(tx, s.StorageID.Int64); err != nil {
 			return
 		}
 	}
@@ -954,8 +1044,16 @@ func (db *SQLiteDataStore) CreateUpdateStorage(s models.Storage, itemNumber int,
 
 	// if SupplierID = -1 then it is a new supplier
 	if v, err = s.Supplier.SupplierID.Value(); s.Supplier.SupplierID.Valid && err == nil && v.(int64) == -1 {
-		sqlr = `INSERT INTO supplier (supplier_label) VALUES (?)`
-		if res, err = tx.Exec(sqlr, s.Supplier.SupplierLabel); err != nil {
+		if db.multiTenant {
+			// the new supplier belongs to the storage entity
+			sqlr = `INSERT INTO supplier (supplier_label, supplier_tenant) VALUES (?, (SELECT entity FROM storelocation WHERE storelocation_id = ?))`
+			res, err = tx.Exec(sqlr, s.Supplier.SupplierLabel, s.StoreLocationID.Int64)
+		} else {
+			sqlr = `INSERT INTO supplier (supplier_label) VALUES (?)`
+			res, err = tx.Exec(sqlr, s.Supplier.SupplierLabel)
+		}
+
+		if err != nil {
 			return
 		}
 		// getting the last inserted id
@@ -1122,11 +1220,75 @@ func (db *SQLiteDataStore) CreateUpdateStorage(s models.Storage, itemNumber int,
 
 	s.StorageID = sql.NullInt64{Valid: true, Int64: lastInsertID}
 
+	// updating the product full text search index
+	if err = updateProductFTS(tx, s.ProductID); err != nil {
+		return
+	}
+
 	logger.Log.WithFields(logrus.Fields{"s": s}).Debug("CreateUpdateStorage")
 
 	return
 }
 
+// createStorageHistory inserts a copy of the storage with the given id
+// referencing it as an history entry.
+func createStorageHistory(tx *sql.Tx, id int64) error {
+	sqlr := `INSERT into storage (storage_creationdate, 
+		storage_modificationdate,
+		storage_entrydate, 
+		storage_exitdate, 
+		storage_openingdate, 
+		storage_expirationdate,
+		storage_comment,
+		storage_reference,
+		storage_batchnumber,
+		storage_quantity,
+		storage_barecode,
+		storage_todestroy,
+		storage_archive,
+		storage_concentration,
+		storage_number_of_unit,
+		storage_number_of_bag,
+		storage_number_of_carton,
+		person,
+		product,
+		storelocation,
+		unit_quantity,
+		unit_concentration,
+		supplier,
+		storage_parent,
+		storage_recall,
+		storage) select storage_creationdate, 
+				storage_modificationdate,
+				storage_entrydate, 
+				storage_exitdate, 
+				storage_openingdate, 
+				storage_expirationdate,
+				storage_comment,
+				storage_reference,
+				storage_batchnumber,
+				storage_quantity,
+				storage_barecode,
+				storage_todestroy,
+				storage_archive,
+				storage_concentration,
+				storage_number_of_unit,
+				storage_number_of_bag,
+				storage_number_of_carton,
+				person,
+				product,
+				storelocation,
+				unit_quantity,
+				unit_concentration,
+				supplier,
+				storage_parent,
+				storage_recall,
+				? FROM storage WHERE storage_id = ?`
+	_, err := tx.Exec(sqlr, id, id)
+
+	return err
+}
+
 // UpdateAllQRCodes updates the storages QRCodes.
 func (db *SQLiteDataStore) UpdateAllQRCodes() error {
 	var (
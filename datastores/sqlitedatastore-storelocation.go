@@ -95,12 +95,12 @@ func (db *SQLiteDataStore) GetStoreLocations(f request.Filter) ([]models.StoreLo
 		goqu.T("storelocation"),
 		goqu.On(goqu.Ex{"s.storelocation": goqu.I("storelocation.storelocation_id")}),
 	).Join(
-		goqu.T("permission").As("perm"),
+		goqu.T("effectivepermission").As("perm"),
 		goqu.On(
 			goqu.Ex{
 				"perm.person":               f.LoggedPersonID,
 				"perm.permission_item_name": []string{"all", "storages"},
-				"perm.permission_perm_name": []string{"r", "w", "all"},
+				"perm.permission_perm_name": []string{"r", "b", "w", "all"},
 				"perm.permission_entity_id": []interface{}{-1, goqu.I("entity.entity_id")},
 			},
 		),
@@ -286,6 +286,8 @@ func (db *SQLiteDataStore) DeleteStoreLocation(id int) error {
 		return err
 	}
 
+	authorizationChanged()
+
 	return nil
 }
 
@@ -314,7 +316,7 @@ func (db *SQLiteDataStore) CreateStoreLocation(s models.StoreLocation) (lastInse
 			return
 		}
 
-		err = tx.Commit()
+		err = commitAuthorizationChange(tx)
 	}()
 
 	s.StoreLocationFullPath = db.buildFullPath(s, tx)
@@ -377,7 +379,7 @@ func (db *SQLiteDataStore) UpdateStoreLocation(s models.StoreLocation) (err erro
 			return
 		}
 
-		err = tx.Commit()
+		err = commitAuthorizationChange(tx)
 	}()
 
 	s.StoreLocationFullPath = db.buildFullPath(s, tx)
@@ -18,10 +18,15 @@ func (db *SQLiteDataStore) GetSuppliers(f request.Filter) ([]models.Supplier, in
 		count                            int
 		exactSearch, countSQL, selectSQL string
 		countArgs, selectArgs            []interface{}
+		tenantRestricted                 bool
 	)
 
 	logger.Log.WithFields(logrus.Fields{"f": f}).Debug("GetSuppliers")
 
+	if tenantRestricted, err = db.isTenantRestricted(f.LoggedPersonID); err != nil {
+		return nil, 0, err
+	}
+
 	exactSearch = f.Search
 	exactSearch = strings.TrimPrefix(exactSearch, "%")
 	exactSearch = strings.TrimSuffix(exactSearch, "%")
@@ -36,6 +41,10 @@ func (db *SQLiteDataStore) GetSuppliers(f request.Filter) ([]models.Supplier, in
 		goqu.I("supplier_label").Like(f.Search),
 	)
 
+	if tenantRestricted {
+		joinClause = joinClause.Where(tenantExpression("supplier_tenant", f.LoggedPersonID))
+	}
+
 	if countSQL, countArgs, err = joinClause.Select(
 		goqu.COUNT(goqu.I("supplier_id").Distinct()),
 	).ToSQL(); err != nil {
@@ -44,6 +53,7 @@ func (db *SQLiteDataStore) GetSuppliers(f request.Filter) ([]models.Supplier, in
 	if selectSQL, selectArgs, err = joinClause.Select(
 		goqu.I("supplier_id"),
 		goqu.I("supplier_label"),
+		goqu.I("supplier_tenant"),
 	).Order(
 		goqu.L("INSTR(supplier_label, ?)", exactSearch).Asc(),
 		goqu.C("supplier_label").Asc(),
@@ -197,7 +207,8 @@ func (db *SQLiteDataStore) CreateSupplier(s models.Supplier) (lastInsertID int64
 
 	iQuery := dialect.Insert(tableSupplier).Rows(
 		goqu.Record{
-			"supplier_label": s.SupplierLabel,
+			"supplier_label":  s.SupplierLabel,
+			"supplier_tenant": s.SupplierTenant,
 		},
 	)
 
@@ -223,10 +234,15 @@ func (db *SQLiteDataStore) GetSupplierRefs(f request.Filter) ([]models.SupplierR
 		count                            int
 		exactSearch, countSQL, selectSQL string
 		countArgs, selectArgs            []interface{}
+		tenantRestricted                 bool
 	)
 
 	logger.Log.WithFields(logrus.Fields{"f": f}).Debug("GetSupplierRefs")
 
+	if tenantRestricted, err = db.isTenantRestricted(f.LoggedPersonID); err != nil {
+		return nil, 0, err
+	}
+
 	if f.OrderBy == "" {
 		f.OrderBy = "supplierref_id"
 	}
@@ -245,6 +261,9 @@ func (db *SQLiteDataStore) GetSupplierRefs(f request.Filter) ([]models.SupplierR
 	if f.Supplier != -1 {
 		whereAnd = append(whereAnd, goqu.I("supplierref.supplier").Eq(f.Supplier))
 	}
+	if tenantRestricted {
+		whereAnd = append(whereAnd, tenantExpression("supplier.supplier_tenant", f.LoggedPersonID))
+	}
 
 	joinClause := dialect.From(
 		supplierrefTable,
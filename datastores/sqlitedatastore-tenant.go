@@ -0,0 +1,173 @@
+package datastores
+
+import (
+	"database/sql"
+	"fmt"
+
+	"github.com/doug-martin/goqu/v9"
+	"github.com/doug-martin/goqu/v9/exp"
+	"github.com/jmoiron/sqlx"
+	"github.com/sirupsen/logrus"
+	"github.com/tbellembois/gochimitheque/logger"
+)
+
+// In multi-tenant mode each entity is a tenant.
+// Product cards, suppliers and producers with a NULL tenant belong to the shared catalog
+// and are visible to everybody, the others are only visible to the members
+// of their tenant entity and to the admins.
+
+// SetMultiTenant enables or disables the multi-tenant mode.
+func (db *SQLiteDataStore) SetMultiTenant(multiTenant bool) {
+	db.multiTenant = multiTenant
+}
+
+// IsMultiTenant returns true if the multi-tenant mode is enabled.
+func (db *SQLiteDataStore) IsMultiTenant() bool {
+	return db.multiTenant
+}
+
+// tenantSQL returns a condition on the tenant column matching the shared catalog
+// and the entities of the person with the :personid named parameter.
+func tenantSQL(column string) string {
+	return fmt.Sprintf("(%[1]s IS NULL OR %[1]s IN (SELECT personentities_entity_id FROM effectivepersonentities WHERE personentities_person_id = :personid))", column)
+}
+
+// tenantExpression is the goqu counterpart of tenantSQL.
+func tenantExpression(column string, personID int) exp.Expression {
+	dialect := goqu.Dialect("sqlite3")
+
+	return goqu.Or(
+		goqu.I(column).IsNull(),
+		goqu.I(column).In(
+			dialect.From(goqu.T("effectivepersonentities")).Select(
+				goqu.I("personentities_entity_id"),
+			).Where(
+				goqu.I("personentities_person_id").Eq(personID),
+			),
+		),
+	)
+}
+
+// isTenantRestricted returns true if the person with the given id
+// only sees the cards of the shared catalog and of its entities.
+func (db *SQLiteDataStore) isTenantRestricted(personID int) (bool, error) {
+	if !db.multiTenant {
+		return false, nil
+	}
+
+	isadmin, err := db.IsPersonAdmin(personID)
+
+	return !isadmin, err
+}
+
+// GetProductTenant returns the tenant of the product with the given id.
+func (db *SQLiteDataStore) GetProductTenant(id int) (sql.NullInt64, error) {
+	var (
+		err    error
+		tenant sql.NullInt64
+	)
+
+	if err = db.Get(&tenant, `SELECT product_tenant FROM product WHERE product_id = ?`, id); err != nil {
+		return sql.NullInt64{}, err
+	}
+
+	return tenant, nil
+}
+
+// GetPersonDefaultTenant returns the tenant of the cards created by the person
+// with the given id ie. its first entity.
+func (db *SQLiteDataStore) GetPersonDefaultTenant(personID int) (sql.NullInt64, error) {
+	var (
+		err    error
+		tenant sql.NullInt64
+	)
+
+	sqlr := `SELECT MIN(personentities_entity_id) FROM personentities WHERE personentities_person_id = ?`
+	if err = db.Get(&tenant, sqlr, personID); err != nil {
+		return sql.NullInt64{}, err
+	}
+
+	return tenant, nil
+}
+
+// HasEntityTenantCards returns true if the entity with the given id
+// owns product cards, suppliers or producers.
+func (db *SQLiteDataStore) HasEntityTenantCards(id int) (bool, error) {
+	var (
+		err   error
+		count int
+	)
+
+	sqlr := `SELECT (SELECT COUNT(*) FROM product WHERE product_tenant = ?) +
+	(SELECT COUNT(*) FROM supplier WHERE supplier_tenant = ?) +
+	(SELECT COUNT(*) FROM producer WHERE producer_tenant = ?)`
+	if err = db.Get(&count, sqlr, id, id, id); err != nil {
+		return false, err
+	}
+
+	return count != 0, nil
+}
+
+// ShareProduct moves the product with the given id, its producer
+// and the suppliers of its supplier references to the shared catalog.
+func (db *SQLiteDataStore) ShareProduct(id int) (err error) {
+	var tx *sqlx.Tx
+
+	logger.Log.WithFields(logrus.Fields{"id": id}).Debug("ShareProduct")
+
+	if tx, err = db.Beginx(); err != nil {
+		return err
+	}
+
+	defer func() {
+		if err != nil {
+			logger.Log.Error(err)
+
+			if rbErr := tx.Rollback(); rbErr != nil {
+				logger.Log.Error(rbErr)
+				err = rbErr
+
+				return
+			}
+
+			return
+		}
+
+		err = commitAuthorizationChange(tx)
+	}()
+
+	sqlr := `UPDATE product SET product_tenant = NULL WHERE product_id = ?`
+	if _, err = tx.Exec(sqlr, id); err != nil {
+		return
+	}
+
+	sqlr = `UPDATE producer SET producer_tenant = NULL WHERE producer_id IN
+	(SELECT producerref.producer FROM product
+	JOIN producerref ON product.producerref = producerref.producerref_id
+	WHERE product.product_id = ?)`
+	if _, err = tx.Exec(sqlr, id); err != nil {
+		return
+	}
+
+	sqlr = `UPDATE supplier SET supplier_tenant = NULL WHERE supplier_id IN
+	(SELECT supplierref.supplier FROM productsupplierrefs
+	JOIN supplierref ON productsupplierrefs.productsupplierrefs_supplierref_id = supplierref.supplierref_id
+	WHERE productsupplierrefs.productsupplierrefs_product_id = ?)`
+	_, err = tx.Exec(sqlr, id)
+
+	return
+}
+
+// ShareSupplier moves the supplier with the given id to the shared catalog.
+func (db *SQLiteDataStore) ShareSupplier(id int) error {
+	_, err := db.Exec(`UPDATE supplier SET supplier_tenant = NULL WHERE supplier_id = ?`, id)
+
+	return err
+}
+
+// ShareProducer moves the producer with the given id to the shared catalog.
+func (db *SQLiteDataStore) ShareProducer(id int) error {
+	_, err := db.Exec(`UPDATE producer SET producer_tenant = NULL WHERE producer_id = ?`, id)
+
+	return err
+}
@@ -0,0 +1,149 @@
+package datastores
+
+import (
+	"github.com/jmoiron/sqlx"
+	"github.com/sirupsen/logrus"
+	"github.com/tbellembois/gochimitheque/logger"
+	"github.com/tbellembois/gochimitheque/models"
+)
+
+// GetPersonTOTP returns the second factor of the person with the given id.
+func (db *SQLiteDataStore) GetPersonTOTP(personID int) (models.PersonTOTP, error) {
+	var t models.PersonTOTP
+
+	sqlr := `SELECT person, persontotp_secret, persontotp_enabled, persontotp_laststep FROM persontotp WHERE person = ?`
+	if err := db.Get(&t, sqlr, personID); err != nil {
+		return models.PersonTOTP{}, err
+	}
+
+	return t, nil
+}
+
+// SavePersonTOTP creates or updates the second factor t.
+func (db *SQLiteDataStore) SavePersonTOTP(t models.PersonTOTP) error {
+	logger.Log.WithFields(logrus.Fields{"person": t.PersonID, "enabled": t.PersonTOTPEnabled}).Debug("SavePersonTOTP")
+
+	sqlr := `INSERT INTO persontotp(person, persontotp_secret, persontotp_enabled, persontotp_laststep)
+	VALUES (?, ?, ?, ?)
+	ON CONFLICT(person) DO UPDATE SET
+	persontotp_secret = excluded.persontotp_secret,
+	persontotp_enabled = excluded.persontotp_enabled,
+	persontotp_laststep = excluded.persontotp_laststep`
+
+	_, err := db.Exec(sqlr, t.PersonID, t.PersonTOTPSecret, t.PersonTOTPEnabled, t.PersonTOTPLastStep)
+
+	return err
+}
+
+// DeletePersonTOTP removes the second factor and the recovery codes
+// of the person with the given id.
+func (db *SQLiteDataStore) DeletePersonTOTP(personID int) (err error) {
+	var tx *sqlx.Tx
+
+	if tx, err = db.Beginx(); err != nil {
+		return
+	}
+
+	defer func() {
+		if err != nil {
+			logger.Log.Error(err)
+
+			if rbErr := tx.Rollback(); rbErr != nil {
+				logger.Log.Error(rbErr)
+				err = rbErr
+			}
+
+			return
+		}
+
+		err = tx.Commit()
+	}()
+
+	if _, err = tx.Exec(`DELETE FROM totprecoverycode WHERE person = ?`, personID); err != nil {
+		return
+	}
+
+	_, err = tx.Exec(`DELETE FROM persontotp WHERE person = ?`, personID)
+
+	return
+}
+
+// SetPersonTOTPRecoveryCodes replaces the recovery codes hashes
+// of the person with the given id.
+func (db *SQLiteDataStore) SetPersonTOTPRecoveryCodes(personID int, hashes []string) (err error) {
+	var tx *sqlx.Tx
+
+	if tx, err = db.Beginx(); err != nil {
+		return
+	}
+
+	defer func() {
+		if err != nil {
+			logger.Log.Error(err)
+
+			if rbErr := tx.Rollback(); rbErr != nil {
+				logger.Log.Error(rbErr)
+				err = rbErr
+			}
+
+			return
+		}
+
+		err = tx.Commit()
+	}()
+
+	if _, err = tx.Exec(`DELETE FROM totprecoverycode WHERE person = ?`, personID); err != nil {
+		return
+	}
+
+	for _, h := range hashes {
+		if _, err = tx.Exec(`INSERT INTO totprecoverycode(totprecoverycode_hash, person) VALUES (?, ?)`, h, personID); err != nil {
+			return
+		}
+	}
+
+	return
+}
+
+// UsePersonTOTPRecoveryCode deletes the recovery code with the given hash
+// of the person with the given id, and returns false if it does not exist.
+func (db *SQLiteDataStore) UsePersonTOTPRecoveryCode(personID int, hash string) (bool, error) {
+	res, err := db.Exec(`DELETE FROM totprecoverycode WHERE person = ? AND totprecoverycode_hash = ?`, personID, hash)
+	if err != nil {
+		return false, err
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+
+	return n > 0, nil
+}
+
+// CountPersonTOTPRecoveryCodes returns the number of unused recovery codes
+// of the person with the given id.
+func (db *SQLiteDataStore) CountPersonTOTPRecoveryCodes(personID int) (int, error) {
+	var count int
+
+	if err := db.Get(&count, `SELECT COUNT(*) FROM totprecoverycode WHERE person = ?`, personID); err != nil {
+		return 0, err
+	}
+
+	return count, nil
+}
+
+// IsPersonTOTPRequiredByRole returns true if the person with the given id
+// has a role requiring a second factor.
+func (db *SQLiteDataStore) IsPersonTOTPRequiredByRole(personID int) (bool, error) {
+	var count int
+
+	sqlr := `SELECT COUNT(*) FROM personrole
+	JOIN role ON personrole.role = role.role_id
+	WHERE personrole.person = ? AND role.role_requiretotp = 1`
+	if err := db.Get(&count, sqlr, personID); err != nil {
+		return false, err
+	}
+
+	return count > 0, nil
+}
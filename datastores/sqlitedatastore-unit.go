@@ -0,0 +1,116 @@
+package datastores
+
+import (
+	"database/sql"
+	"fmt"
+
+	"github.com/sirupsen/logrus"
+	"github.com/tbellembois/gochimitheque/logger"
+	"github.com/tbellembois/gochimitheque/models"
+	"github.com/tbellembois/gochimitheque/units"
+)
+
+// productSubstance returns the physical properties of the product p for the units conversions.
+func productSubstance(p models.Product) units.Substance {
+	return units.Substance{
+		Density:   p.ProductDensity.Float64,
+		MolarMass: p.ProductMolarMass.Float64,
+	}
+}
+
+// GetConversionUnits returns the units by id with their reference unit and multiplier.
+func (db *SQLiteDataStore) GetConversionUnits() (map[int64]units.Unit, error) {
+	var (
+		rows []struct {
+			ID         int64   `db:"unit_id"`
+			Label      string  `db:"unit_label"`
+			Reference  string  `db:"reference"`
+			Multiplier float64 `db:"unit_multiplier"`
+		}
+		err error
+	)
+
+	sqlr := `SELECT u.unit_id,
+	u.unit_label,
+	ifnull(ref.unit_label, u.unit_label) AS reference,
+	u.unit_multiplier
+	FROM unit u
+	LEFT JOIN unit ref ON u.unit = ref.unit_id`
+	if err = db.Select(&rows, sqlr); err != nil {
+		return nil, err
+	}
+
+	us := make(map[int64]units.Unit, len(rows))
+	for _, r := range rows {
+		us[r.ID] = units.Unit{Label: r.Label, Reference: r.Reference, Multiplier: r.Multiplier}
+	}
+
+	return us, nil
+}
+
+// ConvertQuantity returns the quantity q in the unit with the from id
+// converted into the unit with the to id, for the product p.
+func (db *SQLiteDataStore) ConvertQuantity(q float64, from int, to int, p models.Product) (float64, error) {
+	var (
+		us  map[int64]units.Unit
+		err error
+	)
+
+	logger.Log.WithFields(logrus.Fields{"q": q, "from": from, "to": to, "p.ProductID": p.ProductID}).Debug("ConvertQuantity")
+
+	if us, err = db.GetConversionUnits(); err != nil {
+		return 0, err
+	}
+
+	ufrom, ok := us[int64(from)]
+	if !ok {
+		return 0, fmt.Errorf("unit %d: %w", from, sql.ErrNoRows)
+	}
+
+	uto, ok := us[int64(to)]
+	if !ok {
+		return 0, fmt.Errorf("unit %d: %w", to, sql.ErrNoRows)
+	}
+
+	return units.Convert(q, ufrom, uto, productSubstance(p))
+}
+
+// convertStorages sets the quantities of the storages sts converted into the unit with the given id,
+// the quantities that can not be converted are left null.
+func (db *SQLiteDataStore) convertStorages(sts []models.Storage, unitID int) error {
+	var (
+		us  map[int64]units.Unit
+		err error
+	)
+
+	if us, err = db.GetConversionUnits(); err != nil {
+		return err
+	}
+
+	to, ok := us[int64(unitID)]
+	if !ok {
+		return fmt.Errorf("unit %d: %w", unitID, sql.ErrNoRows)
+	}
+
+	for i, s := range sts {
+		sts[i].UnitConverted = models.Unit{
+			UnitID:    sql.NullInt64{Int64: int64(unitID), Valid: true},
+			UnitLabel: sql.NullString{String: to.Label, Valid: true},
+		}
+
+		from, ok := us[s.UnitQuantity.UnitID.Int64]
+		if !s.StorageQuantity.Valid || !ok {
+			continue
+		}
+
+		var q float64
+
+		if q, err = units.Convert(s.StorageQuantity.Float64, from, to, productSubstance(s.Product)); err != nil {
+			continue
+		}
+
+		sts[i].StorageConvertedQuantity = sql.NullFloat64{Float64: q, Valid: true}
+	}
+
+	return nil
+}
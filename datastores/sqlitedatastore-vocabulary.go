@@ -0,0 +1,430 @@
+package datastores
+
+import (
+	"database/sql"
+	"errors"
+	"strings"
+
+	"github.com/doug-martin/goqu/v9"
+	"github.com/jmoiron/sqlx"
+	"github.com/sirupsen/logrus"
+	"github.com/tbellembois/gochimitheque/formula"
+	"github.com/tbellembois/gochimitheque/logger"
+	"github.com/tbellembois/gochimitheque/models"
+)
+
+var (
+	// ErrVocabularyInUse is returned when deleting a vocabulary entry still referenced.
+	ErrVocabularyInUse = errors.New("the entry is in use")
+	// ErrVocabularyLabelExists is returned when renaming a vocabulary entry with the label of another one.
+	ErrVocabularyLabelExists = errors.New("another entry has this label, merge them instead")
+	// ErrNotVocabulary is returned for the Searchable tables that are not reference vocabularies.
+	ErrNotVocabulary = errors.New("not a vocabulary")
+)
+
+// vocabularyReference is a column referencing the entries of a vocabulary.
+type vocabularyReference struct {
+	table  string
+	column string
+	// the column is part of the table primary key,
+	// the rows of the merged entry already existing for the target one are dropped
+	key bool
+	// the column of the table holding the product id, to refresh its full text search index
+	product string
+}
+
+// vocabularyReferences are the references of the vocabularies tables.
+var vocabularyReferences = map[string][]vocabularyReference{
+	"name": {
+		{table: "product", column: "name", product: "product_id"},
+		{table: "productsynonyms", column: "productsynonyms_name_id", key: true, product: "productsynonyms_product_id"},
+	},
+	"casnumber":        {{table: "product", column: "casnumber", product: "product_id"}},
+	"cenumber":         {{table: "product", column: "cenumber", product: "product_id"}},
+	"empiricalformula": {{table: "product", column: "empiricalformula", product: "product_id"}},
+	"linearformula":    {{table: "product", column: "linearformula", product: "product_id"}},
+	"tag":              {{table: "producttags", column: "producttags_tag_id", key: true, product: "producttags_product_id"}},
+	"category":         {{table: "product", column: "category"}},
+	"producer":         {{table: "producerref", column: "producer"}},
+	"supplier": {
+		{table: "supplierref", column: "supplier"},
+		{table: "storage", column: "supplier"},
+		{table: "recall", column: "supplier"},
+	},
+}
+
+// getVocabularyReferences returns the references of the searchable vocabulary.
+func getVocabularyReferences(searchable models.Searchable) ([]vocabularyReference, error) {
+	refs, ok := vocabularyReferences[searchable.GetTableName()]
+	if !ok {
+		return nil, ErrNotVocabulary
+	}
+
+	return refs, nil
+}
+
+// vocabularyProducts returns the ids of the products referencing the searchable entries with the given ids.
+func vocabularyProducts(tx *sqlx.Tx, refs []vocabularyReference, ids ...int) ([]int, error) {
+	var (
+		productIDs []int
+		err        error
+	)
+
+	for _, ref := range refs {
+		if ref.product == "" {
+			continue
+		}
+
+		var (
+			sqlr string
+			args []interface{}
+			pids []int
+		)
+
+		if sqlr, args, err = goqu.Dialect("sqlite3").From(ref.table).Where(
+			goqu.I(ref.column).In(ids),
+		).Select(
+			goqu.I(ref.product),
+		).Distinct().ToSQL(); err != nil {
+			return nil, err
+		}
+
+		if err = tx.Select(&pids, sqlr, args...); err != nil {
+			return nil, err
+		}
+
+		productIDs = append(productIDs, pids...)
+	}
+
+	return productIDs, nil
+}
+
+// GetVocabularyUsages returns the number of references of the searchable entries
+// with the given ids, by id.
+func GetVocabularyUsages[T models.Searchable](searchable T, db *sqlx.DB, ids []int64) (map[int64]int, error) {
+	var (
+		refs []vocabularyReference
+		err  error
+	)
+
+	usages := make(map[int64]int)
+
+	if refs, err = getVocabularyReferences(searchable); err != nil {
+		return nil, err
+	}
+
+	if len(ids) == 0 {
+		return usages, nil
+	}
+
+	for _, ref := range refs {
+		var (
+			sqlr   string
+			args   []interface{}
+			counts []struct {
+				ID    int64 `db:"id"`
+				Count int   `db:"count"`
+			}
+		)
+
+		if sqlr, args, err = goqu.Dialect("sqlite3").From(ref.table).Where(
+			goqu.I(ref.column).In(ids),
+		).Select(
+			goqu.I(ref.column).As("id"),
+			goqu.COUNT("*").As("count"),
+		).GroupBy(goqu.I(ref.column)).ToSQL(); err != nil {
+			return nil, err
+		}
+
+		if err = db.Select(&counts, sqlr, args...); err != nil {
+			return nil, err
+		}
+
+		for _, c := range counts {
+			usages[c.ID] += c.Count
+		}
+	}
+
+	return usages, nil
+}
+
+// RenameVocabulary sets the label of the searchable entry with the given id.
+// It returns ErrVocabularyLabelExists if another entry has the label.
+func RenameVocabulary[T models.Searchable](searchable T, db *sqlx.DB, id int, label string) (err error) {
+	var (
+		refs     []vocabularyReference
+		existing T
+		tx       *sqlx.Tx
+		sqlr     string
+		args     []interface{}
+	)
+
+	logger.Log.WithFields(logrus.Fields{"table": searchable.GetTableName(), "id": id, "label": label}).Debug("RenameVocabulary")
+
+	if refs, err = getVocabularyReferences(searchable); err != nil {
+		return err
+	}
+
+	if existing, err = GetByText(searchable, db, label); err != nil && err != sql.ErrNoRows {
+		return err
+	}
+
+	if existing.GetID() != 0 && existing.GetID() != int64(id) {
+		return ErrVocabularyLabelExists
+	}
+
+	if tx, err = db.Beginx(); err != nil {
+		return err
+	}
+
+	defer func() {
+		if err != nil {
+			logger.Log.Error(err)
+			if rbErr := tx.Rollback(); rbErr != nil {
+				logger.Log.Error(rbErr)
+				err = rbErr
+
+				return
+			}
+
+			return
+		}
+
+		err = tx.Commit()
+	}()
+
+	if sqlr, args, err = goqu.Dialect("sqlite3").Update(searchable.GetTableName()).Set(
+		goqu.Record{searchable.GetTextFieldName(): label},
+	).Where(
+		goqu.I(searchable.GetIDFieldName()).Eq(id),
+	).ToSQL(); err != nil {
+		return
+	}
+
+	var res sql.Result
+
+	if res, err = tx.Exec(sqlr, args...); err != nil {
+		return
+	}
+
+	var n int64
+
+	if n, err = res.RowsAffected(); err != nil {
+		return
+	}
+
+	if n == 0 {
+		err = sql.ErrNoRows
+		return
+	}
+
+	// the molar mass is computed from the empirical formula
+	if searchable.GetTableName() == "empiricalformula" {
+		var productIDs []int
+
+		if productIDs, err = vocabularyProducts(tx, refs, id); err != nil {
+			return
+		}
+
+		if err = updateProductsMolarMass(tx, productIDs); err != nil {
+			return
+		}
+	}
+
+	return refreshVocabularyProducts(tx, refs, id)
+}
+
+// MergeVocabulary replaces the references to the searchable entry with the given id
+// by references to the entry with the intoID id, and deletes it.
+func MergeVocabulary[T models.Searchable](searchable T, db *sqlx.DB, id int, intoID int) (err error) {
+	var (
+		refs []vocabularyReference
+		into T
+		tx   *sqlx.Tx
+		sqlr string
+		args []interface{}
+	)
+
+	logger.Log.WithFields(logrus.Fields{"table": searchable.GetTableName(), "id": id, "intoID": intoID}).Debug("MergeVocabulary")
+
+	if refs, err = getVocabularyReferences(searchable); err != nil {
+		return err
+	}
+
+	if into, err = GetByID(searchable, db, intoID); err != nil {
+		return err
+	}
+
+	if into.GetID() == 0 {
+		return sql.ErrNoRows
+	}
+
+	if tx, err = db.Beginx(); err != nil {
+		return err
+	}
+
+	defer func() {
+		if err != nil {
+			logger.Log.Error(err)
+			if rbErr := tx.Rollback(); rbErr != nil {
+				logger.Log.Error(rbErr)
+				err = rbErr
+
+				return
+			}
+
+			return
+		}
+
+		err = tx.Commit()
+	}()
+
+	var productIDs []int
+
+	if productIDs, err = vocabularyProducts(tx, refs, id); err != nil {
+		return
+	}
+
+	for _, ref := range refs {
+		update := goqu.Dialect("sqlite3").Update(ref.table).Set(
+			goqu.Record{ref.column: intoID},
+		).Where(
+			goqu.I(ref.column).Eq(id),
+		)
+
+		if sqlr, args, err = update.ToSQL(); err != nil {
+			return
+		}
+
+		if ref.key {
+			sqlr = strings.Replace(sqlr, "UPDATE", "UPDATE OR IGNORE", 1)
+		}
+
+		if _, err = tx.Exec(sqlr, args...); err != nil {
+			return
+		}
+
+		// the rows already existing for the target entry
+		if ref.key {
+			if sqlr, args, err = goqu.Dialect("sqlite3").From(ref.table).Where(
+				goqu.I(ref.column).Eq(id),
+			).Delete().ToSQL(); err != nil {
+				return
+			}
+
+			if _, err = tx.Exec(sqlr, args...); err != nil {
+				return
+			}
+		}
+	}
+
+	// a product name can not be one of its synonyms
+	if searchable.GetTableName() == "name" {
+		sqlr = `DELETE FROM productsynonyms WHERE productsynonyms_name_id = ?
+		AND productsynonyms_product_id IN (SELECT product_id FROM product WHERE name = ?)`
+		if _, err = tx.Exec(sqlr, intoID, intoID); err != nil {
+			return
+		}
+	}
+
+	if sqlr, args, err = goqu.Dialect("sqlite3").From(searchable.GetTableName()).Where(
+		goqu.I(searchable.GetIDFieldName()).Eq(id),
+	).Delete().ToSQL(); err != nil {
+		return
+	}
+
+	if _, err = tx.Exec(sqlr, args...); err != nil {
+		return
+	}
+
+	if searchable.GetTableName() == "empiricalformula" {
+		if err = updateProductsMolarMass(tx, productIDs); err != nil {
+			return
+		}
+	}
+
+	for _, pid := range productIDs {
+		if err = updateProductFTS(tx, pid); err != nil {
+			return
+		}
+	}
+
+	return nil
+}
+
+// DeleteVocabulary deletes the searchable entry with the given id.
+// It returns ErrVocabularyInUse if it is referenced.
+func DeleteVocabulary[T models.Searchable](searchable T, db *sqlx.DB, id int) error {
+	var (
+		usages map[int64]int
+		sqlr   string
+		args   []interface{}
+		err    error
+	)
+
+	logger.Log.WithFields(logrus.Fields{"table": searchable.GetTableName(), "id": id}).Debug("DeleteVocabulary")
+
+	if usages, err = GetVocabularyUsages(searchable, db, []int64{int64(id)}); err != nil {
+		return err
+	}
+
+	if usages[int64(id)] > 0 {
+		return ErrVocabularyInUse
+	}
+
+	if sqlr, args, err = goqu.Dialect("sqlite3").From(searchable.GetTableName()).Where(
+		goqu.I(searchable.GetIDFieldName()).Eq(id),
+	).Delete().ToSQL(); err != nil {
+		return err
+	}
+
+	_, err = db.Exec(sqlr, args...)
+
+	return err
+}
+
+// refreshVocabularyProducts refreshes the full text search index of the products
+// referencing the entries with the given ids.
+func refreshVocabularyProducts(tx *sqlx.Tx, refs []vocabularyReference, ids ...int) error {
+	productIDs, err := vocabularyProducts(tx, refs, ids...)
+	if err != nil {
+		return err
+	}
+
+	for _, pid := range productIDs {
+		if err = updateProductFTS(tx, pid); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// updateProductsMolarMass sets the molar mass of the products with the given ids
+// computed from their empirical formula, NULL if it can not be parsed.
+func updateProductsMolarMass(tx *sqlx.Tx, productIDs []int) error {
+	for _, pid := range productIDs {
+		var (
+			label sql.NullString
+			m     sql.NullFloat64
+		)
+
+		if err := tx.Get(&label, `SELECT empiricalformula_label FROM product
+		LEFT JOIN empiricalformula ON product.empiricalformula = empiricalformula.empiricalformula_id
+		WHERE product_id = ?`, pid); err != nil {
+			return err
+		}
+
+		if label.Valid {
+			if v, ferr := formula.MolarMass(label.String); ferr == nil {
+				m = sql.NullFloat64{Float64: v, Valid: true}
+			}
+		}
+
+		if _, err := tx.Exec(`UPDATE product SET product_molarmass = ? WHERE product_id = ?`, m, pid); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
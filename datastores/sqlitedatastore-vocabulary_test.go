@@ -0,0 +1,70 @@
+package datastores
+
+import (
+	"database/sql"
+	"math"
+	"path/filepath"
+	"testing"
+
+	"github.com/tbellembois/gochimitheque/models"
+)
+
+func TestVocabularyMolarMass(t *testing.T) {
+	db, err := NewSQLiteDBstore(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err = db.CreateDatabase(); err != nil {
+		t.Fatal(err)
+	}
+
+	db.MustExec(`INSERT INTO name (name_id, name_label) VALUES (1000, 'VOCABULARY TEST');
+INSERT INTO empiricalformula (empiricalformula_id, empiricalformula_label) VALUES (1000, 'H2O'), (1001, 'C2H6O');
+INSERT INTO product (product_id, name, empiricalformula, product_molarmass, person) VALUES
+	(1000, 1000, 1000, 18.015, 1),
+	(1001, 1000, 1001, 46.069, 1);`)
+
+	molarMass := func(pid int) sql.NullFloat64 {
+		t.Helper()
+
+		var m sql.NullFloat64
+		if err := db.Get(&m, `SELECT product_molarmass FROM product WHERE product_id = ?`, pid); err != nil {
+			t.Fatal(err)
+		}
+
+		return m
+	}
+
+	check := func(pid int, want float64) {
+		t.Helper()
+
+		if m := molarMass(pid); !m.Valid || math.Abs(m.Float64-want) > 0.001 {
+			t.Errorf("product %d molar mass = %v, want %g", pid, m, want)
+		}
+	}
+
+	// a rename recomputes the molar mass
+	if err = RenameVocabulary(models.EmpiricalFormula{}, db.DB, 1000, "H2O2"); err != nil {
+		t.Fatal(err)
+	}
+
+	check(1000, 34.014)
+
+	// that is NULL if the formula can not be parsed
+	if err = RenameVocabulary(models.EmpiricalFormula{}, db.DB, 1000, "H2O2)"); err != nil {
+		t.Fatal(err)
+	}
+
+	if m := molarMass(1000); m.Valid {
+		t.Errorf("product 1000 molar mass = %g, want NULL", m.Float64)
+	}
+
+	// a merge sets the molar mass of the target formula
+	if err = MergeVocabulary(models.EmpiricalFormula{}, db.DB, 1000, 1001); err != nil {
+		t.Fatal(err)
+	}
+
+	check(1000, 46.069)
+	check(1001, 46.069)
+}
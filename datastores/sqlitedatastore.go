@@ -8,30 +8,25 @@ import (
 	"io"
 	"net/http"
 	"regexp"
-	"strconv"
 	"strings"
 
 	"github.com/jmoiron/sqlx"
 	"github.com/mattn/go-sqlite3"
 	"github.com/sirupsen/logrus"
-	"github.com/tbellembois/gochimitheque/aes"
 	"github.com/tbellembois/gochimitheque/data"
+	"github.com/tbellembois/gochimitheque/formula"
 	"github.com/tbellembois/gochimitheque/logger"
 	"github.com/tbellembois/gochimitheque/models"
 )
 
-type CasbinJSON struct {
-	PType string
-	V0    string
-	V1    string
-	V2    string
-	V3    string
-}
-
 // SQLiteDataStore implements the Datastore interface
 // to store data in SQLite3.
 type SQLiteDataStore struct {
 	*sqlx.DB
+
+	// multiTenant isolates the entities product cards,
+	// suppliers and producers
+	multiTenant bool
 }
 
 var regex = func(re, s string) bool {
@@ -47,6 +42,37 @@ var regex = func(re, s string) bool {
 	return m
 }
 
+// authorizationChangeHooks are called after the commit of a change
+// of the data the authorization matchers depend on.
+var authorizationChangeHooks []func()
+
+// OnAuthorizationChange registers f to be called after the commit of a change
+// of the people memberships and admin status, the entities, the store locations,
+// the storages or the products tenants.
+// It must be called at initialization.
+func OnAuthorizationChange(f func()) {
+	authorizationChangeHooks = append(authorizationChangeHooks, f)
+}
+
+// authorizationChanged calls the authorization change hooks.
+func authorizationChanged() {
+	for _, f := range authorizationChangeHooks {
+		f()
+	}
+}
+
+// commitAuthorizationChange commits the transaction tx
+// and calls the authorization change hooks.
+func commitAuthorizationChange(tx interface{ Commit() error }) error {
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	authorizationChanged()
+
+	return nil
+}
+
 func init() {
 	sql.Register("sqlite3_with_go_func",
 		&sqlite3.SQLiteDriver{
@@ -125,42 +151,7 @@ func NewSQLiteDBstore(dataSourceName string) (*SQLiteDataStore, error) {
 		return &SQLiteDataStore{}, err
 	}
 
-	return &SQLiteDataStore{db}, nil
-}
-
-// ToCasbinJSONAdapter returns a JSON as a slice of bytes
-// following the format: https://github.com/casbin/json-adapter#policy-json
-func (db *SQLiteDataStore) ToCasbinJSONAdapter() ([]byte, error) {
-	var (
-		ps   []models.Permission
-		err  error
-		res  []byte
-		sqlr string
-	)
-
-	sqlr = `SELECT person AS "person.person_id", permission_perm_name, permission_item_name, permission_entity_id 
-	FROM permission`
-	if err = db.Select(&ps, sqlr); err != nil {
-		return nil, err
-	}
-
-	js := make([]CasbinJSON, 0, len(ps))
-
-	for _, p := range ps {
-		js = append(js, CasbinJSON{
-			PType: "p",
-			V0:    strconv.Itoa(p.Person.PersonID),
-			V1:    p.PermissionPermName,
-			V2:    p.PermissionItemName,
-			V3:    strconv.Itoa(p.PermissionEntityID),
-		})
-	}
-
-	if res, err = json.Marshal(js); err != nil {
-		return nil, err
-	}
-
-	return res, nil
+	return &SQLiteDataStore{DB: db}, nil
 }
 
 // CreateDatabase creates the database tables.
@@ -180,6 +171,13 @@ func (db *SQLiteDataStore) CreateDatabase() error {
 		return err
 	}
 
+	// full text search indexes need FTS5
+	if err = db.Get(&c, `SELECT sqlite_compileoption_used('ENABLE_FTS5')`); err != nil {
+		return err
+	}
+
+	fts5 = c == 1
+
 	// shema migration
 	if err = db.Get(&userVersion, `PRAGMA user_version`); err != nil {
 		return err
@@ -197,6 +195,11 @@ func (db *SQLiteDataStore) CreateDatabase() error {
 		nextVersion++
 	}
 
+	// full text search indexes
+	if err = db.createFTS(); err != nil {
+		return err
+	}
+
 	// welcome announce
 	if err = db.Get(&c, `SELECT count(*) FROM welcomeannounce`); err != nil {
 		return err
@@ -409,16 +412,9 @@ func (db *SQLiteDataStore) CreateDatabase() error {
 	if c == 0 {
 		logger.Log.Info("  inserting admin user")
 
-		var aeskey string
-
-		if aeskey, err = aes.GenerateAESKey(); err != nil {
-			return err
-		}
-
 		admin = &models.Person{
-			PersonEmail:  "admin@chimitheque.fr",
-			Permissions:  []*models.Permission{{PermissionPermName: "all", PermissionItemName: "all", PermissionEntityID: -1}},
-			PersonAESKey: aeskey,
+			PersonEmail: "admin@chimitheque.fr",
+			Permissions: []*models.Permission{{PermissionPermName: "all", PermissionItemName: "all", PermissionEntityID: -1}},
 		}
 
 		var insertID int64
@@ -471,66 +467,6 @@ func (db *SQLiteDataStore) Maintenance() {
 		tx   *sql.Tx
 	)
 
-	//
-	// Changing default user aes keys.
-	//
-	if tx, err = db.Begin(); err != nil {
-		logger.Log.Error(err)
-
-		return
-	}
-
-	var people []models.Person
-
-	sqlr = `SELECT person_id, person_email, person_password, person_aeskey 
-	FROM person 
-	WHERE person_aeskey="32byteskeytobechangedbygocode+++";`
-
-	if err = db.Select(&people, sqlr); err != nil {
-		logger.Log.Error(err)
-
-		return
-	}
-
-	for _, person := range people {
-		var key string
-
-		if key, err = aes.GenerateAESKey(); err != nil {
-			logger.Log.Error(err)
-
-			if errr := tx.Rollback(); errr != nil {
-				logger.Log.Error(err)
-
-				return
-			}
-
-			return
-		}
-
-		sqlr = `UPDATE person SET person_aeskey=? WHERE person_id=?;`
-		if _, err = tx.Exec(sqlr, key, person.PersonID); err != nil {
-			logger.Log.Error(err)
-
-			if errr := tx.Rollback(); errr != nil {
-				logger.Log.Error(err)
-
-				return
-			}
-
-			return
-		}
-	}
-
-	if err = tx.Commit(); err != nil {
-		logger.Log.Error(err)
-
-		if errr := tx.Rollback(); errr != nil {
-			logger.Log.Error(errr)
-
-			return
-		}
-	}
-
 	//
 	// Cleaning up casnumber labels duplicates.
 	//
@@ -636,6 +572,37 @@ func (db *SQLiteDataStore) Maintenance() {
 			return
 		}
 	}
+
+	//
+	// Computing the missing products molar masses.
+	//
+	var formulas []struct {
+		ProductID int    `db:"product_id"`
+		Label     string `db:"empiricalformula_label"`
+	}
+
+	sqlr = `SELECT product_id, empiricalformula_label FROM product
+	JOIN empiricalformula ON product.empiricalformula = empiricalformula.empiricalformula_id
+	WHERE product_molarmass IS NULL;`
+
+	if err = db.Select(&formulas, sqlr); err != nil {
+		logger.Log.Error(err)
+
+		return
+	}
+
+	for _, f := range formulas {
+		m, ferr := formula.MolarMass(f.Label)
+		if ferr != nil {
+			continue
+		}
+
+		if _, err = db.Exec(`UPDATE product SET product_molarmass=? WHERE product_id=?;`, m, f.ProductID); err != nil {
+			logger.Log.Error(err)
+
+			return
+		}
+	}
 }
 
 // Import import data from another Chimithèque instance.
@@ -798,6 +765,19 @@ func (db *SQLiteDataStore) Import(url string) error {
 			}
 		}
 
+		// adr class already exist ?
+		// adr classes are reference data and are never created on import
+		if p.AdrClass.AdrClassID.Valid {
+			var adrclass models.AdrClass
+
+			if adrclass, err = GetByText(models.AdrClass{}, db.DB, p.AdrClass.AdrClassLabel.String); err != nil && err != sql.ErrNoRows {
+				logger.Log.Error("can not get product adr class " + err.Error())
+				return err
+			}
+
+			p.AdrClass = adrclass
+		}
+
 		// name already exist ?
 		var name models.Name
 
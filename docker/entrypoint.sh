@@ -17,6 +17,7 @@ mailserversender=""
 mailserverusetls=""
 mailservertlsskipverify=""
 enablepublicproductsendpoint=""
+multitenant=""
 admins=""
 logfile=""
 debug=""
@@ -113,6 +114,11 @@ then
       enablepublicproductsendpoint="-enablepublicproductsendpoint"
       echo $enablepublicproductsendpoint
 fi
+if [ ! -z "$CHIMITHEQUE_MULTITENANT" ]
+then
+      multitenant="-multitenant"
+      echo $multitenant
+fi
 if [ ! -z "$CHIMITHEQUE_ADMINS" ]
 then
       admins="-admins $CHIMITHEQUE_ADMINS"
@@ -150,7 +156,7 @@ then
       echo $importfrom
 fi
 
-command="/var/www-data/gochimitheque -dbpath /data $listenport $appurl $apppath $dockerport $ldapserverurl $ldapserverusername $ldapserverpassword $ldapgroupsearchbasedn $ldapgroupsearchfilter $ldapusersearchbasedn $ldapusersearchfilter $autocreateuser $mailserveraddress $mailserverport $mailserversender $mailserverusetls $mailservertlsskipverify $enablepublicproductsendpoint $admins $logfile $debug $resetAdminPassword $updateQRCode $mailTest $importfrom"
+command="/var/www-data/gochimitheque -dbpath /data $listenport $appurl $apppath $dockerport $ldapserverurl $ldapserverusername $ldapserverpassword $ldapgroupsearchbasedn $ldapgroupsearchfilter $ldapusersearchbasedn $ldapusersearchfilter $autocreateuser $mailserveraddress $mailserverport $mailserversender $mailserverusetls $mailservertlsskipverify $enablepublicproductsendpoint $multitenant $admins $logfile $debug $resetAdminPassword $updateQRCode $mailTest $importfrom"
 echo "command:"
 echo $command
 $command
\ No newline at end of file
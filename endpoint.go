@@ -8,16 +8,23 @@ import (
 func buildEndpoints(appFullURL string) (router *mux.Router) {
 	router = mux.NewRouter()
 
-	commonChain := alice.New(env.ContextMiddleware, env.HeadersMiddleware, env.LogingMiddleware)
-	securechain := alice.New(env.ContextMiddleware, env.HeadersMiddleware, env.LogingMiddleware, env.AuthenticateMiddleware, env.AuthorizeMiddleware)
+	commonChain := alice.New(env.ContextMiddleware, env.HeadersMiddleware, env.LogingMiddleware, env.CSRFMiddleware)
+	securechain := alice.New(env.ContextMiddleware, env.HeadersMiddleware, env.LogingMiddleware, env.AuthenticateMiddleware, env.CSRFMiddleware, env.AuthorizeMiddleware)
+
+	// CORS preflight requests
+	router.Methods("OPTIONS").Handler(commonChain.Then(env.AppMiddleware(env.PreflightHandler)))
 
 	router.Handle("/login", commonChain.Then(env.AppMiddleware(env.VLoginHandler))).Methods("GET")
 	router.Handle("/menu", commonChain.Then(env.AppMiddleware(env.VMenuHandler))).Methods("GET")
 	router.Handle("/search", commonChain.Then(env.AppMiddleware(env.VSearchHandler))).Methods("GET")
 	router.Handle("/get-token", commonChain.Then(env.AppMiddleware(env.GetTokenHandler))).Methods("POST")
-	router.Handle("/delete-token", commonChain.Then(env.AppMiddleware(env.DeleteTokenHandler))).Methods("GET")
+	router.Handle("/delete-token", commonChain.Then(env.AppMiddleware(env.DeleteTokenHandler))).Methods("POST")
+	router.Handle("/get-token/totp", commonChain.Then(env.AppMiddleware(env.GetTOTPTokenHandler))).Methods("POST")
+	router.Handle("/get-token/totp/enroll", commonChain.Then(env.AppMiddleware(env.EnrollTOTPLoginHandler))).Methods("POST")
+	router.Handle("/refresh-token", commonChain.Then(env.AppMiddleware(env.RefreshTokenHandler))).Methods("POST")
 	router.Handle("/reset-password", commonChain.Then(env.AppMiddleware(env.ResetPasswordHandler))).Methods("POST")
-	router.Handle("/reset", commonChain.Then(env.AppMiddleware(env.RequestResetPasswordHandler))).Methods("GET")
+	router.Handle("/reset", commonChain.Then(env.AppMiddleware(env.VResetPasswordHandler))).Methods("GET")
+	router.Handle("/reset", commonChain.Then(env.AppMiddleware(env.ResetPasswordFromTokenHandler))).Methods("POST")
 	router.Handle("/captcha", commonChain.Then(env.AppMiddleware(env.CaptchaHandler))).Methods("GET")
 	router.Handle("/about", commonChain.Then(env.AppMiddleware(env.AboutHandler))).Methods("GET")
 
@@ -48,15 +55,6 @@ func buildEndpoints(appFullURL string) (router *mux.Router) {
 	router.Handle("/{item:entities}/{id}", securechain.Then(env.AppMiddleware(env.DeleteEntityHandler))).Methods("DELETE")
 	router.Handle("/entities/{item:stocks}/{id}", securechain.Then(env.AppMiddleware(env.GetEntityStockHandler))).Methods("GET")
 
-	router.Handle("/f/{view:v}/{item:entities}", securechain.Then(env.AppMiddleware(env.FakeHandler))).Methods("GET")
-	router.Handle("/f/{view:vc}/{item:entities}", securechain.Then(env.AppMiddleware(env.FakeHandler))).Methods("GET")
-	router.Handle("/f/{item:entities}", securechain.Then(env.AppMiddleware(env.FakeHandler))).Methods("GET")
-	router.Handle("/f/{item:entities}/{id}", securechain.Then(env.AppMiddleware(env.FakeHandler))).Methods("GET")
-	router.Handle("/f/{item:entities}/{id}/people", securechain.Then(env.AppMiddleware(env.FakeHandler))).Methods("GET")
-	router.Handle("/f/{item:entities}", securechain.Then(env.AppMiddleware(env.FakeHandler))).Methods("POST")
-	router.Handle("/f/{item:entities}/{id}", securechain.Then(env.AppMiddleware(env.FakeHandler))).Methods("PUT")
-	router.Handle("/f/{item:entities}/{id}", securechain.Then(env.AppMiddleware(env.FakeHandler))).Methods("DELETE")
-	router.Handle("/f/entities/{item:stocks}/{id}", securechain.Then(env.AppMiddleware(env.FakeHandler))).Methods("GET")
 	// people
 	router.Handle("/{view:v}/{item:people}", securechain.Then(env.AppMiddleware(env.VGetPeopleHandler))).Methods("GET")
 	router.Handle("/{view:vc}/{item:people}", securechain.Then(env.AppMiddleware(env.VCreatePersonHandler))).Methods("GET")
@@ -67,23 +65,64 @@ func buildEndpoints(appFullURL string) (router *mux.Router) {
 	router.Handle("/{item:people}/{id}/entities", securechain.Then(env.AppMiddleware(env.GetPersonEntitiesHandler))).Methods("GET")
 	router.Handle("/{item:people}/{id}/manageentities", securechain.Then(env.AppMiddleware(env.GetPersonManageEntitiesHandler))).Methods("GET")
 	router.Handle("/{item:people}/{id}/permissions", securechain.Then(env.AppMiddleware(env.GetPersonPermissionsHandler))).Methods("GET")
+	router.Handle("/{item:people}/{id}/roles", securechain.Then(env.AppMiddleware(env.GetPersonRolesHandler))).Methods("GET")
 	router.Handle("/{item:people}/{id}", securechain.Then(env.AppMiddleware(env.UpdatePersonHandler))).Methods("PUT")
 	router.Handle("/{item:people}", securechain.Then(env.AppMiddleware(env.CreatePersonHandler))).Methods("POST")
 	router.Handle("/{item:people}/{id}", securechain.Then(env.AppMiddleware(env.DeletePersonHandler))).Methods("DELETE")
 	router.Handle("/{item:peoplep}", securechain.Then(env.AppMiddleware(env.UpdatePersonpHandler))).Methods("POST")
 	router.Handle("/{item:people}/isldap/{email}", commonChain.Then(env.AppMiddleware(env.IsPersonLDAPHandler))).Methods("GET")
-	router.Handle("/{item:people}/generateqrcode/{id}", securechain.Then(env.AppMiddleware(env.GenerateQRCodeHandler))).Methods("GET")
-
-	router.Handle("/f/{view:v}/{item:people}", securechain.Then(env.AppMiddleware(env.FakeHandler))).Methods("GET")
-	router.Handle("/f/{view:vc}/{item:people}", securechain.Then(env.AppMiddleware(env.FakeHandler))).Methods("GET")
-	router.Handle("/f/{item:people}", securechain.Then(env.AppMiddleware(env.FakeHandler))).Methods("GET")
-	router.Handle("/f/{item:people}/{id}", securechain.Then(env.AppMiddleware(env.FakeHandler))).Methods("GET")
-	router.Handle("/f/{item:people}/{id}/entities", securechain.Then(env.AppMiddleware(env.FakeHandler))).Methods("GET")
-	router.Handle("/f/{item:people}/{id}/manageentities", securechain.Then(env.AppMiddleware(env.FakeHandler))).Methods("GET")
-	router.Handle("/f/{item:people}/{id}/permissions", securechain.Then(env.AppMiddleware(env.FakeHandler))).Methods("GET")
-	router.Handle("/f/{item:people}/{id}", securechain.Then(env.AppMiddleware(env.FakeHandler))).Methods("PUT")
-	router.Handle("/f/{item:people}", securechain.Then(env.AppMiddleware(env.FakeHandler))).Methods("POST")
-	router.Handle("/f/{item:people}/{id}", securechain.Then(env.AppMiddleware(env.FakeHandler))).Methods("DELETE")
+
+	// sessions
+	router.Handle("/{item:sessions}", securechain.Then(env.AppMiddleware(env.GetSessionsHandler))).Methods("GET")
+	router.Handle("/{item:sessions}/{id}", securechain.Then(env.AppMiddleware(env.DeleteSessionHandler))).Methods("DELETE")
+	router.Handle("/{item:sessions}/people/{id}", securechain.Then(env.AppMiddleware(env.DeletePersonSessionsHandler))).Methods("DELETE")
+
+	// device tokens
+	router.Handle("/{item:devicetokens}", securechain.Then(env.AppMiddleware(env.GetDeviceTokensHandler))).Methods("GET")
+	router.Handle("/{item:devicetokens}", securechain.Then(env.AppMiddleware(env.CreateDeviceTokenHandler))).Methods("POST")
+	router.Handle("/{item:devicetokens}/{id}", securechain.Then(env.AppMiddleware(env.DeleteDeviceTokenHandler))).Methods("DELETE")
+	router.Handle("/{item:devicetokens}/people/{id}", securechain.Then(env.AppMiddleware(env.DeletePersonDeviceTokensHandler))).Methods("DELETE")
+
+	// second factor
+	router.Handle("/{item:totp}", securechain.Then(env.AppMiddleware(env.GetTOTPHandler))).Methods("GET")
+	router.Handle("/{item:totp}", securechain.Then(env.AppMiddleware(env.CreateTOTPHandler))).Methods("POST")
+	router.Handle("/{item:totp}", securechain.Then(env.AppMiddleware(env.ConfirmTOTPHandler))).Methods("PUT")
+	router.Handle("/{item:totp}", securechain.Then(env.AppMiddleware(env.DeleteTOTPHandler))).Methods("DELETE")
+	router.Handle("/{item:totp}/recoverycodes", securechain.Then(env.AppMiddleware(env.CreateTOTPRecoveryCodesHandler))).Methods("POST")
+	router.Handle("/{item:totp}/people/{id}", securechain.Then(env.AppMiddleware(env.ResetPersonTOTPHandler))).Methods("DELETE")
+
+	// lockouts and audit log
+	router.Handle("/{item:lockouts}", securechain.Then(env.AppMiddleware(env.GetLockoutsHandler))).Methods("GET")
+	router.Handle("/{item:lockouts}/people/{id}", securechain.Then(env.AppMiddleware(env.UnlockPersonHandler))).Methods("DELETE")
+	router.Handle("/{item:lockouts}/ips/{ip}", securechain.Then(env.AppMiddleware(env.UnlockIPHandler))).Methods("DELETE")
+	router.Handle("/{item:auditlogs}", securechain.Then(env.AppMiddleware(env.GetAuditLogsHandler))).Methods("GET")
+
+	// batch recalls
+	router.Handle("/{item:recalls}", securechain.Then(env.AppMiddleware(env.GetRecallsHandler))).Methods("GET")
+	router.Handle("/{item:recalls}", securechain.Then(env.AppMiddleware(env.CreateRecallHandler))).Methods("POST")
+	router.Handle("/{item:recalls}/{id}", securechain.Then(env.AppMiddleware(env.GetRecallHandler))).Methods("GET")
+	router.Handle("/{item:recalls}/{id}", securechain.Then(env.AppMiddleware(env.DeleteRecallHandler))).Methods("DELETE")
+	router.Handle("/{item:recalls}/{id}/acknowledgement", securechain.Then(env.AppMiddleware(env.AcknowledgeRecallHandler))).Methods("PUT")
+	router.Handle("/{item:vocabularies}/{vocabulary}", securechain.Then(env.AppMiddleware(env.GetVocabularyHandler))).Methods("GET")
+	router.Handle("/{item:vocabularies}/{vocabulary}/{id}", securechain.Then(env.AppMiddleware(env.RenameVocabularyHandler))).Methods("PUT")
+	router.Handle("/{item:vocabularies}/{vocabulary}/{id}", securechain.Then(env.AppMiddleware(env.DeleteVocabularyHandler))).Methods("DELETE")
+	router.Handle("/{item:vocabularies}/{vocabulary}/{id}/merge", securechain.Then(env.AppMiddleware(env.MergeVocabularyHandler))).Methods("POST")
+
+	// controlled substances register
+	router.Handle("/{item:registers}/verify", securechain.Then(env.AppMiddleware(env.VerifyControlledRegisterReportHandler))).Methods("POST")
+	router.Handle("/{item:registers}/{id}", securechain.Then(env.AppMiddleware(env.GetControlledRegisterHandler))).Methods("GET")
+	router.Handle("/{item:registers}/{id}/report", securechain.Then(env.AppMiddleware(env.GetControlledRegisterReportHandler))).Methods("GET")
+	router.Handle("/{item:registers}/{id}/verify", securechain.Then(env.AppMiddleware(env.VerifyControlledRegisterHandler))).Methods("GET")
+
+	// permissions
+	router.Handle("/{item:permissions}/check", securechain.Then(env.AppMiddleware(env.CheckPermissionsHandler))).Methods("POST")
+
+	// roles
+	router.Handle("/{item:roles}", securechain.Then(env.AppMiddleware(env.GetRolesHandler))).Methods("GET")
+	router.Handle("/{item:roles}/{id}", securechain.Then(env.AppMiddleware(env.GetRoleHandler))).Methods("GET")
+	router.Handle("/{item:roles}", securechain.Then(env.AppMiddleware(env.CreateRoleHandler))).Methods("POST")
+	router.Handle("/{item:roles}/{id}", securechain.Then(env.AppMiddleware(env.UpdateRoleHandler))).Methods("PUT")
+	router.Handle("/{item:roles}/{id}", securechain.Then(env.AppMiddleware(env.DeleteRoleHandler))).Methods("DELETE")
 
 	// ldap groups
 	router.Handle("/{item:ldapgroup}", securechain.Then(env.AppMiddleware(env.GetLDAPGroupsHandler))).Methods("GET")
@@ -97,14 +136,6 @@ func buildEndpoints(appFullURL string) (router *mux.Router) {
 	router.Handle("/{item:storelocations}", securechain.Then(env.AppMiddleware(env.CreateStoreLocationHandler))).Methods("POST")
 	router.Handle("/{item:storelocations}/{id}", securechain.Then(env.AppMiddleware(env.DeleteStoreLocationHandler))).Methods("DELETE")
 
-	router.Handle("/f/{view:v}/{item:storelocations}", securechain.Then(env.AppMiddleware(env.FakeHandler))).Methods("GET")
-	router.Handle("/f/{view:vc}/{item:storelocations}", securechain.Then(env.AppMiddleware(env.FakeHandler))).Methods("GET")
-	router.Handle("/f/{item:storelocations}", securechain.Then(env.AppMiddleware(env.FakeHandler))).Methods("GET")
-	router.Handle("/f/{item:storelocations}/{id}", securechain.Then(env.AppMiddleware(env.FakeHandler))).Methods("GET")
-	router.Handle("/f/{item:storelocations}/{id}", securechain.Then(env.AppMiddleware(env.FakeHandler))).Methods("PUT")
-	router.Handle("/f/{item:storelocations}", securechain.Then(env.AppMiddleware(env.FakeHandler))).Methods("POST")
-	router.Handle("/f/{item:storelocations}/{id}", securechain.Then(env.AppMiddleware(env.FakeHandler))).Methods("DELETE")
-
 	router.Handle("/{item:products}/l2eformula/{f}", securechain.Then(env.AppMiddleware(env.ConvertProductEmpiricalToLinearFormulaHandler))).Methods("GET")
 	router.Handle("/{view:v}/{item:products}", securechain.Then(env.AppMiddleware(env.VGetProductsHandler))).Methods("GET")
 	router.Handle("/{view:vc}/{item:products}", securechain.Then(env.AppMiddleware(env.VCreateProductHandler))).Methods("GET")
@@ -114,6 +145,10 @@ func buildEndpoints(appFullURL string) (router *mux.Router) {
 	router.Handle("/{item:products}", securechain.Then(env.AppMiddleware(env.CreateProductHandler))).Methods("POST")
 	router.Handle("/{item:products}/{id}", securechain.Then(env.AppMiddleware(env.DeleteProductHandler))).Methods("DELETE")
 	router.Handle("/{item:bookmarks}/{id}", securechain.Then(env.AppMiddleware(env.ToogleProductBookmarkHandler))).Methods("PUT")
+	router.Handle("/{item:savedsearches}", securechain.Then(env.AppMiddleware(env.GetSavedSearchesHandler))).Methods("GET")
+	router.Handle("/{item:savedsearches}", securechain.Then(env.AppMiddleware(env.CreateSavedSearchHandler))).Methods("POST")
+	router.Handle("/{item:savedsearches}/{id}", securechain.Then(env.AppMiddleware(env.UpdateSavedSearchHandler))).Methods("PUT")
+	router.Handle("/{item:savedsearches}/{id}", securechain.Then(env.AppMiddleware(env.DeleteSavedSearchHandler))).Methods("DELETE")
 
 	router.Handle("/{item:products}/casnumbers/", securechain.Then(env.AppMiddleware(env.GetProductsCasNumbersHandler))).Methods("GET")
 	router.Handle("/{item:products}/casnumbers/{id}", securechain.Then(env.AppMiddleware(env.GetProductsCasNumberHandler))).Methods("GET")
@@ -152,17 +187,15 @@ func buildEndpoints(appFullURL string) (router *mux.Router) {
 	router.Handle("/{item:products}/suppliers/", securechain.Then(env.AppMiddleware(env.GetProductsSuppliersHandler))).Methods("GET")
 	router.Handle("/{item:products}/categories/", securechain.Then(env.AppMiddleware(env.GetProductsCategoriesHandler))).Methods("GET")
 	router.Handle("/{item:products}/tags/", securechain.Then(env.AppMiddleware(env.GetProductsTagsHandler))).Methods("GET")
+	router.Handle("/{item:products}/adrclasses/", securechain.Then(env.AppMiddleware(env.GetProductsAdrClassesHandler))).Methods("GET")
+	router.Handle("/{item:products}/duplicates/", securechain.Then(env.AppMiddleware(env.GetProductDuplicatesHandler))).Methods("GET")
+	router.Handle("/{item:products}/merges/", securechain.Then(env.AppMiddleware(env.GetProductMergesHandler))).Methods("GET")
+	router.Handle("/{item:products}/{id}/merge", securechain.Then(env.AppMiddleware(env.MergeProductsHandler))).Methods("POST")
 
 	router.Handle("/{item:products}/producers", securechain.Then(env.AppMiddleware(env.CreateProducerHandler))).Methods("POST")
 	router.Handle("/{item:products}/suppliers", securechain.Then(env.AppMiddleware(env.CreateSupplierHandler))).Methods("POST")
+	router.Handle("/{item:sharedcatalog}/{card:products|suppliers|producers}/{id}", securechain.Then(env.AppMiddleware(env.ShareCardHandler))).Methods("PUT")
 
-	router.Handle("/f/{view:v}/{item:products}", securechain.Then(env.AppMiddleware(env.FakeHandler))).Methods("GET")
-	router.Handle("/f/{view:vc}/{item:products}", securechain.Then(env.AppMiddleware(env.FakeHandler))).Methods("GET")
-	router.Handle("/f/{item:products}", securechain.Then(env.AppMiddleware(env.FakeHandler))).Methods("GET")
-	router.Handle("/f/{item:products}/{id}", securechain.Then(env.AppMiddleware(env.FakeHandler))).Methods("GET")
-	router.Handle("/f/{item:products}/{id}", securechain.Then(env.AppMiddleware(env.FakeHandler))).Methods("PUT")
-	router.Handle("/f/{item:products}", securechain.Then(env.AppMiddleware(env.FakeHandler))).Methods("POST")
-	router.Handle("/f/{item:products}/{id}", securechain.Then(env.AppMiddleware(env.FakeHandler))).Methods("DELETE")
 	// storages
 	router.Handle("/{view:v}/{item:storages}", securechain.Then(env.AppMiddleware(env.VGetStoragesHandler))).Methods("GET")
 	router.Handle("/{view:vc}/{item:storages}", securechain.Then(env.AppMiddleware(env.VCreateStorageHandler))).Methods("GET")
@@ -170,19 +203,19 @@ func buildEndpoints(appFullURL string) (router *mux.Router) {
 	router.Handle("/{item:storages}/others", securechain.Then(env.AppMiddleware(env.GetOtherStoragesHandler))).Methods("GET")
 	router.Handle("/{item:storages}/suppliers", securechain.Then(env.AppMiddleware(env.GetStoragesSuppliersHandler))).Methods("GET")
 	router.Handle("/{item:storages}/units", securechain.Then(env.AppMiddleware(env.GetStoragesUnitsHandler))).Methods("GET")
+	router.Handle("/{item:storages}/units/convert", securechain.Then(env.AppMiddleware(env.ConvertQuantityHandler))).Methods("GET")
 	router.Handle("/{item:storages}/{id}", securechain.Then(env.AppMiddleware(env.GetStorageHandler))).Methods("GET")
 	router.Handle("/{item:storages}/{id}", securechain.Then(env.AppMiddleware(env.UpdateStorageHandler))).Methods("PUT")
 	router.Handle("/{item:storages}", securechain.Then(env.AppMiddleware(env.CreateStorageHandler))).Methods("POST")
 	router.Handle("/{item:storages}/{id}", securechain.Then(env.AppMiddleware(env.DeleteStorageHandler))).Methods("DELETE")
 	router.Handle("/{item:storages}/{id}/a", securechain.Then(env.AppMiddleware(env.ArchiveStorageHandler))).Methods("DELETE")
 	router.Handle("/{item:storages}/{id}/r", securechain.Then(env.AppMiddleware(env.RestoreStorageHandler))).Methods("PUT")
+	router.Handle("/{item:storages}/{id}/split", securechain.Then(env.AppMiddleware(env.SplitStorageHandler))).Methods("POST")
+	router.Handle("/{item:storages}/{id}/lineage", securechain.Then(env.AppMiddleware(env.GetStorageLineageHandler))).Methods("GET")
+	router.Handle("/{item:storages}/preparations", securechain.Then(env.AppMiddleware(env.CreatePreparationHandler))).Methods("POST")
+	router.Handle("/{item:storages}/{id}/preparation", securechain.Then(env.AppMiddleware(env.GetPreparationHandler))).Methods("GET")
 	router.Handle("/{item:borrowings}", securechain.Then(env.AppMiddleware(env.ToogleStorageBorrowingHandler))).Methods("PUT")
 
-	router.Handle("/f/{item:storages}/{id}", securechain.Then(env.AppMiddleware(env.FakeHandler))).Methods("GET")
-	router.Handle("/f/{item:storages}/{id}", securechain.Then(env.AppMiddleware(env.FakeHandler))).Methods("PUT")
-	router.Handle("/f/{item:storages}", securechain.Then(env.AppMiddleware(env.FakeHandler))).Methods("POST")
-	router.Handle("/f/{item:storages}/{id}", securechain.Then(env.AppMiddleware(env.FakeHandler))).Methods("DELETE")
-
 	// validators
 	router.Handle("/{item:validate}/entity/{id}/name/", securechain.Then(env.AppMiddleware(env.ValidateEntityNameHandler))).Methods("POST")
 	router.Handle("/{item:validate}/person/{id}/email/", securechain.Then(env.AppMiddleware(env.ValidatePersonEmailHandler))).Methods("POST")
@@ -193,6 +226,8 @@ func buildEndpoints(appFullURL string) (router *mux.Router) {
 
 	// formatters
 	router.Handle("/{item:format}/product/{id}/empiricalformula/", securechain.Then(env.AppMiddleware(env.FormatProductEmpiricalFormulaHandler))).Methods("POST")
+	router.Handle("/{item:format}/product/{id}/molarmass/", securechain.Then(env.AppMiddleware(env.FormatProductMolarMassHandler))).Methods("POST")
+	router.Handle("/{item:format}/product/{id}/smiles/", securechain.Then(env.AppMiddleware(env.FormatProductSMILESHandler))).Methods("POST")
 
 	// export download
 	router.Handle("/{item:download}/{id}", securechain.Then(env.AppMiddleware(env.DownloadExportHandler))).Methods("GET")
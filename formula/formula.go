@@ -0,0 +1,265 @@
+// Parsing of chemical formulas into their elemental composition,
+// molar mass and Hill notation.
+package formula
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// ErrInvalidFormula is returned for the formulas that can not be parsed.
+var ErrInvalidFormula = errors.New("invalid formula")
+
+// Composition is the number of atoms of each element of a formula.
+type Composition map[string]int
+
+// Element is the share of an element in a formula.
+type Element struct {
+	Symbol       string  `json:"symbol"`
+	Count        int     `json:"count"`
+	Mass         float64 `json:"mass"`          // g/mol
+	MassFraction float64 `json:"mass_fraction"` // %
+}
+
+// hydrateSeparators separate the parts of an addition compound as CuSO4.5H2O.
+const hydrateSeparators = ".·•*"
+
+// parser parses a formula part.
+type parser struct {
+	formula string
+	pos     int
+}
+
+// Parse returns the composition of the formula f, as C2H6O, Ca(OH)2 or CuSO4.5H2O.
+func Parse(f string) (Composition, error) {
+	f = strings.Join(strings.Fields(f), "")
+
+	if f == "" {
+		return nil, ErrInvalidFormula
+	}
+
+	c := make(Composition)
+
+	for _, part := range strings.FieldsFunc(f, func(r rune) bool { return strings.ContainsRune(hydrateSeparators, r) }) {
+		// leading multiplier of the part
+		i := 0
+		for i < len(part) && part[i] >= '0' && part[i] <= '9' {
+			i++
+		}
+
+		multiplier := 1
+		if i > 0 {
+			multiplier, _ = strconv.Atoi(part[:i])
+		}
+
+		p := parser{formula: part[i:]}
+
+		pc, err := p.group(0)
+		if err != nil {
+			return nil, err
+		}
+
+		if p.pos != len(p.formula) {
+			return nil, fmt.Errorf("%w: unexpected %q in %s", ErrInvalidFormula, p.formula[p.pos], f)
+		}
+
+		for e, n := range pc {
+			c[e] += n * multiplier
+		}
+	}
+
+	if len(c) == 0 {
+		return nil, ErrInvalidFormula
+	}
+
+	return c, nil
+}
+
+// group parses the formula until the closing bracket if not 0.
+func (p *parser) group(closing byte) (Composition, error) {
+	c := make(Composition)
+
+	for p.pos < len(p.formula) {
+		b := p.formula[p.pos]
+
+		switch {
+		case b == closing:
+			return c, nil
+		case b == '(' || b == '[':
+			closer := byte(')')
+			if b == '[' {
+				closer = ']'
+			}
+
+			p.pos++
+
+			gc, err := p.group(closer)
+			if err != nil {
+				return nil, err
+			}
+
+			if p.pos >= len(p.formula) {
+				return nil, fmt.Errorf("%w: missing %q in %s", ErrInvalidFormula, closer, p.formula)
+			}
+
+			p.pos++
+
+			n := p.count()
+			for e, m := range gc {
+				c[e] += m * n
+			}
+		case b >= 'A' && b <= 'Z':
+			symbol := string(b)
+			p.pos++
+
+			if p.pos < len(p.formula) && p.formula[p.pos] >= 'a' && p.formula[p.pos] <= 'z' {
+				symbol += string(p.formula[p.pos])
+				p.pos++
+			}
+
+			if _, ok := AtomicWeights[symbol]; !ok {
+				return nil, fmt.Errorf("%w: unknown element %s", ErrInvalidFormula, symbol)
+			}
+
+			c[symbol] += p.count()
+		default:
+			return nil, fmt.Errorf("%w: unexpected %q in %s", ErrInvalidFormula, b, p.formula)
+		}
+	}
+
+	if closing != 0 {
+		return nil, fmt.Errorf("%w: missing %q in %s", ErrInvalidFormula, closing, p.formula)
+	}
+
+	return c, nil
+}
+
+// count parses the number of atoms or groups, 1 if not set.
+func (p *parser) count() int {
+	start := p.pos
+	for p.pos < len(p.formula) && unicode.IsDigit(rune(p.formula[p.pos])) {
+		p.pos++
+	}
+
+	if start == p.pos {
+		return 1
+	}
+
+	n, _ := strconv.Atoi(p.formula[start:p.pos])
+
+	return n
+}
+
+// hillOrder returns the elements of c in the Hill system order:
+// carbon, hydrogen and then alphabetical if the formula contains carbon,
+// all alphabetical otherwise.
+func (c Composition) hillOrder() []string {
+	symbols := make([]string, 0, len(c))
+	for e := range c {
+		symbols = append(symbols, e)
+	}
+
+	_, carbon := c["C"]
+
+	rank := func(e string) int {
+		if carbon {
+			switch e {
+			case "C":
+				return 0
+			case "H":
+				return 1
+			}
+		}
+
+		return 2
+	}
+
+	sort.Slice(symbols, func(i, j int) bool {
+		if rank(symbols[i]) != rank(symbols[j]) {
+			return rank(symbols[i]) < rank(symbols[j])
+		}
+
+		return symbols[i] < symbols[j]
+	})
+
+	return symbols
+}
+
+// Hill returns the formula of c in the Hill notation.
+func (c Composition) Hill() string {
+	var b strings.Builder
+
+	for _, e := range c.hillOrder() {
+		b.WriteString(e)
+
+		if c[e] != 1 {
+			b.WriteString(strconv.Itoa(c[e]))
+		}
+	}
+
+	return b.String()
+}
+
+// Equal returns true if c and o have the same elements and counts.
+func (c Composition) Equal(o Composition) bool {
+	if len(c) != len(o) {
+		return false
+	}
+
+	for e, n := range c {
+		if o[e] != n {
+			return false
+		}
+	}
+
+	return true
+}
+
+// MolarMass returns the molar mass of c in g/mol.
+func (c Composition) MolarMass() float64 {
+	var m float64
+
+	for e, n := range c {
+		m += AtomicWeights[e] * float64(n)
+	}
+
+	return round(m)
+}
+
+// Elements returns the elemental composition of c in the Hill system order.
+func (c Composition) Elements() []Element {
+	total := c.MolarMass()
+	elements := make([]Element, 0, len(c))
+
+	for _, e := range c.hillOrder() {
+		m := AtomicWeights[e] * float64(c[e])
+		elements = append(elements, Element{
+			Symbol:       e,
+			Count:        c[e],
+			Mass:         round(m),
+			MassFraction: round(100 * m / total),
+		})
+	}
+
+	return elements
+}
+
+// MolarMass returns the molar mass of the formula f in g/mol.
+func MolarMass(f string) (float64, error) {
+	c, err := Parse(f)
+	if err != nil {
+		return 0, err
+	}
+
+	return c.MolarMass(), nil
+}
+
+// round rounds f to 3 decimals.
+func round(f float64) float64 {
+	return math.Round(f*1000) / 1000
+}
@@ -0,0 +1,193 @@
+package formula
+
+import (
+	"errors"
+	"math"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		formula   string
+		hill      string
+		molarMass float64
+	}{
+		{"H2O", "H2O", 18.015},
+		{"C2H6O", "C2H6O", 46.069},
+		{"CH3CH2OH", "C2H6O", 46.069},
+		{"HOCH2CH3", "C2H6O", 46.069},
+		{"C 2 H 6 O", "C2H6O", 46.069},
+		{"NaCl", "ClNa", 58.44},
+		{"Ca(OH)2", "CaH2O2", 74.092},
+		{"K4[Fe(CN)6]", "C6FeK4N6", 368.345},
+		{"(CH3)3COH", "C4H10O", 74.123},
+		{"CuSO4.5H2O", "CuH10O9S", 249.677},
+		{"CuSO4·5H2O", "CuH10O9S", 249.677},
+		{"Na2CO3*10H2O", "CH20Na2O13", 286.138},
+		{"CHCl3", "CHCl3", 119.369},
+		{"Br2", "Br2", 159.808},
+	}
+
+	for _, tt := range tests {
+		c, err := Parse(tt.formula)
+		if err != nil {
+			t.Errorf("Parse(%q) error: %s", tt.formula, err)
+			continue
+		}
+
+		if got := c.Hill(); got != tt.hill {
+			t.Errorf("Parse(%q).Hill() = %s, want %s", tt.formula, got, tt.hill)
+		}
+
+		if got := c.MolarMass(); math.Abs(got-tt.molarMass) > 0.001 {
+			t.Errorf("Parse(%q).MolarMass() = %g, want %g", tt.formula, got, tt.molarMass)
+		}
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []string{
+		"",
+		"   ",
+		"h2o",
+		"Xx2",
+		"C2H6O)",
+		"Ca(OH2",
+		"K4[Fe(CN)6",
+		"K4[Fe(CN)6)",
+		"C2-H6",
+		"5",
+		".",
+	}
+
+	for _, f := range tests {
+		if c, err := Parse(f); !errors.Is(err, ErrInvalidFormula) {
+			t.Errorf("Parse(%q) = %v, %v, want %v", f, c, err, ErrInvalidFormula)
+		}
+	}
+}
+
+func TestElements(t *testing.T) {
+	c, err := Parse("C2H6O")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []Element{
+		{Symbol: "C", Count: 2, Mass: 24.022, MassFraction: 52.143},
+		{Symbol: "H", Count: 6, Mass: 6.048, MassFraction: 13.128},
+		{Symbol: "O", Count: 1, Mass: 15.999, MassFraction: 34.729},
+	}
+
+	got := c.Elements()
+	if len(got) != len(want) {
+		t.Fatalf("Elements() = %v, want %v", got, want)
+	}
+
+	var total float64
+
+	for i := range want {
+		if got[i].Symbol != want[i].Symbol || got[i].Count != want[i].Count ||
+			math.Abs(got[i].Mass-want[i].Mass) > 0.001 || math.Abs(got[i].MassFraction-want[i].MassFraction) > 0.001 {
+			t.Errorf("Elements()[%d] = %+v, want %+v", i, got[i], want[i])
+		}
+
+		total += got[i].MassFraction
+	}
+
+	if math.Abs(total-100) > 0.01 {
+		t.Errorf("Elements() mass fractions sum = %g, want 100", total)
+	}
+}
+
+func TestEqual(t *testing.T) {
+	tests := []struct {
+		a, b  string
+		equal bool
+	}{
+		{"C2H6O", "CH3CH2OH", true},
+		{"C2H6O", "CH3OCH3", true},
+		{"CuSO4.5H2O", "CuH10O9S", true},
+		{"C2H6O", "C2H6", false},
+		{"C2H6O", "C2H6S", false},
+		{"H2O", "H2O2", false},
+	}
+
+	for _, tt := range tests {
+		a, err := Parse(tt.a)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		b, err := Parse(tt.b)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if got := a.Equal(b); got != tt.equal {
+			t.Errorf("Equal(%s, %s) = %t, want %t", tt.a, tt.b, got, tt.equal)
+		}
+	}
+}
+
+func TestMolarMass(t *testing.T) {
+	if m, err := MolarMass("C6H12O6"); err != nil || math.Abs(m-180.156) > 0.001 {
+		t.Errorf("MolarMass(C6H12O6) = %g, %v, want 180.156", m, err)
+	}
+
+	if _, err := MolarMass("C6H12O6)"); !errors.Is(err, ErrInvalidFormula) {
+		t.Errorf("MolarMass(C6H12O6)) error = %v, want %v", err, ErrInvalidFormula)
+	}
+}
+
+func TestParseInChI(t *testing.T) {
+	tests := []struct {
+		inchi string
+		hill  string
+	}{
+		{"InChI=1S/C2H6O/c1-2-3/h3H,2H2,1H3", "C2H6O"},
+		{"InChI=1S/H2O/h1H2", "H2O"},
+		// ammonium, protonated ammonia
+		{"InChI=1S/H3N/h1H3/p+1", "H4N"},
+		// acetate, deprotonated acetic acid
+		{"InChI=1S/C2H4O2/c1-2(3)4/h1H3,(H,3,4)/p-1", "C2H3O2"},
+	}
+
+	for _, tt := range tests {
+		c, err := ParseInChI(tt.inchi)
+		if err != nil {
+			t.Errorf("ParseInChI(%q) error: %s", tt.inchi, err)
+			continue
+		}
+
+		if got := c.Hill(); got != tt.hill {
+			t.Errorf("ParseInChI(%q) = %s, want %s", tt.inchi, got, tt.hill)
+		}
+	}
+
+	for _, i := range []string{"", "C2H6O", "InChI=1S", "InChI=1S/C2H6Q/c1-2-3", "InChI=1S/H3N/h1H3/px"} {
+		if _, err := ParseInChI(i); !errors.Is(err, ErrInvalidInChI) {
+			t.Errorf("ParseInChI(%q) error = %v, want %v", i, err, ErrInvalidInChI)
+		}
+	}
+}
+
+func TestIsInChIKey(t *testing.T) {
+	tests := []struct {
+		key   string
+		valid bool
+	}{
+		{"LFQSCWFLJHTTHZ-UHFFFAOYSA-N", true},
+		{"XLYOFNOQVPJJNP-UHFFFAOYSA-N", true},
+		{"LFQSCWFLJHTTHZ-UHFFFAOYSA", false},
+		{"lfqscwfljhtthz-uhfffaoysa-n", false},
+		{"LFQSCWFLJHTTHZ-UHFFFAOYXA-N", false},
+		{"InChI=1S/H2O/h1H2", false},
+	}
+
+	for _, tt := range tests {
+		if got := IsInChIKey(tt.key); got != tt.valid {
+			t.Errorf("IsInChIKey(%q) = %t, want %t", tt.key, got, tt.valid)
+		}
+	}
+}
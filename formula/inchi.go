@@ -0,0 +1,53 @@
+package formula
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// ErrInvalidInChI is returned for the InChIs that can not be parsed.
+var ErrInvalidInChI = errors.New("invalid InChI")
+
+var inchiKeyRegex = regexp.MustCompile(`^[A-Z]{14}-[A-Z]{8}[SN]A-[A-Z]$`)
+
+// IsInChIKey returns true if k is a well formed InChIKey as LFQSCWFLJHTTHZ-UHFFFAOYSA-N.
+func IsInChIKey(k string) bool {
+	return inchiKeyRegex.MatchString(k)
+}
+
+// ParseInChI returns the composition of the InChI i from its formula
+// and protonation layers, as InChI=1S/C2H6O/c1-2-3/h3H,2H2,1H3.
+func ParseInChI(i string) (Composition, error) {
+	layers := strings.Split(strings.TrimSpace(i), "/")
+
+	if len(layers) < 2 || !strings.HasPrefix(layers[0], "InChI=1") {
+		return nil, ErrInvalidInChI
+	}
+
+	c, err := Parse(layers[1])
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidInChI, err.Error())
+	}
+
+	// the formula layer is the one of the neutral molecule
+	for _, l := range layers[2:] {
+		if !strings.HasPrefix(l, "p") {
+			continue
+		}
+
+		p, err := strconv.Atoi(strings.TrimPrefix(l[1:], "+"))
+		if err != nil {
+			return nil, fmt.Errorf("%w: protonation layer %s", ErrInvalidInChI, l)
+		}
+
+		c["H"] += p
+		if c["H"] <= 0 {
+			delete(c, "H")
+		}
+	}
+
+	return c, nil
+}
@@ -7,9 +7,6 @@ go 1.25.0
 require (
 	github.com/BurntSushi/toml v1.3.2
 	github.com/casbin/casbin/v2 v2.77.2
-	github.com/dchest/authcookie v0.0.0-20190824115100-f900d2294c8e // indirect
-	github.com/dchest/passwordreset v0.0.0-20190826080013-4518b1f41006
-	github.com/dgrijalva/jwt-go v3.2.0+incompatible
 	github.com/doug-martin/goqu/v9 v9.18.0
 	github.com/gorilla/mux v1.8.0
 	github.com/jmoiron/sqlx v1.3.5
@@ -26,7 +23,6 @@ require (
 )
 
 require (
-	github.com/casbin/json-adapter/v2 v2.1.1
 	github.com/go-ldap/ldap/v3 v3.4.6
 	github.com/golang-jwt/jwt v3.2.2+incompatible
 	github.com/russross/blackfriday/v2 v2.1.0
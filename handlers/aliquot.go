@@ -0,0 +1,192 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+	"github.com/sirupsen/logrus"
+	"github.com/tbellembois/gochimitheque/datastores"
+	"github.com/tbellembois/gochimitheque/logger"
+	"github.com/tbellembois/gochimitheque/models"
+	"github.com/tbellembois/gochimitheque/request"
+)
+
+// storageSplit is the body of the storage split request.
+type storageSplit struct {
+	Aliquots []models.Aliquot `json:"aliquots"`
+}
+
+// SplitStorageHandler splits the storage with the requested id into aliquots
+// in store locations of the same entity.
+func (env *Env) SplitStorageHandler(w http.ResponseWriter, r *http.Request) *models.AppError {
+	vars := mux.Vars(r)
+
+	var (
+		id  int
+		ids []int64
+		s   models.Storage
+		ss  storageSplit
+		err error
+	)
+
+	if id, err = strconv.Atoi(vars["id"]); err != nil {
+		return &models.AppError{
+			OriginalError: err,
+			Message:       "id atoi conversion",
+			Code:          http.StatusInternalServerError,
+		}
+	}
+
+	if err = json.NewDecoder(r.Body).Decode(&ss); err != nil {
+		return &models.AppError{
+			OriginalError: err,
+			Message:       "JSON decoding error",
+			Code:          http.StatusBadRequest,
+		}
+	}
+
+	logger.Log.WithFields(logrus.Fields{"id": id, "ss": ss}).Debug("SplitStorageHandler")
+
+	if s, err = env.DB.GetStorage(id); err != nil {
+		if err == sql.ErrNoRows {
+			return &models.AppError{
+				OriginalError: err,
+				Message:       "storage not found",
+				Code:          http.StatusNotFound,
+			}
+		}
+
+		return &models.AppError{
+			OriginalError: err,
+			Message:       "get storage",
+			Code:          http.StatusInternalServerError,
+		}
+	}
+
+	if s.StorageArchive.Bool {
+		return &models.AppError{
+			Message: "an archived storage can not be split",
+			Code:    http.StatusBadRequest,
+		}
+	}
+
+	if len(ss.Aliquots) == 0 {
+		return &models.AppError{
+			Message: "no aliquot",
+			Code:    http.StatusBadRequest,
+		}
+	}
+
+	for _, a := range ss.Aliquots {
+		if a.StorageQuantity <= 0 {
+			return &models.AppError{
+				Message: "the aliquots quantities must be positive",
+				Code:    http.StatusBadRequest,
+			}
+		}
+
+		var sl models.StoreLocation
+
+		if sl, err = env.DB.GetStoreLocation(int(a.StoreLocationID)); err != nil {
+			return &models.AppError{
+				OriginalError: err,
+				Message:       "error retrieving the aliquot store location",
+				Code:          http.StatusBadRequest,
+			}
+		}
+
+		if sl.EntityID != s.StoreLocation.EntityID {
+			return &models.AppError{
+				Message: "the aliquots must be stored in the entity of the storage",
+				Code:    http.StatusBadRequest,
+			}
+		}
+	}
+
+	c := request.ContainerFromRequestContext(r)
+
+	if ids, err = env.DB.SplitStorage(id, ss.Aliquots, c.PersonID); err != nil {
+		if err == datastores.ErrInsufficientQuantity {
+			return &models.AppError{
+				OriginalError: err,
+				Message:       err.Error(),
+				Code:          http.StatusBadRequest,
+			}
+		}
+
+		return &models.AppError{
+			OriginalError: err,
+			Message:       "split storage error",
+			Code:          http.StatusInternalServerError,
+		}
+	}
+
+	result := make([]models.Storage, 0, len(ids))
+	for _, i := range ids {
+		result = append(result, models.Storage{
+			StorageID:       sql.NullInt64{Valid: true, Int64: i},
+			StorageParentID: sql.NullInt64{Valid: true, Int64: int64(id)},
+		})
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+
+	if err = json.NewEncoder(w).Encode(result); err != nil {
+		return &models.AppError{
+			Code:    http.StatusInternalServerError,
+			Message: err.Error(),
+		}
+	}
+
+	return nil
+}
+
+// GetStorageLineageHandler returns a json tree of the storage with the requested id lineage,
+// from the storage it has been split from first.
+func (env *Env) GetStorageLineageHandler(w http.ResponseWriter, r *http.Request) *models.AppError {
+	vars := mux.Vars(r)
+
+	var (
+		id      int
+		lineage models.StorageLineage
+		err     error
+	)
+
+	if id, err = strconv.Atoi(vars["id"]); err != nil {
+		return &models.AppError{
+			OriginalError: err,
+			Message:       "id atoi conversion",
+			Code:          http.StatusInternalServerError,
+		}
+	}
+
+	if lineage, err = env.DB.GetStorageLineage(id); err != nil {
+		if err == sql.ErrNoRows {
+			return &models.AppError{
+				OriginalError: err,
+				Message:       "storage not found",
+				Code:          http.StatusNotFound,
+			}
+		}
+
+		return &models.AppError{
+			OriginalError: err,
+			Message:       "error getting the storage lineage",
+			Code:          http.StatusInternalServerError,
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+
+	if err = json.NewEncoder(w).Encode(lineage); err != nil {
+		return &models.AppError{
+			Code:    http.StatusInternalServerError,
+			Message: err.Error(),
+		}
+	}
+
+	return nil
+}
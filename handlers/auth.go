@@ -8,19 +8,14 @@ import (
 	"encoding/base64"
 	"encoding/hex"
 	"encoding/json"
-	"fmt"
 	"net/http"
 	"strconv"
 	"strings"
 	"time"
 
-	"github.com/dchest/passwordreset"
-	"github.com/golang-jwt/jwt"
 	"github.com/nicksnyder/go-i18n/v2/i18n"
 	"github.com/sirupsen/logrus"
 	"github.com/steambap/captcha"
-	"github.com/tbellembois/gochimitheque/aes"
-	"github.com/tbellembois/gochimitheque/casbin"
 	"github.com/tbellembois/gochimitheque/ldap"
 	"github.com/tbellembois/gochimitheque/locales"
 	"github.com/tbellembois/gochimitheque/logger"
@@ -144,56 +139,81 @@ func (env *Env) CaptchaHandler(w http.ResponseWriter, r *http.Request) *models.A
 	return nil
 }
 
-// RequestResetPasswordHandler reset the user password from the token.
-func (env *Env) RequestResetPasswordHandler(w http.ResponseWriter, r *http.Request) *models.AppError {
+// VResetPasswordHandler returns the page to choose a new password
+// from a password reset link.
+func (env *Env) VResetPasswordHandler(w http.ResponseWriter, r *http.Request) *models.AppError {
+	c := request.ContainerFromRequestContext(r)
+
+	jade.Resetpassword(c, w)
+
+	return nil
+}
+
+// ResetPasswordFromTokenHandler sets the new password of the person of a password reset link,
+// the link can be used once and the sessions of the person are revoked.
+func (env *Env) ResetPasswordFromTokenHandler(w http.ResponseWriter, r *http.Request) *models.AppError {
 	var (
-		tokenquery []string
-		token      string
-		ok         bool
-		err        error
+		query struct {
+			Token               string `json:"token"`
+			PersonPassword      string `json:"person_password"`
+			PersonPasswordAgain string `json:"person_passwordagain"`
+		}
+		pr     models.PasswordReset
+		person models.Person
+		aerr   *models.AppError
+		err    error
 	)
 
-	if tokenquery, ok = r.URL.Query()["token"]; !ok {
+	if err = json.NewDecoder(r.Body).Decode(&query); err != nil {
 		return &models.AppError{
-			Code:    http.StatusBadRequest,
-			Message: "token not found in request",
+			OriginalError: err,
+			Message:       "JSON decoding error",
+			Code:          http.StatusBadRequest,
 		}
 	}
-	token = tokenquery[0]
 
-	var login string
+	invalidToken := &models.AppError{
+		Code:    http.StatusBadRequest,
+		Message: locales.Localizer.MustLocalize(&i18n.LocalizeConfig{MessageID: "resetpassword_invalid_token", PluralCount: 1}),
+	}
+
+	if pr, err = env.DB.GetPasswordReset(hashToken(query.Token)); err != nil {
+		if err == sql.ErrNoRows {
+			return invalidToken
+		}
 
-	if login, err = passwordreset.VerifyToken(token, env.GetPasswordHash, env.TokenSignKey); err != nil {
 		return &models.AppError{
-			Code:          http.StatusForbidden,
+			Code:          http.StatusInternalServerError,
 			OriginalError: err,
-			Message:       "password reset token not verified",
+			Message:       "error getting the password reset link",
 		}
 	}
 
-	var person models.Person
+	if pr.IsExpired() {
+		return invalidToken
+	}
 
-	if person, err = env.DB.GetPersonByEmail(login); err != nil {
+	if query.PersonPassword != query.PersonPasswordAgain {
 		return &models.AppError{
-			Code:          http.StatusInternalServerError,
-			OriginalError: err,
-			Message:       "error getting user",
+			Code:    http.StatusBadRequest,
+			Message: locales.Localizer.MustLocalize(&i18n.LocalizeConfig{MessageID: "not_same_password", PluralCount: 1}),
 		}
 	}
 
-	// Generating a random password with the login.
-	var ph []byte
+	if aerr = env.checkPasswordPolicy(query.PersonPassword); aerr != nil {
+		return aerr
+	}
 
-	if ph, err = env.GetPasswordHash(login); err != nil {
+	if person, err = env.DB.GetPerson(pr.PersonID); err != nil {
 		return &models.AppError{
 			Code:          http.StatusInternalServerError,
 			OriginalError: err,
-			Message:       "error generating password hash",
+			Message:       "error getting user",
 		}
 	}
-	person.PersonPassword = hex.EncodeToString(ph)
 
-	// Updating the person password.
+	person.PersonPassword = query.PersonPassword
+
 	if err = env.DB.UpdatePersonPassword(person); err != nil {
 		return &models.AppError{
 			Code:          http.StatusInternalServerError,
@@ -202,25 +222,39 @@ func (env *Env) RequestResetPasswordHandler(w http.ResponseWriter, r *http.Reque
 		}
 	}
 
-	// Send reset password mail.
-	msgbody := fmt.Sprintf(locales.Localizer.MustLocalize(&i18n.LocalizeConfig{MessageID: "resetpassword_mailbody1", PluralCount: 1}), person.PersonPassword)
-	msgsubject := locales.Localizer.MustLocalize(&i18n.LocalizeConfig{MessageID: "resetpassword_mailsubject1", PluralCount: 1})
+	if err = env.DB.DeletePersonPasswordResets(person.PersonID); err != nil {
+		return &models.AppError{
+			Code:          http.StatusInternalServerError,
+			OriginalError: err,
+			Message:       "error deleting the password reset link",
+		}
+	}
 
-	if err = mailer.SendMail(login, msgsubject, msgbody); err != nil {
+	if err = env.DB.DeletePersonSessions(person.PersonID); err != nil {
 		return &models.AppError{
 			Code:          http.StatusInternalServerError,
 			OriginalError: err,
-			Message:       "error sending the new password mail",
+			Message:       "error revoking the sessions",
 		}
 	}
 
-	// Redirect home.
-	msgdone := fmt.Sprintf(locales.Localizer.MustLocalize(&i18n.LocalizeConfig{MessageID: "resetpassword_done", PluralCount: 1}), person.PersonEmail)
-	http.Redirect(w, r, env.AppFullURL+"?message="+msgdone, http.StatusSeeOther)
+	// the mailbox owner can log in again
+	env.loginSucceeded(person.PersonEmail)
+	env.audit(r, "password_reset", person.PersonEmail, "")
+
+	if _, err = w.Write([]byte(locales.Localizer.MustLocalize(&i18n.LocalizeConfig{MessageID: "resetpassword_done", PluralCount: 1}))); err != nil {
+		return &models.AppError{
+			Code:    http.StatusInternalServerError,
+			Message: err.Error(),
+		}
+	}
 
 	return nil
 }
 
+// passwordResetTTL is the lifetime of a password reset link.
+const passwordResetTTL = time.Hour
+
 // ResetPasswordHandler send a password reinitialisation link by mail.
 func (env *Env) ResetPasswordHandler(w http.ResponseWriter, r *http.Request) *models.AppError {
 	var (
@@ -263,14 +297,14 @@ func (env *Env) ResetPasswordHandler(w http.ResponseWriter, r *http.Request) *mo
 		}
 	}
 
-	// Get the person from db.
-	if _, err = env.DB.GetPersonByEmail(person.PersonEmail); err != nil {
+	// Get the person from db,
+	// not revealing if the person exists.
+	var p models.Person
+
+	if p, err = env.DB.GetPersonByEmail(person.PersonEmail); err != nil {
 		if err == sql.ErrNoRows {
-			return &models.AppError{
-				Code:          http.StatusUnauthorized,
-				OriginalError: err,
-				Message:       "user not found in database",
-			}
+			logger.Log.WithFields(logrus.Fields{"email": person.PersonEmail}).Debug("ResetPasswordHandler: user not found")
+			return nil
 		}
 
 		return &models.AppError{
@@ -280,24 +314,41 @@ func (env *Env) ResetPasswordHandler(w http.ResponseWriter, r *http.Request) *mo
 		}
 	}
 
-	// Generate a password hash.
-	var hash []byte
+	// Generate a single use reinitialization token.
+	var token string
 
-	if hash, err = env.GetPasswordHash(person.PersonEmail); err != nil {
+	if token, err = newSessionSecret(); err != nil {
 		return &models.AppError{
 			Code:          http.StatusInternalServerError,
 			OriginalError: err,
-			Message:       "error generating the password hash",
+			Message:       "error generating the reinitialization token",
 		}
 	}
 
-	// Generate a reinitialization token.
-	token := passwordreset.NewToken(person.PersonEmail, 12*time.Hour, hash, env.TokenSignKey)
+	if err = env.DB.CreatePasswordReset(models.PasswordReset{
+		PasswordResetHash:           hashToken(token),
+		PasswordResetExpirationDate: time.Now().Add(passwordResetTTL),
+		PersonID:                    p.PersonID,
+	}); err != nil {
+		return &models.AppError{
+			Code:          http.StatusInternalServerError,
+			OriginalError: err,
+			Message:       "error creating the reinitialization link",
+		}
+	}
 
 	// Send reset password mail.
-	msgbody := fmt.Sprintf(locales.Localizer.MustLocalize(&i18n.LocalizeConfig{MessageID: "resetpassword_mailbody2", PluralCount: 1}), env.AppFullURL, token)
+	msgbody := locales.Localizer.MustLocalize(&i18n.LocalizeConfig{
+		MessageID: "resetpassword_mailbody2",
+		TemplateData: map[string]interface{}{
+			"Email":    p.PersonEmail,
+			"URL":      env.AppFullURL + "reset?token=" + token,
+			"Validity": passwordResetTTL.String(),
+		},
+		PluralCount: 1,
+	})
 	msgsubject := locales.Localizer.MustLocalize(&i18n.LocalizeConfig{MessageID: "resetpassword_mailsubject2", PluralCount: 1})
-	if err = mailer.SendMail(person.PersonEmail, msgsubject, msgbody); err != nil {
+	if err = mailer.SendMail(p.PersonEmail, msgsubject, msgbody); err != nil {
 		return &models.AppError{
 			Code:          http.StatusInternalServerError,
 			OriginalError: err,
@@ -308,10 +359,23 @@ func (env *Env) ResetPasswordHandler(w http.ResponseWriter, r *http.Request) *mo
 	return nil
 }
 
-// DeleteTokenHandler reset the token cookie.
+// DeleteTokenHandler revokes the session of the request refresh token
+// and resets the token cookies.
 func (env *Env) DeleteTokenHandler(w http.ResponseWriter, r *http.Request) *models.AppError {
 	logger.Log.Debug("DeleteTokenHandler")
-	http.Redirect(w, r, env.AppFullURL, http.StatusTemporaryRedirect)
+
+	if c, err := r.Cookie(refreshTokenCookie); err == nil {
+		uid, _, _ := strings.Cut(c.Value, ".")
+
+		if s, err := env.DB.GetSession(uid); err == nil {
+			if err = env.DB.DeleteSession(s.SessionID); err != nil {
+				logger.Log.Errorf("delete session: %s", err)
+			}
+		}
+	}
+
+	env.clearSessionCookies(w)
+	http.Redirect(w, r, env.AppFullURL, http.StatusSeeOther)
 
 	return nil
 }
@@ -322,14 +386,14 @@ func (env *Env) DeleteTokenHandler(w http.ResponseWriter, r *http.Request) *mode
 // @tags authentication
 // @Accept json
 // @Produce plain
-// @Param Person body models.Person true "Person with only `person_email` and `person_password` or `qrcode` (full plain qrcode string) fields."
+// @Param Person body models.Person true "Person with only `person_email` and `person_password` or `qrcode` (scanned device token) fields."
 // @Success 200 {string} Token "qwerty"
 // @Failure 500
 // @Failure 403
 // @Router /get-token [get].
-func (env *Env) GetTokenHandler(w http.ResponseWriter, r *http.Request) *models.AppError {
+func (env *Env) GetTokenHandler(w http.ResponseWriter, r *http.Request) (aerr *models.AppError) {
 	var (
-		qrcodeAuthenticated             bool
+		totpPending                     bool
 		person                          models.Person
 		personquery                     *models.Person
 		userFoundInLDAP, userBindInLDAP bool
@@ -349,37 +413,44 @@ func (env *Env) GetTokenHandler(w http.ResponseWriter, r *http.Request) *models.
 		"len(personquery.QRCode)": len(personquery.QRCode),
 	}).Debug("GetTokenHandler")
 
-	// If a qrcode is present, decoding it
+	// Brute force protection, counting the failed authentications
+	// of the account and of the client IP.
+	login := personquery.PersonEmail
 	if len(personquery.QRCode) > 0 {
-		credentials := strings.Split(string(personquery.QRCode), ":")
-		personquery.PersonEmail = credentials[0]
-		encryptedPassword := credentials[1]
+		login = env.deviceTokenLogin(string(personquery.QRCode))
+	}
 
-		var dbPerson models.Person
+	if aerr = env.checkLoginFailures(w, r, login, personquery); aerr != nil {
+		return aerr
+	}
 
-		if dbPerson, err = env.DB.GetPersonByEmail(personquery.PersonEmail); err != nil {
-			return &models.AppError{
-				Code:          http.StatusInternalServerError,
-				OriginalError: err,
-				Message:       "error getting user",
+	defer func() {
+		switch {
+		case aerr == nil:
+			// the login succeeds with the TOTP code
+			if !totpPending {
+				env.loginSucceeded(login)
 			}
+		case aerr.Code == http.StatusUnauthorized:
+			env.loginFailed(r, login)
 		}
-		person.PersonEmail = dbPerson.PersonEmail
-		person.PersonID = dbPerson.PersonID
-
-		decryptedPassword := aes.Decrypt(encryptedPassword, dbPerson.PersonAESKey)
+	}()
 
-		logger.Log.WithFields(logrus.Fields{
-			"decryptedPassword":       decryptedPassword,
-			"dbPerson.PersonPassword": dbPerson.PersonPassword,
-		}).Debug("GetTokenHandler")
+	// If a qrcode is present, it is a device token.
+	if len(personquery.QRCode) > 0 {
+		if person, err = env.authenticateDeviceToken(string(personquery.QRCode)); err != nil {
+			code := http.StatusUnauthorized
+			if err != errDeviceTokenNotFound && err != errDeviceTokenExpired && err != errInvalidDeviceToken {
+				code = http.StatusInternalServerError
+			}
 
-		if decryptedPassword == dbPerson.PersonPassword {
-			qrcodeAuthenticated = true
+			return &models.AppError{
+				Code:          code,
+				OriginalError: err,
+				Message:       err.Error(),
+			}
 		}
-	}
-
-	if !qrcodeAuthenticated {
+	} else {
 
 		if env.LDAPConnection.IsEnabled {
 			var sr *ldap.LDAPSearchResult
@@ -453,13 +524,6 @@ func (env *Env) GetTokenHandler(w http.ResponseWriter, r *http.Request) *models.
 						Code:          http.StatusInternalServerError,
 					}
 				}
-				if personquery.PersonAESKey, err = aes.GenerateAESKey(); err != nil {
-					return &models.AppError{
-						OriginalError: err,
-						Message:       "generate aes key error",
-						Code:          http.StatusInternalServerError,
-					}
-				}
 				if _, err := env.DB.CreatePerson(*personquery); err != nil {
 					return &models.AppError{
 						OriginalError: err,
@@ -475,7 +539,9 @@ func (env *Env) GetTokenHandler(w http.ResponseWriter, r *http.Request) *models.
 					}
 				}
 
-				env.Enforcer = casbin.InitCasbinPolicy(env.DB)
+				if aerr := env.reloadPolicies(person.PersonID); aerr != nil {
+					return aerr
+				}
 			} else {
 				return &models.AppError{
 					Code:          http.StatusInternalServerError,
@@ -497,56 +563,28 @@ func (env *Env) GetTokenHandler(w http.ResponseWriter, r *http.Request) *models.
 				}
 			}
 		}
-
-		// Updating the person password in the DB.
-		// Needed in the case of LDAP authentication for QRCode generation.
-		if err := env.DB.UpdatePersonPassword(*personquery); err != nil {
-			return &models.AppError{
-				OriginalError: err,
-				Message:       "update person password error",
-				Code:          http.StatusInternalServerError,
-			}
-		}
 	}
 
-	// Create the JWT token.
-	token := jwt.New(jwt.SigningMethodHS256)
-	claims := token.Claims.(jwt.MapClaims)
-	claims["email"] = person.PersonEmail
-	// claims["exp"] = time.Now().Add(time.Hour * 8).Unix()
+	// The second factor is validated by GetTOTPTokenHandler.
+	if totpPending, aerr = env.startTOTPLogin(w, person); aerr != nil || totpPending {
+		return aerr
+	}
 
-	// Sign the token.
-	var tokenString string
+	return env.logIn(w, r, person)
+}
 
-	if tokenString, err = token.SignedString(env.TokenSignKey); err != nil {
-		return &models.AppError{
-			Code:          http.StatusInternalServerError,
-			OriginalError: err,
-			Message:       "error signing token",
-		}
-	}
+// logIn creates a session for the authenticated person p,
+// sets the session and person cookies and writes the access token.
+func (env *Env) logIn(w http.ResponseWriter, r *http.Request, p models.Person) *models.AppError {
+	var (
+		tokenString string
+		aerr        *models.AppError
+		err         error
+	)
 
-	// Write the token to the browser window.
-	//
-	// w.Write([]byte(tokenString))
-	// Write the token in a cookie.
-	// further readings: https://www.calhoun.io/securing-cookies-in-go/
-	ctoken := http.Cookie{
-		Name:  "token",
-		Value: tokenString,
+	if tokenString, aerr = env.startLogIn(w, r, p); aerr != nil {
+		return aerr
 	}
-	cemail := http.Cookie{
-		Name:  "email",
-		Value: person.PersonEmail,
-	}
-	cid := http.Cookie{
-		Name:  "id",
-		Value: strconv.Itoa(person.PersonID),
-	}
-
-	http.SetCookie(w, &ctoken)
-	http.SetCookie(w, &cemail)
-	http.SetCookie(w, &cid)
 
 	if _, err = w.Write([]byte(tokenString)); err != nil {
 		return &models.AppError{
@@ -557,3 +595,18 @@ func (env *Env) GetTokenHandler(w http.ResponseWriter, r *http.Request) *models.
 
 	return nil
 }
+
+// startLogIn creates a session for the authenticated person p,
+// sets the session and person cookies and returns the access token.
+func (env *Env) startLogIn(w http.ResponseWriter, r *http.Request, p models.Person) (string, *models.AppError) {
+	// Create the session and its access and refresh tokens cookies.
+	tokenString, aerr := env.startSession(w, r, p)
+	if aerr != nil {
+		return "", aerr
+	}
+
+	http.SetCookie(w, env.newCookie("email", p.PersonEmail))
+	http.SetCookie(w, env.newCookie("id", strconv.Itoa(p.PersonID)))
+
+	return tokenString, nil
+}
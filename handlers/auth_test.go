@@ -0,0 +1,201 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/tbellembois/gochimitheque/datastores"
+	"github.com/tbellembois/gochimitheque/ldap"
+	"github.com/tbellembois/gochimitheque/models"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// newTestEnv returns an environment backed by a new database
+// with the default admin account.
+func newTestEnv(t *testing.T) *Env {
+	t.Helper()
+
+	db, err := datastores.NewSQLiteDBstore(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err = db.CreateDatabase(); err != nil {
+		t.Fatal(err)
+	}
+
+	env := NewEnv()
+	env.DB = db
+	env.TokenSignKey = []byte("test")
+	env.LDAPConnection = &ldap.LDAPConnection{}
+
+	return &env
+}
+
+func TestGetTokenHandler(t *testing.T) {
+	tests := []struct {
+		name     string
+		password string
+		totp     bool
+		want     int
+	}{
+		{"password", "chimitheque", false, http.StatusOK},
+		{"password and TOTP", "chimitheque", true, http.StatusAccepted},
+		{"wrong password", "wrong", false, http.StatusUnauthorized},
+		{"wrong password and TOTP", "wrong", true, http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			env := newTestEnv(t)
+
+			if tt.totp {
+				if err := env.DB.SavePersonTOTP(models.PersonTOTP{
+					PersonID:          1,
+					PersonTOTPSecret:  "JBSWY3DPEHPK3PXP",
+					PersonTOTPEnabled: true,
+				}); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			body := `{"person_email":"admin@chimitheque.fr","person_password":"` + tt.password + `"}`
+			r := httptest.NewRequest(http.MethodPost, "/get-token", strings.NewReader(body))
+			w := httptest.NewRecorder()
+
+			code := http.StatusOK
+			if aerr := env.GetTokenHandler(w, r); aerr != nil {
+				code = aerr.Code
+			} else if w.Code != http.StatusOK {
+				code = w.Code
+			}
+
+			if code != tt.want {
+				t.Fatalf("GetTokenHandler() code = %d, want %d", code, tt.want)
+			}
+
+			if code == http.StatusAccepted {
+				var l totpLogin
+				if err := json.NewDecoder(w.Body).Decode(&l); err != nil {
+					t.Fatal(err)
+				}
+
+				if l.TOTPToken == "" || !l.TOTPEnrolled {
+					t.Errorf("GetTokenHandler() = %+v, want a TOTP token of an enrolled person", l)
+				}
+			}
+
+			// A login waiting for its TOTP code is neither a failure nor a success.
+			_, err := env.DB.GetLoginFailure(loginFailureEmail, "admin@chimitheque.fr")
+			if failed := err == nil; failed != (tt.want == http.StatusUnauthorized) {
+				t.Errorf("login failure recorded = %t, want %t", failed, tt.want == http.StatusUnauthorized)
+			}
+		})
+	}
+}
+
+func TestResetPasswordFromTokenHandler(t *testing.T) {
+	// newReset creates a password reset link of the admin
+	// created the given duration ago and returns its token.
+	newReset := func(t *testing.T, env *Env, age time.Duration) string {
+		t.Helper()
+
+		token, err := newSessionSecret()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if err = env.DB.CreatePasswordReset(models.PasswordReset{
+			PasswordResetHash:           hashToken(token),
+			PasswordResetExpirationDate: time.Now().Add(passwordResetTTL - age),
+			PersonID:                    1,
+		}); err != nil {
+			t.Fatal(err)
+		}
+
+		return token
+	}
+
+	reset := func(env *Env, token string, password string) int {
+		body := `{"token":"` + token + `","person_password":"` + password + `","person_passwordagain":"` + password + `"}`
+		r := httptest.NewRequest(http.MethodPost, "/reset", strings.NewReader(body))
+
+		if aerr := env.ResetPasswordFromTokenHandler(httptest.NewRecorder(), r); aerr != nil {
+			return aerr.Code
+		}
+
+		return http.StatusOK
+	}
+
+	t.Run("single use", func(t *testing.T) {
+		env := newTestEnv(t)
+		newTestSession(t, env, testAdmin)
+		token := newReset(t, env, 0)
+
+		if code := reset(env, token, "n3wPassword"); code != http.StatusOK {
+			t.Fatalf("first reset code = %d, want %d", code, http.StatusOK)
+		}
+
+		if code := reset(env, token, "0therPassword"); code != http.StatusBadRequest {
+			t.Errorf("second reset code = %d, want %d", code, http.StatusBadRequest)
+		}
+
+		// the password of the first reset is kept and the sessions are revoked
+		p, err := env.DB.GetPersonByEmail(testAdmin.PersonEmail)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if bcrypt.CompareHashAndPassword([]byte(p.PersonPassword), []byte("n3wPassword")) != nil {
+			t.Errorf("password not updated by the first reset")
+		}
+
+		if sessions, _ := env.DB.GetPersonSessions(testAdmin.PersonID); len(sessions) != 0 {
+			t.Errorf("%d sessions not revoked", len(sessions))
+		}
+	})
+
+	t.Run("newer link", func(t *testing.T) {
+		env := newTestEnv(t)
+		token := newReset(t, env, 0)
+		newReset(t, env, 0)
+
+		if code := reset(env, token, "n3wPassword"); code != http.StatusBadRequest {
+			t.Errorf("reset with a replaced link code = %d, want %d", code, http.StatusBadRequest)
+		}
+	})
+
+	tests := []struct {
+		name string
+		age  time.Duration
+		want int
+	}{
+		{"59 minutes old", 59 * time.Minute, http.StatusOK},
+		{"61 minutes old", 61 * time.Minute, http.StatusBadRequest},
+		{"unknown token", -1, http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			env := newTestEnv(t)
+			token := newReset(t, env, tt.age)
+
+			if tt.age < 0 {
+				token += "x"
+			}
+
+			if code := reset(env, token, "n3wPassword"); code != tt.want {
+				t.Errorf("reset code = %d, want %d", code, tt.want)
+			}
+		})
+	}
+
+	if passwordResetTTL != time.Hour {
+		t.Errorf("passwordResetTTL = %s, want 1h", passwordResetTTL)
+	}
+}
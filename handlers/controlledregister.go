@@ -0,0 +1,440 @@
+package handlers
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/sirupsen/logrus"
+	"github.com/tbellembois/gochimitheque/logger"
+	"github.com/tbellembois/gochimitheque/models"
+	"github.com/tbellembois/gochimitheque/pdf"
+	"github.com/tbellembois/gochimitheque/request"
+)
+
+// registerSignaturePrefix ends the signed CSV reports, followed by the hex encoded signature.
+const registerSignaturePrefix = "signature,"
+
+// registerEntity returns the entity of the request vars if the logged person
+// is an admin or a manager of the entity.
+func (env *Env) registerEntity(r *http.Request) (models.Entity, *models.AppError) {
+	var (
+		err      error
+		id       int
+		isadmin  bool
+		entity   models.Entity
+		entities []models.Entity
+	)
+
+	c := request.ContainerFromRequestContext(r)
+
+	if id, err = strconv.Atoi(mux.Vars(r)["id"]); err != nil {
+		return entity, &models.AppError{
+			OriginalError: err,
+			Message:       "id atoi conversion",
+			Code:          http.StatusInternalServerError,
+		}
+	}
+
+	if entity, err = env.DB.GetEntity(id); err != nil {
+		if err == sql.ErrNoRows {
+			return entity, &models.AppError{
+				OriginalError: err,
+				Message:       "entity not found",
+				Code:          http.StatusNotFound,
+			}
+		}
+
+		return entity, &models.AppError{
+			OriginalError: err,
+			Message:       "error getting the entity",
+			Code:          http.StatusInternalServerError,
+		}
+	}
+
+	if isadmin, err = env.DB.IsPersonAdmin(c.PersonID); err != nil {
+		return entity, &models.AppError{
+			OriginalError: err,
+			Message:       "error getting the person admin status",
+			Code:          http.StatusInternalServerError,
+		}
+	}
+
+	if isadmin {
+		return entity, nil
+	}
+
+	if entities, err = env.DB.GetPersonManageEntities(c.PersonID); err != nil {
+		return entity, &models.AppError{
+			OriginalError: err,
+			Message:       "error getting the person managed entities",
+			Code:          http.StatusInternalServerError,
+		}
+	}
+
+	for _, e := range entities {
+		if e.EntityID == id {
+			return entity, nil
+		}
+	}
+
+	return entity, &models.AppError{
+		Message: "only admins and the entity managers can read the controlled substances register",
+		Code:    http.StatusForbidden,
+	}
+}
+
+// registerPeriod returns the period of the "from" and "to" parameters, as 2006-01-02,
+// both included. The default period is the previous month.
+// The returned to date is excluded.
+func registerPeriod(r *http.Request) (from time.Time, to time.Time, aerr *models.AppError) {
+	now := time.Now()
+
+	from = time.Date(now.Year(), now.Month()-1, 1, 0, 0, 0, 0, time.Local)
+	to = from.AddDate(0, 1, 0)
+
+	if v := r.URL.Query().Get("from"); v != "" {
+		var err error
+
+		if from, err = time.ParseInLocation("2006-01-02", v, time.Local); err != nil {
+			return from, to, &models.AppError{
+				OriginalError: err,
+				Message:       "invalid from date " + v,
+				Code:          http.StatusBadRequest,
+			}
+		}
+	}
+
+	if v := r.URL.Query().Get("to"); v != "" {
+		var err error
+
+		if to, err = time.ParseInLocation("2006-01-02", v, time.Local); err != nil {
+			return from, to, &models.AppError{
+				OriginalError: err,
+				Message:       "invalid to date " + v,
+				Code:          http.StatusBadRequest,
+			}
+		}
+
+		to = to.AddDate(0, 0, 1)
+	}
+
+	if !to.After(from) {
+		return from, to, &models.AppError{
+			Message: "the to date must not be before the from date",
+			Code:    http.StatusBadRequest,
+		}
+	}
+
+	return from, to, nil
+}
+
+// registerSignature returns the hex encoded signature of the report.
+func (env *Env) registerSignature(report []byte) string {
+	mac := hmac.New(sha256.New, env.ReportSignKey)
+	mac.Write([]byte("controlledregister:"))
+	mac.Write(report)
+
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// registerReport returns the CSV report of the register of the entity on the period,
+// without its signature. The report of a closed period does not change as long as
+// the register is not tampered with.
+func (env *Env) registerReport(entity models.Entity, from time.Time, to time.Time) ([]byte, error) {
+	var (
+		err      error
+		entries  []models.ControlledRegisterEntry
+		opening  []models.ControlledRegisterBalance
+		closing  []models.ControlledRegisterBalance
+		check    models.ControlledRegisterCheck
+		b        bytes.Buffer
+		lastHash string
+	)
+
+	if entries, err = env.DB.GetControlledRegister(entity.EntityID, from, to); err != nil {
+		return nil, err
+	}
+
+	if opening, err = env.DB.GetControlledRegisterBalances(entity.EntityID, from); err != nil {
+		return nil, err
+	}
+
+	if closing, err = env.DB.GetControlledRegisterBalances(entity.EntityID, to); err != nil {
+		return nil, err
+	}
+
+	if check, err = env.DB.VerifyControlledRegister(entity.EntityID); err != nil {
+		return nil, err
+	}
+
+	if len(entries) > 0 {
+		lastHash = entries[len(entries)-1].ControlledRegisterHash
+	}
+
+	chain := "valid"
+	if !check.Valid {
+		chain = fmt.Sprintf("broken at sequence %d", check.BrokenSequence)
+	}
+
+	float := func(f float64) string { return strconv.FormatFloat(f, 'f', -1, 64) }
+
+	csvwr := csv.NewWriter(&b)
+
+	records := [][]string{
+		{"controlled substances register"},
+		{"entity", strconv.Itoa(entity.EntityID), entity.EntityName},
+		{"period", from.Format("2006-01-02"), to.AddDate(0, 0, -1).Format("2006-01-02")},
+		{"opening_balance", "product_id", "product_name", "regulation", "unit", "balance"},
+	}
+
+	for _, ob := range opening {
+		records = append(records, []string{"opening_balance", strconv.Itoa(ob.ProductID), ob.ProductName, ob.ProductRegulation, ob.UnitLabel, float(ob.Balance)})
+	}
+
+	records = append(records, []string{"entry", "sequence", "date", "event", "storage_id", "storage_barecode", "product_id", "product_name", "regulation", "quantity", "unit", "balance", "person", "hash"})
+
+	for _, e := range entries {
+		records = append(records, []string{
+			"entry",
+			strconv.Itoa(e.ControlledRegisterSequence),
+			e.ControlledRegisterDate.UTC().Format(time.RFC3339),
+			e.ControlledRegisterEvent,
+			strconv.FormatInt(e.StorageID, 10),
+			e.StorageBarecode.String,
+			strconv.Itoa(e.ProductID),
+			e.ProductName,
+			e.ProductRegulation,
+			float(e.ControlledRegisterQuantity),
+			e.UnitLabel,
+			float(e.ControlledRegisterBalance),
+			e.PersonEmail,
+			e.ControlledRegisterHash,
+		})
+	}
+
+	records = append(records, []string{"closing_balance", "product_id", "product_name", "regulation", "unit", "balance"})
+
+	for _, cb := range closing {
+		records = append(records, []string{"closing_balance", strconv.Itoa(cb.ProductID), cb.ProductName, cb.ProductRegulation, cb.UnitLabel, float(cb.Balance)})
+	}
+
+	records = append(records,
+		[]string{"chain", chain},
+		[]string{"last_hash", lastHash})
+
+	if err = csvwr.WriteAll(records); err != nil {
+		return nil, err
+	}
+
+	return b.Bytes(), nil
+}
+
+/*
+	REST handlers
+*/
+
+// GetControlledRegisterHandler returns a json list of the register entries of the requested entity
+// on the "from" "to" period, only for admins and the entity managers.
+func (env *Env) GetControlledRegisterHandler(w http.ResponseWriter, r *http.Request) *models.AppError {
+	var (
+		err     error
+		entries []models.ControlledRegisterEntry
+	)
+
+	entity, aerr := env.registerEntity(r)
+	if aerr != nil {
+		return aerr
+	}
+
+	from, to, aerr := registerPeriod(r)
+	if aerr != nil {
+		return aerr
+	}
+
+	logger.Log.WithFields(logrus.Fields{"entity": entity.EntityID, "from": from, "to": to}).Debug("GetControlledRegisterHandler")
+
+	if entries, err = env.DB.GetControlledRegister(entity.EntityID, from, to); err != nil {
+		return &models.AppError{
+			OriginalError: err,
+			Message:       "error getting the controlled substances register",
+			Code:          http.StatusInternalServerError,
+		}
+	}
+
+	type resp struct {
+		Rows  []models.ControlledRegisterEntry `json:"rows"`
+		Total int                              `json:"total"`
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	if err = json.NewEncoder(w).Encode(resp{Rows: entries, Total: len(entries)}); err != nil {
+		return &models.AppError{
+			OriginalError: err,
+			Code:          http.StatusInternalServerError,
+		}
+	}
+
+	return nil
+}
+
+// GetControlledRegisterReportHandler returns the signed report of the register of the requested
+// entity on the "from" "to" period, as CSV or as PDF with the "format" pdf parameter.
+func (env *Env) GetControlledRegisterReportHandler(w http.ResponseWriter, r *http.Request) *models.AppError {
+	var (
+		err    error
+		report []byte
+	)
+
+	entity, aerr := env.registerEntity(r)
+	if aerr != nil {
+		return aerr
+	}
+
+	from, to, aerr := registerPeriod(r)
+	if aerr != nil {
+		return aerr
+	}
+
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		format = "csv"
+	}
+
+	if format != "csv" && format != "pdf" {
+		return &models.AppError{
+			Message: "invalid format " + format,
+			Code:    http.StatusBadRequest,
+		}
+	}
+
+	if report, err = env.registerReport(entity, from, to); err != nil {
+		return &models.AppError{
+			OriginalError: err,
+			Message:       "error generating the controlled substances register report",
+			Code:          http.StatusInternalServerError,
+		}
+	}
+
+	signature := env.registerSignature(report)
+	filename := fmt.Sprintf("register-%d-%s-%s", entity.EntityID, from.Format("20060102"), to.AddDate(0, 0, -1).Format("20060102"))
+
+	env.audit(r, "register_report", "", fmt.Sprintf("%s %s %s", entity.EntityName, filename, format))
+
+	if format == "csv" {
+		w.Header().Set("Content-Type", "text/csv")
+		w.Header().Set("Content-Disposition", "attachment;filename="+filename+".csv")
+
+		if _, err = w.Write(append(report, []byte(registerSignaturePrefix+signature+"\n")...)); err != nil {
+			return &models.AppError{
+				OriginalError: err,
+				Code:          http.StatusInternalServerError,
+			}
+		}
+
+		return nil
+	}
+
+	// the PDF shows the lines of the CSV report and its signature
+	lines := bytes.Split(bytes.TrimSuffix(report, []byte("\n")), []byte("\n"))
+
+	text := make([]string, 0, len(lines)+3)
+	for _, l := range lines {
+		text = append(text, string(l))
+	}
+
+	text = append(text, "", registerSignaturePrefix+signature, "generated "+time.Now().Format(time.RFC3339))
+
+	w.Header().Set("Content-Type", "application/pdf")
+	w.Header().Set("Content-Disposition", "attachment;filename="+filename+".pdf")
+
+	if err = pdf.Write(w, "controlled substances register "+entity.EntityName, text); err != nil {
+		return &models.AppError{
+			OriginalError: err,
+			Code:          http.StatusInternalServerError,
+		}
+	}
+
+	return nil
+}
+
+// VerifyControlledRegisterHandler returns the verification of the hash chain
+// of the register of the requested entity.
+func (env *Env) VerifyControlledRegisterHandler(w http.ResponseWriter, r *http.Request) *models.AppError {
+	var (
+		err   error
+		check models.ControlledRegisterCheck
+	)
+
+	entity, aerr := env.registerEntity(r)
+	if aerr != nil {
+		return aerr
+	}
+
+	if check, err = env.DB.VerifyControlledRegister(entity.EntityID); err != nil {
+		return &models.AppError{
+			OriginalError: err,
+			Message:       "error verifying the controlled substances register",
+			Code:          http.StatusInternalServerError,
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	if err = json.NewEncoder(w).Encode(check); err != nil {
+		return &models.AppError{
+			OriginalError: err,
+			Code:          http.StatusInternalServerError,
+		}
+	}
+
+	return nil
+}
+
+// VerifyControlledRegisterReportHandler checks the signature of the CSV report of the request body.
+func (env *Env) VerifyControlledRegisterReportHandler(w http.ResponseWriter, r *http.Request) *models.AppError {
+	var (
+		err  error
+		body []byte
+	)
+
+	if body, err = io.ReadAll(io.LimitReader(r.Body, 32<<20)); err != nil {
+		return &models.AppError{
+			OriginalError: err,
+			Message:       "error reading the report",
+			Code:          http.StatusBadRequest,
+		}
+	}
+
+	// normalizing the line endings changed by the spreadsheets and editors
+	body = bytes.ReplaceAll(body, []byte("\r\n"), []byte("\n"))
+	body = bytes.TrimRight(body, "\n")
+
+	valid := false
+
+	if i := bytes.LastIndex(body, []byte("\n"+registerSignaturePrefix)); i != -1 {
+		report := body[:i+1]
+		signature := string(body[i+1+len(registerSignaturePrefix):])
+
+		valid = hmac.Equal([]byte(signature), []byte(env.registerSignature(report)))
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	if err = json.NewEncoder(w).Encode(map[string]bool{"valid": valid}); err != nil {
+		return &models.AppError{
+			OriginalError: err,
+			Code:          http.StatusInternalServerError,
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,113 @@
+package handlers
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/tbellembois/gochimitheque/models"
+)
+
+const (
+	// csrfTokenCookie is the name of the cookie holding the CSRF token,
+	// readable by the client to be sent back in the csrfTokenHeader header.
+	csrfTokenCookie = "csrf_token"
+	csrfTokenHeader = "X-CSRF-Token"
+)
+
+// originOf returns the "scheme://host[:port]" origin of the URL u,
+// or an empty string if u is not an absolute URL.
+func originOf(u string) string {
+	pu, err := url.Parse(u)
+	if err != nil || pu.Scheme == "" || pu.Host == "" {
+		return ""
+	}
+
+	return strings.ToLower(pu.Scheme + "://" + pu.Host)
+}
+
+// ParseOrigins returns the origins of the comma separated URLs list l.
+func ParseOrigins(l string) []string {
+	var origins []string
+
+	for _, u := range strings.Split(l, ",") {
+		if o := originOf(strings.TrimSpace(u)); o != "" {
+			origins = append(origins, o)
+		}
+	}
+
+	return origins
+}
+
+// requestOrigin returns the origin of the page issuing the request r,
+// from the Origin header or else the Referer header.
+func requestOrigin(r *http.Request) string {
+	if o := r.Header.Get("Origin"); o != "" {
+		return strings.ToLower(o)
+	}
+
+	return originOf(r.Header.Get("Referer"))
+}
+
+// isAllowedOrigin returns true if the origin o is the application one
+// or one of the CORS allowed origins.
+func (env *Env) isAllowedOrigin(o string) bool {
+	if o == "" {
+		return false
+	}
+
+	if o == originOf(env.AppURL) {
+		return true
+	}
+
+	for _, ao := range env.CORSOrigins {
+		if o == ao {
+			return true
+		}
+	}
+
+	return false
+}
+
+// isSecure returns true if the application is served over HTTPS.
+func (env *Env) isSecure() bool {
+	return strings.HasPrefix(strings.ToLower(env.AppURL), "https://")
+}
+
+// newCookie returns a cookie of the application path, secure if the application is served over HTTPS.
+// The cookies are sent with the cross site requests of the CORS allowed origins only if secure.
+func (env *Env) newCookie(name string, value string) *http.Cookie {
+	c := &http.Cookie{
+		Name:     name,
+		Value:    value,
+		Path:     env.AppPath,
+		Secure:   env.isSecure(),
+		SameSite: http.SameSiteLaxMode,
+	}
+
+	if c.Secure && len(env.CORSOrigins) > 0 {
+		c.SameSite = http.SameSiteNoneMode
+	}
+
+	return c
+}
+
+// csrfToken returns the CSRF token of the session with the given uid,
+// signed so that it can not be forged by a client setting the cookie.
+func (env *Env) csrfToken(sessionUID string) string {
+	mac := hmac.New(sha256.New, env.TokenSignKey)
+	mac.Write([]byte("csrf:" + sessionUID))
+
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// PreflightHandler answers the CORS preflight requests,
+// the headers are set by the HeadersMiddleware.
+func (env *Env) PreflightHandler(w http.ResponseWriter, r *http.Request) *models.AppError {
+	w.WriteHeader(http.StatusNoContent)
+
+	return nil
+}
@@ -0,0 +1,341 @@
+package handlers
+
+import (
+	"crypto/subtle"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/sirupsen/logrus"
+	"github.com/skip2/go-qrcode"
+	"github.com/tbellembois/gochimitheque/logger"
+	"github.com/tbellembois/gochimitheque/models"
+	"github.com/tbellembois/gochimitheque/request"
+)
+
+// defaultDeviceTokenName is the name of the device tokens created without name.
+const defaultDeviceTokenName = "QR code"
+
+var (
+	errDeviceTokenNotFound = errors.New("device token not found")
+	errDeviceTokenExpired  = errors.New("device token expired")
+	errInvalidDeviceToken  = errors.New("invalid device token")
+)
+
+// deviceTokenRequest is the body of the device token creation request.
+type deviceTokenRequest struct {
+	DeviceTokenName string `json:"devicetoken_name"`
+}
+
+// newDeviceToken is a created device token, the token and its QR code
+// can not be retrieved afterwards.
+type newDeviceToken struct {
+	models.DeviceToken
+	DeviceTokenToken  string `json:"devicetoken_token"`  // "<uid>.<secret>" to send as the get-token qrcode
+	DeviceTokenQRCode []byte `json:"devicetoken_qrcode"` // PNG of the token
+}
+
+// createDeviceToken creates a device token named name for the person p
+// and returns it with its QR code.
+func (env *Env) createDeviceToken(r *http.Request, p models.Person, name string) (newDeviceToken, *models.AppError) {
+	var (
+		uid, secret string
+		id          int64
+		err         error
+	)
+
+	failed := func(err error, message string) *models.AppError {
+		return &models.AppError{
+			OriginalError: err,
+			Message:       message,
+			Code:          http.StatusInternalServerError,
+		}
+	}
+
+	if err = env.DB.DeleteExpiredDeviceTokens(); err != nil {
+		logger.Log.Errorf("delete expired device tokens: %s", err)
+	}
+
+	if name = strings.TrimSpace(name); name == "" {
+		name = defaultDeviceTokenName
+	}
+
+	if uid, err = newSessionSecret(); err != nil {
+		return newDeviceToken{}, failed(err, "device token generation error")
+	}
+
+	if secret, err = newSessionSecret(); err != nil {
+		return newDeviceToken{}, failed(err, "device token generation error")
+	}
+
+	now := time.Now()
+	t := newDeviceToken{
+		DeviceToken: models.DeviceToken{
+			DeviceTokenUID:            uid,
+			DeviceTokenHash:           hashToken(secret),
+			DeviceTokenName:           name,
+			DeviceTokenCreationDate:   now,
+			DeviceTokenExpirationDate: now.Add(env.DeviceTokenTTL),
+			Person:                    p,
+		},
+		DeviceTokenToken: uid + "." + secret,
+	}
+
+	if id, err = env.DB.CreateDeviceToken(t.DeviceToken); err != nil {
+		return newDeviceToken{}, failed(err, "create device token error")
+	}
+
+	t.DeviceTokenID = int(id)
+
+	if t.DeviceTokenQRCode, err = qrcode.Encode(t.DeviceTokenToken, qrcode.Medium, 512); err != nil {
+		return newDeviceToken{}, failed(err, "qrcode generation error")
+	}
+
+	env.audit(r, "devicetoken_created", p.PersonEmail, name)
+
+	return t, nil
+}
+
+// deviceTokenLogin returns the email of the person of the device token,
+// or the token uid if not found, to count the failed authentications.
+func (env *Env) deviceTokenLogin(token string) string {
+	uid, _, _ := strings.Cut(token, ".")
+
+	if t, err := env.DB.GetDeviceToken(uid); err == nil {
+		return t.PersonEmail
+	}
+
+	return uid
+}
+
+// authenticateDeviceToken returns the person of the "<uid>.<secret>" device token
+// and sets its last used date.
+func (env *Env) authenticateDeviceToken(token string) (models.Person, error) {
+	var (
+		t   models.DeviceToken
+		err error
+	)
+
+	uid, secret, found := strings.Cut(token, ".")
+	if !found {
+		return models.Person{}, errInvalidDeviceToken
+	}
+
+	if t, err = env.DB.GetDeviceToken(uid); err != nil {
+		if err == sql.ErrNoRows {
+			return models.Person{}, errDeviceTokenNotFound
+		}
+
+		return models.Person{}, err
+	}
+
+	if subtle.ConstantTimeCompare([]byte(hashToken(secret)), []byte(t.DeviceTokenHash)) != 1 {
+		return models.Person{}, errInvalidDeviceToken
+	}
+
+	if t.IsExpired() {
+		return models.Person{}, errDeviceTokenExpired
+	}
+
+	if err = env.DB.UseDeviceToken(uid, time.Now()); err != nil {
+		return models.Person{}, err
+	}
+
+	return t.Person, nil
+}
+
+/*
+	REST handlers
+*/
+
+// GetDeviceTokensHandler returns a json list of the logged person device tokens.
+func (env *Env) GetDeviceTokensHandler(w http.ResponseWriter, r *http.Request) *models.AppError {
+	logger.Log.Debug("GetDeviceTokensHandler")
+
+	c := request.ContainerFromRequestContext(r)
+
+	tokens, err := env.DB.GetPersonDeviceTokens(c.PersonID)
+	if err != nil {
+		return &models.AppError{
+			OriginalError: err,
+			Code:          http.StatusInternalServerError,
+			Message:       "error getting the device tokens",
+		}
+	}
+
+	type resp struct {
+		Rows  []models.DeviceToken `json:"rows"`
+		Total int                  `json:"total"`
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+
+	if err = json.NewEncoder(w).Encode(resp{Rows: tokens, Total: len(tokens)}); err != nil {
+		return &models.AppError{
+			Code:    http.StatusInternalServerError,
+			Message: err.Error(),
+		}
+	}
+
+	return nil
+}
+
+// CreateDeviceTokenHandler creates a device token for the logged person
+// and returns it with its QR code.
+func (env *Env) CreateDeviceTokenHandler(w http.ResponseWriter, r *http.Request) *models.AppError {
+	var (
+		dr   deviceTokenRequest
+		p    models.Person
+		t    newDeviceToken
+		aerr *models.AppError
+		err  error
+	)
+
+	if err = json.NewDecoder(r.Body).Decode(&dr); err != nil {
+		return &models.AppError{
+			OriginalError: err,
+			Message:       "JSON decoding error",
+			Code:          http.StatusBadRequest,
+		}
+	}
+
+	c := request.ContainerFromRequestContext(r)
+
+	logger.Log.WithFields(logrus.Fields{"dr": dr}).Debug("CreateDeviceTokenHandler")
+
+	if p, err = env.DB.GetPerson(c.PersonID); err != nil {
+		return &models.AppError{
+			OriginalError: err,
+			Message:       "get person error",
+			Code:          http.StatusInternalServerError,
+		}
+	}
+
+	if t, aerr = env.createDeviceToken(r, p, dr.DeviceTokenName); aerr != nil {
+		return aerr
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+
+	if err = json.NewEncoder(w).Encode(t); err != nil {
+		return &models.AppError{
+			Code:    http.StatusInternalServerError,
+			Message: err.Error(),
+		}
+	}
+
+	return nil
+}
+
+// DeleteDeviceTokenHandler revokes the logged person device token with the requested id.
+func (env *Env) DeleteDeviceTokenHandler(w http.ResponseWriter, r *http.Request) *models.AppError {
+	vars := mux.Vars(r)
+
+	var (
+		id     int
+		err    error
+		tokens []models.DeviceToken
+	)
+
+	if id, err = strconv.Atoi(vars["id"]); err != nil {
+		return &models.AppError{
+			OriginalError: err,
+			Message:       "id atoi conversion",
+			Code:          http.StatusInternalServerError,
+		}
+	}
+
+	c := request.ContainerFromRequestContext(r)
+
+	if tokens, err = env.DB.GetPersonDeviceTokens(c.PersonID); err != nil {
+		return &models.AppError{
+			OriginalError: err,
+			Code:          http.StatusInternalServerError,
+			Message:       "error getting the device tokens",
+		}
+	}
+
+	for _, t := range tokens {
+		if t.DeviceTokenID != id {
+			continue
+		}
+
+		if err = env.DB.DeleteDeviceToken(id); err != nil {
+			return &models.AppError{
+				OriginalError: err,
+				Message:       "delete device token error",
+				Code:          http.StatusInternalServerError,
+			}
+		}
+
+		env.audit(r, "devicetoken_revoked", t.PersonEmail, t.DeviceTokenName)
+
+		return nil
+	}
+
+	return &models.AppError{
+		Message: "device token not found",
+		Code:    http.StatusNotFound,
+	}
+}
+
+// DeletePersonDeviceTokensHandler revokes all the device tokens of the person with the requested id,
+// only for admins.
+func (env *Env) DeletePersonDeviceTokensHandler(w http.ResponseWriter, r *http.Request) *models.AppError {
+	vars := mux.Vars(r)
+
+	var (
+		id  int
+		p   models.Person
+		err error
+	)
+
+	if id, err = strconv.Atoi(vars["id"]); err != nil {
+		return &models.AppError{
+			OriginalError: err,
+			Message:       "id atoi conversion",
+			Code:          http.StatusInternalServerError,
+		}
+	}
+
+	c := request.ContainerFromRequestContext(r)
+
+	if aerr := env.checkAdmin(c.PersonID, "only admins can revoke the device tokens of a person"); aerr != nil {
+		return aerr
+	}
+
+	logger.Log.WithFields(logrus.Fields{"id": id}).Debug("DeletePersonDeviceTokensHandler")
+
+	if p, err = env.DB.GetPerson(id); err != nil {
+		if err == sql.ErrNoRows {
+			return &models.AppError{
+				OriginalError: err,
+				Message:       "person not found",
+				Code:          http.StatusNotFound,
+			}
+		}
+
+		return &models.AppError{
+			OriginalError: err,
+			Message:       "get person error",
+			Code:          http.StatusInternalServerError,
+		}
+	}
+
+	if err = env.DB.DeletePersonDeviceTokens(id); err != nil {
+		return &models.AppError{
+			OriginalError: err,
+			Message:       "delete device tokens error",
+			Code:          http.StatusInternalServerError,
+		}
+	}
+
+	env.audit(r, "devicetoken_revoked", p.PersonEmail, "all")
+
+	return nil
+}
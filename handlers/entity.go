@@ -7,7 +7,6 @@ import (
 
 	"github.com/gorilla/mux"
 	"github.com/sirupsen/logrus"
-	"github.com/tbellembois/gochimitheque/casbin"
 	"github.com/tbellembois/gochimitheque/logger"
 	"github.com/tbellembois/gochimitheque/models"
 	"github.com/tbellembois/gochimitheque/request"
@@ -232,7 +231,14 @@ func (env *Env) CreateEntityHandler(w http.ResponseWriter, r *http.Request) *mod
 		}
 	}
 
-	env.Enforcer = casbin.InitCasbinPolicy(env.DB)
+	managerIDs := make([]int, 0, len(e.Managers))
+	for _, m := range e.Managers {
+		managerIDs = append(managerIDs, m.PersonID)
+	}
+
+	if aerr := env.reloadPolicies(managerIDs...); aerr != nil {
+		return aerr
+	}
 
 	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
 
@@ -251,9 +257,10 @@ func (env *Env) UpdateEntityHandler(w http.ResponseWriter, r *http.Request) *mod
 	vars := mux.Vars(r)
 
 	var (
-		id          int
-		err         error
-		e, updatede models.Entity
+		id             int
+		err            error
+		e, updatede    models.Entity
+		formerManagers []models.Person
 	)
 
 	if err = json.NewDecoder(r.Body).Decode(&e); err != nil {
@@ -286,6 +293,14 @@ func (env *Env) UpdateEntityHandler(w http.ResponseWriter, r *http.Request) *mod
 	updatede.Managers = e.Managers
 	updatede.LDAPGroups = e.LDAPGroups
 
+	if formerManagers, err = env.DB.GetEntityManager(id); err != nil {
+		return &models.AppError{
+			OriginalError: err,
+			Message:       "get entity managers error",
+			Code:          http.StatusInternalServerError,
+		}
+	}
+
 	logger.Log.WithFields(logrus.Fields{"updatede": updatede}).Debug("UpdateEntityHandler")
 
 	if err = env.DB.UpdateEntity(updatede); err != nil {
@@ -296,7 +311,18 @@ func (env *Env) UpdateEntityHandler(w http.ResponseWriter, r *http.Request) *mod
 		}
 	}
 
-	env.Enforcer = casbin.InitCasbinPolicy(env.DB)
+	// former and new managers permissions changed
+	managerIDs := make([]int, 0, len(formerManagers)+len(updatede.Managers))
+	for _, m := range formerManagers {
+		managerIDs = append(managerIDs, m.PersonID)
+	}
+	for _, m := range updatede.Managers {
+		managerIDs = append(managerIDs, m.PersonID)
+	}
+
+	if aerr := env.reloadPolicies(managerIDs...); aerr != nil {
+		return aerr
+	}
 
 	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
 
@@ -2,11 +2,19 @@ package handlers
 
 import (
 	"crypto/rand"
+	"encoding/hex"
 	"errors"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"time"
 
 	"github.com/casbin/casbin/v2"
+	chimcasbin "github.com/tbellembois/gochimitheque/casbin"
 	"github.com/tbellembois/gochimitheque/datastores"
 	"github.com/tbellembois/gochimitheque/ldap"
+	"github.com/tbellembois/gochimitheque/models"
 )
 
 // https://github.com/northbright/Notes/blob/master/jwt/generate_hmac_secret_key_for_jwt.md
@@ -24,22 +32,84 @@ func genSymmetricKey(bits int) (k []byte, err error) {
 	return k, nil
 }
 
+// LoadSignKey returns the hex encoded signing key stored in the file keyFile
+// and creates the file with a random key if it does not exist.
+func LoadSignKey(keyFile string) ([]byte, error) {
+	var (
+		k   []byte
+		err error
+	)
+
+	if k, err = os.ReadFile(keyFile); err == nil {
+		return hex.DecodeString(strings.TrimSpace(string(k)))
+	}
+
+	if !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	if k, err = genSymmetricKey(512); err != nil {
+		return nil, err
+	}
+
+	if err = os.WriteFile(keyFile, []byte(hex.EncodeToString(k)), 0o600); err != nil {
+		return nil, err
+	}
+
+	return k, nil
+}
+
 // Env is used to pass variables throughout the application.
 type Env struct {
 	DB datastores.Datastore
 
-	Enforcer *casbin.Enforcer
+	Enforcer *casbin.SyncedEnforcer
 
 	// AutoCreateUser is used with a proxy authentication
 	AutoCreateUser bool
 	// TokenSignKey is the JWT token signing key
+	// persisted in the database directory if not given
 	TokenSignKey []byte
+	// ReportSignKey is the controlled registers reports signing key
+	// persisted in the database directory if not given
+	ReportSignKey []byte
+	// AccessTokenTTL is the JWT access token lifetime
+	// 15 minutes by default
+	AccessTokenTTL time.Duration
+	// SessionTTL is the lifetime of a session not refreshed
+	// 7 days by default
+	SessionTTL time.Duration
+	// DeviceTokenTTL is the lifetime of the devices QR code login tokens
+	// 90 days by default
+	DeviceTokenTTL time.Duration
+	// LoginCaptchaFailures is the number of failed authentications
+	// of an account after which a captcha is required
+	LoginCaptchaFailures int
+	// LoginLockoutFailures is the number of failed authentications
+	// of an account after which it is locked out
+	LoginLockoutFailures int
+	// LoginLockoutDuration is the first lockout duration,
+	// doubled with each new failure
+	LoginLockoutDuration time.Duration
+	// TOTPAdmins requires a second factor for the admins,
+	// roles can also require it
+	TOTPAdmins bool
+	// PasswordMinLength and PasswordMinClasses are the local accounts password policy,
+	// the classes are lowercase letters, uppercase letters, digits and symbols
+	PasswordMinLength  int
+	PasswordMinClasses int
 	// AppPath is the application proxy path if behind a proxy
 	// "/"" by default
 	AppPath string
 	// AppURL is application base url
 	// "http://localhost:8081" by default
 	AppURL string
+	// CORSOrigins are the additional origins ("https://host[:port]")
+	// allowed to send credentialed cross origin requests
+	CORSOrigins []string
+	// TrustedProxies are the reverse proxies networks
+	// whose X-Real-IP and X-Forwarded-For headers give the client IP
+	TrustedProxies []*net.IPNet
 	// AppFullURL is application full url
 	// "ProxyURL + ProxyPath"
 	AppFullURL string
@@ -54,15 +124,52 @@ type Env struct {
 }
 
 func NewEnv() Env {
-	var (
-		env Env
-		err error
-	)
+	return Env{
+		AccessTokenTTL: 15 * time.Minute,
+		SessionTTL:     7 * 24 * time.Hour,
+		DeviceTokenTTL: 90 * 24 * time.Hour,
+
+		LoginCaptchaFailures: 3,
+		LoginLockoutFailures: 5,
+		LoginLockoutDuration: time.Minute,
+
+		PasswordMinLength:  8,
+		PasswordMinClasses: 2,
+	}
+}
+
+// reloadPolicies updates the enforcer policies of the people with the given ids
+// after a change of their permissions.
+func (env *Env) reloadPolicies(personIDs ...int) *models.AppError {
+	if err := chimcasbin.ReloadPersonPolicies(env.Enforcer, env.DB, personIDs...); err != nil {
+		return &models.AppError{
+			OriginalError: err,
+			Message:       "reload policies error",
+			Code:          http.StatusInternalServerError,
+		}
+	}
+
+	return nil
+}
+
+// checkAdmin returns an error with the message if the person with id personID
+// is not an admin.
+func (env *Env) checkAdmin(personID int, message string) *models.AppError {
+	isadmin, err := env.DB.IsPersonAdmin(personID)
+	if err != nil {
+		return &models.AppError{
+			OriginalError: err,
+			Message:       "error getting the person admin status",
+			Code:          http.StatusInternalServerError,
+		}
+	}
 
-	// Generate JWT signing key.
-	if env.TokenSignKey, err = genSymmetricKey(64); err != nil {
-		panic(err)
+	if !isadmin {
+		return &models.AppError{
+			Message: message,
+			Code:    http.StatusForbidden,
+		}
 	}
 
-	return env
+	return nil
 }
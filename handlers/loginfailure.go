@@ -0,0 +1,437 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/nicksnyder/go-i18n/v2/i18n"
+	"github.com/sirupsen/logrus"
+	"github.com/tbellembois/gochimitheque/locales"
+	"github.com/tbellembois/gochimitheque/logger"
+	"github.com/tbellembois/gochimitheque/models"
+	"github.com/tbellembois/gochimitheque/request"
+)
+
+const (
+	loginFailureEmail = "email"
+	loginFailureIP    = "ip"
+	// ipFailuresFactor multiplies the thresholds of the client IPs
+	// that can be shared by several people (NAT, proxies).
+	ipFailuresFactor = 4
+	// loginFailuresWindow is the duration without failure
+	// after which the failures are forgotten.
+	loginFailuresWindow = 24 * time.Hour
+	// loginLockoutMax is the maximum lockout duration.
+	loginLockoutMax = 24 * time.Hour
+)
+
+// ParseTrustedProxies returns the networks of the comma separated
+// IP addresses or CIDR list l.
+func ParseTrustedProxies(l string) ([]*net.IPNet, error) {
+	var proxies []*net.IPNet
+
+	for _, s := range strings.Split(l, ",") {
+		if s = strings.TrimSpace(s); s == "" {
+			continue
+		}
+
+		if !strings.Contains(s, "/") {
+			if ip := net.ParseIP(s); ip != nil && ip.To4() != nil {
+				s += "/32"
+			} else {
+				s += "/128"
+			}
+		}
+
+		_, n, err := net.ParseCIDR(s)
+		if err != nil {
+			return nil, err
+		}
+
+		proxies = append(proxies, n)
+	}
+
+	return proxies, nil
+}
+
+// isTrustedProxy returns true if ip is the address of a trusted proxy.
+func (env *Env) isTrustedProxy(ip string) bool {
+	i := net.ParseIP(ip)
+	if i == nil {
+		return false
+	}
+
+	for _, n := range env.TrustedProxies {
+		if n.Contains(i) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// clientIP returns the IP address of the request client.
+// The X-Real-IP and X-Forwarded-For headers are only used
+// if the request comes from a trusted proxy, otherwise anybody could set them.
+func (env *Env) clientIP(r *http.Request) string {
+	ip, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		ip = r.RemoteAddr
+	}
+
+	if !env.isTrustedProxy(ip) {
+		return ip
+	}
+
+	if x := strings.TrimSpace(r.Header.Get("X-Real-IP")); net.ParseIP(x) != nil {
+		return x
+	}
+
+	// The rightmost address not added by a trusted proxy,
+	// the ones on its left can be forged by the client.
+	f := strings.Split(r.Header.Get("X-Forwarded-For"), ",")
+	for i := len(f) - 1; i >= 0; i-- {
+		x := strings.TrimSpace(f[i])
+		if net.ParseIP(x) == nil {
+			break
+		}
+
+		ip = x
+
+		if !env.isTrustedProxy(x) {
+			break
+		}
+	}
+
+	return ip
+}
+
+// loginThresholds returns the number of failures of the kind
+// after which a captcha is required and the login is locked out.
+func (env *Env) loginThresholds(kind string) (captcha int, lockout int) {
+	if kind == loginFailureIP {
+		return env.LoginCaptchaFailures * ipFailuresFactor, env.LoginLockoutFailures * ipFailuresFactor
+	}
+
+	return env.LoginCaptchaFailures, env.LoginLockoutFailures
+}
+
+// audit records the event in the audit log, errors are only logged.
+func (env *Env) audit(r *http.Request, event string, personEmail string, details string) {
+	a := models.AuditLog{
+		AuditLogDate:        time.Now(),
+		AuditLogEvent:       event,
+		AuditLogPersonEmail: personEmail,
+		AuditLogIP:          env.clientIP(r),
+		AuditLogDetails:     details,
+		AuditLogAuthor:      request.ContainerFromRequestContext(r).PersonEmail,
+	}
+
+	logger.Log.WithFields(logrus.Fields{"a": a}).Warn("audit")
+
+	if err := env.DB.CreateAuditLog(a); err != nil {
+		logger.Log.Errorf("create audit log: %s", err)
+	}
+}
+
+// checkLoginFailures returns an error if the account login or the request client IP is locked out,
+// or if a captcha is required after too many failures and the one of p is not valid.
+func (env *Env) checkLoginFailures(w http.ResponseWriter, r *http.Request, login string, p *models.Person) *models.AppError {
+	var (
+		f               models.LoginFailure
+		err             error
+		captchaRequired bool
+	)
+
+	now := time.Now()
+
+	for _, k := range [][2]string{{loginFailureEmail, login}, {loginFailureIP, env.clientIP(r)}} {
+		if f, err = env.DB.GetLoginFailure(k[0], k[1]); err != nil {
+			if err == sql.ErrNoRows {
+				continue
+			}
+
+			return &models.AppError{
+				OriginalError: err,
+				Message:       "error getting the login failures",
+				Code:          http.StatusInternalServerError,
+			}
+		}
+
+		if now.Sub(f.LoginFailureLastDate) > loginFailuresWindow {
+			continue
+		}
+
+		if f.IsLocked(now) {
+			w.Header().Set("Retry-After", strconv.Itoa(int(f.LoginFailureLockedUntil.Time.Sub(now).Seconds())+1))
+
+			return &models.AppError{
+				Message: locales.Localizer.MustLocalize(&i18n.LocalizeConfig{MessageID: "login_locked", PluralCount: 1}),
+				Code:    http.StatusTooManyRequests,
+			}
+		}
+
+		if captcha, _ := env.loginThresholds(k[0]); f.LoginFailureCount >= captcha {
+			captchaRequired = true
+		}
+	}
+
+	if !captchaRequired {
+		return nil
+	}
+
+	var v bool
+
+	if p.CaptchaUID != "" {
+		if v, err = env.DB.ValidateCaptcha(p.CaptchaUID, p.CaptchaText); err != nil {
+			return &models.AppError{
+				Code:          http.StatusInternalServerError,
+				OriginalError: err,
+				Message:       "error validating captcha",
+			}
+		}
+	}
+
+	if !v {
+		w.Header().Set("X-Captcha-Required", "true")
+
+		return &models.AppError{
+			Message: locales.Localizer.MustLocalize(&i18n.LocalizeConfig{MessageID: "captcha_required", PluralCount: 1}),
+			Code:    http.StatusPreconditionRequired,
+		}
+	}
+
+	return nil
+}
+
+// loginFailed counts a failed authentication of the account login
+// from the request client IP and locks them out after too many failures,
+// the lockout duration doubles with each new failure.
+func (env *Env) loginFailed(r *http.Request, login string) {
+	var (
+		f   models.LoginFailure
+		err error
+	)
+
+	now := time.Now()
+
+	for _, k := range [][2]string{{loginFailureEmail, login}, {loginFailureIP, env.clientIP(r)}} {
+		if f, err = env.DB.GetLoginFailure(k[0], k[1]); err != nil {
+			if err != sql.ErrNoRows {
+				logger.Log.Errorf("get login failure: %s", err)
+				continue
+			}
+
+			f = models.LoginFailure{LoginFailureKind: k[0], LoginFailureValue: k[1]}
+		}
+
+		if now.Sub(f.LoginFailureLastDate) > loginFailuresWindow {
+			f.LoginFailureCount = 0
+			f.LoginFailureLockedUntil = sql.NullTime{}
+		}
+
+		f.LoginFailureCount++
+		f.LoginFailureLastDate = now
+
+		if _, lockout := env.loginThresholds(k[0]); f.LoginFailureCount >= lockout {
+			d := loginLockoutMax
+			if shift := f.LoginFailureCount - lockout; shift < 16 {
+				d = min(env.LoginLockoutDuration<<shift, loginLockoutMax)
+			}
+
+			f.LoginFailureLockedUntil = sql.NullTime{Time: now.Add(d), Valid: true}
+
+			var email string
+			if k[0] == loginFailureEmail {
+				email = k[1]
+			}
+
+			env.audit(r, "login_lockout", email, fmt.Sprintf("%s %s locked out for %s after %d failures", k[0], k[1], d, f.LoginFailureCount))
+		}
+
+		if err = env.DB.SaveLoginFailure(f); err != nil {
+			logger.Log.Errorf("save login failure: %s", err)
+		}
+	}
+}
+
+// loginSucceeded forgets the failures of the account login.
+func (env *Env) loginSucceeded(login string) {
+	if err := env.DB.DeleteLoginFailure(loginFailureEmail, login); err != nil {
+		logger.Log.Errorf("delete login failure: %s", err)
+	}
+}
+
+/*
+	REST handlers
+*/
+
+// GetLockoutsHandler returns a json list of the locked out accounts and client IPs,
+// only for admins.
+func (env *Env) GetLockoutsHandler(w http.ResponseWriter, r *http.Request) *models.AppError {
+	logger.Log.Debug("GetLockoutsHandler")
+
+	c := request.ContainerFromRequestContext(r)
+
+	if aerr := env.checkAdmin(c.PersonID, "only admins can list the lockouts"); aerr != nil {
+		return aerr
+	}
+
+	lockouts, err := env.DB.GetLockedLoginFailures(time.Now())
+	if err != nil {
+		return &models.AppError{
+			OriginalError: err,
+			Code:          http.StatusInternalServerError,
+			Message:       "error getting the lockouts",
+		}
+	}
+
+	type resp struct {
+		Rows  []models.LoginFailure `json:"rows"`
+		Total int                   `json:"total"`
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+
+	if err = json.NewEncoder(w).Encode(resp{Rows: lockouts, Total: len(lockouts)}); err != nil {
+		return &models.AppError{
+			Code:    http.StatusInternalServerError,
+			Message: err.Error(),
+		}
+	}
+
+	return nil
+}
+
+// UnlockPersonHandler resets the failed authentications of the person with the requested id,
+// only for admins.
+func (env *Env) UnlockPersonHandler(w http.ResponseWriter, r *http.Request) *models.AppError {
+	vars := mux.Vars(r)
+
+	var (
+		id  int
+		err error
+		p   models.Person
+	)
+
+	c := request.ContainerFromRequestContext(r)
+
+	if aerr := env.checkAdmin(c.PersonID, "only admins can unlock people"); aerr != nil {
+		return aerr
+	}
+
+	if id, err = strconv.Atoi(vars["id"]); err != nil {
+		return &models.AppError{
+			OriginalError: err,
+			Message:       "id atoi conversion",
+			Code:          http.StatusInternalServerError,
+		}
+	}
+
+	if p, err = env.DB.GetPerson(id); err != nil {
+		if err == sql.ErrNoRows {
+			return &models.AppError{
+				OriginalError: err,
+				Message:       "person not found",
+				Code:          http.StatusNotFound,
+			}
+		}
+
+		return &models.AppError{
+			OriginalError: err,
+			Message:       "get person error",
+			Code:          http.StatusInternalServerError,
+		}
+	}
+
+	if err = env.DB.DeleteLoginFailure(loginFailureEmail, p.PersonEmail); err != nil {
+		return &models.AppError{
+			OriginalError: err,
+			Message:       "unlock person error",
+			Code:          http.StatusInternalServerError,
+		}
+	}
+
+	env.audit(r, "login_unlock", p.PersonEmail, "email "+p.PersonEmail+" unlocked")
+
+	return nil
+}
+
+// UnlockIPHandler resets the failed authentications of the requested client IP,
+// only for admins.
+func (env *Env) UnlockIPHandler(w http.ResponseWriter, r *http.Request) *models.AppError {
+	vars := mux.Vars(r)
+
+	c := request.ContainerFromRequestContext(r)
+
+	if aerr := env.checkAdmin(c.PersonID, "only admins can unlock client IPs"); aerr != nil {
+		return aerr
+	}
+
+	if err := env.DB.DeleteLoginFailure(loginFailureIP, vars["ip"]); err != nil {
+		return &models.AppError{
+			OriginalError: err,
+			Message:       "unlock ip error",
+			Code:          http.StatusInternalServerError,
+		}
+	}
+
+	env.audit(r, "login_unlock", "", "ip "+vars["ip"]+" unlocked")
+
+	return nil
+}
+
+// GetAuditLogsHandler returns a json list of the audit log events,
+// only for admins.
+func (env *Env) GetAuditLogsHandler(w http.ResponseWriter, r *http.Request) *models.AppError {
+	logger.Log.Debug("GetAuditLogsHandler")
+
+	var (
+		err   error
+		aerr  *models.AppError
+		f     *request.Filter
+		logs  []models.AuditLog
+		count int
+	)
+
+	c := request.ContainerFromRequestContext(r)
+
+	if aerr = env.checkAdmin(c.PersonID, "only admins can read the audit log"); aerr != nil {
+		return aerr
+	}
+
+	if f, aerr = request.NewFilter(r, nil); aerr != nil {
+		return aerr
+	}
+
+	if logs, count, err = env.DB.GetAuditLogs(*f); err != nil {
+		return &models.AppError{
+			OriginalError: err,
+			Code:          http.StatusInternalServerError,
+			Message:       "error getting the audit log",
+		}
+	}
+
+	type resp struct {
+		Rows  []models.AuditLog `json:"rows"`
+		Total int               `json:"total"`
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+
+	if err = json.NewEncoder(w).Encode(resp{Rows: logs, Total: count}); err != nil {
+		return &models.AppError{
+			Code:    http.StatusInternalServerError,
+			Message: err.Error(),
+		}
+	}
+
+	return nil
+}
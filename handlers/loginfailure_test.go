@@ -0,0 +1,208 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/tbellembois/gochimitheque/models"
+)
+
+func TestClientIP(t *testing.T) {
+	proxies, err := ParseTrustedProxies("127.0.0.1, 10.0.0.0/8")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name      string
+		remote    string
+		realIP    string
+		forwarded string
+		trusted   bool
+		want      string
+	}{
+		{"direct", "192.0.2.1:1234", "", "", false, "192.0.2.1"},
+		{"untrusted headers", "192.0.2.1:1234", "198.51.100.1", "198.51.100.2", false, "192.0.2.1"},
+		{"proxies not set", "127.0.0.1:1234", "198.51.100.1", "", false, "127.0.0.1"},
+		{"X-Real-IP", "127.0.0.1:1234", "198.51.100.1", "198.51.100.2", true, "198.51.100.1"},
+		{"X-Forwarded-For", "127.0.0.1:1234", "", "198.51.100.2", true, "198.51.100.2"},
+		{"forged X-Forwarded-For", "127.0.0.1:1234", "", "203.0.113.9, 198.51.100.2", true, "198.51.100.2"},
+		{"proxies chain", "10.0.0.2:1234", "", "198.51.100.2, 10.0.0.1", true, "198.51.100.2"},
+		{"invalid X-Real-IP", "127.0.0.1:1234", "foo", "198.51.100.2", true, "198.51.100.2"},
+		{"invalid X-Forwarded-For", "127.0.0.1:1234", "", "foo", true, "127.0.0.1"},
+		{"untrusted proxy", "192.0.2.1:1234", "198.51.100.1", "", true, "192.0.2.1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			env := NewEnv()
+			if tt.trusted {
+				env.TrustedProxies = proxies
+			}
+
+			r := httptest.NewRequest(http.MethodPost, "/get-token", nil)
+			r.RemoteAddr = tt.remote
+
+			if tt.realIP != "" {
+				r.Header.Set("X-Real-IP", tt.realIP)
+			}
+
+			if tt.forwarded != "" {
+				r.Header.Set("X-Forwarded-For", tt.forwarded)
+			}
+
+			if got := env.clientIP(r); got != tt.want {
+				t.Errorf("clientIP() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+
+	if _, err := ParseTrustedProxies("127.0.0.1,foo"); err == nil {
+		t.Errorf("ParseTrustedProxies(127.0.0.1,foo) error = nil")
+	}
+}
+
+// checkLogin returns the code of checkLoginFailures for login from the client ip.
+func checkLogin(t *testing.T, env *Env, login string, ip string) int {
+	t.Helper()
+
+	r := httptest.NewRequest(http.MethodPost, "/get-token", nil)
+	r.RemoteAddr = ip + ":1234"
+
+	if aerr := env.checkLoginFailures(httptest.NewRecorder(), r, login, &models.Person{}); aerr != nil {
+		return aerr.Code
+	}
+
+	return http.StatusOK
+}
+
+// failLogin records n failed authentications of login from the client ip.
+func failLogin(env *Env, login string, ip string, n int) {
+	r := httptest.NewRequest(http.MethodPost, "/get-token", nil)
+	r.RemoteAddr = ip + ":1234"
+
+	for i := 0; i < n; i++ {
+		env.loginFailed(r, login)
+	}
+}
+
+func TestLoginFailuresThresholds(t *testing.T) {
+	env := newTestEnv(t)
+
+	// account thresholds
+	failLogin(env, "a@test", "192.0.2.1", 2)
+
+	if code := checkLogin(t, env, "a@test", "192.0.2.1"); code != http.StatusOK {
+		t.Errorf("after 2 failures code = %d, want %d", code, http.StatusOK)
+	}
+
+	failLogin(env, "a@test", "192.0.2.1", 1)
+
+	if code := checkLogin(t, env, "a@test", "192.0.2.1"); code != http.StatusPreconditionRequired {
+		t.Errorf("after 3 failures code = %d, want %d", code, http.StatusPreconditionRequired)
+	}
+
+	// the captcha is required for the account from any IP
+	if code := checkLogin(t, env, "a@test", "192.0.2.2"); code != http.StatusPreconditionRequired {
+		t.Errorf("after 3 failures from another IP code = %d, want %d", code, http.StatusPreconditionRequired)
+	}
+
+	failLogin(env, "a@test", "192.0.2.1", 2)
+
+	if code := checkLogin(t, env, "a@test", "192.0.2.2"); code != http.StatusTooManyRequests {
+		t.Errorf("after 5 failures code = %d, want %d", code, http.StatusTooManyRequests)
+	}
+
+	// a success resets the account count
+	env.loginSucceeded("a@test")
+
+	if code := checkLogin(t, env, "a@test", "192.0.2.2"); code != http.StatusOK {
+		t.Errorf("after a success code = %d, want %d", code, http.StatusOK)
+	}
+
+	// IP thresholds, 4 times higher, shared by the accounts
+	for i, login := range []string{"b@test", "c@test", "d@test", "e@test", "f@test", "g@test"} {
+		failLogin(env, login, "192.0.2.3", 2)
+
+		want := http.StatusOK
+		if 2*(i+1) >= env.LoginCaptchaFailures*ipFailuresFactor {
+			want = http.StatusPreconditionRequired
+		}
+
+		if code := checkLogin(t, env, "h@test", "192.0.2.3"); code != want {
+			t.Errorf("after %d failures from the IP code = %d, want %d", 2*(i+1), code, want)
+		}
+	}
+
+	failLogin(env, "i@test", "192.0.2.3", 8)
+
+	if code := checkLogin(t, env, "h@test", "192.0.2.3"); code != http.StatusTooManyRequests {
+		t.Errorf("after 20 failures from the IP code = %d, want %d", code, http.StatusTooManyRequests)
+	}
+
+	if code := checkLogin(t, env, "h@test", "192.0.2.4"); code != http.StatusOK {
+		t.Errorf("from another IP code = %d, want %d", code, http.StatusOK)
+	}
+}
+
+func TestLoginFailuresBackoff(t *testing.T) {
+	env := newTestEnv(t)
+
+	lockout := func() time.Duration {
+		t.Helper()
+
+		f, err := env.DB.GetLoginFailure(loginFailureEmail, "a@test")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !f.LoginFailureLockedUntil.Valid {
+			return 0
+		}
+
+		return time.Until(f.LoginFailureLockedUntil.Time).Round(time.Minute)
+	}
+
+	failLogin(env, "a@test", "192.0.2.1", env.LoginLockoutFailures-1)
+
+	if d := lockout(); d != 0 {
+		t.Errorf("before the threshold lockout = %s, want none", d)
+	}
+
+	// the lockout duration doubles with each new failure
+	for _, want := range []time.Duration{time.Minute, 2 * time.Minute, 4 * time.Minute, 8 * time.Minute} {
+		failLogin(env, "a@test", "192.0.2.1", 1)
+
+		if d := lockout(); d != want {
+			t.Errorf("lockout = %s, want %s", d, want)
+		}
+	}
+
+	// up to loginLockoutMax
+	failLogin(env, "a@test", "192.0.2.1", 20)
+
+	if d := lockout(); d != loginLockoutMax {
+		t.Errorf("lockout = %s, want %s", d, loginLockoutMax)
+	}
+
+	// the failures are forgotten after loginFailuresWindow
+	f, err := env.DB.GetLoginFailure(loginFailureEmail, "a@test")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	f.LoginFailureLastDate = time.Now().Add(-loginFailuresWindow - time.Minute)
+	f.LoginFailureLockedUntil.Time = time.Now().Add(-time.Minute)
+
+	if err = env.DB.SaveLoginFailure(f); err != nil {
+		t.Fatal(err)
+	}
+
+	failLogin(env, "a@test", "192.0.2.1", 1)
+
+	if d := lockout(); d != 0 {
+		t.Errorf("after the window lockout = %s, want none", d)
+	}
+}
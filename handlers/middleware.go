@@ -2,6 +2,7 @@ package handlers
 
 import (
 	"context"
+	"crypto/hmac"
 	"database/sql"
 	"fmt"
 	"net/http"
@@ -9,7 +10,7 @@ import (
 	"strconv"
 	"strings"
 
-	"github.com/dgrijalva/jwt-go"
+	"github.com/golang-jwt/jwt"
 	"github.com/gorilla/mux"
 	"github.com/nicksnyder/go-i18n/v2/i18n"
 	"github.com/sirupsen/logrus"
@@ -53,14 +54,56 @@ func (env *Env) LogingMiddleware(h http.Handler) http.Handler {
 // HeadersMiddleware is the application handlers wrapper managing the common response HTTP headers.
 func (env *Env) HeadersMiddleware(h http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
-		w.Header().Set("Access-Control-Allow-Methods", "*")
-		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Accept")
-		w.Header().Set("Access-Control-Allow-Origin", "*")
+		// the cross origin requests are only allowed for the configured origins
+		w.Header().Add("Vary", "Origin")
+
+		if o := req.Header.Get("Origin"); o != "" && env.isAllowedOrigin(strings.ToLower(o)) {
+			w.Header().Set("Access-Control-Allow-Origin", o)
+			w.Header().Set("Access-Control-Allow-Credentials", "true")
+			w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE")
+			w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Accept, "+csrfTokenHeader)
+		}
 
 		h.ServeHTTP(w, req)
 	})
 }
 
+// CSRFMiddleware rejects the cross site state changing requests.
+// The authenticated requests must have the session CSRF token in the X-CSRF-Token header
+// or come from an allowed origin, the others must not come from another origin.
+func (env *Env) CSRFMiddleware(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet, http.MethodHead, http.MethodOptions:
+			h.ServeHTTP(w, r)
+			return
+		}
+
+		c := request.ContainerFromRequestContext(r)
+		o := requestOrigin(r)
+
+		switch {
+		case c.SessionUID == "":
+			// login, password reset...
+			if o != "" && !env.isAllowedOrigin(o) {
+				http.Error(w, "cross site request forbidden", http.StatusForbidden)
+				return
+			}
+		case r.Header.Get(csrfTokenHeader) != "":
+			if !hmac.Equal([]byte(r.Header.Get(csrfTokenHeader)), []byte(env.csrfToken(c.SessionUID))) {
+				http.Error(w, "invalid CSRF token", http.StatusForbidden)
+				return
+			}
+		case !env.isAllowedOrigin(o):
+			logger.Log.WithFields(logrus.Fields{"origin": o}).Debug("CSRFMiddleware")
+			http.Error(w, "CSRF token or allowed origin required", http.StatusForbidden)
+			return
+		}
+
+		h.ServeHTTP(w, r)
+	})
+}
+
 // ContextMiddleware initialize the request context and setup initial variables.
 func (env *Env) ContextMiddleware(h http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -90,7 +133,8 @@ func (env *Env) AuthenticateMiddleware(h http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		var (
 			email       string
-			cemail      interface{}
+			sid         string
+			session     models.Session
 			claims      jwt.MapClaims
 			ok          bool
 			person      models.Person
@@ -111,56 +155,86 @@ func (env *Env) AuthenticateMiddleware(h http.Handler) http.Handler {
 		// extracting the token string from cookie
 		if reqToken, err = r.Cookie("token"); err != nil {
 			logger.Log.Debug("token not found in cookies")
-			// http.Error(w, "token not found in cookies, please log in", http.StatusUnauthorized)
-			http.Redirect(w, r, env.AppFullURL+"login", http.StatusTemporaryRedirect)
-			return
-		}
-		if !tre.MatchString(reqToken.String()) {
-			logger.Log.Debug("token has an invalid format")
-			http.Error(w, "token has an invalid format", http.StatusUnauthorized)
-			return
-		}
-		logger.Log.WithFields(logrus.Fields{
-			"reqToken.Name":  reqToken.Name,
-			"reqToken.Value": reqToken.Value,
-		}).Debug()
-
-		// validating the token
-		// header version
-		// splitToken := strings.Split(reqToken, "Bearer ")
-		// cookie version
-		splitToken := strings.Split(reqToken.String(), "token=")
-		reqTokenStr = splitToken[1]
-		token, err = jwt.Parse(reqTokenStr, func(token *jwt.Token) (interface{}, error) {
-			if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-				logger.Log.Debugf("unexpected signing method: %v", token.Header["alg"])
-				http.Error(w, err.Error(), http.StatusUnauthorized)
-				return nil, nil
-			}
-			return env.TokenSignKey, nil
-		})
-		if err != nil {
-			logger.Log.Debug("parse token error")
-			http.Error(w, err.Error(), http.StatusUnauthorized)
-			return
-		}
-
-		// getting the claims
-		if claims, ok = token.Claims.(jwt.MapClaims); ok && token.Valid {
-			logger.Log.Debug(fmt.Sprintf("claims: %+v\n", claims))
-
-			// then the email claim
-			if cemail, ok = claims["email"]; !ok {
-				logger.Log.Debug("email not found in claims")
-				http.Error(w, "email not found in claims", http.StatusBadRequest)
+			// restoring the session from the refresh token if any
+			if session, _, err = env.refreshSession(w, r); err != nil {
+				// http.Error(w, "token not found in cookies, please log in", http.StatusUnauthorized)
+				http.Redirect(w, r, env.AppFullURL+"login", http.StatusTemporaryRedirect)
 				return
 			}
-			email = cemail.(string)
 		} else {
-			logger.Log.Debug("can not extract claims")
-			http.Error(w, "can not extract claims", http.StatusBadRequest)
-			return
+			if !tre.MatchString(reqToken.String()) {
+				logger.Log.Debug("token has an invalid format")
+				http.Error(w, "token has an invalid format", http.StatusUnauthorized)
+				return
+			}
+			logger.Log.WithFields(logrus.Fields{
+				"reqToken.Name":  reqToken.Name,
+				"reqToken.Value": reqToken.Value,
+			}).Debug()
+
+			// validating the token
+			// header version
+			// splitToken := strings.Split(reqToken, "Bearer ")
+			// cookie version
+			splitToken := strings.Split(reqToken.String(), "token=")
+			reqTokenStr = splitToken[1]
+			token, err = jwt.Parse(reqTokenStr, func(token *jwt.Token) (interface{}, error) {
+				if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+					logger.Log.Debugf("unexpected signing method: %v", token.Header["alg"])
+					http.Error(w, err.Error(), http.StatusUnauthorized)
+					return nil, nil
+				}
+				return env.TokenSignKey, nil
+			})
+			if ve, isve := err.(*jwt.ValidationError); isve && ve.Errors == jwt.ValidationErrorExpired {
+				// expired access token, refreshing the session
+				logger.Log.Debug("token expired")
+				if session, _, err = env.refreshSession(w, r); err != nil {
+					env.clearSessionCookies(w)
+					http.Error(w, err.Error(), http.StatusUnauthorized)
+					return
+				}
+			} else if err != nil {
+				logger.Log.Debug("parse token error")
+				http.Error(w, err.Error(), http.StatusUnauthorized)
+				return
+			} else {
+				// getting the claims
+				if claims, ok = token.Claims.(jwt.MapClaims); ok && token.Valid {
+					logger.Log.Debug(fmt.Sprintf("claims: %+v\n", claims))
+
+					// then the session claim
+					if sid, ok = claims["sid"].(string); !ok {
+						logger.Log.Debug("sid not found in claims")
+						env.clearSessionCookies(w)
+						http.Error(w, errSessionNotFound.Error(), http.StatusUnauthorized)
+						return
+					}
+				} else {
+					logger.Log.Debug("can not extract claims")
+					http.Error(w, "can not extract claims", http.StatusBadRequest)
+					return
+				}
+
+				// checking that the session has not been revoked
+				if session, err = env.DB.GetSession(sid); err != nil {
+					if err == sql.ErrNoRows {
+						logger.Log.Debug("session revoked")
+						env.clearSessionCookies(w)
+						http.Error(w, errSessionNotFound.Error(), http.StatusUnauthorized)
+					} else {
+						http.Error(w, "can not get session: "+err.Error(), http.StatusInternalServerError)
+					}
+					return
+				}
+				if session.IsExpired() {
+					env.clearSessionCookies(w)
+					http.Error(w, errSessionExpired.Error(), http.StatusUnauthorized)
+					return
+				}
+			}
 		}
+		email = session.PersonEmail
 
 		logger.Log.Debugf("email: %s\n", email)
 		// getting the logged user
@@ -178,6 +252,7 @@ func (env *Env) AuthenticateMiddleware(h http.Handler) http.Handler {
 		// setting up auth person informations
 		container.PersonEmail = person.PersonEmail
 		container.PersonID = person.PersonID
+		container.SessionUID = session.SessionUID
 		ctx = context.WithValue(
 			r.Context(),
 			request.ChimithequeContextKey("container"),
@@ -197,12 +272,9 @@ func (env *Env) AuthorizeMiddleware(h http.Handler) http.Handler {
 			personid    int    // logged person id
 			item        string // storages, products...
 			itemid      string // the item id to be accessed: an int, -1, -2 or ""
-			itemidInt   int
 			view        string
 			action      string
-			permok      bool
 			personemail string
-			err         error
 		)
 
 		// extracting the logged user email from context
@@ -228,9 +300,18 @@ func (env *Env) AuthorizeMiddleware(h http.Handler) http.Handler {
 		item = vars["item"]
 		// id = an int or ""
 		itemid = vars["id"]
+		// the id of the /products/casnumbers/{id}... routes is not a product id
+		if item == "products" {
+			if tmpl, e := mux.CurrentRoute(r).GetPathTemplate(); e == nil && !strings.HasSuffix(tmpl, "{item:products}/{id}") {
+				itemid = ""
+			}
+		}
 
-		// action = r or w
+		// action = r, b or w
 		switch {
+		case item == "borrowings":
+			// the storage is checked by ToogleStorageBorrowingHandler
+			action = "b"
 		case view == "v":
 			action = "r"
 		case view == "vc":
@@ -243,175 +324,206 @@ func (env *Env) AuthorizeMiddleware(h http.Handler) http.Handler {
 			}
 		}
 
-		//
-		// pre checks
-		//
-		switch r.Method {
-		case "PUT":
-			// REST update,create methods
-			switch item {
-			case "people":
-				// itemid is an int
-				if itemidInt, err = strconv.Atoi(itemid); err != nil {
-					logger.Log.WithFields(logrus.Fields{"err": err.Error()}).Error("AuthorizeMiddleware")
-					http.Error(w, err.Error(), http.StatusInternalServerError)
-					return
-				}
-				// a user can not edit himself
-				if itemidInt == personid {
-					http.Error(w, "can not edit/delete yourself", http.StatusUnauthorized)
-					return
-				}
-				// we can not edit an admin
-				a, e := env.DB.IsPersonAdmin(itemidInt)
-				if e != nil {
-					logger.Log.WithFields(logrus.Fields{"err": err.Error()}).Error("AuthorizeMiddleware")
-					http.Error(w, e.Error(), http.StatusInternalServerError)
-					return
-				}
-				if a {
-					http.Error(w, "can not delete an admin", http.StatusUnauthorized)
-					return
-				}
-			}
-		case "DELETE":
-			// REST delete method
-			switch item {
-			case "people":
-				// itemid is an int
-				if itemidInt, err = strconv.Atoi(itemid); err != nil {
-					logger.Log.WithFields(logrus.Fields{"err": err.Error()}).Debug("AuthorizeMiddleware")
-					http.Error(w, err.Error(), http.StatusInternalServerError)
-					return
-				}
-				// a user can not delete himself
-				if itemidInt == personid {
-					http.Error(w, "can not edit/delete yourself", http.StatusUnauthorized)
-					return
-				}
-				// we can not delete a manager
-				m, e := env.DB.IsPersonManager(itemidInt)
-				if e != nil {
-					logger.Log.WithFields(logrus.Fields{"err": err.Error()}).Error("AuthorizeMiddleware")
-					http.Error(w, e.Error(), http.StatusInternalServerError)
-					return
-				}
-				if m {
-					http.Error(w, "can not delete a manager", http.StatusUnauthorized)
-					return
-				}
-				// we can not delete an admin
-				a, e := env.DB.IsPersonAdmin(itemidInt)
-				if e != nil {
-					logger.Log.WithFields(logrus.Fields{"err": err.Error()}).Error("AuthorizeMiddleware")
-					http.Error(w, e.Error(), http.StatusInternalServerError)
-					return
-				}
-				if a {
-					http.Error(w, "can not delete an admin", http.StatusUnauthorized)
-					return
-				}
-			case "storelocations":
-				// itemid is an int
-				if itemidInt, err = strconv.Atoi(itemid); err != nil {
-					logger.Log.WithFields(logrus.Fields{"err": err.Error()}).Debug("AuthorizeMiddleware")
-					http.Error(w, err.Error(), http.StatusInternalServerError)
-					return
-				}
-				// can not delete store location with children
-				c, e := env.DB.GetStoreLocationChildren(itemidInt)
-				if e != nil {
-					logger.Log.WithFields(logrus.Fields{"err": err.Error()}).Error("AuthorizeMiddleware")
-					http.Error(w, e.Error(), http.StatusInternalServerError)
-					return
-				}
-				if len(c) != 0 {
-					http.Error(w, "can not delete store location with children", http.StatusUnauthorized)
-					return
-				}
-				// we can not delete a non empty store location
-				m, e := env.DB.HasStorelocationStorage(itemidInt)
-				if e != nil {
-					logger.Log.WithFields(logrus.Fields{"err": err.Error()}).Error("AuthorizeMiddleware")
-					http.Error(w, e.Error(), http.StatusInternalServerError)
-					return
-				}
-				if !m {
-					http.Error(w, "can not delete a non empty store location", http.StatusUnauthorized)
-					return
-				}
-			case "products":
-				// itemid is an int
-				if itemidInt, err = strconv.Atoi(itemid); err != nil {
-					logger.Log.WithFields(logrus.Fields{"err": err.Error()}).Error("AuthorizeMiddleware")
-					http.Error(w, err.Error(), http.StatusInternalServerError)
-				}
-				// we can not delete a product with storages
-				c, e := env.DB.CountProductStorages(itemidInt)
-				if e != nil {
-					logger.Log.WithFields(logrus.Fields{"err": err.Error()}).Error("AuthorizeMiddleware")
-					http.Error(w, e.Error(), http.StatusInternalServerError)
-					return
-				}
-				if c != 0 {
-					http.Error(w, "can not delete a product with storages", http.StatusUnauthorized)
-					return
-				}
-			case "entities":
-				if r.Method == "DELETE" {
-					// itemid is an int
-					if itemidInt, err = strconv.Atoi(itemid); err != nil {
-						logger.Log.WithFields(logrus.Fields{"err": err.Error()}).Error("AuthorizeMiddleware")
-						http.Error(w, err.Error(), http.StatusInternalServerError)
-						return
-					}
-					m, e1 := env.DB.HasEntityMember(itemidInt)
-					n, e2 := env.DB.HasEntityStorelocation(itemidInt)
-					if e1 != nil {
-						logger.Log.WithFields(logrus.Fields{"err": err.Error()}).Error("AuthorizeMiddleware")
-						http.Error(w, e1.Error(), http.StatusUnauthorized)
-						return
-					}
-					if e2 != nil {
-						logger.Log.WithFields(logrus.Fields{"err": err.Error()}).Error("AuthorizeMiddleware")
-						http.Error(w, e2.Error(), http.StatusUnauthorized)
-						return
-					}
-					if m {
-						http.Error(w, "can not delete an entity with members", http.StatusUnauthorized)
-						return
-					}
-					if n {
-						http.Error(w, "can not delete an entity with store locations", http.StatusUnauthorized)
-						return
-					}
-				}
-			}
-		}
-
-		// allow/deny access
-		logger.Log.WithFields(logrus.Fields{
-			"itemid":   itemid,
-			"item":     item,
-			"personid": strconv.Itoa(personid),
-			"action":   action,
-		}).Debug("AuthorizeMiddleware")
-
-		if permok, err = env.Enforcer.Enforce(strconv.Itoa(personid), action, item, itemid); err != nil {
-			http.Error(w, "enforcer error: "+err.Error(), http.StatusInternalServerError)
+		if aerr := env.authorize(personid, r.Method, action, item, itemid); aerr != nil {
+			http.Error(w, aerr.Message, aerr.Code)
 			return
 		}
 
-		logger.Log.WithFields(logrus.Fields{
-			"permok": permok,
-		}).Debug("AuthorizeMiddleware")
+		h.ServeHTTP(w, r)
+	})
+}
 
-		if !permok {
-			logger.Log.WithFields(logrus.Fields{"unauthorized": "!permok"}).Debug("AuthorizeMiddleware")
-			http.Error(w, "forbidden", http.StatusForbidden)
-			return
+// authorize returns an error if the person with the given id can not perform
+// the request method and action on the item with the given id.
+func (env *Env) authorize(personid int, method string, action string, item string, itemid string) *models.AppError {
+	var (
+		itemidInt int
+		permok    bool
+		err       error
+	)
+
+	denied := func(message string, code int) *models.AppError {
+		return &models.AppError{Message: message, Code: code}
+	}
+
+	failed := func(err error) *models.AppError {
+		logger.Log.WithFields(logrus.Fields{"err": err.Error()}).Error("AuthorizeMiddleware")
+		return &models.AppError{OriginalError: err, Message: err.Error(), Code: http.StatusInternalServerError}
+	}
+
+	//
+	// pre checks
+	//
+	switch method {
+	case "PUT":
+		// REST update,create methods
+		switch item {
+		case "people":
+			// itemid is an int
+			if itemidInt, err = strconv.Atoi(itemid); err != nil {
+				return failed(err)
+			}
+			// a user can not edit himself
+			if itemidInt == personid {
+				return denied("can not edit/delete yourself", http.StatusUnauthorized)
+			}
+			// we can not edit an admin
+			a, e := env.DB.IsPersonAdmin(itemidInt)
+			if e != nil {
+				return failed(e)
+			}
+			if a {
+				return denied("can not delete an admin", http.StatusUnauthorized)
+			}
+			// only admins can edit a member of all the entities
+			if aerr := env.authorizeAllEntitiesMember(personid, itemidInt); aerr != nil {
+				return aerr
+			}
 		}
+	case "DELETE":
+		// REST delete method
+		switch item {
+		case "people":
+			// itemid is an int
+			if itemidInt, err = strconv.Atoi(itemid); err != nil {
+				return failed(err)
+			}
+			// a user can not delete himself
+			if itemidInt == personid {
+				return denied("can not edit/delete yourself", http.StatusUnauthorized)
+			}
+			// we can not delete a manager
+			m, e := env.DB.IsPersonManager(itemidInt)
+			if e != nil {
+				return failed(e)
+			}
+			if m {
+				return denied("can not delete a manager", http.StatusUnauthorized)
+			}
+			// we can not delete an admin
+			a, e := env.DB.IsPersonAdmin(itemidInt)
+			if e != nil {
+				return failed(e)
+			}
+			if a {
+				return denied("can not delete an admin", http.StatusUnauthorized)
+			}
+			// only admins can delete a member of all the entities
+			if aerr := env.authorizeAllEntitiesMember(personid, itemidInt); aerr != nil {
+				return aerr
+			}
+		case "storelocations":
+			// itemid is an int
+			if itemidInt, err = strconv.Atoi(itemid); err != nil {
+				return failed(err)
+			}
+			// we can not delete a store location with children
+			c, e := env.DB.GetStoreLocationChildren(itemidInt)
+			if e != nil {
+				return failed(e)
+			}
+			if len(c) != 0 {
+				return denied("can not delete store location with children", http.StatusUnauthorized)
+			}
+			// we can not delete a non empty store location
+			m, e := env.DB.HasStorelocationStorage(itemidInt)
+			if e != nil {
+				return failed(e)
+			}
+			if !m {
+				return denied("can not delete a non empty store location", http.StatusUnauthorized)
+			}
+		case "products":
+			// itemid is an int
+			if itemidInt, err = strconv.Atoi(itemid); err != nil {
+				return failed(err)
+			}
+			// we can not delete a product with storages
+			c, e := env.DB.CountProductStorages(itemidInt)
+			if e != nil {
+				return failed(e)
+			}
+			if c != 0 {
+				return denied("can not delete a product with storages", http.StatusUnauthorized)
+			}
+		case "entities":
+			// itemid is an int
+			if itemidInt, err = strconv.Atoi(itemid); err != nil {
+				return failed(err)
+			}
+			m, e1 := env.DB.HasEntityMember(itemidInt)
+			if e1 != nil {
+				return failed(e1)
+			}
+			n, e2 := env.DB.HasEntityStorelocation(itemidInt)
+			if e2 != nil {
+				return failed(e2)
+			}
+			if m {
+				return denied("can not delete an entity with members", http.StatusUnauthorized)
+			}
+			if n {
+				return denied("can not delete an entity with store locations", http.StatusUnauthorized)
+			}
+			// multi-tenant mode
+			o, e3 := env.DB.HasEntityTenantCards(itemidInt)
+			if e3 != nil {
+				return failed(e3)
+			}
+			if o {
+				return denied("can not delete an entity with product cards, suppliers or producers", http.StatusUnauthorized)
+			}
+		}
+	}
+
+	// allow/deny access
+	logger.Log.WithFields(logrus.Fields{
+		"itemid":   itemid,
+		"item":     item,
+		"personid": strconv.Itoa(personid),
+		"action":   action,
+	}).Debug("AuthorizeMiddleware")
+
+	if permok, err = env.Enforcer.Enforce(strconv.Itoa(personid), action, item, itemid); err != nil {
+		return &models.AppError{OriginalError: err, Message: "enforcer error: " + err.Error(), Code: http.StatusInternalServerError}
+	}
+
+	logger.Log.WithFields(logrus.Fields{
+		"permok": permok,
+	}).Debug("AuthorizeMiddleware")
+
+	if !permok {
+		logger.Log.WithFields(logrus.Fields{"unauthorized": "!permok"}).Debug("AuthorizeMiddleware")
+		return denied("forbidden", http.StatusForbidden)
+	}
+
+	return nil
+}
 
-		h.ServeHTTP(w, r)
-	})
+// authorizeAllEntitiesMember returns an error if the person with id itemid
+// is a member of all the entities and the person with id personid is not an admin.
+func (env *Env) authorizeAllEntitiesMember(personid int, itemid int) *models.AppError {
+	p, err := env.DB.GetPerson(itemid)
+	if err == sql.ErrNoRows {
+		// left to the enforcer
+		return nil
+	}
+	if err != nil {
+		return &models.AppError{OriginalError: err, Message: err.Error(), Code: http.StatusInternalServerError}
+	}
+
+	if !p.PersonAllEntities {
+		return nil
+	}
+
+	a, err := env.DB.IsPersonAdmin(personid)
+	if err != nil {
+		return &models.AppError{OriginalError: err, Message: err.Error(), Code: http.StatusInternalServerError}
+	}
+
+	if !a {
+		return &models.AppError{Message: "can not edit/delete a member of all the entities", Code: http.StatusUnauthorized}
+	}
+
+	return nil
 }
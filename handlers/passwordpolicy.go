@@ -0,0 +1,55 @@
+package handlers
+
+import (
+	"net/http"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/nicksnyder/go-i18n/v2/i18n"
+	"github.com/tbellembois/gochimitheque/locales"
+	"github.com/tbellembois/gochimitheque/models"
+)
+
+// checkPasswordPolicy returns an error if the password of a local account
+// is shorter than PasswordMinLength or has less than PasswordMinClasses
+// characters classes among lowercase letters, uppercase letters, digits and symbols.
+func (env *Env) checkPasswordPolicy(password string) *models.AppError {
+	if utf8.RuneCountInString(password) < env.PasswordMinLength {
+		return &models.AppError{
+			Message: locales.Localizer.MustLocalize(&i18n.LocalizeConfig{
+				MessageID:    "password_policy_length",
+				TemplateData: map[string]interface{}{"Length": env.PasswordMinLength},
+				PluralCount:  1,
+			}),
+			Code: http.StatusBadRequest,
+		}
+	}
+
+	var lower, upper, digit, symbol int
+
+	for _, c := range password {
+		switch {
+		case unicode.IsLower(c):
+			lower = 1
+		case unicode.IsUpper(c):
+			upper = 1
+		case unicode.IsDigit(c):
+			digit = 1
+		default:
+			symbol = 1
+		}
+	}
+
+	if lower+upper+digit+symbol < env.PasswordMinClasses {
+		return &models.AppError{
+			Message: locales.Localizer.MustLocalize(&i18n.LocalizeConfig{
+				MessageID:    "password_policy_classes",
+				TemplateData: map[string]interface{}{"Classes": env.PasswordMinClasses},
+				PluralCount:  1,
+			}),
+			Code: http.StatusBadRequest,
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,85 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/sirupsen/logrus"
+	"github.com/tbellembois/gochimitheque/logger"
+	"github.com/tbellembois/gochimitheque/models"
+	"github.com/tbellembois/gochimitheque/request"
+)
+
+// permissionsCheckMax is the maximum number of permissions
+// checked in one request.
+const permissionsCheckMax = 500
+
+// CheckPermissionsHandler returns for each permission of the request
+// if the logged person has it, as the AuthorizeMiddleware would decide.
+func (env *Env) CheckPermissionsHandler(w http.ResponseWriter, r *http.Request) *models.AppError {
+	var (
+		checks []models.PermissionCheck
+		err    error
+	)
+
+	if err = json.NewDecoder(r.Body).Decode(&checks); err != nil {
+		return &models.AppError{
+			OriginalError: err,
+			Message:       "JSON decoding error",
+			Code:          http.StatusBadRequest,
+		}
+	}
+
+	if len(checks) > permissionsCheckMax {
+		return &models.AppError{
+			Message: "too many permissions to check",
+			Code:    http.StatusBadRequest,
+		}
+	}
+
+	c := request.ContainerFromRequestContext(r)
+
+	logger.Log.WithFields(logrus.Fields{"personid": c.PersonID, "checks": len(checks)}).Debug("CheckPermissionsHandler")
+
+	for i, check := range checks {
+		var method, action string
+
+		// the request method and casbin action of the matching route
+		switch check.Action {
+		case "r":
+			method, action = http.MethodGet, "r"
+		case "w":
+			method, action = http.MethodPut, "w"
+			if check.ItemID == "" {
+				method = http.MethodPost
+			}
+		case "d":
+			method, action = http.MethodDelete, "w"
+		case "b":
+			method, action = http.MethodPut, "b"
+		default:
+			checks[i].Reason = "unknown action"
+			continue
+		}
+
+		// a malformed check is not allowed, it does not fail the others
+		if aerr := env.authorize(c.PersonID, method, action, check.Item, check.ItemID); aerr != nil {
+			checks[i].Reason = aerr.Message
+
+			continue
+		}
+
+		checks[i].Allowed = true
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+
+	if err = json.NewEncoder(w).Encode(checks); err != nil {
+		return &models.AppError{
+			Code:    http.StatusInternalServerError,
+			Message: err.Error(),
+		}
+	}
+
+	return nil
+}
@@ -1,8 +1,10 @@
 package handlers
 
 import (
+	"bytes"
 	"encoding/json"
 	"fmt"
+	"io"
 	"net/http"
 	"strconv"
 	"strings"
@@ -10,9 +12,6 @@ import (
 	"github.com/gorilla/mux"
 	"github.com/nicksnyder/go-i18n/v2/i18n"
 	"github.com/sirupsen/logrus"
-	qrcode "github.com/skip2/go-qrcode"
-	"github.com/tbellembois/gochimitheque/aes"
-	"github.com/tbellembois/gochimitheque/casbin"
 	"github.com/tbellembois/gochimitheque/ldap"
 	"github.com/tbellembois/gochimitheque/locales"
 	"github.com/tbellembois/gochimitheque/logger"
@@ -66,6 +65,62 @@ func (env *Env) VGetPeopleHandler(w http.ResponseWriter, r *http.Request) *model
 	REST handlers
 */
 
+// decodePerson decodes the person of the request body and returns
+// the person_allentities value of the body, nil if it is not set:
+// the person form does not send it.
+func decodePerson(r *http.Request, p *models.Person) (*bool, *models.AppError) {
+	var (
+		body []byte
+		err  error
+	)
+
+	allEntities := struct {
+		PersonAllEntities *bool `json:"person_allentities"`
+	}{}
+
+	if body, err = io.ReadAll(r.Body); err == nil {
+		if err = json.NewDecoder(bytes.NewReader(body)).Decode(p); err == nil {
+			err = json.NewDecoder(bytes.NewReader(body)).Decode(&allEntities)
+		}
+	}
+
+	if err != nil {
+		return nil, &models.AppError{
+			OriginalError: err,
+			Message:       "JSON decoding error",
+			Code:          http.StatusInternalServerError,
+		}
+	}
+
+	return allEntities.PersonAllEntities, nil
+}
+
+// checkPersonAllEntities returns an error if the person with id personID
+// is not an admin and changes the member of all the entities flag from current.
+func (env *Env) checkPersonAllEntities(personID int, allEntities *bool, current bool) *models.AppError {
+	if allEntities == nil || *allEntities == current {
+		return nil
+	}
+
+	isadmin, err := env.DB.IsPersonAdmin(personID)
+	if err != nil {
+		return &models.AppError{
+			OriginalError: err,
+			Message:       "error getting the person admin status",
+			Code:          http.StatusInternalServerError,
+		}
+	}
+
+	if !isadmin {
+		return &models.AppError{
+			Message: "only admins can change the membership of all the entities",
+			Code:    http.StatusForbidden,
+		}
+	}
+
+	return nil
+}
+
 func (env *Env) GetLDAPGroupsHandler(w http.ResponseWriter, r *http.Request) *models.AppError {
 	logger.Log.Debug("GetLDAPGroupsHandler")
 
@@ -142,84 +197,6 @@ func (env *Env) GetPeopleHandler(w http.ResponseWriter, r *http.Request) *models
 	return nil
 }
 
-func (env *Env) GenerateQRCodeHandler(w http.ResponseWriter, r *http.Request) *models.AppError {
-	vars := mux.Vars(r)
-
-	var (
-		id     int
-		person models.Person
-		err    error
-	)
-
-	if id, err = strconv.Atoi(vars["id"]); err != nil {
-		return &models.AppError{
-			OriginalError: err,
-			Message:       "id atoi conversion",
-			Code:          http.StatusInternalServerError,
-		}
-	}
-
-	if person, err = env.DB.GetPerson(id); err != nil {
-		return &models.AppError{
-			OriginalError: err,
-			Message:       "get person error",
-			Code:          http.StatusInternalServerError,
-		}
-	}
-
-	if person.PersonAESKey, err = aes.GenerateAESKey(); err != nil {
-		return &models.AppError{
-			OriginalError: err,
-			Message:       "generate aes key error",
-			Code:          http.StatusInternalServerError,
-		}
-	}
-
-	if err = env.DB.UpdatePersonAESKey(person); err != nil {
-		return &models.AppError{
-			OriginalError: err,
-			Message:       "update person aes key error",
-			Code:          http.StatusInternalServerError,
-		}
-	}
-
-	// Encoding the password.
-	// We need to keep the email unencrypted the retrieve the personnal AES key of the person.
-	var (
-		encryptedPassword string
-	)
-	if encryptedPassword, err = aes.Encrypt(person.PersonPassword, person.PersonAESKey); err != nil {
-		return &models.AppError{
-			OriginalError: err,
-			Message:       "encrypt person credentials error",
-			Code:          http.StatusInternalServerError,
-		}
-	}
-
-	logger.Log.WithFields(logrus.Fields{
-		"person":               person,
-		"encryptedCredentials": encryptedPassword,
-	}).Debug("GetPersonHandler")
-
-	if person.QRCode, err = qrcode.Encode(fmt.Sprintf("%s:%s", person.PersonEmail, encryptedPassword), qrcode.Medium, 512); err != nil {
-		return &models.AppError{
-			Code:    http.StatusInternalServerError,
-			Message: err.Error(),
-		}
-	}
-
-	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
-
-	if err = json.NewEncoder(w).Encode(person); err != nil {
-		return &models.AppError{
-			Code:    http.StatusInternalServerError,
-			Message: err.Error(),
-		}
-	}
-
-	return nil
-}
-
 func (env *Env) IsPersonLDAPHandler(w http.ResponseWriter, r *http.Request) *models.AppError {
 	var (
 		result bool
@@ -297,30 +274,7 @@ func (env *Env) GetPersonHandler(w http.ResponseWriter, r *http.Request) *models
 		}
 	}
 
-	// Encoding the password.
-	// We need to keep the email unencrypted the retrieve the personnal AES key of the person.
-	var (
-		encryptedPassword string
-	)
-	if encryptedPassword, err = aes.Encrypt(person.PersonPassword, person.PersonAESKey); err != nil {
-		return &models.AppError{
-			OriginalError: err,
-			Message:       "encrypt person credentials error",
-			Code:          http.StatusInternalServerError,
-		}
-	}
-
-	logger.Log.WithFields(logrus.Fields{
-		"person":               person,
-		"encryptedCredentials": encryptedPassword,
-	}).Debug("GetPersonHandler")
-
-	if person.QRCode, err = qrcode.Encode(fmt.Sprintf("%s:%s", person.PersonEmail, encryptedPassword), qrcode.Medium, 512); err != nil {
-		return &models.AppError{
-			Code:    http.StatusInternalServerError,
-			Message: err.Error(),
-		}
-	}
+	logger.Log.WithFields(logrus.Fields{"person": person}).Debug("GetPersonHandler")
 
 	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
 
@@ -446,40 +400,78 @@ func (env *Env) GetPersonPermissionsHandler(w http.ResponseWriter, r *http.Reque
 	return nil
 }
 
-// CreatePersonHandler creates the person from the request form.
-func (env *Env) CreatePersonHandler(w http.ResponseWriter, r *http.Request) *models.AppError {
+// GetPersonRolesHandler returns a json of the roles of the person with the requested id.
+func (env *Env) GetPersonRolesHandler(w http.ResponseWriter, r *http.Request) *models.AppError {
+	vars := mux.Vars(r)
+
 	var (
-		p   models.Person
+		id  int
 		err error
 	)
 
-	if err = json.NewDecoder(r.Body).Decode(&p); err != nil {
+	if id, err = strconv.Atoi(vars["id"]); err != nil {
 		return &models.AppError{
 			OriginalError: err,
-			Message:       "JSON decoding error",
+			Message:       "id atoi conversion",
 			Code:          http.StatusInternalServerError,
 		}
 	}
 
-	logger.Log.WithFields(logrus.Fields{"p": p}).Debug("CreatePersonHandler")
-
-	if err = p.GeneratePassword(); err != nil {
+	roles, err := env.DB.GetPersonRoles(id)
+	if err != nil {
 		return &models.AppError{
 			OriginalError: err,
-			Message:       "password generation error",
 			Code:          http.StatusInternalServerError,
+			Message:       "error getting the roles",
 		}
 	}
 
-	if p.PersonAESKey, err = aes.GenerateAESKey(); err != nil {
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+
+	if err = json.NewEncoder(w).Encode(roles); err != nil {
+		return &models.AppError{
+			Code:    http.StatusInternalServerError,
+			Message: err.Error(),
+		}
+	}
+	return nil
+}
+
+// CreatePersonHandler creates the person from the request form.
+func (env *Env) CreatePersonHandler(w http.ResponseWriter, r *http.Request) *models.AppError {
+	var (
+		p           models.Person
+		allEntities *bool
+		err         error
+		aerr        *models.AppError
+	)
+
+	if allEntities, aerr = decodePerson(r, &p); aerr != nil {
+		return aerr
+	}
+
+	logger.Log.WithFields(logrus.Fields{"p": p}).Debug("CreatePersonHandler")
+
+	c := request.ContainerFromRequestContext(r)
+	if aerr = env.checkPersonAllEntities(c.PersonID, allEntities, false); aerr != nil {
+		return aerr
+	}
+
+	if aerr := checkPersonRoles(p); aerr != nil {
+		return aerr
+	}
+
+	if err = p.GeneratePassword(); err != nil {
 		return &models.AppError{
 			OriginalError: err,
-			Message:       "aeskey generation error",
+			Message:       "password generation error",
 			Code:          http.StatusInternalServerError,
 		}
 	}
 
-	if _, err := env.DB.CreatePerson(p); err != nil {
+	var id int64
+
+	if id, err = env.DB.CreatePerson(p); err != nil {
 		return &models.AppError{
 			OriginalError: err,
 			Message:       "create person error",
@@ -487,6 +479,8 @@ func (env *Env) CreatePersonHandler(w http.ResponseWriter, r *http.Request) *mod
 		}
 	}
 
+	p.PersonID = int(id)
+
 	// sending the new mail
 	msgbody := fmt.Sprintf(locales.Localizer.MustLocalize(&i18n.LocalizeConfig{MessageID: "createperson_mailbody", PluralCount: 1}), env.AppFullURL, p.PersonEmail)
 	msgsubject := locales.Localizer.MustLocalize(&i18n.LocalizeConfig{MessageID: "createperson_mailsubject", PluralCount: 1})
@@ -494,7 +488,9 @@ func (env *Env) CreatePersonHandler(w http.ResponseWriter, r *http.Request) *mod
 		logger.Log.Errorf("error sending email %s", err.Error())
 	}
 
-	env.Enforcer = casbin.InitCasbinPolicy(env.DB)
+	if aerr := env.reloadPolicies(p.PersonID); aerr != nil {
+		return aerr
+	}
 
 	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
 
@@ -524,6 +520,10 @@ func (env *Env) UpdatePersonpHandler(w http.ResponseWriter, r *http.Request) *mo
 
 	logger.Log.WithFields(logrus.Fields{"p": p}).Debug("UpdatePersonpHandler")
 
+	if aerr := env.checkPasswordPolicy(p.PersonPassword); aerr != nil {
+		return aerr
+	}
+
 	// retrieving the logged user id from request context
 	c := request.ContainerFromRequestContext(r)
 
@@ -568,16 +568,14 @@ func (env *Env) UpdatePersonHandler(w http.ResponseWriter, r *http.Request) *mod
 	var (
 		id          int
 		err         error
+		aerr        *models.AppError
 		p, updatedp models.Person
 		es          []models.Entity
+		allEntities *bool
 	)
 
-	if err = json.NewDecoder(r.Body).Decode(&p); err != nil {
-		return &models.AppError{
-			OriginalError: err,
-			Message:       "JSON decoding error",
-			Code:          http.StatusInternalServerError,
-		}
+	if allEntities, aerr = decodePerson(r, &p); aerr != nil {
+		return aerr
 	}
 
 	logger.Log.WithFields(logrus.Fields{"p": p}).Debug("UpdatePersonHandler")
@@ -600,6 +598,20 @@ func (env *Env) UpdatePersonHandler(w http.ResponseWriter, r *http.Request) *mod
 	updatedp.PersonEmail = p.PersonEmail
 	updatedp.Entities = p.Entities
 	updatedp.Permissions = p.Permissions
+	updatedp.Roles = p.Roles
+
+	c := request.ContainerFromRequestContext(r)
+	if aerr = env.checkPersonAllEntities(c.PersonID, allEntities, updatedp.PersonAllEntities); aerr != nil {
+		return aerr
+	}
+
+	if allEntities != nil {
+		updatedp.PersonAllEntities = *allEntities
+	}
+
+	if aerr = checkPersonRoles(updatedp); aerr != nil {
+		return aerr
+	}
 
 	// checking if the person is a manager
 	if es, err = env.DB.GetPersonManageEntities(id); err != nil {
@@ -653,7 +665,9 @@ func (env *Env) UpdatePersonHandler(w http.ResponseWriter, r *http.Request) *mod
 		}
 	}
 
-	env.Enforcer = casbin.InitCasbinPolicy(env.DB)
+	if aerr := env.reloadPolicies(id); aerr != nil {
+		return aerr
+	}
 
 	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
 
@@ -691,5 +705,9 @@ func (env *Env) DeletePersonHandler(w http.ResponseWriter, r *http.Request) *mod
 		}
 	}
 
+	if aerr := env.reloadPolicies(id); aerr != nil {
+		return aerr
+	}
+
 	return nil
 }
@@ -0,0 +1,296 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/mux"
+	"github.com/sirupsen/logrus"
+	"github.com/tbellembois/gochimitheque/datastores"
+	"github.com/tbellembois/gochimitheque/logger"
+	"github.com/tbellembois/gochimitheque/models"
+	"github.com/tbellembois/gochimitheque/request"
+)
+
+// preparationRequest is the body of the solution preparation request,
+// the storage is the prepared one with its final quantity and concentration.
+type preparationRequest struct {
+	Preparation models.Preparation `json:"preparation"`
+	Storage     models.Storage     `json:"storage"`
+}
+
+// CreatePreparationHandler creates a storage prepared from the requested source storages
+// and returns its id.
+func (env *Env) CreatePreparationHandler(w http.ResponseWriter, r *http.Request) *models.AppError {
+	var (
+		pr  preparationRequest
+		id  int64
+		err error
+	)
+
+	if err = json.NewDecoder(r.Body).Decode(&pr); err != nil {
+		return &models.AppError{
+			OriginalError: err,
+			Message:       "JSON decoding error",
+			Code:          http.StatusBadRequest,
+		}
+	}
+
+	logger.Log.WithFields(logrus.Fields{"pr": pr}).Debug("CreatePreparationHandler")
+
+	c := request.ContainerFromRequestContext(r)
+
+	p := pr.Preparation
+	s := pr.Storage
+
+	if len(p.Sources) == 0 {
+		return &models.AppError{
+			Message: "no source storage",
+			Code:    http.StatusBadRequest,
+		}
+	}
+
+	if !s.StorageQuantity.Valid || s.StorageQuantity.Float64 <= 0 {
+		return &models.AppError{
+			Message: "the prepared quantity must be positive",
+			Code:    http.StatusBadRequest,
+		}
+	}
+
+	// retrieving the full store location
+	// we need its entity id to compute the barecode
+	if s.StoreLocation, err = env.DB.GetStoreLocation(int(s.StoreLocationID.Int64)); err != nil {
+		return &models.AppError{
+			OriginalError: err,
+			Message:       "error retrieving the storage store location",
+			Code:          http.StatusBadRequest,
+		}
+	}
+
+	var (
+		sourceProducts   []models.Product
+		sourceProductIDs = make(map[int]struct{})
+	)
+
+	for _, ps := range p.Sources {
+		var source models.Storage
+
+		if ps.PreparationSourceQuantity <= 0 {
+			return &models.AppError{
+				Message: "the sources quantities must be positive",
+				Code:    http.StatusBadRequest,
+			}
+		}
+
+		if source, err = env.DB.GetStorage(int(ps.StorageID.Int64)); err != nil {
+			if err == sql.ErrNoRows {
+				return &models.AppError{
+					OriginalError: err,
+					Message:       "source storage not found",
+					Code:          http.StatusNotFound,
+				}
+			}
+
+			return &models.AppError{
+				OriginalError: err,
+				Message:       "get storage",
+				Code:          http.StatusInternalServerError,
+			}
+		}
+
+		if source.StorageArchive.Bool {
+			return &models.AppError{
+				Message: "an archived storage can not be used for a preparation",
+				Code:    http.StatusBadRequest,
+			}
+		}
+
+		if source.StoreLocation.EntityID != s.StoreLocation.EntityID {
+			return &models.AppError{
+				Message: "the sources must be stored in the entity of the prepared storage",
+				Code:    http.StatusBadRequest,
+			}
+		}
+
+		// the logged user must be able to modify the source
+		if aerr := env.authorize(c.PersonID, r.Method, "w", "storages", strconv.FormatInt(ps.StorageID.Int64, 10)); aerr != nil {
+			return aerr
+		}
+
+		if _, ok := sourceProductIDs[source.ProductID]; !ok {
+			sourceProductIDs[source.ProductID] = struct{}{}
+			sourceProducts = append(sourceProducts, source.Product)
+		}
+	}
+
+	for i := range sourceProducts {
+		if sourceProducts[i], err = env.DB.GetProduct(sourceProducts[i].ProductID); err != nil {
+			return &models.AppError{
+				OriginalError: err,
+				Message:       "get source product",
+				Code:          http.StatusInternalServerError,
+			}
+		}
+	}
+
+	// the prepared storage product must bear the hazards of the sources,
+	// it defaults to the first source one bearing them
+	if s.ProductID == 0 {
+		for _, sp := range sourceProducts {
+			if len(uncoveredHazards(sp, sourceProducts)) == 0 {
+				s.ProductID = sp.ProductID
+				break
+			}
+		}
+
+		if s.ProductID == 0 {
+			return &models.AppError{
+				Message: "no source product bears the hazards of all the sources, choose the prepared product",
+				Code:    http.StatusBadRequest,
+			}
+		}
+	} else {
+		var product models.Product
+
+		if product, err = env.DB.GetProduct(s.ProductID); err != nil {
+			if err == sql.ErrNoRows {
+				return &models.AppError{
+					OriginalError: err,
+					Message:       "prepared product not found",
+					Code:          http.StatusNotFound,
+				}
+			}
+
+			return &models.AppError{
+				OriginalError: err,
+				Message:       "get product",
+				Code:          http.StatusInternalServerError,
+			}
+		}
+
+		if missing := uncoveredHazards(product, sourceProducts); len(missing) != 0 {
+			return &models.AppError{
+				Message: "the prepared product does not bear the sources hazards " + strings.Join(missing, ", "),
+				Code:    http.StatusBadRequest,
+			}
+		}
+	}
+
+	s.PersonID = c.PersonID
+	p.PersonID = c.PersonID
+
+	if aerr := env.checkStorageTenant(s); aerr != nil {
+		return aerr
+	}
+
+	if id, err = env.DB.CreatePreparation(p, s); err != nil {
+		if err == datastores.ErrInsufficientQuantity {
+			return &models.AppError{
+				OriginalError: err,
+				Message:       "a source quantity exceeds the storage quantity",
+				Code:          http.StatusBadRequest,
+			}
+		}
+
+		return &models.AppError{
+			OriginalError: err,
+			Message:       "create preparation error",
+			Code:          http.StatusInternalServerError,
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+
+	if err = json.NewEncoder(w).Encode(models.Storage{StorageID: sql.NullInt64{Valid: true, Int64: id}}); err != nil {
+		return &models.AppError{
+			Code:    http.StatusInternalServerError,
+			Message: err.Error(),
+		}
+	}
+
+	return nil
+}
+
+// uncoveredHazards returns the symbols labels and hazard statements references
+// of the sources products not borne by the product p.
+func uncoveredHazards(p models.Product, sources []models.Product) []string {
+	var missing []string
+
+	symbols := make(map[int]struct{})
+	for _, sy := range p.Symbols {
+		symbols[sy.SymbolID] = struct{}{}
+	}
+
+	hazardStatements := make(map[int]struct{})
+	for _, hs := range p.HazardStatements {
+		hazardStatements[hs.HazardStatementID] = struct{}{}
+	}
+
+	for _, sp := range sources {
+		for _, sy := range sp.Symbols {
+			if _, ok := symbols[sy.SymbolID]; !ok {
+				symbols[sy.SymbolID] = struct{}{}
+				missing = append(missing, sy.SymbolLabel)
+			}
+		}
+
+		for _, hs := range sp.HazardStatements {
+			if _, ok := hazardStatements[hs.HazardStatementID]; !ok {
+				hazardStatements[hs.HazardStatementID] = struct{}{}
+				missing = append(missing, hs.HazardStatementReference)
+			}
+		}
+	}
+
+	return missing
+}
+
+// GetPreparationHandler returns a json of the preparation of the storage with the requested id,
+// with its sources and their hazards.
+func (env *Env) GetPreparationHandler(w http.ResponseWriter, r *http.Request) *models.AppError {
+	vars := mux.Vars(r)
+
+	var (
+		id  int
+		p   models.Preparation
+		err error
+	)
+
+	if id, err = strconv.Atoi(vars["id"]); err != nil {
+		return &models.AppError{
+			OriginalError: err,
+			Message:       "id atoi conversion",
+			Code:          http.StatusInternalServerError,
+		}
+	}
+
+	if p, err = env.DB.GetPreparation(id); err != nil {
+		if err == sql.ErrNoRows {
+			return &models.AppError{
+				OriginalError: err,
+				Message:       "preparation not found",
+				Code:          http.StatusNotFound,
+			}
+		}
+
+		return &models.AppError{
+			OriginalError: err,
+			Message:       "error getting the preparation",
+			Code:          http.StatusInternalServerError,
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+
+	if err = json.NewEncoder(w).Encode(p); err != nil {
+		return &models.AppError{
+			Code:    http.StatusInternalServerError,
+			Message: err.Error(),
+		}
+	}
+
+	return nil
+}
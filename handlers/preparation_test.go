@@ -0,0 +1,49 @@
+package handlers
+
+import (
+	"reflect"
+	"strconv"
+	"testing"
+
+	"github.com/tbellembois/gochimitheque/models"
+)
+
+func TestUncoveredHazards(t *testing.T) {
+	product := func(symbols []int, hazardStatements []int) models.Product {
+		var p models.Product
+
+		for _, id := range symbols {
+			p.Symbols = append(p.Symbols, models.Symbol{SymbolID: id, SymbolLabel: "SGH0" + strconv.Itoa(id)})
+		}
+
+		for _, id := range hazardStatements {
+			p.HazardStatements = append(p.HazardStatements, models.HazardStatement{HazardStatementID: id, HazardStatementReference: "H" + strconv.Itoa(id)})
+		}
+
+		return p
+	}
+
+	hcl := product([]int{5, 7}, []int{1, 2})
+	water := product(nil, nil)
+	flammable := product([]int{2}, []int{3})
+
+	tests := []struct {
+		name    string
+		p       models.Product
+		sources []models.Product
+		want    []string
+	}{
+		{"source product", hcl, []models.Product{hcl, water}, nil},
+		{"other product bearing the hazards", product([]int{2, 5, 7}, []int{1, 2, 3, 4}), []models.Product{hcl, flammable}, nil},
+		{"product without hazards", water, []models.Product{hcl, water}, []string{"SGH05", "SGH07", "H1", "H2"}},
+		{"partially covered", hcl, []models.Product{hcl, flammable, flammable}, []string{"SGH02", "H3"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := uncoveredHazards(tt.p, tt.sources); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("uncoveredHazards() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
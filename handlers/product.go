@@ -13,9 +13,11 @@ import (
 	"github.com/sirupsen/logrus"
 	"github.com/tbellembois/gochimitheque-utils/convert"
 	"github.com/tbellembois/gochimitheque/datastores"
+	"github.com/tbellembois/gochimitheque/formula"
 	"github.com/tbellembois/gochimitheque/logger"
 	"github.com/tbellembois/gochimitheque/models"
 	"github.com/tbellembois/gochimitheque/request"
+	"github.com/tbellembois/gochimitheque/smiles"
 	"github.com/tbellembois/gochimitheque/static/jade"
 )
 
@@ -28,6 +30,160 @@ func sanitizeProduct(p *models.Product) {
 	p.EmpiricalFormulaLabel.String = strings.Trim(p.EmpiricalFormulaLabel.String, " ")
 	p.CasNumberLabel.String = strings.Trim(p.CasNumberLabel.String, " ")
 	p.CeNumberLabel.String = strings.Trim(p.CeNumberLabel.String, " ")
+	// transport information
+	p.ProductUNNumber.String = strings.TrimSpace(strings.TrimPrefix(strings.ToUpper(strings.TrimSpace(p.ProductUNNumber.String)), "UN"))
+	p.ProductUNNumber.Valid = p.ProductUNNumber.String != ""
+	p.ProductPackingGroup.String = strings.ToUpper(strings.TrimSpace(p.ProductPackingGroup.String))
+	p.ProductPackingGroup.Valid = p.ProductPackingGroup.String != ""
+	// unknown physical properties
+	if p.ProductDensity.Float64 <= 0 {
+		p.ProductDensity.Valid = false
+	}
+	if p.ProductMolarMass.Float64 <= 0 {
+		p.ProductMolarMass.Valid = false
+	}
+	// structure identifiers
+	p.ProductSMILES.String = strings.TrimSpace(p.ProductSMILES.String)
+	p.ProductSMILES.Valid = p.ProductSMILES.String != ""
+	p.ProductInChI.String = strings.TrimSpace(p.ProductInChI.String)
+	p.ProductInChI.Valid = p.ProductInChI.String != ""
+	p.ProductInChIKey.String = strings.ToUpper(strings.TrimSpace(p.ProductInChIKey.String))
+	p.ProductInChIKey.Valid = p.ProductInChIKey.String != ""
+	// regulatory classification
+	p.ProductRegulation.String = strings.ToLower(strings.TrimSpace(p.ProductRegulation.String))
+	p.ProductRegulation.Valid = p.ProductRegulation.String != ""
+}
+
+// checkProductTransport validates the transport information of the product p.
+func checkProductTransport(p *models.Product) *models.AppError {
+	if !p.ProductPackingGroup.Valid {
+		return nil
+	}
+
+	switch p.ProductPackingGroup.String {
+	case "I", "II", "III":
+		return nil
+	}
+
+	return &models.AppError{
+		Message: "invalid packing group " + p.ProductPackingGroup.String + ", expected I, II or III",
+		Code:    http.StatusBadRequest,
+	}
+}
+
+// checkProductRegulation validates the regulatory classification of the product p.
+func checkProductRegulation(p *models.Product) *models.AppError {
+	if p.ProductRegulation.Valid && !models.IsProductRegulation(p.ProductRegulation.String) {
+		return &models.AppError{
+			Message: "invalid regulation " + p.ProductRegulation.String,
+			Code:    http.StatusBadRequest,
+		}
+	}
+
+	return nil
+}
+
+// checkProductStructure validates the structure identifiers of the product p.
+// The empirical formula is derived from the SMILES if not set, warnings are
+// added to p when the SMILES or InChI formulas differ from the empirical formula.
+func (env *Env) checkProductStructure(p *models.Product) *models.AppError {
+	var (
+		err     error
+		entered formula.Composition
+		derived formula.Composition
+	)
+
+	p.ProductWarnings = nil
+
+	// the entered empirical formula
+	if p.EmpiricalFormulaID.Valid && p.EmpiricalFormulaLabel.String == "" && p.EmpiricalFormulaID.Int64 != -1 {
+		var ef models.EmpiricalFormula
+
+		if ef, err = datastores.GetByID(models.EmpiricalFormula{}, env.DB.GetDB(), int(p.EmpiricalFormulaID.Int64)); err != nil {
+			return &models.AppError{
+				OriginalError: err,
+				Message:       "get empirical formula",
+				Code:          http.StatusInternalServerError,
+			}
+		}
+
+		p.EmpiricalFormulaLabel = ef.EmpiricalFormulaLabel
+	}
+
+	if p.EmpiricalFormulaID.Valid {
+		// unparsable formulas are not compared
+		entered, _ = formula.Parse(p.EmpiricalFormulaLabel.String)
+	}
+
+	if p.ProductInChIKey.Valid && !formula.IsInChIKey(p.ProductInChIKey.String) {
+		return &models.AppError{
+			Message: "invalid InChIKey " + p.ProductInChIKey.String,
+			Code:    http.StatusBadRequest,
+		}
+	}
+
+	if p.ProductSMILES.Valid {
+		var m *smiles.Molecule
+
+		if m, err = smiles.Parse(p.ProductSMILES.String); err != nil {
+			return &models.AppError{
+				OriginalError: err,
+				Message:       err.Error(),
+				Code:          http.StatusBadRequest,
+			}
+		}
+
+		derived = m.Composition()
+
+		switch {
+		case !p.EmpiricalFormulaID.Valid:
+			var (
+				label string
+				ef    models.EmpiricalFormula
+			)
+
+			if label, err = convert.ToEmpiricalFormula(derived.Hill()); err != nil {
+				break
+			}
+
+			if ef, err = datastores.GetByText(models.EmpiricalFormula{}, env.DB.GetDB(), label); err != nil && err != sql.ErrNoRows {
+				return &models.AppError{
+					OriginalError: err,
+					Message:       "get empirical formula",
+					Code:          http.StatusInternalServerError,
+				}
+			}
+
+			// -1 to create it
+			if err == sql.ErrNoRows || ef == (models.EmpiricalFormula{}) {
+				ef = models.EmpiricalFormula{EmpiricalFormulaID: sql.NullInt64{Int64: -1, Valid: true}}
+			}
+
+			ef.EmpiricalFormulaLabel = sql.NullString{String: label, Valid: true}
+			p.EmpiricalFormula = ef
+			entered = derived
+		case entered != nil && !entered.Equal(derived):
+			p.ProductWarnings = append(p.ProductWarnings, fmt.Sprintf("the SMILES formula %s differs from the empirical formula %s", derived.Hill(), entered.Hill()))
+		}
+	}
+
+	if p.ProductInChI.Valid {
+		var c formula.Composition
+
+		if c, err = formula.ParseInChI(p.ProductInChI.String); err != nil {
+			return &models.AppError{
+				OriginalError: err,
+				Message:       err.Error(),
+				Code:          http.StatusBadRequest,
+			}
+		}
+
+		if entered != nil && !entered.Equal(c) {
+			p.ProductWarnings = append(p.ProductWarnings, fmt.Sprintf("the InChI formula %s differs from the empirical formula %s", c.Hill(), entered.Hill()))
+		}
+	}
+
+	return nil
 }
 
 /*
@@ -178,6 +334,46 @@ func (env *Env) GetProductsCategoriesHandler(w http.ResponseWriter, r *http.Requ
 	return nil
 }
 
+// GetProductsAdrClassesHandler returns a json list of the transport (ADR) classes.
+func (env *Env) GetProductsAdrClassesHandler(w http.ResponseWriter, r *http.Request) *models.AppError {
+	logger.Log.Debug("GetProductsAdrClassesHandler")
+
+	var (
+		err    error
+		aerr   *models.AppError
+		filter *request.Filter
+	)
+
+	// init db request parameters
+	if filter, aerr = request.NewFilter(r, nil); aerr != nil {
+		return aerr
+	}
+
+	adrclasses, count, err := datastores.GetByMany(models.AdrClass{}, env.DB.GetDB(), filter)
+	if err != nil {
+		return &models.AppError{
+			OriginalError: err,
+			Code:          http.StatusInternalServerError,
+			Message:       "error getting the adr classes",
+		}
+	}
+
+	type resp struct {
+		Rows  []models.AdrClass `json:"rows"`
+		Total int               `json:"total"`
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+
+	if err = json.NewEncoder(w).Encode(resp{Rows: adrclasses, Total: count}); err != nil {
+		return &models.AppError{
+			Code:    http.StatusInternalServerError,
+			Message: err.Error(),
+		}
+	}
+	return nil
+}
+
 // GetProductsTagsHandler returns a json list of the tag.
 func (env *Env) GetProductsTagsHandler(w http.ResponseWriter, r *http.Request) *models.AppError {
 	logger.Log.Debug("GetProductsTagsHandler")
@@ -1315,8 +1511,9 @@ func (env *Env) CreateProductHandler(w http.ResponseWriter, r *http.Request) *mo
 	logger.Log.Debug("CreateProductHandler")
 
 	var (
-		p   models.Product
-		err error
+		p    models.Product
+		err  error
+		aerr *models.AppError
 	)
 
 	if err = json.NewDecoder(r.Body).Decode(&p); err != nil {
@@ -1332,10 +1529,26 @@ func (env *Env) CreateProductHandler(w http.ResponseWriter, r *http.Request) *mo
 
 	p.PersonID = c.PersonID
 
+	if p.ProductTenant, aerr = env.cardTenant(c.PersonID, p.ProductTenant); aerr != nil {
+		return aerr
+	}
+
 	logger.Log.WithFields(logrus.Fields{"p": fmt.Sprintf("%+v", p)}).Debug("CreateProductHandler")
 
 	sanitizeProduct(&p)
 
+	if aerr = checkProductTransport(&p); aerr != nil {
+		return aerr
+	}
+
+	if aerr = checkProductRegulation(&p); aerr != nil {
+		return aerr
+	}
+
+	if aerr = env.checkProductStructure(&p); aerr != nil {
+		return aerr
+	}
+
 	var pid int64
 
 	if pid, err = env.DB.CreateUpdateProduct(p, false); err != nil {
@@ -1430,10 +1643,34 @@ func (env *Env) UpdateProductHandler(w http.ResponseWriter, r *http.Request) *mo
 	updatedp.ProductSheet = p.ProductSheet
 	updatedp.ProductTemperature = p.ProductTemperature
 	updatedp.UnitTemperature = p.UnitTemperature
+	updatedp.AdrClass = p.AdrClass
+	updatedp.ProductUNNumber = p.ProductUNNumber
+	updatedp.ProductPackingGroup = p.ProductPackingGroup
+	updatedp.ProductHazardLabels = p.ProductHazardLabels
+	updatedp.ProductTransportCategory = p.ProductTransportCategory
+	updatedp.ProductDensity = p.ProductDensity
+	updatedp.ProductMolarMass = p.ProductMolarMass
+	updatedp.ProductSMILES = p.ProductSMILES
+	updatedp.ProductInChI = p.ProductInChI
+	updatedp.ProductInChIKey = p.ProductInChIKey
+	updatedp.ProductRegulation = p.ProductRegulation
 
 	logger.Log.WithFields(logrus.Fields{"updatedp": fmt.Sprintf("%+v", updatedp)}).Debug("UpdateProductHandler")
 
 	sanitizeProduct(&updatedp)
+
+	if aerr := checkProductTransport(&updatedp); aerr != nil {
+		return aerr
+	}
+
+	if aerr := checkProductRegulation(&updatedp); aerr != nil {
+		return aerr
+	}
+
+	if aerr := env.checkProductStructure(&updatedp); aerr != nil {
+		return aerr
+	}
+
 	if _, err := env.DB.CreateUpdateProduct(updatedp, true); err != nil {
 		return &models.AppError{
 			OriginalError: err,
@@ -1510,9 +1747,10 @@ func (env *Env) CreateSupplierHandler(w http.ResponseWriter, r *http.Request) *m
 	logger.Log.Debug("CreateSupplierHandler")
 
 	var (
-		sup models.Supplier
-		err error
-		id  int64
+		sup  models.Supplier
+		err  error
+		aerr *models.AppError
+		id   int64
 	)
 
 	if err = json.NewDecoder(r.Body).Decode(&sup); err != nil {
@@ -1523,6 +1761,12 @@ func (env *Env) CreateSupplierHandler(w http.ResponseWriter, r *http.Request) *m
 		}
 	}
 
+	c := request.ContainerFromRequestContext(r)
+
+	if sup.SupplierTenant, aerr = env.cardTenant(c.PersonID, sup.SupplierTenant); aerr != nil {
+		return aerr
+	}
+
 	if id, err = env.DB.CreateSupplier(sup); err != nil {
 		return &models.AppError{
 			OriginalError: err,
@@ -1548,9 +1792,10 @@ func (env *Env) CreateProducerHandler(w http.ResponseWriter, r *http.Request) *m
 	logger.Log.Debug("CreateProducerHandler")
 
 	var (
-		pr  models.Producer
-		err error
-		id  int64
+		pr   models.Producer
+		err  error
+		aerr *models.AppError
+		id   int64
 	)
 
 	if err = json.NewDecoder(r.Body).Decode(&pr); err != nil {
@@ -1561,6 +1806,12 @@ func (env *Env) CreateProducerHandler(w http.ResponseWriter, r *http.Request) *m
 		}
 	}
 
+	c := request.ContainerFromRequestContext(r)
+
+	if pr.ProducerTenant, aerr = env.cardTenant(c.PersonID, pr.ProducerTenant); aerr != nil {
+		return aerr
+	}
+
 	if id, err = env.DB.CreateProducer(pr); err != nil {
 		return &models.AppError{
 			OriginalError: err,
@@ -0,0 +1,50 @@
+package handlers
+
+import (
+	"database/sql"
+	"net/http"
+	"testing"
+
+	"github.com/tbellembois/gochimitheque/models"
+)
+
+func TestProductTransport(t *testing.T) {
+	tests := []struct {
+		un          string
+		packing     string
+		wantUN      sql.NullString
+		wantPacking sql.NullString
+		wantCode    int
+	}{
+		{"1090", "ii", sql.NullString{String: "1090", Valid: true}, sql.NullString{String: "II", Valid: true}, 0},
+		{"UN 1090", " III ", sql.NullString{String: "1090", Valid: true}, sql.NullString{String: "III", Valid: true}, 0},
+		{" un1090 ", "I", sql.NullString{String: "1090", Valid: true}, sql.NullString{String: "I", Valid: true}, 0},
+		{" ", " ", sql.NullString{}, sql.NullString{}, 0},
+		{"1090", "IV", sql.NullString{String: "1090", Valid: true}, sql.NullString{String: "IV", Valid: true}, http.StatusBadRequest},
+		{"1090", "2", sql.NullString{String: "1090", Valid: true}, sql.NullString{String: "2", Valid: true}, http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.un+"/"+tt.packing, func(t *testing.T) {
+			p := models.Product{
+				ProductUNNumber:     sql.NullString{String: tt.un, Valid: true},
+				ProductPackingGroup: sql.NullString{String: tt.packing, Valid: true},
+			}
+
+			sanitizeProduct(&p)
+
+			if p.ProductUNNumber != tt.wantUN || p.ProductPackingGroup != tt.wantPacking {
+				t.Errorf("sanitizeProduct() = %+v, %+v, want %+v, %+v", p.ProductUNNumber, p.ProductPackingGroup, tt.wantUN, tt.wantPacking)
+			}
+
+			code := 0
+			if aerr := checkProductTransport(&p); aerr != nil {
+				code = aerr.Code
+			}
+
+			if code != tt.wantCode {
+				t.Errorf("checkProductTransport() code = %d, want %d", code, tt.wantCode)
+			}
+		})
+	}
+}
@@ -0,0 +1,216 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+	"github.com/sirupsen/logrus"
+	"github.com/tbellembois/gochimitheque/logger"
+	"github.com/tbellembois/gochimitheque/models"
+	"github.com/tbellembois/gochimitheque/request"
+)
+
+// productMerge is the body of the products merge request.
+type productMerge struct {
+	ProductIDs []int `json:"product_ids"` // the products merged into the requested one
+}
+
+// GetProductDuplicatesHandler returns a json list of the pairs of products that may be duplicates,
+// of the "product" parameter product if set, only for admins.
+func (env *Env) GetProductDuplicatesHandler(w http.ResponseWriter, r *http.Request) *models.AppError {
+	var (
+		productID  int
+		duplicates []models.ProductDuplicate
+		err        error
+	)
+
+	c := request.ContainerFromRequestContext(r)
+
+	if aerr := env.checkAdmin(c.PersonID, "only admins can look for duplicate products"); aerr != nil {
+		return aerr
+	}
+
+	if p := r.URL.Query().Get("product"); p != "" {
+		if productID, err = strconv.Atoi(p); err != nil {
+			return &models.AppError{
+				OriginalError: err,
+				Message:       "product atoi conversion",
+				Code:          http.StatusBadRequest,
+			}
+		}
+	}
+
+	logger.Log.WithFields(logrus.Fields{"productID": productID}).Debug("GetProductDuplicatesHandler")
+
+	if duplicates, err = env.DB.GetProductDuplicates(productID); err != nil {
+		return &models.AppError{
+			OriginalError: err,
+			Code:          http.StatusInternalServerError,
+			Message:       "error getting the duplicate products",
+		}
+	}
+
+	type resp struct {
+		Rows  []models.ProductDuplicate `json:"rows"`
+		Total int                       `json:"total"`
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+
+	if err = json.NewEncoder(w).Encode(resp{Rows: duplicates, Total: len(duplicates)}); err != nil {
+		return &models.AppError{
+			Code:    http.StatusInternalServerError,
+			Message: err.Error(),
+		}
+	}
+
+	return nil
+}
+
+// GetProductMergesHandler returns a json list of the products merges, only for admins.
+func (env *Env) GetProductMergesHandler(w http.ResponseWriter, r *http.Request) *models.AppError {
+	logger.Log.Debug("GetProductMergesHandler")
+
+	c := request.ContainerFromRequestContext(r)
+
+	if aerr := env.checkAdmin(c.PersonID, "only admins can read the products merges"); aerr != nil {
+		return aerr
+	}
+
+	merges, err := env.DB.GetProductMerges()
+	if err != nil {
+		return &models.AppError{
+			OriginalError: err,
+			Code:          http.StatusInternalServerError,
+			Message:       "error getting the products merges",
+		}
+	}
+
+	type resp struct {
+		Rows  []models.ProductMerge `json:"rows"`
+		Total int                   `json:"total"`
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+
+	if err = json.NewEncoder(w).Encode(resp{Rows: merges, Total: len(merges)}); err != nil {
+		return &models.AppError{
+			Code:    http.StatusInternalServerError,
+			Message: err.Error(),
+		}
+	}
+
+	return nil
+}
+
+// MergeProductsHandler merges the requested products into the product with the requested id,
+// only for admins.
+func (env *Env) MergeProductsHandler(w http.ResponseWriter, r *http.Request) *models.AppError {
+	vars := mux.Vars(r)
+
+	var (
+		id     int
+		pm     productMerge
+		p      models.Product
+		tenant sql.NullInt64
+		err    error
+	)
+
+	if id, err = strconv.Atoi(vars["id"]); err != nil {
+		return &models.AppError{
+			OriginalError: err,
+			Message:       "id atoi conversion",
+			Code:          http.StatusInternalServerError,
+		}
+	}
+
+	if err = json.NewDecoder(r.Body).Decode(&pm); err != nil {
+		return &models.AppError{
+			OriginalError: err,
+			Message:       "JSON decoding error",
+			Code:          http.StatusBadRequest,
+		}
+	}
+
+	logger.Log.WithFields(logrus.Fields{"id": id, "pm": pm}).Debug("MergeProductsHandler")
+
+	c := request.ContainerFromRequestContext(r)
+
+	if aerr := env.checkAdmin(c.PersonID, "only admins can merge products"); aerr != nil {
+		return aerr
+	}
+
+	if len(pm.ProductIDs) == 0 {
+		return &models.AppError{
+			Message: "no product to merge",
+			Code:    http.StatusBadRequest,
+		}
+	}
+
+	if p, err = env.DB.GetProduct(id); err != nil {
+		return &models.AppError{
+			OriginalError: err,
+			Message:       "product not found",
+			Code:          http.StatusNotFound,
+		}
+	}
+
+	if tenant, err = env.DB.GetProductTenant(id); err != nil {
+		return &models.AppError{
+			OriginalError: err,
+			Message:       "error getting the product tenant",
+			Code:          http.StatusInternalServerError,
+		}
+	}
+
+	for _, m := range pm.ProductIDs {
+		var mtenant sql.NullInt64
+
+		if m == id {
+			return &models.AppError{
+				Message: "a product can not be merged into itself",
+				Code:    http.StatusBadRequest,
+			}
+		}
+
+		if mtenant, err = env.DB.GetProductTenant(m); err != nil {
+			if err == sql.ErrNoRows {
+				return &models.AppError{
+					OriginalError: err,
+					Message:       fmt.Sprintf("product %d not found", m),
+					Code:          http.StatusNotFound,
+				}
+			}
+
+			return &models.AppError{
+				OriginalError: err,
+				Message:       "error getting the product tenant",
+				Code:          http.StatusInternalServerError,
+			}
+		}
+
+		// the products of an entity catalog can not be merged into another catalog
+		if mtenant != tenant {
+			return &models.AppError{
+				Message: "the merged products must belong to the same catalog",
+				Code:    http.StatusBadRequest,
+			}
+		}
+	}
+
+	if err = env.DB.MergeProducts(id, pm.ProductIDs, c.PersonID); err != nil {
+		return &models.AppError{
+			OriginalError: err,
+			Message:       "merge products error",
+			Code:          http.StatusInternalServerError,
+		}
+	}
+
+	env.audit(r, "product_merged", "", fmt.Sprintf("%v into %d %s", pm.ProductIDs, id, p.NameLabel))
+
+	return nil
+}
@@ -0,0 +1,367 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/nicksnyder/go-i18n/v2/i18n"
+	"github.com/sirupsen/logrus"
+	"github.com/tbellembois/gochimitheque/locales"
+	"github.com/tbellembois/gochimitheque/logger"
+	"github.com/tbellembois/gochimitheque/mailer"
+	"github.com/tbellembois/gochimitheque/models"
+	"github.com/tbellembois/gochimitheque/request"
+)
+
+// recallID returns the recall id of the request vars.
+func recallID(r *http.Request) (int, *models.AppError) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		return 0, &models.AppError{
+			OriginalError: err,
+			Message:       "id atoi conversion",
+			Code:          http.StatusInternalServerError,
+		}
+	}
+
+	return id, nil
+}
+
+// getRecall returns the recall with the given id.
+func (env *Env) getRecall(id int) (models.Recall, *models.AppError) {
+	rc, err := env.DB.GetRecall(id)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return models.Recall{}, &models.AppError{
+				OriginalError: err,
+				Message:       "recall not found",
+				Code:          http.StatusNotFound,
+			}
+		}
+
+		return models.Recall{}, &models.AppError{
+			OriginalError: err,
+			Message:       "error getting the recall",
+			Code:          http.StatusInternalServerError,
+		}
+	}
+
+	return rc, nil
+}
+
+// sendRecallMails notifies the managers of the entities of the recalled storages,
+// each one with the storages of its entities. Errors are only logged.
+func (env *Env) sendRecallMails(rc models.Recall) {
+	supplier := rc.SupplierLabel.String
+	if supplier == "" {
+		supplier = "-"
+	}
+
+	for _, ack := range rc.Acknowledgements {
+		if ack.RecallAcknowledgementDate.Valid {
+			continue
+		}
+
+		var lines []string
+
+		for _, a := range rc.Acknowledgements {
+			if a.PersonID != ack.PersonID {
+				continue
+			}
+
+			for _, s := range rc.Storages {
+				if s.EntityID == a.EntityID {
+					lines = append(lines, strings.TrimSpace(fmt.Sprintf("- %s %s %s %v %s", s.EntityName, s.StoreLocationFullPath, s.StorageBarecode.String, s.StorageQuantity.Float64, s.UnitLabel.String)))
+				}
+			}
+		}
+
+		msgbody := fmt.Sprintf(locales.Localizer.MustLocalize(&i18n.LocalizeConfig{MessageID: "recall_mailbody", PluralCount: 1}),
+			rc.RecallBatchNumber,
+			rc.ProductName.String,
+			supplier,
+			rc.RecallComment.String,
+			strings.Join(lines, "\n\t"),
+			env.AppFullURL)
+		msgsubject := fmt.Sprintf(locales.Localizer.MustLocalize(&i18n.LocalizeConfig{MessageID: "recall_mailsubject", PluralCount: 1}), rc.ProductName.String, rc.RecallBatchNumber)
+
+		if err := mailer.SendMail(ack.PersonEmail, msgsubject, msgbody); err != nil {
+			logger.Log.Errorf("send recall mail to %s: %s", ack.PersonEmail, err)
+		}
+	}
+}
+
+/*
+	REST handlers
+*/
+
+// GetRecallsHandler returns a json list of the recalls for the admins,
+// or of the recalls to be acknowledged by the logged manager.
+func (env *Env) GetRecallsHandler(w http.ResponseWriter, r *http.Request) *models.AppError {
+	logger.Log.Debug("GetRecallsHandler")
+
+	var (
+		err     error
+		isadmin bool
+		recalls []models.Recall
+	)
+
+	c := request.ContainerFromRequestContext(r)
+
+	if isadmin, err = env.DB.IsPersonAdmin(c.PersonID); err != nil {
+		return &models.AppError{
+			OriginalError: err,
+			Message:       "error getting the person admin status",
+			Code:          http.StatusInternalServerError,
+		}
+	}
+
+	if isadmin {
+		recalls, err = env.DB.GetRecalls()
+	} else {
+		recalls, err = env.DB.GetManagerRecalls(c.PersonID)
+	}
+
+	if err != nil {
+		return &models.AppError{
+			OriginalError: err,
+			Code:          http.StatusInternalServerError,
+			Message:       "error getting the recalls",
+		}
+	}
+
+	type resp struct {
+		Rows  []models.Recall `json:"rows"`
+		Total int             `json:"total"`
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+
+	if err = json.NewEncoder(w).Encode(resp{Rows: recalls, Total: len(recalls)}); err != nil {
+		return &models.AppError{
+			Code:    http.StatusInternalServerError,
+			Message: err.Error(),
+		}
+	}
+
+	return nil
+}
+
+// GetRecallHandler returns a json of the recall with the requested id,
+// its storages and acknowledgements, for the admins and the managers concerned.
+func (env *Env) GetRecallHandler(w http.ResponseWriter, r *http.Request) *models.AppError {
+	var (
+		id      int
+		rc      models.Recall
+		isadmin bool
+		aerr    *models.AppError
+		err     error
+	)
+
+	if id, aerr = recallID(r); aerr != nil {
+		return aerr
+	}
+
+	logger.Log.WithFields(logrus.Fields{"id": id}).Debug("GetRecallHandler")
+
+	c := request.ContainerFromRequestContext(r)
+
+	if rc, aerr = env.getRecall(id); aerr != nil {
+		return aerr
+	}
+
+	if isadmin, err = env.DB.IsPersonAdmin(c.PersonID); err != nil {
+		return &models.AppError{
+			OriginalError: err,
+			Message:       "error getting the person admin status",
+			Code:          http.StatusInternalServerError,
+		}
+	}
+
+	concerned := isadmin
+	for _, a := range rc.Acknowledgements {
+		if a.PersonID == c.PersonID {
+			concerned = true
+		}
+	}
+
+	if !concerned {
+		return &models.AppError{
+			Message: "only admins and the managers concerned can read a recall",
+			Code:    http.StatusForbidden,
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+
+	if err = json.NewEncoder(w).Encode(rc); err != nil {
+		return &models.AppError{
+			Code:    http.StatusInternalServerError,
+			Message: err.Error(),
+		}
+	}
+
+	return nil
+}
+
+// CreateRecallHandler creates a batch recall flagging the matching active storages of all the entities
+// and notifies their managers, only for admins.
+func (env *Env) CreateRecallHandler(w http.ResponseWriter, r *http.Request) *models.AppError {
+	var (
+		rc   models.Recall
+		id   int64
+		aerr *models.AppError
+		err  error
+	)
+
+	if err = json.NewDecoder(r.Body).Decode(&rc); err != nil {
+		return &models.AppError{
+			OriginalError: err,
+			Message:       "JSON decoding error",
+			Code:          http.StatusBadRequest,
+		}
+	}
+
+	logger.Log.WithFields(logrus.Fields{"rc": rc}).Debug("CreateRecallHandler")
+
+	c := request.ContainerFromRequestContext(r)
+
+	if aerr = env.checkAdmin(c.PersonID, "only admins can recall a batch"); aerr != nil {
+		return aerr
+	}
+
+	if rc.RecallBatchNumber = strings.TrimSpace(rc.RecallBatchNumber); rc.RecallBatchNumber == "" {
+		return &models.AppError{
+			Message: "missing batch number",
+			Code:    http.StatusBadRequest,
+		}
+	}
+
+	if !rc.ProductID.Valid {
+		return &models.AppError{
+			Message: "missing product",
+			Code:    http.StatusBadRequest,
+		}
+	}
+
+	if _, err = env.DB.GetProduct(int(rc.ProductID.Int64)); err != nil {
+		return &models.AppError{
+			OriginalError: err,
+			Message:       "error retrieving the recall product",
+			Code:          http.StatusBadRequest,
+		}
+	}
+
+	rc.RecallDate = time.Now()
+	rc.PersonID = c.PersonID
+
+	if id, err = env.DB.CreateRecall(rc); err != nil {
+		return &models.AppError{
+			OriginalError: err,
+			Message:       "create recall error",
+			Code:          http.StatusInternalServerError,
+		}
+	}
+
+	if rc, aerr = env.getRecall(int(id)); aerr != nil {
+		return aerr
+	}
+
+	env.audit(r, "recall_created", "", fmt.Sprintf("%s %s: %d storages", rc.ProductName.String, rc.RecallBatchNumber, len(rc.Storages)))
+
+	env.sendRecallMails(rc)
+
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+
+	if err = json.NewEncoder(w).Encode(rc); err != nil {
+		return &models.AppError{
+			Code:    http.StatusInternalServerError,
+			Message: err.Error(),
+		}
+	}
+
+	return nil
+}
+
+// AcknowledgeRecallHandler records the acknowledgement of the recall with the requested id
+// by the logged manager.
+func (env *Env) AcknowledgeRecallHandler(w http.ResponseWriter, r *http.Request) *models.AppError {
+	var (
+		id   int
+		aerr *models.AppError
+		err  error
+	)
+
+	if id, aerr = recallID(r); aerr != nil {
+		return aerr
+	}
+
+	logger.Log.WithFields(logrus.Fields{"id": id}).Debug("AcknowledgeRecallHandler")
+
+	c := request.ContainerFromRequestContext(r)
+
+	if err = env.DB.AcknowledgeRecall(id, c.PersonID, time.Now()); err != nil {
+		if err == sql.ErrNoRows {
+			return &models.AppError{
+				OriginalError: err,
+				Message:       "no recall to acknowledge",
+				Code:          http.StatusNotFound,
+			}
+		}
+
+		return &models.AppError{
+			OriginalError: err,
+			Message:       "acknowledge recall error",
+			Code:          http.StatusInternalServerError,
+		}
+	}
+
+	env.audit(r, "recall_acknowledged", c.PersonEmail, strconv.Itoa(id))
+
+	return nil
+}
+
+// DeleteRecallHandler deletes the recall with the requested id,
+// removing the recall flag of its storages, only for admins.
+func (env *Env) DeleteRecallHandler(w http.ResponseWriter, r *http.Request) *models.AppError {
+	var (
+		id   int
+		rc   models.Recall
+		aerr *models.AppError
+		err  error
+	)
+
+	if id, aerr = recallID(r); aerr != nil {
+		return aerr
+	}
+
+	logger.Log.WithFields(logrus.Fields{"id": id}).Debug("DeleteRecallHandler")
+
+	c := request.ContainerFromRequestContext(r)
+
+	if aerr = env.checkAdmin(c.PersonID, "only admins can delete a recall"); aerr != nil {
+		return aerr
+	}
+
+	if rc, aerr = env.getRecall(id); aerr != nil {
+		return aerr
+	}
+
+	if err = env.DB.DeleteRecall(id); err != nil {
+		return &models.AppError{
+			OriginalError: err,
+			Message:       "delete recall error",
+			Code:          http.StatusInternalServerError,
+		}
+	}
+
+	env.audit(r, "recall_deleted", "", fmt.Sprintf("%s %s", rc.ProductName.String, rc.RecallBatchNumber))
+
+	return nil
+}
@@ -0,0 +1,308 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/mux"
+	"github.com/sirupsen/logrus"
+	"github.com/tbellembois/gochimitheque/logger"
+	"github.com/tbellembois/gochimitheque/models"
+)
+
+// checkRole returns an error if the role r has no name
+// or a permission not allowed in a role.
+func checkRole(r models.Role) *models.AppError {
+	if strings.TrimSpace(r.RoleName) == "" {
+		return &models.AppError{
+			Message: "empty role name",
+			Code:    http.StatusBadRequest,
+		}
+	}
+
+	for _, rp := range r.RolePermissions {
+		if !rp.IsValid() {
+			return &models.AppError{
+				OriginalError: errors.New("invalid role permission " + rp.RolePermissionPermName + " " + rp.RolePermissionItemName),
+				Message:       "invalid role permission",
+				Code:          http.StatusBadRequest,
+			}
+		}
+	}
+
+	return nil
+}
+
+// checkPersonRoles returns an error if a role of the person p
+// is assigned for an entity p does not belong to.
+func checkPersonRoles(p models.Person) *models.AppError {
+	for _, pr := range p.Roles {
+		// the members of all the entities can have roles for all the entities
+		found := p.PersonAllEntities && pr.PersonRoleEntityID == -1
+
+		for _, e := range p.Entities {
+			if e.EntityID == pr.PersonRoleEntityID {
+				found = true
+				break
+			}
+		}
+
+		if !found {
+			return &models.AppError{
+				OriginalError: errors.New("role for entity " + strconv.Itoa(pr.PersonRoleEntityID)),
+				Message:       "roles can only be assigned for the person entities",
+				Code:          http.StatusBadRequest,
+			}
+		}
+	}
+
+	return nil
+}
+
+/*
+	REST handlers
+*/
+
+// GetRolesHandler returns a json list of the roles.
+func (env *Env) GetRolesHandler(w http.ResponseWriter, r *http.Request) *models.AppError {
+	logger.Log.Debug("GetRolesHandler")
+
+	roles, err := env.DB.GetRoles()
+	if err != nil {
+		return &models.AppError{
+			OriginalError: err,
+			Code:          http.StatusInternalServerError,
+			Message:       "error getting the roles",
+		}
+	}
+
+	type resp struct {
+		Rows  []models.Role `json:"rows"`
+		Total int           `json:"total"`
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+
+	if err = json.NewEncoder(w).Encode(resp{Rows: roles, Total: len(roles)}); err != nil {
+		return &models.AppError{
+			Code:    http.StatusInternalServerError,
+			Message: err.Error(),
+		}
+	}
+
+	return nil
+}
+
+// GetRoleHandler returns a json of the role with the requested id.
+func (env *Env) GetRoleHandler(w http.ResponseWriter, r *http.Request) *models.AppError {
+	vars := mux.Vars(r)
+
+	var (
+		id   int
+		err  error
+		role models.Role
+	)
+
+	if id, err = strconv.Atoi(vars["id"]); err != nil {
+		return &models.AppError{
+			OriginalError: err,
+			Message:       "id atoi conversion",
+			Code:          http.StatusInternalServerError,
+		}
+	}
+
+	if role, err = env.DB.GetRole(id); err != nil {
+		if err == sql.ErrNoRows {
+			return &models.AppError{
+				OriginalError: err,
+				Message:       "role not found",
+				Code:          http.StatusNotFound,
+			}
+		}
+
+		return &models.AppError{
+			OriginalError: err,
+			Message:       "get role error",
+			Code:          http.StatusInternalServerError,
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+
+	if err = json.NewEncoder(w).Encode(role); err != nil {
+		return &models.AppError{
+			Code:    http.StatusInternalServerError,
+			Message: err.Error(),
+		}
+	}
+
+	return nil
+}
+
+// CreateRoleHandler creates the role from the request form.
+func (env *Env) CreateRoleHandler(w http.ResponseWriter, r *http.Request) *models.AppError {
+	var (
+		role models.Role
+		id   int64
+		err  error
+		aerr *models.AppError
+	)
+
+	if err = json.NewDecoder(r.Body).Decode(&role); err != nil {
+		return &models.AppError{
+			OriginalError: err,
+			Message:       "JSON decoding error",
+			Code:          http.StatusInternalServerError,
+		}
+	}
+
+	logger.Log.WithFields(logrus.Fields{"role": role}).Debug("CreateRoleHandler")
+
+	role.RoleName = strings.TrimSpace(role.RoleName)
+
+	if aerr = checkRole(role); aerr != nil {
+		return aerr
+	}
+
+	if id, err = env.DB.CreateRole(role); err != nil {
+		return &models.AppError{
+			OriginalError: err,
+			Message:       "create role error",
+			Code:          http.StatusInternalServerError,
+		}
+	}
+
+	role.RoleID = int(id)
+
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+
+	if err = json.NewEncoder(w).Encode(role); err != nil {
+		return &models.AppError{
+			Code:    http.StatusInternalServerError,
+			Message: err.Error(),
+		}
+	}
+
+	return nil
+}
+
+// UpdateRoleHandler updates the role from the request form
+// and the permissions of the people it is assigned to.
+func (env *Env) UpdateRoleHandler(w http.ResponseWriter, r *http.Request) *models.AppError {
+	vars := mux.Vars(r)
+
+	var (
+		id        int
+		err       error
+		aerr      *models.AppError
+		role, upd models.Role
+		people    []int
+	)
+
+	if err = json.NewDecoder(r.Body).Decode(&role); err != nil {
+		return &models.AppError{
+			OriginalError: err,
+			Message:       "JSON decoding error",
+			Code:          http.StatusInternalServerError,
+		}
+	}
+
+	logger.Log.WithFields(logrus.Fields{"role": role}).Debug("UpdateRoleHandler")
+
+	if id, err = strconv.Atoi(vars["id"]); err != nil {
+		return &models.AppError{
+			OriginalError: err,
+			Message:       "id atoi conversion",
+			Code:          http.StatusInternalServerError,
+		}
+	}
+
+	if upd, err = env.DB.GetRole(id); err != nil {
+		return &models.AppError{
+			OriginalError: err,
+			Message:       "get role error",
+			Code:          http.StatusInternalServerError,
+		}
+	}
+
+	upd.RoleName = strings.TrimSpace(role.RoleName)
+	upd.RoleRequireTOTP = role.RoleRequireTOTP
+	upd.RolePermissions = role.RolePermissions
+
+	if aerr = checkRole(upd); aerr != nil {
+		return aerr
+	}
+
+	if err = env.DB.UpdateRole(upd); err != nil {
+		return &models.AppError{
+			OriginalError: err,
+			Message:       "update role error",
+			Code:          http.StatusInternalServerError,
+		}
+	}
+
+	if people, err = env.DB.GetRolePeople(id); err != nil {
+		return &models.AppError{
+			OriginalError: err,
+			Message:       "get role people error",
+			Code:          http.StatusInternalServerError,
+		}
+	}
+
+	if aerr = env.reloadPolicies(people...); aerr != nil {
+		return aerr
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+
+	if err = json.NewEncoder(w).Encode(upd); err != nil {
+		return &models.AppError{
+			Code:    http.StatusInternalServerError,
+			Message: err.Error(),
+		}
+	}
+
+	return nil
+}
+
+// DeleteRoleHandler deletes the role with the requested id.
+func (env *Env) DeleteRoleHandler(w http.ResponseWriter, r *http.Request) *models.AppError {
+	vars := mux.Vars(r)
+
+	var (
+		id     int
+		err    error
+		people []int
+	)
+
+	if id, err = strconv.Atoi(vars["id"]); err != nil {
+		return &models.AppError{
+			OriginalError: err,
+			Message:       "id atoi conversion",
+			Code:          http.StatusInternalServerError,
+		}
+	}
+
+	// fetching the assignees before the role is unassigned
+	if people, err = env.DB.GetRolePeople(id); err != nil {
+		return &models.AppError{
+			OriginalError: err,
+			Message:       "get role people error",
+			Code:          http.StatusInternalServerError,
+		}
+	}
+
+	if err = env.DB.DeleteRole(id); err != nil {
+		return &models.AppError{
+			OriginalError: err,
+			Message:       "delete role error",
+			Code:          http.StatusInternalServerError,
+		}
+	}
+
+	return env.reloadPolicies(people...)
+}
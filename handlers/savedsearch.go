@@ -0,0 +1,384 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/nicksnyder/go-i18n/v2/i18n"
+	"github.com/sirupsen/logrus"
+	"github.com/tbellembois/gochimitheque/locales"
+	"github.com/tbellembois/gochimitheque/logger"
+	"github.com/tbellembois/gochimitheque/mailer"
+	"github.com/tbellembois/gochimitheque/models"
+	"github.com/tbellembois/gochimitheque/request"
+)
+
+// savedSearchNotifyLimit is the maximum number of new products and storages
+// listed in a subscription mail.
+const savedSearchNotifyLimit = 50
+
+// savedSearchFilter returns the request.Filter of the saved search s
+// as if it was requested by its owner.
+func savedSearchFilter(s models.SavedSearch) (*request.Filter, *models.AppError) {
+	r, err := http.NewRequest(http.MethodGet, "/?"+s.SavedSearchQuery, nil)
+	if err != nil {
+		return nil, &models.AppError{
+			OriginalError: err,
+			Code:          http.StatusBadRequest,
+			Message:       "invalid saved search query",
+		}
+	}
+
+	ctx := context.WithValue(r.Context(), request.ChimithequeContextKey("container"), request.Container{PersonID: s.PersonID})
+
+	return request.NewFilter(r.WithContext(ctx), nil)
+}
+
+// getOwnedSavedSearch returns the saved search with the request id
+// if it belongs to the logged person.
+func (env *Env) getOwnedSavedSearch(r *http.Request) (models.SavedSearch, *models.AppError) {
+	var (
+		id  int
+		err error
+		s   models.SavedSearch
+	)
+
+	vars := mux.Vars(r)
+
+	if id, err = strconv.Atoi(vars["id"]); err != nil {
+		return s, &models.AppError{
+			OriginalError: err,
+			Message:       "id atoi conversion",
+			Code:          http.StatusInternalServerError,
+		}
+	}
+
+	if s, err = env.DB.GetSavedSearch(id); err != nil {
+		if err == sql.ErrNoRows {
+			return s, &models.AppError{
+				OriginalError: err,
+				Message:       "saved search not found",
+				Code:          http.StatusNotFound,
+			}
+		}
+
+		return s, &models.AppError{
+			OriginalError: err,
+			Message:       "get saved search",
+			Code:          http.StatusInternalServerError,
+		}
+	}
+
+	c := request.ContainerFromRequestContext(r)
+
+	if s.PersonID != c.PersonID {
+		return s, &models.AppError{
+			Message: "saved search of another person",
+			Code:    http.StatusForbidden,
+		}
+	}
+
+	return s, nil
+}
+
+/*
+	REST handlers
+*/
+
+// GetSavedSearchesHandler returns a json list of the logged person saved searches.
+func (env *Env) GetSavedSearchesHandler(w http.ResponseWriter, r *http.Request) *models.AppError {
+	logger.Log.Debug("GetSavedSearchesHandler")
+
+	c := request.ContainerFromRequestContext(r)
+
+	savedsearches, err := env.DB.GetSavedSearches(c.PersonID)
+	if err != nil {
+		return &models.AppError{
+			OriginalError: err,
+			Code:          http.StatusInternalServerError,
+			Message:       "error getting the saved searches",
+		}
+	}
+
+	type resp struct {
+		Rows  []models.SavedSearch `json:"rows"`
+		Total int                  `json:"total"`
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+
+	if err = json.NewEncoder(w).Encode(resp{Rows: savedsearches, Total: len(savedsearches)}); err != nil {
+		return &models.AppError{
+			Code:    http.StatusInternalServerError,
+			Message: err.Error(),
+		}
+	}
+
+	return nil
+}
+
+// CreateSavedSearchHandler saves a search for the logged person.
+func (env *Env) CreateSavedSearchHandler(w http.ResponseWriter, r *http.Request) *models.AppError {
+	logger.Log.Debug("CreateSavedSearchHandler")
+
+	var (
+		s    models.SavedSearch
+		id   int64
+		err  error
+		aerr *models.AppError
+	)
+
+	if err = json.NewDecoder(r.Body).Decode(&s); err != nil {
+		return &models.AppError{
+			OriginalError: err,
+			Message:       "JSON decoding error",
+			Code:          http.StatusInternalServerError,
+		}
+	}
+
+	c := request.ContainerFromRequestContext(r)
+
+	s.PersonID = c.PersonID
+	s.SavedSearchName = strings.TrimSpace(s.SavedSearchName)
+	s.SavedSearchQuery = strings.TrimPrefix(s.SavedSearchQuery, "?")
+
+	if s.SavedSearchName == "" {
+		return &models.AppError{
+			Message: "empty saved search name",
+			Code:    http.StatusBadRequest,
+		}
+	}
+
+	if _, aerr = savedSearchFilter(s); aerr != nil {
+		return aerr
+	}
+
+	if id, err = env.DB.CreateSavedSearch(s); err != nil {
+		return &models.AppError{
+			OriginalError: err,
+			Message:       "create saved search error",
+			Code:          http.StatusInternalServerError,
+		}
+	}
+
+	s.SavedSearchID = sql.NullInt64{Valid: true, Int64: id}
+
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+
+	if err = json.NewEncoder(w).Encode(s); err != nil {
+		return &models.AppError{
+			Code:    http.StatusInternalServerError,
+			Message: err.Error(),
+		}
+	}
+
+	return nil
+}
+
+// UpdateSavedSearchHandler renames, changes the query or the subscription
+// of a logged person saved search.
+func (env *Env) UpdateSavedSearchHandler(w http.ResponseWriter, r *http.Request) *models.AppError {
+	logger.Log.Debug("UpdateSavedSearchHandler")
+
+	var (
+		s, updateds models.SavedSearch
+		err         error
+		aerr        *models.AppError
+	)
+
+	if updateds, aerr = env.getOwnedSavedSearch(r); aerr != nil {
+		return aerr
+	}
+
+	if err = json.NewDecoder(r.Body).Decode(&s); err != nil {
+		return &models.AppError{
+			OriginalError: err,
+			Message:       "JSON decoding error",
+			Code:          http.StatusInternalServerError,
+		}
+	}
+
+	updateds.SavedSearchName = strings.TrimSpace(s.SavedSearchName)
+	updateds.SavedSearchQuery = strings.TrimPrefix(s.SavedSearchQuery, "?")
+	updateds.SavedSearchSubscribed = s.SavedSearchSubscribed
+
+	if updateds.SavedSearchName == "" {
+		return &models.AppError{
+			Message: "empty saved search name",
+			Code:    http.StatusBadRequest,
+		}
+	}
+
+	if _, aerr = savedSearchFilter(updateds); aerr != nil {
+		return aerr
+	}
+
+	if err = env.DB.UpdateSavedSearch(updateds); err != nil {
+		return &models.AppError{
+			OriginalError: err,
+			Message:       "update saved search error",
+			Code:          http.StatusInternalServerError,
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+
+	if err = json.NewEncoder(w).Encode(updateds); err != nil {
+		return &models.AppError{
+			Code:    http.StatusInternalServerError,
+			Message: err.Error(),
+		}
+	}
+
+	return nil
+}
+
+// DeleteSavedSearchHandler deletes a logged person saved search.
+func (env *Env) DeleteSavedSearchHandler(w http.ResponseWriter, r *http.Request) *models.AppError {
+	logger.Log.Debug("DeleteSavedSearchHandler")
+
+	var (
+		s    models.SavedSearch
+		err  error
+		aerr *models.AppError
+	)
+
+	if s, aerr = env.getOwnedSavedSearch(r); aerr != nil {
+		return aerr
+	}
+
+	if err = env.DB.DeleteSavedSearch(int(s.SavedSearchID.Int64)); err != nil {
+		return &models.AppError{
+			OriginalError: err,
+			Message:       "delete saved search error",
+			Code:          http.StatusInternalServerError,
+		}
+	}
+
+	return nil
+}
+
+/*
+	subscriptions
+*/
+
+// NotifySavedSearches mails the subscribers of the saved searches
+// matching new products or storages since the last notification.
+func (env *Env) NotifySavedSearches() {
+	var (
+		err                          error
+		savedsearches                []models.SavedSearch
+		lastProductID, lastStorageID int64
+	)
+
+	// fetching the last ids first so that the products and storages
+	// created while notifying are notified on the next run
+	if lastProductID, lastStorageID, err = env.DB.GetLastProductAndStorageIDs(); err != nil {
+		logger.Log.Errorf("get last product and storage ids: %s", err)
+		return
+	}
+
+	if savedsearches, err = env.DB.GetSubscribedSavedSearches(); err != nil {
+		logger.Log.Errorf("get subscribed saved searches: %s", err)
+		return
+	}
+
+	for _, s := range savedsearches {
+		if err = env.notifySavedSearch(s, lastProductID, lastStorageID); err != nil {
+			logger.Log.WithFields(logrus.Fields{"savedsearch": s.SavedSearchID.Int64}).Errorf("notify saved search: %s", err)
+			continue
+		}
+
+		if err = env.DB.UpdateSavedSearchLastIDs(int(s.SavedSearchID.Int64), lastProductID, lastStorageID); err != nil {
+			logger.Log.WithFields(logrus.Fields{"savedsearch": s.SavedSearchID.Int64}).Errorf("update saved search: %s", err)
+		}
+	}
+}
+
+// notifySavedSearch mails the subscriber of the saved search s the products and storages
+// matching the search with an id in ]s.SavedSearchLast...ID, last...ID].
+func (env *Env) notifySavedSearch(s models.SavedSearch, lastProductID, lastStorageID int64) error {
+	var (
+		err       error
+		aerr      *models.AppError
+		filter    *request.Filter
+		products  []models.Product
+		storages  []models.Storage
+		newLines  []string
+		hasMore   bool
+		msgbody   string
+		msgsubjet string
+	)
+
+	if filter, aerr = savedSearchFilter(s); aerr != nil {
+		return aerr.OriginalError
+	}
+
+	// newest first
+	filter.Order = "desc"
+	filter.Offset = 0
+	filter.Limit = savedSearchNotifyLimit
+
+	if lastProductID > s.SavedSearchLastProductID {
+		filter.OrderBy = "product_id"
+
+		if products, _, err = env.DB.GetProducts(*filter, false); err != nil {
+			return err
+		}
+
+		for _, p := range products {
+			if int64(p.ProductID) > s.SavedSearchLastProductID && int64(p.ProductID) <= lastProductID {
+				newLines = append(newLines, strings.TrimSpace(fmt.Sprintf("- %s %s %s", p.NameLabel, p.CasNumberLabel.String, p.ProductSpecificity.String)))
+			}
+		}
+
+		hasMore = len(products) == savedSearchNotifyLimit && int64(products[len(products)-1].ProductID) > s.SavedSearchLastProductID
+	}
+
+	if lastStorageID > s.SavedSearchLastStorageID {
+		filter.OrderBy = "storage_id"
+
+		if storages, _, err = env.DB.GetStorages(*filter); err != nil {
+			return err
+		}
+
+		for _, st := range storages {
+			if st.StorageID.Int64 > s.SavedSearchLastStorageID && st.StorageID.Int64 <= lastStorageID {
+				newLines = append(newLines, strings.TrimSpace(fmt.Sprintf("- %s %s %s", st.Product.NameLabel, st.StorageBarecode.String, st.StoreLocation.StoreLocationFullPath)))
+			}
+		}
+
+		hasMore = hasMore || (len(storages) == savedSearchNotifyLimit && storages[len(storages)-1].StorageID.Int64 > s.SavedSearchLastStorageID)
+	}
+
+	if len(newLines) == 0 {
+		return nil
+	}
+
+	if hasMore {
+		newLines = append(newLines, "- ...")
+	}
+
+	msgbody = fmt.Sprintf(locales.Localizer.MustLocalize(&i18n.LocalizeConfig{MessageID: "savedsearch_mailbody", PluralCount: 1}), s.SavedSearchName, strings.Join(newLines, "\n\t"), env.AppFullURL)
+	msgsubjet = fmt.Sprintf(locales.Localizer.MustLocalize(&i18n.LocalizeConfig{MessageID: "savedsearch_mailsubject", PluralCount: 1}), s.SavedSearchName)
+
+	return mailer.SendMail(s.PersonEmail, msgsubjet, msgbody)
+}
+
+// RunSavedSearchesNotifier notifies the saved searches subscribers
+// every interval.
+func (env *Env) RunSavedSearchesNotifier(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+
+	for range ticker.C {
+		logger.Log.Debug("notifying saved searches subscribers")
+		env.NotifySavedSearches()
+	}
+}
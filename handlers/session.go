@@ -0,0 +1,349 @@
+package handlers
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt"
+	"github.com/gorilla/mux"
+	"github.com/sirupsen/logrus"
+	"github.com/tbellembois/gochimitheque/logger"
+	"github.com/tbellembois/gochimitheque/models"
+	"github.com/tbellembois/gochimitheque/request"
+)
+
+// refreshTokenCookie is the name of the refresh token cookie,
+// the refresh token is "<session uid>.<secret>".
+const refreshTokenCookie = "refresh_token"
+
+var (
+	errSessionNotFound = errors.New("session not found, please log in")
+	errSessionExpired  = errors.New("session expired, please log in")
+	errInvalidRefresh  = errors.New("invalid refresh token")
+)
+
+// newSessionSecret returns a random refresh token secret.
+func newSessionSecret() (string, error) {
+	k, err := genSymmetricKey(256)
+	if err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(k), nil
+}
+
+// hashToken returns the stored hash of a secret token
+// (refresh token secret, password reset link token...).
+func hashToken(secret string) string {
+	h := sha256.Sum256([]byte(secret))
+
+	return hex.EncodeToString(h[:])
+}
+
+// signAccessToken returns a JWT access token of the session s.
+func (env *Env) signAccessToken(s models.Session) (string, error) {
+	token := jwt.New(jwt.SigningMethodHS256)
+	claims := token.Claims.(jwt.MapClaims)
+	claims["email"] = s.PersonEmail
+	claims["sid"] = s.SessionUID
+	claims["exp"] = time.Now().Add(env.AccessTokenTTL).Unix()
+
+	return token.SignedString(env.TokenSignKey)
+}
+
+// setSessionCookies sets the access token, refresh token and CSRF token cookies of the session s.
+func (env *Env) setSessionCookies(w http.ResponseWriter, s models.Session, accessToken string, refreshToken string) {
+	http.SetCookie(w, env.newCookie("token", accessToken))
+
+	c := env.newCookie(refreshTokenCookie, refreshToken)
+	c.Expires = s.SessionExpirationDate
+	c.HttpOnly = true
+	http.SetCookie(w, c)
+
+	http.SetCookie(w, env.newCookie(csrfTokenCookie, env.csrfToken(s.SessionUID)))
+}
+
+// clearSessionCookies removes the access token, refresh token and CSRF token cookies.
+func (env *Env) clearSessionCookies(w http.ResponseWriter) {
+	for _, name := range []string{"token", refreshTokenCookie, csrfTokenCookie} {
+		c := env.newCookie(name, "")
+		c.MaxAge = -1
+		c.HttpOnly = name == refreshTokenCookie
+		http.SetCookie(w, c)
+	}
+}
+
+// startSession creates a session for the person p, sets the session cookies
+// and returns the access token.
+func (env *Env) startSession(w http.ResponseWriter, r *http.Request, p models.Person) (string, *models.AppError) {
+	var (
+		uid, secret, accessToken string
+		id                       int64
+		err                      error
+	)
+
+	failed := func(err error, message string) *models.AppError {
+		return &models.AppError{
+			OriginalError: err,
+			Message:       message,
+			Code:          http.StatusInternalServerError,
+		}
+	}
+
+	if err = env.DB.DeleteExpiredSessions(); err != nil {
+		logger.Log.Errorf("delete expired sessions: %s", err)
+	}
+
+	if uid, err = newSessionSecret(); err != nil {
+		return "", failed(err, "session generation error")
+	}
+
+	if secret, err = newSessionSecret(); err != nil {
+		return "", failed(err, "session generation error")
+	}
+
+	now := time.Now()
+	s := models.Session{
+		SessionUID:            uid,
+		SessionRefreshHash:    hashToken(secret),
+		SessionCreationDate:   now,
+		SessionLastSeenDate:   now,
+		SessionExpirationDate: now.Add(env.SessionTTL),
+		SessionUserAgent:      r.UserAgent(),
+		SessionIP:             env.clientIP(r),
+		Person:                p,
+	}
+
+	if id, err = env.DB.CreateSession(s); err != nil {
+		return "", failed(err, "create session error")
+	}
+
+	s.SessionID = int(id)
+
+	if accessToken, err = env.signAccessToken(s); err != nil {
+		return "", failed(err, "error signing token")
+	}
+
+	env.setSessionCookies(w, s, accessToken, uid+"."+secret)
+
+	return accessToken, nil
+}
+
+// refreshSession extends the session of the request refresh token,
+// sets the session cookies with a new access token and returns them.
+// The refresh token is not rotated so that the concurrent requests
+// of an expired access token can all be refreshed.
+func (env *Env) refreshSession(w http.ResponseWriter, r *http.Request) (models.Session, string, error) {
+	var (
+		c           *http.Cookie
+		s           models.Session
+		accessToken string
+		err         error
+	)
+
+	if c, err = r.Cookie(refreshTokenCookie); err != nil {
+		return s, "", errSessionNotFound
+	}
+
+	uid, secret, found := strings.Cut(c.Value, ".")
+	if !found {
+		return s, "", errInvalidRefresh
+	}
+
+	if s, err = env.DB.GetSession(uid); err != nil {
+		if err == sql.ErrNoRows {
+			return s, "", errSessionNotFound
+		}
+
+		return s, "", err
+	}
+
+	if subtle.ConstantTimeCompare([]byte(hashToken(secret)), []byte(s.SessionRefreshHash)) != 1 {
+		return s, "", errInvalidRefresh
+	}
+
+	if s.IsExpired() {
+		return s, "", errSessionExpired
+	}
+
+	now := time.Now()
+	s.SessionLastSeenDate = now
+	s.SessionExpirationDate = now.Add(env.SessionTTL)
+
+	if err = env.DB.RefreshSession(s.SessionUID, s.SessionRefreshHash, s.SessionLastSeenDate, s.SessionExpirationDate); err != nil {
+		return s, "", err
+	}
+
+	if accessToken, err = env.signAccessToken(s); err != nil {
+		return s, "", err
+	}
+
+	env.setSessionCookies(w, s, accessToken, c.Value)
+
+	return s, accessToken, nil
+}
+
+/*
+	REST handlers
+*/
+
+// RefreshTokenHandler returns a new access token for the request refresh token
+// and extends its session.
+func (env *Env) RefreshTokenHandler(w http.ResponseWriter, r *http.Request) *models.AppError {
+	logger.Log.Debug("RefreshTokenHandler")
+
+	var (
+		accessToken string
+		err         error
+	)
+
+	if _, accessToken, err = env.refreshSession(w, r); err != nil {
+		env.clearSessionCookies(w)
+
+		return &models.AppError{
+			OriginalError: err,
+			Message:       err.Error(),
+			Code:          http.StatusUnauthorized,
+		}
+	}
+
+	if _, err = w.Write([]byte(accessToken)); err != nil {
+		return &models.AppError{
+			Code:    http.StatusInternalServerError,
+			Message: err.Error(),
+		}
+	}
+
+	return nil
+}
+
+// GetSessionsHandler returns a json list of the logged person sessions.
+func (env *Env) GetSessionsHandler(w http.ResponseWriter, r *http.Request) *models.AppError {
+	logger.Log.Debug("GetSessionsHandler")
+
+	c := request.ContainerFromRequestContext(r)
+
+	sessions, err := env.DB.GetPersonSessions(c.PersonID)
+	if err != nil {
+		return &models.AppError{
+			OriginalError: err,
+			Code:          http.StatusInternalServerError,
+			Message:       "error getting the sessions",
+		}
+	}
+
+	for i := range sessions {
+		sessions[i].SessionCurrent = sessions[i].SessionUID == c.SessionUID
+	}
+
+	type resp struct {
+		Rows  []models.Session `json:"rows"`
+		Total int              `json:"total"`
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+
+	if err = json.NewEncoder(w).Encode(resp{Rows: sessions, Total: len(sessions)}); err != nil {
+		return &models.AppError{
+			Code:    http.StatusInternalServerError,
+			Message: err.Error(),
+		}
+	}
+
+	return nil
+}
+
+// DeleteSessionHandler revokes the logged person session with the requested id.
+func (env *Env) DeleteSessionHandler(w http.ResponseWriter, r *http.Request) *models.AppError {
+	vars := mux.Vars(r)
+
+	var (
+		id       int
+		err      error
+		sessions []models.Session
+	)
+
+	if id, err = strconv.Atoi(vars["id"]); err != nil {
+		return &models.AppError{
+			OriginalError: err,
+			Message:       "id atoi conversion",
+			Code:          http.StatusInternalServerError,
+		}
+	}
+
+	c := request.ContainerFromRequestContext(r)
+
+	if sessions, err = env.DB.GetPersonSessions(c.PersonID); err != nil {
+		return &models.AppError{
+			OriginalError: err,
+			Code:          http.StatusInternalServerError,
+			Message:       "error getting the sessions",
+		}
+	}
+
+	for _, s := range sessions {
+		if s.SessionID != id {
+			continue
+		}
+
+		if err = env.DB.DeleteSession(id); err != nil {
+			return &models.AppError{
+				OriginalError: err,
+				Message:       "delete session error",
+				Code:          http.StatusInternalServerError,
+			}
+		}
+
+		return nil
+	}
+
+	return &models.AppError{
+		Message: "session not found",
+		Code:    http.StatusNotFound,
+	}
+}
+
+// DeletePersonSessionsHandler revokes all the sessions of the person with the requested id,
+// only for admins.
+func (env *Env) DeletePersonSessionsHandler(w http.ResponseWriter, r *http.Request) *models.AppError {
+	vars := mux.Vars(r)
+
+	var (
+		id  int
+		err error
+	)
+
+	if id, err = strconv.Atoi(vars["id"]); err != nil {
+		return &models.AppError{
+			OriginalError: err,
+			Message:       "id atoi conversion",
+			Code:          http.StatusInternalServerError,
+		}
+	}
+
+	c := request.ContainerFromRequestContext(r)
+
+	if aerr := env.checkAdmin(c.PersonID, "only admins can revoke the sessions of a person"); aerr != nil {
+		return aerr
+	}
+
+	logger.Log.WithFields(logrus.Fields{"id": id}).Debug("DeletePersonSessionsHandler")
+
+	if err = env.DB.DeletePersonSessions(id); err != nil {
+		return &models.AppError{
+			OriginalError: err,
+			Message:       "delete sessions error",
+			Code:          http.StatusInternalServerError,
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,243 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt"
+	"github.com/gorilla/mux"
+	"github.com/tbellembois/gochimitheque/datastores"
+	"github.com/tbellembois/gochimitheque/models"
+	"github.com/tbellembois/gochimitheque/request"
+)
+
+// newTestSession starts a session of the person p and returns its cookies.
+func newTestSession(t *testing.T, env *Env, p models.Person) map[string]*http.Cookie {
+	t.Helper()
+
+	w := httptest.NewRecorder()
+
+	if _, aerr := env.startSession(w, httptest.NewRequest(http.MethodPost, "/get-token", nil), p); aerr != nil {
+		t.Fatal(aerr)
+	}
+
+	cookies := make(map[string]*http.Cookie)
+	for _, c := range w.Result().Cookies() {
+		cookies[c.Name] = c
+	}
+
+	return cookies
+}
+
+// newContainerRequest returns a request with the application context container of the person p.
+func newContainerRequest(method string, target string, p models.Person) *http.Request {
+	r := httptest.NewRequest(method, target, nil)
+
+	return r.WithContext(context.WithValue(r.Context(), request.ChimithequeContextKey("container"), request.Container{
+		PersonID:    p.PersonID,
+		PersonEmail: p.PersonEmail,
+	}))
+}
+
+// sessionCleared returns true if the response clears the session cookies.
+func sessionCleared(w *httptest.ResponseRecorder) bool {
+	for _, c := range w.Result().Cookies() {
+		if c.Name == refreshTokenCookie && c.MaxAge < 0 {
+			return true
+		}
+	}
+
+	return false
+}
+
+var testAdmin = models.Person{PersonID: 1, PersonEmail: "admin@chimitheque.fr"}
+
+func TestRefreshTokenHandler(t *testing.T) {
+	tests := []struct {
+		name   string
+		change func(env *Env, s models.Session) error
+		want   int
+	}{
+		{"valid session", func(env *Env, s models.Session) error { return nil }, http.StatusOK},
+		{"revoked session", func(env *Env, s models.Session) error {
+			return env.DB.DeleteSession(s.SessionID)
+		}, http.StatusUnauthorized},
+		{"revoked person sessions", func(env *Env, s models.Session) error {
+			return env.DB.DeletePersonSessions(s.PersonID)
+		}, http.StatusUnauthorized},
+		{"expired session", func(env *Env, s models.Session) error {
+			past := time.Now().Add(-time.Minute)
+			return env.DB.RefreshSession(s.SessionUID, s.SessionRefreshHash, past, past)
+		}, http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			env := newTestEnv(t)
+			cookies := newTestSession(t, env, testAdmin)
+
+			sessions, err := env.DB.GetPersonSessions(testAdmin.PersonID)
+			if err != nil || len(sessions) != 1 {
+				t.Fatalf("GetPersonSessions() = %v, %v, want one session", sessions, err)
+			}
+
+			if err = tt.change(env, sessions[0]); err != nil {
+				t.Fatal(err)
+			}
+
+			r := httptest.NewRequest(http.MethodPost, "/refresh-token", nil)
+			r.AddCookie(cookies[refreshTokenCookie])
+			w := httptest.NewRecorder()
+
+			code := http.StatusOK
+			if aerr := env.RefreshTokenHandler(w, r); aerr != nil {
+				code = aerr.Code
+			}
+
+			if code != tt.want {
+				t.Fatalf("RefreshTokenHandler() code = %d, want %d", code, tt.want)
+			}
+
+			if cleared := sessionCleared(w); cleared != (tt.want == http.StatusUnauthorized) {
+				t.Errorf("session cookies cleared = %t, want %t", cleared, tt.want == http.StatusUnauthorized)
+			}
+		})
+	}
+
+	// a forged refresh token secret
+	env := newTestEnv(t)
+	cookies := newTestSession(t, env, testAdmin)
+
+	r := httptest.NewRequest(http.MethodPost, "/refresh-token", nil)
+	r.AddCookie(&http.Cookie{Name: refreshTokenCookie, Value: cookies[refreshTokenCookie].Value + "x"})
+
+	if aerr := env.RefreshTokenHandler(httptest.NewRecorder(), r); aerr == nil || aerr.Code != http.StatusUnauthorized {
+		t.Errorf("RefreshTokenHandler() with a forged secret = %v, want %d", aerr, http.StatusUnauthorized)
+	}
+}
+
+func TestAuthenticateMiddlewareSession(t *testing.T) {
+	tests := []struct {
+		name   string
+		token  func(env *Env, cookies map[string]*http.Cookie) string
+		revoke bool
+		want   int
+	}{
+		{"valid session", func(env *Env, cookies map[string]*http.Cookie) string {
+			return cookies["token"].Value
+		}, false, http.StatusOK},
+		{"deleted session", func(env *Env, cookies map[string]*http.Cookie) string {
+			return cookies["token"].Value
+		}, true, http.StatusUnauthorized},
+		{"unknown sid", func(env *Env, cookies map[string]*http.Cookie) string {
+			s, _ := env.signAccessToken(models.Session{SessionUID: "unknown", Person: testAdmin})
+			return s
+		}, false, http.StatusUnauthorized},
+		{"no sid", func(env *Env, cookies map[string]*http.Cookie) string {
+			token := jwt.New(jwt.SigningMethodHS256)
+			token.Claims.(jwt.MapClaims)["email"] = testAdmin.PersonEmail
+			token.Claims.(jwt.MapClaims)["exp"] = time.Now().Add(time.Minute).Unix()
+			s, _ := token.SignedString(env.TokenSignKey)
+			return s
+		}, false, http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			env := newTestEnv(t)
+			cookies := newTestSession(t, env, testAdmin)
+
+			if tt.revoke {
+				if err := env.DB.DeletePersonSessions(testAdmin.PersonID); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			var got request.Container
+
+			h := env.AuthenticateMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				got = request.ContainerFromRequestContext(r)
+			}))
+
+			r := newContainerRequest(http.MethodGet, "/entities", models.Person{})
+			r.AddCookie(&http.Cookie{Name: "token", Value: tt.token(env, cookies)})
+			w := httptest.NewRecorder()
+
+			h.ServeHTTP(w, r)
+
+			if w.Code != tt.want {
+				t.Fatalf("AuthenticateMiddleware() code = %d, want %d", w.Code, tt.want)
+			}
+
+			if tt.want == http.StatusOK && (got.PersonID != testAdmin.PersonID || got.SessionUID == "") {
+				t.Errorf("AuthenticateMiddleware() container = %+v, want the admin session", got)
+			}
+
+			if tt.revoke && !sessionCleared(w) {
+				t.Errorf("session cookies not cleared")
+			}
+		})
+	}
+}
+
+func TestDeletePersonSessionsHandler(t *testing.T) {
+	env := newTestEnv(t)
+
+	env.DB.(*datastores.SQLiteDataStore).MustExec(`INSERT INTO person (person_id, person_email, person_password) VALUES (20, 'p20@test', '')`)
+
+	user := models.Person{PersonID: 20, PersonEmail: "p20@test"}
+
+	newTestSession(t, env, testAdmin)
+	newTestSession(t, env, user)
+
+	count := func(p models.Person) int {
+		t.Helper()
+
+		sessions, err := env.DB.GetPersonSessions(p.PersonID)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return len(sessions)
+	}
+
+	deleteSessions := func(logged models.Person, id int) int {
+		t.Helper()
+
+		r := mux.SetURLVars(newContainerRequest(http.MethodDelete, "/sessions/people/"+strconv.Itoa(id), logged), map[string]string{"id": strconv.Itoa(id)})
+
+		if aerr := env.DeletePersonSessionsHandler(httptest.NewRecorder(), r); aerr != nil {
+			return aerr.Code
+		}
+
+		return http.StatusOK
+	}
+
+	// a person can not revoke the sessions of another one, nor its own ones this way
+	for _, id := range []int{testAdmin.PersonID, user.PersonID} {
+		if code := deleteSessions(user, id); code != http.StatusForbidden {
+			t.Errorf("DeletePersonSessionsHandler(%d) by a person code = %d, want %d", id, code, http.StatusForbidden)
+		}
+	}
+
+	if count(testAdmin) != 1 || count(user) != 1 {
+		t.Fatalf("sessions revoked by a person")
+	}
+
+	// an admin can
+	if code := deleteSessions(testAdmin, user.PersonID); code != http.StatusOK {
+		t.Fatalf("DeletePersonSessionsHandler() by an admin code = %d, want %d", code, http.StatusOK)
+	}
+
+	if count(user) != 0 {
+		t.Errorf("person sessions not revoked")
+	}
+
+	if count(testAdmin) != 1 {
+		t.Errorf("admin sessions revoked")
+	}
+}
@@ -3,6 +3,7 @@ package handlers
 import (
 	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
 	"strconv"
@@ -14,6 +15,7 @@ import (
 	"github.com/tbellembois/gochimitheque/models"
 	"github.com/tbellembois/gochimitheque/request"
 	"github.com/tbellembois/gochimitheque/static/jade"
+	"github.com/tbellembois/gochimitheque/units"
 )
 
 /*
@@ -43,7 +45,7 @@ func (env *Env) VCreateStorageHandler(w http.ResponseWriter, r *http.Request) *m
 */
 
 // ToogleStorageBorrowingHandler (un)borrow the storage with id passed in the request vars
-// for the logged user.
+// for the logged user who must have the borrow permission on the storage entity.
 func (env *Env) ToogleStorageBorrowingHandler(w http.ResponseWriter, r *http.Request) *models.AppError {
 	var (
 		err error
@@ -58,8 +60,22 @@ func (env *Env) ToogleStorageBorrowingHandler(w http.ResponseWriter, r *http.Req
 		}
 	}
 
+	if s.Borrowing == nil {
+		return &models.AppError{
+			OriginalError: errors.New("missing borrowing"),
+			Message:       "missing borrowing",
+			Code:          http.StatusBadRequest,
+		}
+	}
+
 	// retrieving the logged user id from request context
 	c := request.ContainerFromRequestContext(r)
+
+	// the logged user must be able to borrow the storage
+	if aerr := env.authorize(c.PersonID, r.Method, "b", "storages", strconv.FormatInt(s.StorageID.Int64, 10)); aerr != nil {
+		return aerr
+	}
+
 	s.Borrowing.Person = &models.Person{}
 	s.Borrowing.Person.PersonID = c.PersonID
 
@@ -129,6 +145,103 @@ func (env *Env) GetStoragesUnitsHandler(w http.ResponseWriter, r *http.Request)
 	return nil
 }
 
+// ConvertQuantityHandler returns a json of the "quantity" in the "from" unit converted into the "to" unit,
+// with the density and molar mass of the "product" if set.
+func (env *Env) ConvertQuantityHandler(w http.ResponseWriter, r *http.Request) *models.AppError {
+	var (
+		q         float64
+		from, to  int
+		productID int
+		p         models.Product
+		err       error
+	)
+
+	query := r.URL.Query()
+
+	if q, err = strconv.ParseFloat(query.Get("quantity"), 64); err != nil {
+		return &models.AppError{
+			OriginalError: err,
+			Message:       "quantity float conversion",
+			Code:          http.StatusBadRequest,
+		}
+	}
+
+	if from, err = strconv.Atoi(query.Get("from")); err != nil {
+		return &models.AppError{
+			OriginalError: err,
+			Message:       "from atoi conversion",
+			Code:          http.StatusBadRequest,
+		}
+	}
+
+	if to, err = strconv.Atoi(query.Get("to")); err != nil {
+		return &models.AppError{
+			OriginalError: err,
+			Message:       "to atoi conversion",
+			Code:          http.StatusBadRequest,
+		}
+	}
+
+	if pid := query.Get("product"); pid != "" {
+		if productID, err = strconv.Atoi(pid); err != nil {
+			return &models.AppError{
+				OriginalError: err,
+				Message:       "product atoi conversion",
+				Code:          http.StatusBadRequest,
+			}
+		}
+
+		if p, err = env.DB.GetProduct(productID); err != nil {
+			return &models.AppError{
+				OriginalError: err,
+				Message:       "product not found",
+				Code:          http.StatusNotFound,
+			}
+		}
+	}
+
+	logger.Log.WithFields(logrus.Fields{"q": q, "from": from, "to": to, "productID": productID}).Debug("ConvertQuantityHandler")
+
+	if q, err = env.DB.ConvertQuantity(q, from, to, p); err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return &models.AppError{
+				OriginalError: err,
+				Message:       "unit not found",
+				Code:          http.StatusNotFound,
+			}
+		case errors.Is(err, units.ErrIncompatibleUnits), errors.Is(err, units.ErrMissingDensity), errors.Is(err, units.ErrMissingMolarMass):
+			return &models.AppError{
+				OriginalError: err,
+				Message:       err.Error(),
+				Code:          http.StatusBadRequest,
+			}
+		}
+
+		return &models.AppError{
+			OriginalError: err,
+			Message:       "conversion error",
+			Code:          http.StatusInternalServerError,
+		}
+	}
+
+	type resp struct {
+		Quantity float64 `json:"quantity"`
+		Unit     int     `json:"unit"`
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+
+	if err = json.NewEncoder(w).Encode(resp{Quantity: q, Unit: to}); err != nil {
+		return &models.AppError{
+			Code:    http.StatusInternalServerError,
+			Message: err.Error(),
+		}
+	}
+
+	return nil
+}
+
 // GetStoragesSuppliersHandler godoc
 // @Summary Get the suppliers.
 // @tags supplier
@@ -369,6 +482,10 @@ func (env *Env) UpdateStorageHandler(w http.ResponseWriter, r *http.Request) *mo
 	s.StorageID = updateds.StorageID
 	s.PersonID = c.PersonID
 
+	if aerr := env.checkStorageTenant(s); aerr != nil {
+		return aerr
+	}
+
 	logger.Log.WithFields(logrus.Fields{"updateds": updateds}).Debug("UpdateStorageHandler")
 
 	if _, err := env.DB.CreateUpdateStorage(s, 0, true); err != nil {
@@ -393,6 +510,7 @@ func (env *Env) UpdateStorageHandler(w http.ResponseWriter, r *http.Request) *mo
 // DeleteStorageHandler deletes the storage with the requested id.
 func (env *Env) DeleteStorageHandler(w http.ResponseWriter, r *http.Request) *models.AppError {
 	vars := mux.Vars(r)
+	c := request.ContainerFromRequestContext(r)
 
 	var (
 		id  int
@@ -407,7 +525,7 @@ func (env *Env) DeleteStorageHandler(w http.ResponseWriter, r *http.Request) *mo
 		}
 	}
 
-	if err = env.DB.DeleteStorage(id); err != nil {
+	if err = env.DB.DeleteStorage(id, c.PersonID); err != nil {
 		return &models.AppError{
 			OriginalError: err,
 			Code:          http.StatusInternalServerError,
@@ -420,6 +538,7 @@ func (env *Env) DeleteStorageHandler(w http.ResponseWriter, r *http.Request) *mo
 // ArchiveStorageHandler archives the storage with the requested id.
 func (env *Env) ArchiveStorageHandler(w http.ResponseWriter, r *http.Request) *models.AppError {
 	vars := mux.Vars(r)
+	c := request.ContainerFromRequestContext(r)
 
 	var (
 		id  int
@@ -434,7 +553,7 @@ func (env *Env) ArchiveStorageHandler(w http.ResponseWriter, r *http.Request) *m
 		}
 	}
 
-	if err = env.DB.ArchiveStorage(id); err != nil {
+	if err = env.DB.ArchiveStorage(id, c.PersonID); err != nil {
 		return &models.AppError{
 			Code:    http.StatusInternalServerError,
 			Message: err.Error(),
@@ -446,6 +565,7 @@ func (env *Env) ArchiveStorageHandler(w http.ResponseWriter, r *http.Request) *m
 // RestoreStorageHandler restores the storage with the requested id.
 func (env *Env) RestoreStorageHandler(w http.ResponseWriter, r *http.Request) *models.AppError {
 	vars := mux.Vars(r)
+	c := request.ContainerFromRequestContext(r)
 
 	var (
 		id  int
@@ -460,7 +580,7 @@ func (env *Env) RestoreStorageHandler(w http.ResponseWriter, r *http.Request) *m
 		}
 	}
 
-	if err = env.DB.RestoreStorage(id); err != nil {
+	if err = env.DB.RestoreStorage(id, c.PersonID); err != nil {
 		return &models.AppError{
 			Code:    http.StatusInternalServerError,
 			Message: err.Error(),
@@ -504,6 +624,10 @@ func (env *Env) CreateStorageHandler(w http.ResponseWriter, r *http.Request) *mo
 	s.StorageModificationDate = time.Now()
 	s.PersonID = c.PersonID
 
+	if aerr := env.checkStorageTenant(s); aerr != nil {
+		return aerr
+	}
+
 	logger.Log.WithFields(logrus.Fields{"s": fmt.Sprintf("%+v", s)}).Debug("CreateStorageHandler")
 	logger.Log.WithFields(logrus.Fields{"s.StorageNbItem": s.StorageNbItem}).Debug("CreateStorageHandler")
 
@@ -0,0 +1,170 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+	"github.com/tbellembois/gochimitheque/logger"
+	"github.com/tbellembois/gochimitheque/models"
+)
+
+// cardTenant returns the tenant of a product card, supplier or producer
+// created by the person with the given id.
+// Admins can create cards for any entity or for the shared catalog (requested tenant NULL),
+// the other people create cards for one of their entities, their first one by default.
+func (env *Env) cardTenant(personID int, requested sql.NullInt64) (sql.NullInt64, *models.AppError) {
+	var (
+		err      error
+		isadmin  bool
+		isMember bool
+		tenant   sql.NullInt64
+	)
+
+	if !env.DB.IsMultiTenant() {
+		return sql.NullInt64{}, nil
+	}
+
+	if isadmin, err = env.DB.IsPersonAdmin(personID); err != nil {
+		return sql.NullInt64{}, &models.AppError{
+			OriginalError: err,
+			Message:       "error getting the person admin status",
+			Code:          http.StatusInternalServerError,
+		}
+	}
+
+	if isadmin {
+		return requested, nil
+	}
+
+	if !requested.Valid {
+		if tenant, err = env.DB.GetPersonDefaultTenant(personID); err != nil {
+			return sql.NullInt64{}, &models.AppError{
+				OriginalError: err,
+				Message:       "error getting the person default tenant",
+				Code:          http.StatusInternalServerError,
+			}
+		}
+
+		if !tenant.Valid {
+			return sql.NullInt64{}, &models.AppError{
+				OriginalError: errors.New("person without entity"),
+				Message:       "you must belong to an entity to create cards",
+				Code:          http.StatusForbidden,
+			}
+		}
+
+		return tenant, nil
+	}
+
+	if isMember, err = env.DB.DoesPersonBelongsTo(personID, []models.Entity{{EntityID: int(requested.Int64)}}); err != nil {
+		return sql.NullInt64{}, &models.AppError{
+			OriginalError: err,
+			Message:       "error checking the person entities",
+			Code:          http.StatusInternalServerError,
+		}
+	}
+
+	if !isMember {
+		return sql.NullInt64{}, &models.AppError{
+			OriginalError: errors.New("tenant of another entity"),
+			Message:       "you can only create cards for your entities",
+			Code:          http.StatusForbidden,
+		}
+	}
+
+	return requested, nil
+}
+
+// checkStorageTenant returns an error if the storage s product
+// belongs to another entity than the storage store location one.
+func (env *Env) checkStorageTenant(s models.Storage) *models.AppError {
+	var (
+		err    error
+		tenant sql.NullInt64
+		sl     models.StoreLocation
+	)
+
+	if !env.DB.IsMultiTenant() {
+		return nil
+	}
+
+	if tenant, err = env.DB.GetProductTenant(s.ProductID); err != nil {
+		return &models.AppError{
+			OriginalError: err,
+			Message:       "error getting the product tenant",
+			Code:          http.StatusInternalServerError,
+		}
+	}
+
+	// shared catalog
+	if !tenant.Valid {
+		return nil
+	}
+
+	if sl, err = env.DB.GetStoreLocation(int(s.StoreLocationID.Int64)); err != nil {
+		return &models.AppError{
+			OriginalError: err,
+			Message:       "error retrieving the storage store location",
+			Code:          http.StatusInternalServerError,
+		}
+	}
+
+	if int64(sl.EntityID) != tenant.Int64 {
+		return &models.AppError{
+			OriginalError: errors.New("product of another entity"),
+			Message:       "the product belongs to another entity",
+			Code:          http.StatusForbidden,
+		}
+	}
+
+	return nil
+}
+
+// ShareCardHandler moves the product card, supplier or producer
+// with the requested id to the shared catalog.
+func (env *Env) ShareCardHandler(w http.ResponseWriter, r *http.Request) *models.AppError {
+	logger.Log.Debug("ShareCardHandler")
+
+	var (
+		id  int
+		err error
+	)
+
+	vars := mux.Vars(r)
+
+	if id, err = strconv.Atoi(vars["id"]); err != nil {
+		return &models.AppError{
+			OriginalError: err,
+			Message:       "id atoi conversion",
+			Code:          http.StatusInternalServerError,
+		}
+	}
+
+	switch vars["card"] {
+	case "products":
+		err = env.DB.ShareProduct(id)
+	case "suppliers":
+		err = env.DB.ShareSupplier(id)
+	case "producers":
+		err = env.DB.ShareProducer(id)
+	default:
+		return &models.AppError{
+			OriginalError: errors.New("unknown card " + vars["card"]),
+			Message:       "unknown card",
+			Code:          http.StatusBadRequest,
+		}
+	}
+
+	if err != nil {
+		return &models.AppError{
+			OriginalError: err,
+			Message:       "share card error",
+			Code:          http.StatusInternalServerError,
+		}
+	}
+
+	return nil
+}
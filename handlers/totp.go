@@ -0,0 +1,787 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt"
+	"github.com/gorilla/mux"
+	"github.com/sirupsen/logrus"
+	"github.com/skip2/go-qrcode"
+	"github.com/tbellembois/gochimitheque/logger"
+	"github.com/tbellembois/gochimitheque/models"
+	"github.com/tbellembois/gochimitheque/request"
+	"github.com/tbellembois/gochimitheque/totp"
+)
+
+const (
+	// totpIssuer is the account issuer displayed by the authenticator applications.
+	totpIssuer = "Chimithèque"
+	// totpTokenTTL is the lifetime of the token between the password and the second factor validations.
+	totpTokenTTL = 5 * time.Minute
+	// totpRecoveryCodes is the number of generated recovery codes.
+	totpRecoveryCodes = 10
+)
+
+// totpRequest is the body of the second factor requests.
+type totpRequest struct {
+	TOTPToken   string `json:"totp_token"` // the token returned by GetTokenHandler after the password validation
+	TOTPCode    string `json:"totp_code"`  // a TOTP or recovery code
+	CaptchaUID  string `json:"captcha_uid"`
+	CaptchaText string `json:"captcha_text"`
+}
+
+// totpLogin is the response of GetTokenHandler when a second factor is needed.
+type totpLogin struct {
+	TOTPToken    string `json:"totp_token"`
+	TOTPEnrolled bool   `json:"totp_enrolled"` // false if the second factor is required but not enrolled yet
+}
+
+// totpEnrollment is a new pending second factor to be registered in an authenticator application.
+type totpEnrollment struct {
+	TOTPSecret string `json:"totp_secret"`
+	TOTPURL    string `json:"totp_url"`
+	TOTPQRCode []byte `json:"totp_qrcode"` // PNG of the TOTP URL
+}
+
+// totpRecoveryCodesResponse holds new recovery codes, they can not be retrieved afterwards.
+type totpRecoveryCodesResponse struct {
+	Token         string   `json:"token,omitempty"` // the access token of a login enabling the second factor
+	RecoveryCodes []string `json:"totp_recovery_codes"`
+}
+
+// totpStatus is the second factor status of the logged person.
+type totpStatus struct {
+	TOTPEnabled       bool `json:"totp_enabled"`
+	TOTPRequired      bool `json:"totp_required"`
+	TOTPRecoveryCodes int  `json:"totp_recovery_codes"` // number of unused recovery codes
+}
+
+// hashRecoveryCode returns the stored hash of a recovery code.
+func hashRecoveryCode(code string) string {
+	return hashToken(strings.ToLower(strings.ReplaceAll(strings.TrimSpace(code), "-", "")))
+}
+
+// isTOTPRequired returns true if the person with id personID must use a second factor.
+func (env *Env) isTOTPRequired(personID int) (bool, error) {
+	if env.TOTPAdmins {
+		isadmin, err := env.DB.IsPersonAdmin(personID)
+		if err != nil || isadmin {
+			return isadmin, err
+		}
+	}
+
+	return env.DB.IsPersonTOTPRequiredByRole(personID)
+}
+
+// signTOTPToken returns the token proving the password validation of the person p.
+func (env *Env) signTOTPToken(p models.Person) (string, error) {
+	token := jwt.New(jwt.SigningMethodHS256)
+	claims := token.Claims.(jwt.MapClaims)
+	claims["email"] = p.PersonEmail
+	claims["purpose"] = "totp"
+	claims["exp"] = time.Now().Add(totpTokenTTL).Unix()
+
+	return token.SignedString(env.TokenSignKey)
+}
+
+// parseTOTPToken returns the person of a token returned by signTOTPToken.
+func (env *Env) parseTOTPToken(tokenString string) (models.Person, *models.AppError) {
+	unauthorized := func(err error) (models.Person, *models.AppError) {
+		return models.Person{}, &models.AppError{
+			OriginalError: err,
+			Message:       "invalid or expired second factor token, please log in",
+			Code:          http.StatusUnauthorized,
+		}
+	}
+
+	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
+		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, errors.New("unexpected signing method")
+		}
+
+		return env.TokenSignKey, nil
+	})
+	if err != nil || !token.Valid {
+		return unauthorized(err)
+	}
+
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok || claims["purpose"] != "totp" {
+		return unauthorized(errors.New("not a second factor token"))
+	}
+
+	email, ok := claims["email"].(string)
+	if !ok {
+		return unauthorized(errors.New("email not found in claims"))
+	}
+
+	p, err := env.DB.GetPersonByEmail(email)
+	if err != nil {
+		return unauthorized(err)
+	}
+
+	return p, nil
+}
+
+// startTOTPLogin writes the second factor token instead of logging the person p in
+// if p has enabled or must use a second factor, and returns true in that case.
+func (env *Env) startTOTPLogin(w http.ResponseWriter, p models.Person) (bool, *models.AppError) {
+	var (
+		t        models.PersonTOTP
+		required bool
+		token    string
+		err      error
+	)
+
+	if t, err = env.DB.GetPersonTOTP(p.PersonID); err != nil && err != sql.ErrNoRows {
+		return false, &models.AppError{
+			OriginalError: err,
+			Message:       "error getting the second factor",
+			Code:          http.StatusInternalServerError,
+		}
+	}
+
+	if !t.PersonTOTPEnabled {
+		if required, err = env.isTOTPRequired(p.PersonID); err != nil {
+			return false, &models.AppError{
+				OriginalError: err,
+				Message:       "error getting the second factor requirement",
+				Code:          http.StatusInternalServerError,
+			}
+		}
+
+		if !required {
+			return false, nil
+		}
+	}
+
+	if token, err = env.signTOTPToken(p); err != nil {
+		return false, &models.AppError{
+			OriginalError: err,
+			Message:       "error signing token",
+			Code:          http.StatusInternalServerError,
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.WriteHeader(http.StatusAccepted)
+
+	if err = json.NewEncoder(w).Encode(totpLogin{TOTPToken: token, TOTPEnrolled: t.PersonTOTPEnabled}); err != nil {
+		logger.Log.Error(err)
+	}
+
+	return true, nil
+}
+
+// enrollTOTP creates a new pending second factor for the person p
+// and writes it.
+func (env *Env) enrollTOTP(w http.ResponseWriter, p models.Person) *models.AppError {
+	var (
+		e   totpEnrollment
+		err error
+	)
+
+	if e.TOTPSecret, err = totp.GenerateSecret(); err != nil {
+		return &models.AppError{
+			OriginalError: err,
+			Message:       "secret generation error",
+			Code:          http.StatusInternalServerError,
+		}
+	}
+
+	e.TOTPURL = totp.URL(totpIssuer, p.PersonEmail, e.TOTPSecret)
+
+	if e.TOTPQRCode, err = qrcode.Encode(e.TOTPURL, qrcode.Medium, 256); err != nil {
+		return &models.AppError{
+			OriginalError: err,
+			Message:       "qrcode generation error",
+			Code:          http.StatusInternalServerError,
+		}
+	}
+
+	if err = env.DB.SavePersonTOTP(models.PersonTOTP{PersonID: p.PersonID, PersonTOTPSecret: e.TOTPSecret}); err != nil {
+		return &models.AppError{
+			OriginalError: err,
+			Message:       "save second factor error",
+			Code:          http.StatusInternalServerError,
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+
+	if err = json.NewEncoder(w).Encode(e); err != nil {
+		return &models.AppError{
+			Code:    http.StatusInternalServerError,
+			Message: err.Error(),
+		}
+	}
+
+	return nil
+}
+
+// validateTOTPCode returns true if code is a valid TOTP code of t, not used yet,
+// or if allowRecovery and code is an unused recovery code of t.
+// A pending second factor is enabled by its first valid code.
+func (env *Env) validateTOTPCode(r *http.Request, p models.Person, t models.PersonTOTP, code string, allowRecovery bool) (bool, error) {
+	if step, ok := totp.Validate(t.PersonTOTPSecret, code, time.Now()); ok {
+		if step <= t.PersonTOTPLastStep {
+			// replayed code
+			return false, nil
+		}
+
+		enabling := !t.PersonTOTPEnabled
+
+		t.PersonTOTPLastStep = step
+		t.PersonTOTPEnabled = true
+
+		if err := env.DB.SavePersonTOTP(t); err != nil {
+			return false, err
+		}
+
+		if enabling {
+			env.audit(r, "totp_enabled", p.PersonEmail, "")
+		}
+
+		return true, nil
+	}
+
+	if !allowRecovery || !t.PersonTOTPEnabled {
+		return false, nil
+	}
+
+	used, err := env.DB.UsePersonTOTPRecoveryCode(p.PersonID, hashRecoveryCode(code))
+	if used {
+		env.audit(r, "totp_recovery_code_used", p.PersonEmail, "")
+	}
+
+	return used, err
+}
+
+// generateRecoveryCodes generates and stores new recovery codes for the person p
+// and returns them.
+func (env *Env) generateRecoveryCodes(p models.Person) ([]string, *models.AppError) {
+	var (
+		codes  []string
+		hashes []string
+	)
+
+	for i := 0; i < totpRecoveryCodes; i++ {
+		k, err := genSymmetricKey(40)
+		if err != nil {
+			return nil, &models.AppError{
+				OriginalError: err,
+				Message:       "recovery code generation error",
+				Code:          http.StatusInternalServerError,
+			}
+		}
+
+		c := hex.EncodeToString(k)
+		c = c[:5] + "-" + c[5:]
+
+		codes = append(codes, c)
+		hashes = append(hashes, hashRecoveryCode(c))
+	}
+
+	if err := env.DB.SetPersonTOTPRecoveryCodes(p.PersonID, hashes); err != nil {
+		return nil, &models.AppError{
+			OriginalError: err,
+			Message:       "save recovery codes error",
+			Code:          http.StatusInternalServerError,
+		}
+	}
+
+	return codes, nil
+}
+
+// newRecoveryCodes generates and stores new recovery codes for the person p
+// and writes them.
+func (env *Env) newRecoveryCodes(w http.ResponseWriter, p models.Person) *models.AppError {
+	codes, aerr := env.generateRecoveryCodes(p)
+	if aerr != nil {
+		return aerr
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+
+	if err := json.NewEncoder(w).Encode(totpRecoveryCodesResponse{RecoveryCodes: codes}); err != nil {
+		return &models.AppError{
+			Code:    http.StatusInternalServerError,
+			Message: err.Error(),
+		}
+	}
+
+	return nil
+}
+
+// decodeTOTPRequest decodes the request body.
+func decodeTOTPRequest(r *http.Request) (totpRequest, *models.AppError) {
+	var tr totpRequest
+
+	if err := json.NewDecoder(r.Body).Decode(&tr); err != nil {
+		return tr, &models.AppError{
+			OriginalError: err,
+			Message:       "JSON decoding error",
+			Code:          http.StatusBadRequest,
+		}
+	}
+
+	return tr, nil
+}
+
+// loggedPersonTOTP returns the logged person and its second factor.
+func (env *Env) loggedPersonTOTP(r *http.Request) (models.Person, models.PersonTOTP, *models.AppError) {
+	var (
+		p   models.Person
+		t   models.PersonTOTP
+		err error
+	)
+
+	c := request.ContainerFromRequestContext(r)
+
+	if p, err = env.DB.GetPerson(c.PersonID); err != nil {
+		return p, t, &models.AppError{
+			OriginalError: err,
+			Message:       "get person error",
+			Code:          http.StatusInternalServerError,
+		}
+	}
+
+	if t, err = env.DB.GetPersonTOTP(c.PersonID); err != nil && err != sql.ErrNoRows {
+		return p, t, &models.AppError{
+			OriginalError: err,
+			Message:       "error getting the second factor",
+			Code:          http.StatusInternalServerError,
+		}
+	}
+
+	return p, t, nil
+}
+
+/*
+	REST handlers
+*/
+
+// GetTOTPTokenHandler validates the second factor of a person authenticated by GetTokenHandler
+// and logs it in. A pending second factor enrolled with EnrollTOTPLoginHandler is enabled,
+// the access token is then returned as JSON with the new recovery codes.
+func (env *Env) GetTOTPTokenHandler(w http.ResponseWriter, r *http.Request) (aerr *models.AppError) {
+	var (
+		tr  totpRequest
+		p   models.Person
+		t   models.PersonTOTP
+		ok  bool
+		err error
+	)
+
+	if tr, aerr = decodeTOTPRequest(r); aerr != nil {
+		return aerr
+	}
+
+	if p, aerr = env.parseTOTPToken(tr.TOTPToken); aerr != nil {
+		return aerr
+	}
+
+	logger.Log.WithFields(logrus.Fields{"email": p.PersonEmail}).Debug("GetTOTPTokenHandler")
+
+	// Brute force protection, the codes failures are the account ones.
+	if aerr = env.checkLoginFailures(w, r, p.PersonEmail, &models.Person{CaptchaUID: tr.CaptchaUID, CaptchaText: tr.CaptchaText}); aerr != nil {
+		return aerr
+	}
+
+	defer func() {
+		switch {
+		case aerr == nil:
+			env.loginSucceeded(p.PersonEmail)
+		case aerr.Code == http.StatusUnauthorized:
+			env.loginFailed(r, p.PersonEmail)
+		}
+	}()
+
+	if t, err = env.DB.GetPersonTOTP(p.PersonID); err != nil {
+		if err == sql.ErrNoRows {
+			return &models.AppError{
+				OriginalError: err,
+				Message:       "second factor not enrolled",
+				Code:          http.StatusBadRequest,
+			}
+		}
+
+		return &models.AppError{
+			OriginalError: err,
+			Message:       "error getting the second factor",
+			Code:          http.StatusInternalServerError,
+		}
+	}
+
+	enabling := !t.PersonTOTPEnabled
+
+	if ok, err = env.validateTOTPCode(r, p, t, tr.TOTPCode, true); err != nil {
+		return &models.AppError{
+			OriginalError: err,
+			Message:       "error validating the second factor",
+			Code:          http.StatusInternalServerError,
+		}
+	}
+
+	if !ok {
+		return &models.AppError{
+			Message: "invalid second factor code",
+			Code:    http.StatusUnauthorized,
+		}
+	}
+
+	if !enabling {
+		return env.logIn(w, r, p)
+	}
+
+	// The second factor enrolled at login is enabled,
+	// its recovery codes are returned with the access token.
+	var resp totpRecoveryCodesResponse
+
+	if resp.RecoveryCodes, aerr = env.generateRecoveryCodes(p); aerr != nil {
+		return aerr
+	}
+
+	if resp.Token, aerr = env.startLogIn(w, r, p); aerr != nil {
+		return aerr
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+
+	if err = json.NewEncoder(w).Encode(resp); err != nil {
+		return &models.AppError{
+			Code:    http.StatusInternalServerError,
+			Message: err.Error(),
+		}
+	}
+
+	return nil
+}
+
+// EnrollTOTPLoginHandler creates a pending second factor for a person authenticated by GetTokenHandler
+// who must use a second factor but has not enrolled yet.
+func (env *Env) EnrollTOTPLoginHandler(w http.ResponseWriter, r *http.Request) *models.AppError {
+	var (
+		tr   totpRequest
+		p    models.Person
+		t    models.PersonTOTP
+		aerr *models.AppError
+		err  error
+	)
+
+	if tr, aerr = decodeTOTPRequest(r); aerr != nil {
+		return aerr
+	}
+
+	if p, aerr = env.parseTOTPToken(tr.TOTPToken); aerr != nil {
+		return aerr
+	}
+
+	logger.Log.WithFields(logrus.Fields{"email": p.PersonEmail}).Debug("EnrollTOTPLoginHandler")
+
+	if t, err = env.DB.GetPersonTOTP(p.PersonID); err != nil && err != sql.ErrNoRows {
+		return &models.AppError{
+			OriginalError: err,
+			Message:       "error getting the second factor",
+			Code:          http.StatusInternalServerError,
+		}
+	}
+
+	if t.PersonTOTPEnabled {
+		return &models.AppError{
+			Message: "second factor already enrolled",
+			Code:    http.StatusBadRequest,
+		}
+	}
+
+	return env.enrollTOTP(w, p)
+}
+
+// GetTOTPHandler returns the second factor status of the logged person.
+func (env *Env) GetTOTPHandler(w http.ResponseWriter, r *http.Request) *models.AppError {
+	logger.Log.Debug("GetTOTPHandler")
+
+	var (
+		p    models.Person
+		t    models.PersonTOTP
+		s    totpStatus
+		aerr *models.AppError
+		err  error
+	)
+
+	if p, t, aerr = env.loggedPersonTOTP(r); aerr != nil {
+		return aerr
+	}
+
+	s.TOTPEnabled = t.PersonTOTPEnabled
+
+	if s.TOTPRequired, err = env.isTOTPRequired(p.PersonID); err != nil {
+		return &models.AppError{
+			OriginalError: err,
+			Message:       "error getting the second factor requirement",
+			Code:          http.StatusInternalServerError,
+		}
+	}
+
+	if s.TOTPRecoveryCodes, err = env.DB.CountPersonTOTPRecoveryCodes(p.PersonID); err != nil {
+		return &models.AppError{
+			OriginalError: err,
+			Message:       "error counting the recovery codes",
+			Code:          http.StatusInternalServerError,
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+
+	if err = json.NewEncoder(w).Encode(s); err != nil {
+		return &models.AppError{
+			Code:    http.StatusInternalServerError,
+			Message: err.Error(),
+		}
+	}
+
+	return nil
+}
+
+// CreateTOTPHandler creates a pending second factor for the logged person,
+// to be confirmed with ConfirmTOTPHandler.
+func (env *Env) CreateTOTPHandler(w http.ResponseWriter, r *http.Request) *models.AppError {
+	logger.Log.Debug("CreateTOTPHandler")
+
+	p, t, aerr := env.loggedPersonTOTP(r)
+	if aerr != nil {
+		return aerr
+	}
+
+	if t.PersonTOTPEnabled {
+		return &models.AppError{
+			Message: "second factor already enrolled, disable it first",
+			Code:    http.StatusBadRequest,
+		}
+	}
+
+	return env.enrollTOTP(w, p)
+}
+
+// ConfirmTOTPHandler enables the pending second factor of the logged person
+// with a first valid code and returns new recovery codes.
+func (env *Env) ConfirmTOTPHandler(w http.ResponseWriter, r *http.Request) *models.AppError {
+	logger.Log.Debug("ConfirmTOTPHandler")
+
+	var (
+		tr   totpRequest
+		p    models.Person
+		t    models.PersonTOTP
+		ok   bool
+		aerr *models.AppError
+		err  error
+	)
+
+	if tr, aerr = decodeTOTPRequest(r); aerr != nil {
+		return aerr
+	}
+
+	if p, t, aerr = env.loggedPersonTOTP(r); aerr != nil {
+		return aerr
+	}
+
+	if t.PersonTOTPSecret == "" || t.PersonTOTPEnabled {
+		return &models.AppError{
+			Message: "no pending second factor",
+			Code:    http.StatusBadRequest,
+		}
+	}
+
+	if ok, err = env.validateTOTPCode(r, p, t, tr.TOTPCode, false); err != nil {
+		return &models.AppError{
+			OriginalError: err,
+			Message:       "error validating the second factor",
+			Code:          http.StatusInternalServerError,
+		}
+	}
+
+	if !ok {
+		return &models.AppError{
+			Message: "invalid second factor code",
+			Code:    http.StatusBadRequest,
+		}
+	}
+
+	return env.newRecoveryCodes(w, p)
+}
+
+// CreateTOTPRecoveryCodesHandler replaces the recovery codes of the logged person
+// after the validation of a code.
+func (env *Env) CreateTOTPRecoveryCodesHandler(w http.ResponseWriter, r *http.Request) *models.AppError {
+	logger.Log.Debug("CreateTOTPRecoveryCodesHandler")
+
+	var (
+		tr   totpRequest
+		p    models.Person
+		t    models.PersonTOTP
+		ok   bool
+		aerr *models.AppError
+		err  error
+	)
+
+	if tr, aerr = decodeTOTPRequest(r); aerr != nil {
+		return aerr
+	}
+
+	if p, t, aerr = env.loggedPersonTOTP(r); aerr != nil {
+		return aerr
+	}
+
+	if !t.PersonTOTPEnabled {
+		return &models.AppError{
+			Message: "second factor not enrolled",
+			Code:    http.StatusBadRequest,
+		}
+	}
+
+	if ok, err = env.validateTOTPCode(r, p, t, tr.TOTPCode, false); err != nil {
+		return &models.AppError{
+			OriginalError: err,
+			Message:       "error validating the second factor",
+			Code:          http.StatusInternalServerError,
+		}
+	}
+
+	if !ok {
+		return &models.AppError{
+			Message: "invalid second factor code",
+			Code:    http.StatusBadRequest,
+		}
+	}
+
+	return env.newRecoveryCodes(w, p)
+}
+
+// DeleteTOTPHandler disables the second factor of the logged person
+// after the validation of a code, if not required.
+func (env *Env) DeleteTOTPHandler(w http.ResponseWriter, r *http.Request) *models.AppError {
+	logger.Log.Debug("DeleteTOTPHandler")
+
+	var (
+		tr       totpRequest
+		p        models.Person
+		t        models.PersonTOTP
+		ok       bool
+		required bool
+		aerr     *models.AppError
+		err      error
+	)
+
+	if tr, aerr = decodeTOTPRequest(r); aerr != nil {
+		return aerr
+	}
+
+	if p, t, aerr = env.loggedPersonTOTP(r); aerr != nil {
+		return aerr
+	}
+
+	if required, err = env.isTOTPRequired(p.PersonID); err != nil {
+		return &models.AppError{
+			OriginalError: err,
+			Message:       "error getting the second factor requirement",
+			Code:          http.StatusInternalServerError,
+		}
+	}
+
+	if required {
+		return &models.AppError{
+			Message: "the second factor is required",
+			Code:    http.StatusForbidden,
+		}
+	}
+
+	if t.PersonTOTPEnabled {
+		if ok, err = env.validateTOTPCode(r, p, t, tr.TOTPCode, true); err != nil {
+			return &models.AppError{
+				OriginalError: err,
+				Message:       "error validating the second factor",
+				Code:          http.StatusInternalServerError,
+			}
+		}
+
+		if !ok {
+			return &models.AppError{
+				Message: "invalid second factor code",
+				Code:    http.StatusBadRequest,
+			}
+		}
+	}
+
+	if err = env.DB.DeletePersonTOTP(p.PersonID); err != nil {
+		return &models.AppError{
+			OriginalError: err,
+			Message:       "delete second factor error",
+			Code:          http.StatusInternalServerError,
+		}
+	}
+
+	env.audit(r, "totp_disabled", p.PersonEmail, "")
+
+	return nil
+}
+
+// ResetPersonTOTPHandler removes the second factor of the person with the requested id,
+// for a lost device, only for admins.
+func (env *Env) ResetPersonTOTPHandler(w http.ResponseWriter, r *http.Request) *models.AppError {
+	vars := mux.Vars(r)
+
+	var (
+		id  int
+		p   models.Person
+		err error
+	)
+
+	c := request.ContainerFromRequestContext(r)
+
+	if aerr := env.checkAdmin(c.PersonID, "only admins can reset the second factor of a person"); aerr != nil {
+		return aerr
+	}
+
+	if id, err = strconv.Atoi(vars["id"]); err != nil {
+		return &models.AppError{
+			OriginalError: err,
+			Message:       "id atoi conversion",
+			Code:          http.StatusInternalServerError,
+		}
+	}
+
+	if p, err = env.DB.GetPerson(id); err != nil {
+		if err == sql.ErrNoRows {
+			return &models.AppError{
+				OriginalError: err,
+				Message:       "person not found",
+				Code:          http.StatusNotFound,
+			}
+		}
+
+		return &models.AppError{
+			OriginalError: err,
+			Message:       "get person error",
+			Code:          http.StatusInternalServerError,
+		}
+	}
+
+	if err = env.DB.DeletePersonTOTP(id); err != nil {
+		return &models.AppError{
+			OriginalError: err,
+			Message:       "delete second factor error",
+			Code:          http.StatusInternalServerError,
+		}
+	}
+
+	env.audit(r, "totp_reset", p.PersonEmail, "")
+
+	return nil
+}
@@ -0,0 +1,86 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/tbellembois/gochimitheque/models"
+	"github.com/tbellembois/gochimitheque/totp"
+)
+
+func TestTOTPLoginEnrollment(t *testing.T) {
+	env := newTestEnv(t)
+	env.TOTPAdmins = true
+
+	call := func(h func(http.ResponseWriter, *http.Request) *models.AppError, body string, want int) *httptest.ResponseRecorder {
+		t.Helper()
+
+		r := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(body))
+		w := httptest.NewRecorder()
+
+		code := http.StatusOK
+		if aerr := h(w, r); aerr != nil {
+			code = aerr.Code
+		} else if w.Code != http.StatusOK {
+			code = w.Code
+		}
+
+		if code != want {
+			t.Fatalf("code = %d, want %d", code, want)
+		}
+
+		return w
+	}
+
+	login := func() string {
+		t.Helper()
+
+		var l totpLogin
+
+		w := call(env.GetTokenHandler, `{"person_email":"admin@chimitheque.fr","person_password":"chimitheque"}`, http.StatusAccepted)
+		if err := json.NewDecoder(w.Body).Decode(&l); err != nil {
+			t.Fatal(err)
+		}
+
+		return l.TOTPToken
+	}
+
+	// the admin must enroll at login
+	token := login()
+
+	var e totpEnrollment
+
+	w := call(env.EnrollTOTPLoginHandler, `{"totp_token":"`+token+`"}`, http.StatusOK)
+	if err := json.NewDecoder(w.Body).Decode(&e); err != nil {
+		t.Fatal(err)
+	}
+
+	code, err := totp.Code(e.TOTPSecret, totp.Step(time.Now()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the first code enables the second factor and returns the recovery codes with the token
+	var resp totpRecoveryCodesResponse
+
+	w = call(env.GetTOTPTokenHandler, `{"totp_token":"`+token+`","totp_code":"`+code+`"}`, http.StatusOK)
+	if err = json.NewDecoder(w.Body).Decode(&resp); err != nil {
+		t.Fatal(err)
+	}
+
+	if resp.Token == "" || len(resp.RecoveryCodes) != totpRecoveryCodes {
+		t.Fatalf("GetTOTPTokenHandler() = %+v, want a token and %d recovery codes", resp, totpRecoveryCodes)
+	}
+
+	// the next logins return the token only, a recovery code can be used
+	w = call(env.GetTOTPTokenHandler, `{"totp_token":"`+login()+`","totp_code":"`+resp.RecoveryCodes[0]+`"}`, http.StatusOK)
+	if b := w.Body.String(); b == "" || strings.HasPrefix(b, "{") {
+		t.Errorf("GetTOTPTokenHandler() body = %q, want the token", b)
+	}
+
+	call(env.GetTOTPTokenHandler, `{"totp_token":"`+login()+`","totp_code":"`+resp.RecoveryCodes[0]+`"}`, http.StatusUnauthorized)
+}
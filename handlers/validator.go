@@ -12,10 +12,12 @@ import (
 	"github.com/tbellembois/gochimitheque-utils/convert"
 	"github.com/tbellembois/gochimitheque-utils/validator"
 	"github.com/tbellembois/gochimitheque/datastores"
+	"github.com/tbellembois/gochimitheque/formula"
 	"github.com/tbellembois/gochimitheque/locales"
 	"github.com/tbellembois/gochimitheque/logger"
 	"github.com/tbellembois/gochimitheque/models"
 	"github.com/tbellembois/gochimitheque/request"
+	"github.com/tbellembois/gochimitheque/smiles"
 )
 
 func sendResponse(w http.ResponseWriter, response string) {
@@ -258,6 +260,97 @@ func (env *Env) FormatProductEmpiricalFormulaHandler(w http.ResponseWriter, r *h
 	return nil
 }
 
+// FormatProductMolarMassHandler returns the molar mass, Hill notation
+// and elemental composition of the empirical formula.
+func (env *Env) FormatProductMolarMassHandler(w http.ResponseWriter, r *http.Request) *models.AppError {
+	var (
+		err error
+		c   formula.Composition
+	)
+
+	if err = r.ParseForm(); err != nil {
+		return &models.AppError{
+			OriginalError: err,
+			Message:       "form parsing",
+			Code:          http.StatusInternalServerError,
+		}
+	}
+
+	if c, err = formula.Parse(r.Form.Get("empiricalformula")); err != nil {
+		return &models.AppError{
+			OriginalError: err,
+			Message:       err.Error(),
+			Code:          http.StatusBadRequest,
+		}
+	}
+
+	resp := struct {
+		MolarMass float64           `json:"molarmass"`
+		Hill      string            `json:"hill"`
+		Elements  []formula.Element `json:"elements"`
+	}{
+		MolarMass: c.MolarMass(),
+		Hill:      c.Hill(),
+		Elements:  c.Elements(),
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	if err = json.NewEncoder(w).Encode(resp); err != nil {
+		return &models.AppError{
+			Code:    http.StatusInternalServerError,
+			Message: err.Error(),
+		}
+	}
+
+	return nil
+}
+
+// FormatProductSMILESHandler returns the canonical SMILES, empirical formula
+// and molar mass of the SMILES.
+func (env *Env) FormatProductSMILESHandler(w http.ResponseWriter, r *http.Request) *models.AppError {
+	var (
+		err error
+		m   *smiles.Molecule
+	)
+
+	if err = r.ParseForm(); err != nil {
+		return &models.AppError{
+			OriginalError: err,
+			Message:       "form parsing",
+			Code:          http.StatusInternalServerError,
+		}
+	}
+
+	if m, err = smiles.Parse(r.Form.Get("smiles")); err != nil {
+		return &models.AppError{
+			OriginalError: err,
+			Message:       err.Error(),
+			Code:          http.StatusBadRequest,
+		}
+	}
+
+	c := m.Composition()
+	resp := struct {
+		CanonicalSMILES  string  `json:"canonicalsmiles"`
+		EmpiricalFormula string  `json:"empiricalformula"`
+		MolarMass        float64 `json:"molarmass"`
+	}{
+		CanonicalSMILES:  m.Canonical(),
+		EmpiricalFormula: c.Hill(),
+		MolarMass:        c.MolarMass(),
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	if err = json.NewEncoder(w).Encode(resp); err != nil {
+		return &models.AppError{
+			Code:    http.StatusInternalServerError,
+			Message: err.Error(),
+		}
+	}
+
+	return nil
+}
+
 // ValidateProductCasNumberHandler checks that:
 // - the cas number is valid
 // - a product with the cas number and specificity does not already exist.
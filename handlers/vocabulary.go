@@ -0,0 +1,422 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/mux"
+	"github.com/jmoiron/sqlx"
+	"github.com/sirupsen/logrus"
+	"github.com/tbellembois/gochimitheque-utils/convert"
+	"github.com/tbellembois/gochimitheque-utils/validator"
+	"github.com/tbellembois/gochimitheque/datastores"
+	"github.com/tbellembois/gochimitheque/logger"
+	"github.com/tbellembois/gochimitheque/models"
+	"github.com/tbellembois/gochimitheque/request"
+)
+
+// vocabulary are the operations on a reference vocabulary table.
+type vocabulary struct {
+	list   func(db *sqlx.DB, filter *request.Filter) (interface{}, int, error)
+	label  func(db *sqlx.DB, id int) (string, error)
+	rename func(db *sqlx.DB, id int, label string) error
+	merge  func(db *sqlx.DB, id int, intoID int) error
+	delete func(db *sqlx.DB, id int) error
+	// normalize returns the label as stored, or an error if it is not valid
+	normalize func(string) (string, error)
+}
+
+// vocabularyEntry is an entry of a vocabulary with its number of references.
+type vocabularyEntry[T models.Searchable] struct {
+	Entry  T   `json:"entry"`
+	Usages int `json:"usages"`
+}
+
+// vocabularyMerge is the body of the vocabulary merge request.
+type vocabularyMerge struct {
+	Into int `json:"into"` // the id of the entry kept
+}
+
+// vocabularyRename is the body of the vocabulary rename request.
+type vocabularyRename struct {
+	Label string `json:"label"`
+}
+
+// newVocabulary returns the vocabulary of the searchable table.
+// If tenant is not nil the entries of an entity catalog can only be merged
+// into an entry of the same catalog or of the shared one.
+func newVocabulary[T models.Searchable](searchable T, normalize func(string) (string, error), tenant func(T) sql.NullInt64) vocabulary {
+	return vocabulary{
+		list: func(db *sqlx.DB, filter *request.Filter) (interface{}, int, error) {
+			entries, count, err := datastores.GetByMany(searchable, db, filter)
+			if err != nil {
+				return nil, 0, err
+			}
+
+			ids := make([]int64, len(entries))
+			for i, e := range entries {
+				ids[i] = e.GetID()
+			}
+
+			usages, err := datastores.GetVocabularyUsages(searchable, db, ids)
+			if err != nil {
+				return nil, 0, err
+			}
+
+			rows := make([]vocabularyEntry[T], len(entries))
+			for i, e := range entries {
+				rows[i] = vocabularyEntry[T]{Entry: e, Usages: usages[e.GetID()]}
+			}
+
+			return rows, count, nil
+		},
+		label: func(db *sqlx.DB, id int) (string, error) {
+			var label string
+
+			err := db.Get(&label, fmt.Sprintf("SELECT %s FROM %s WHERE %s = ?", searchable.GetTextFieldName(), searchable.GetTableName(), searchable.GetIDFieldName()), id)
+
+			return label, err
+		},
+		rename: func(db *sqlx.DB, id int, label string) error {
+			return datastores.RenameVocabulary(searchable, db, id, label)
+		},
+		merge: func(db *sqlx.DB, id int, intoID int) error {
+			if tenant != nil {
+				e, err := datastores.GetByID(searchable, db, id)
+				if err != nil {
+					return err
+				}
+
+				into, err := datastores.GetByID(searchable, db, intoID)
+				if err != nil {
+					return err
+				}
+
+				if tenant(into).Valid && tenant(into) != tenant(e) {
+					return errVocabularyTenant
+				}
+			}
+
+			return datastores.MergeVocabulary(searchable, db, id, intoID)
+		},
+		delete: func(db *sqlx.DB, id int) error {
+			return datastores.DeleteVocabulary(searchable, db, id)
+		},
+		normalize: normalize,
+	}
+}
+
+var errVocabularyTenant = errors.New("an entry can not be merged into the catalog of another entity")
+
+// checkFormat returns a normalize function returning the label if valid is true for it.
+func checkFormat(valid func(string) bool) func(string) (string, error) {
+	return func(s string) (string, error) {
+		if !valid(s) {
+			return "", fmt.Errorf("invalid label %s", s)
+		}
+
+		return s, nil
+	}
+}
+
+// vocabularies are the reference vocabularies by request name.
+var vocabularies = map[string]vocabulary{
+	"names": newVocabulary(models.Name{}, func(s string) (string, error) {
+		return strings.ToUpper(s), nil
+	}, nil),
+	"casnumbers":        newVocabulary(models.CasNumber{}, checkFormat(validator.IsCasNumber), nil),
+	"cenumbers":         newVocabulary(models.CeNumber{}, checkFormat(validator.IsCeNumber), nil),
+	"empiricalformulas": newVocabulary(models.EmpiricalFormula{}, convert.ToEmpiricalFormula, nil),
+	"linearformulas":    newVocabulary(models.LinearFormula{}, nil, nil),
+	"tags":              newVocabulary(models.Tag{}, nil, nil),
+	"categories":        newVocabulary(models.Category{}, nil, nil),
+	"producers": newVocabulary(models.Producer{}, nil, func(p models.Producer) sql.NullInt64 {
+		return p.ProducerTenant
+	}),
+	"suppliers": newVocabulary(models.Supplier{}, nil, func(s models.Supplier) sql.NullInt64 {
+		return s.SupplierTenant
+	}),
+}
+
+// getVocabulary returns the vocabulary and entry id of the request vars,
+// only for admins.
+func (env *Env) getVocabulary(r *http.Request, withID bool) (vocabulary, int, *models.AppError) {
+	var (
+		id  int
+		err error
+	)
+
+	vars := mux.Vars(r)
+
+	c := request.ContainerFromRequestContext(r)
+
+	if aerr := env.checkAdmin(c.PersonID, "only admins can manage the vocabularies"); aerr != nil {
+		return vocabulary{}, 0, aerr
+	}
+
+	v, ok := vocabularies[vars["vocabulary"]]
+	if !ok {
+		return vocabulary{}, 0, &models.AppError{
+			Message: "unknown vocabulary " + vars["vocabulary"],
+			Code:    http.StatusNotFound,
+		}
+	}
+
+	if withID {
+		if id, err = strconv.Atoi(vars["id"]); err != nil {
+			return vocabulary{}, 0, &models.AppError{
+				OriginalError: err,
+				Message:       "id atoi conversion",
+				Code:          http.StatusInternalServerError,
+			}
+		}
+	}
+
+	return v, id, nil
+}
+
+/*
+	REST handlers
+*/
+
+// GetVocabularyHandler returns a json list of the entries of the requested vocabulary
+// with their number of references, only for admins.
+func (env *Env) GetVocabularyHandler(w http.ResponseWriter, r *http.Request) *models.AppError {
+	var (
+		v      vocabulary
+		filter *request.Filter
+		rows   interface{}
+		count  int
+		aerr   *models.AppError
+		err    error
+	)
+
+	if v, _, aerr = env.getVocabulary(r, false); aerr != nil {
+		return aerr
+	}
+
+	logger.Log.WithFields(logrus.Fields{"vocabulary": mux.Vars(r)["vocabulary"]}).Debug("GetVocabularyHandler")
+
+	if filter, aerr = request.NewFilter(r, v.normalize); aerr != nil {
+		// partial labels may not be valid, searching them as typed
+		if filter, aerr = request.NewFilter(r, nil); aerr != nil {
+			return aerr
+		}
+	}
+
+	if rows, count, err = v.list(env.DB.GetDB(), filter); err != nil {
+		return &models.AppError{
+			OriginalError: err,
+			Code:          http.StatusInternalServerError,
+			Message:       "error getting the vocabulary",
+		}
+	}
+
+	type resp struct {
+		Rows  interface{} `json:"rows"`
+		Total int         `json:"total"`
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+
+	if err = json.NewEncoder(w).Encode(resp{Rows: rows, Total: count}); err != nil {
+		return &models.AppError{
+			Code:    http.StatusInternalServerError,
+			Message: err.Error(),
+		}
+	}
+
+	return nil
+}
+
+// RenameVocabularyHandler sets the label of the requested vocabulary entry, only for admins.
+func (env *Env) RenameVocabularyHandler(w http.ResponseWriter, r *http.Request) *models.AppError {
+	var (
+		v        vocabulary
+		id       int
+		vr       vocabularyRename
+		oldlabel string
+		aerr     *models.AppError
+		err      error
+	)
+
+	if v, id, aerr = env.getVocabulary(r, true); aerr != nil {
+		return aerr
+	}
+
+	if err = json.NewDecoder(r.Body).Decode(&vr); err != nil {
+		return &models.AppError{
+			OriginalError: err,
+			Message:       "JSON decoding error",
+			Code:          http.StatusBadRequest,
+		}
+	}
+
+	logger.Log.WithFields(logrus.Fields{"vocabulary": mux.Vars(r)["vocabulary"], "id": id, "vr": vr}).Debug("RenameVocabularyHandler")
+
+	if vr.Label = strings.TrimSpace(vr.Label); vr.Label == "" {
+		return &models.AppError{
+			Message: "missing label",
+			Code:    http.StatusBadRequest,
+		}
+	}
+
+	if v.normalize != nil {
+		if vr.Label, err = v.normalize(vr.Label); err != nil {
+			return &models.AppError{
+				OriginalError: err,
+				Message:       "invalid label",
+				Code:          http.StatusBadRequest,
+			}
+		}
+	}
+
+	if oldlabel, err = v.label(env.DB.GetDB(), id); err != nil {
+		return &models.AppError{
+			OriginalError: err,
+			Message:       "entry not found",
+			Code:          http.StatusNotFound,
+		}
+	}
+
+	if err = v.rename(env.DB.GetDB(), id, vr.Label); err != nil {
+		if errors.Is(err, datastores.ErrVocabularyLabelExists) {
+			return &models.AppError{
+				OriginalError: err,
+				Message:       err.Error(),
+				Code:          http.StatusConflict,
+			}
+		}
+
+		return &models.AppError{
+			OriginalError: err,
+			Message:       "rename entry error",
+			Code:          http.StatusInternalServerError,
+		}
+	}
+
+	env.audit(r, "vocabulary_renamed", "", fmt.Sprintf("%s %d: %s -> %s", mux.Vars(r)["vocabulary"], id, oldlabel, vr.Label))
+
+	return nil
+}
+
+// MergeVocabularyHandler merges the requested vocabulary entry into the "into" entry
+// and deletes it, only for admins.
+func (env *Env) MergeVocabularyHandler(w http.ResponseWriter, r *http.Request) *models.AppError {
+	var (
+		v         vocabulary
+		id        int
+		vm        vocabularyMerge
+		label     string
+		intolabel string
+		aerr      *models.AppError
+		err       error
+	)
+
+	if v, id, aerr = env.getVocabulary(r, true); aerr != nil {
+		return aerr
+	}
+
+	if err = json.NewDecoder(r.Body).Decode(&vm); err != nil {
+		return &models.AppError{
+			OriginalError: err,
+			Message:       "JSON decoding error",
+			Code:          http.StatusBadRequest,
+		}
+	}
+
+	logger.Log.WithFields(logrus.Fields{"vocabulary": mux.Vars(r)["vocabulary"], "id": id, "vm": vm}).Debug("MergeVocabularyHandler")
+
+	if vm.Into == id {
+		return &models.AppError{
+			Message: "an entry can not be merged into itself",
+			Code:    http.StatusBadRequest,
+		}
+	}
+
+	if label, err = v.label(env.DB.GetDB(), id); err != nil {
+		return &models.AppError{
+			OriginalError: err,
+			Message:       "entry not found",
+			Code:          http.StatusNotFound,
+		}
+	}
+
+	if intolabel, err = v.label(env.DB.GetDB(), vm.Into); err != nil {
+		return &models.AppError{
+			OriginalError: err,
+			Message:       "target entry not found",
+			Code:          http.StatusNotFound,
+		}
+	}
+
+	if err = v.merge(env.DB.GetDB(), id, vm.Into); err != nil {
+		if errors.Is(err, errVocabularyTenant) {
+			return &models.AppError{
+				OriginalError: err,
+				Message:       err.Error(),
+				Code:          http.StatusBadRequest,
+			}
+		}
+
+		return &models.AppError{
+			OriginalError: err,
+			Message:       "merge entries error",
+			Code:          http.StatusInternalServerError,
+		}
+	}
+
+	env.audit(r, "vocabulary_merged", "", fmt.Sprintf("%s %d %s into %d %s", mux.Vars(r)["vocabulary"], id, label, vm.Into, intolabel))
+
+	return nil
+}
+
+// DeleteVocabularyHandler deletes the requested vocabulary entry if it is not used, only for admins.
+func (env *Env) DeleteVocabularyHandler(w http.ResponseWriter, r *http.Request) *models.AppError {
+	var (
+		v     vocabulary
+		id    int
+		label string
+		aerr  *models.AppError
+		err   error
+	)
+
+	if v, id, aerr = env.getVocabulary(r, true); aerr != nil {
+		return aerr
+	}
+
+	logger.Log.WithFields(logrus.Fields{"vocabulary": mux.Vars(r)["vocabulary"], "id": id}).Debug("DeleteVocabularyHandler")
+
+	if label, err = v.label(env.DB.GetDB(), id); err != nil {
+		return &models.AppError{
+			OriginalError: err,
+			Message:       "entry not found",
+			Code:          http.StatusNotFound,
+		}
+	}
+
+	if err = v.delete(env.DB.GetDB(), id); err != nil {
+		if errors.Is(err, datastores.ErrVocabularyInUse) {
+			return &models.AppError{
+				OriginalError: err,
+				Message:       err.Error(),
+				Code:          http.StatusConflict,
+			}
+		}
+
+		return &models.AppError{
+			OriginalError: err,
+			Message:       "delete entry error",
+			Code:          http.StatusInternalServerError,
+		}
+	}
+
+	env.audit(r, "vocabulary_deleted", "", fmt.Sprintf("%s %d %s", mux.Vars(r)["vocabulary"], id, label))
+
+	return nil
+}
@@ -84,6 +84,10 @@ var LOCALES_EN = []byte(`
 	one = "confirm password"
 [invalid_password]
 	one = "invalid password"
+[login_locked]
+	one = "too many failed logins, please retry later"
+[captcha_required]
+	one = "please solve the captcha"
 [invalid_email]
 	one = "invalid email"
 [not_same_password]
@@ -135,24 +139,52 @@ var LOCALES_EN = []byte(`
 	one = "a reinitialization link has been sent to %s"
 [resetpassword_areyourobot]
 	one = "are you a robot?"
-[resetpassword_mailbody1]
-	one = '''
-	This is your new temporary Chimithèque password: %s
-
-	You can change it in the application.
-	'''
-[resetpassword_mailsubject1]
-	one = "Chimithèque new temporary password\r\n"
 [resetpassword_mailbody2]
 	one = '''
-	Click on this link to reinitialize your password: %sreset?token=%s
+	A password reset has been requested for your Chimithèque account {{.Email}}.
+
+	Click on this link to choose a new password, it can be used once within {{.Validity}}: {{.URL}}
 
-	You will then receive a new mail with a temporary password.
+	If you did not request it, ignore this mail, your password is unchanged.
 	'''
 [resetpassword_mailsubject2]
 	one = "Chimithèque password reset link\r\n"
 [resetpassword_done]
-	one = "A new temporary password has been sent to %s"
+	one = "your password has been changed, please log in"
+[resetpassword_invalid_token]
+	one = "invalid or expired reset link, please request a new one"
+[resetpassword_newpassword_text]
+	one = "choose a new password"
+[password_policy_length]
+	one = "the password must contain at least {{.Length}} characters"
+[password_policy_classes]
+	one = "the password must contain at least {{.Classes}} characters types among lowercase letters, uppercase letters, digits and symbols"
+
+[savedsearch_mailsubject]
+	one = "Chimithèque saved search \"%s\" has new results\r\n"
+[savedsearch_mailbody]
+	one = '''
+	New products and storages match your saved search "%s":
+
+	%s
+
+	%s
+	'''
+
+[recall_mailsubject]
+	one = "Chimithèque batch recall: %s %s\r\n"
+[recall_mailbody]
+	one = '''
+	The batch %s of the product %s (supplier: %s) has been recalled.
+
+	%s
+
+	The following storages of the entities you manage are concerned:
+
+	%s
+
+	Please acknowledge the recall in Chimithèque: %s
+	'''
 
 [createperson_mailsubject]
 	one = "Chimithèque new account\r\n"
@@ -211,11 +243,23 @@ var LOCALES_EN = []byte(`
 	one = "borrowed storages"
 [s_storage_to_destroy]
 	one = "storages to destroy"
+[s_query]
+	one = "search query"
+[s_query_help]
+	one = "e.g. (H225 OR H226) AND location:\"building B\" AND NOT is:archived - qualifiers: name: cas: ce: formula: hs: ps: tag: category: state: location: entity: batch: barecode: supplier: quantity: entrydate: exitdate: openingdate: expirationdate: is:(cmr|restricted|radioactive|archived|todestroy|borrowed) - ranges: 10..100, >=10, 2020-01-01..2020-12-31"
+[s_savedsearch_name]
+	one = "saved search name"
+[s_savedsearch_subscribed]
+	one = "notify me by mail of the new matching products and storages"
+[savesearch_text]
+	one = "save search"
 
 [menu_home]
 	one = "home"
 [menu_bookmark]
 	one = "bookmarks"
+[menu_savedsearches]
+	one = "saved searches"
 [menu_scanqr]
 	one = "scan"
 [menu_borrow]
@@ -450,6 +494,16 @@ var LOCALES_EN = []byte(`
 	one = "number of units per carton"
 [product_number_per_bag_title]
 	one = "number of units per bag"
+[product_un_number_title]
+	one = "UN number"
+[adrclass_label_title]
+	one = "transport hazard class (ADR)"
+[product_packing_group_title]
+	one = "packing group"
+[product_hazard_labels_title]
+	one = "hazard labels"
+[product_transport_category_title]
+	one = "transport category"
 [producer_label_title]
 	one = "producer"
 [producerref_label_title]
@@ -518,6 +572,8 @@ var LOCALES_EN = []byte(`
 	one = "select or enter tag(s)"
 [product_category_placeholder]
 	one = "select or enter a category"
+[product_adrclass_placeholder]
+	one = "select an ADR class"
 [product_unit_placeholder]
 	one = "select a unit"
 [product_deleted_message]
@@ -559,12 +615,26 @@ var LOCALES_EN = []byte(`
 	one = "select all 'no permission'"
 [person_select_all_r_storage]
 	one = "select all 'view only'"
+[person_select_all_b_storage]
+	one = "select all 'view and borrow'"
 [person_select_all_rw_storage]
 	one = "select all 'view, modify, create and delete'"
 [person_show_password]
 	one = "show password field"
 [person_qrcode_regenerate]
 	one = "generate a new QRcode"
+[person_devicetoken_name]
+	one = "device name"
+[person_devicetoken_lastused]
+	one = "last used"
+[person_devicetoken_expiration]
+	one = "expiration"
+[person_devicetoken_revoke]
+	one = "revoke"
+[person_devicetoken_once]
+	one = "this QR code is shown only once, scan it with the device now"
+[person_devicetoken_none]
+	one = "no device"
 
 [permission_product]
 	one = "products"
@@ -576,6 +646,8 @@ var LOCALES_EN = []byte(`
 	one = "no permission"
 [permission_read]
 	one = "view only"
+[permission_borrow]
+	one = "view and borrow"
 [permission_crud]
 	one = "view, modify, create and delete"
 
@@ -84,6 +84,10 @@ var LOCALES_FR = []byte(`
 	one = "confirmer le mot de passe"
 [invalid_password]
 	one = "mauvais mot de passe"
+[login_locked]
+	one = "trop d'échecs de connexion, veuillez réessayer plus tard"
+[captcha_required]
+	one = "veuillez résoudre le captcha"
 [invalid_email]
 	one = "adresse email invalide"
 [not_same_password]
@@ -135,24 +139,52 @@ var LOCALES_FR = []byte(`
 	one = "un mail de réinitialisation a été envoyé à %s"
 [resetpassword_areyourobot]
 	one = "êtes vous un robot ?"
-[resetpassword_mailbody1]
-	one = '''
-	Voici votre mot de passe temporaire pour Chimithèque : %s
-
-	Vous pouvez le changer dans l'application.
-	'''
-[resetpassword_mailsubject1]
-	one = "Chimithèque nouveau mot de passe temporaire\r\n"
 [resetpassword_mailbody2]
 	one = '''
-	Cliquez sur ce lien pour réinitialiser votre mot de passe : %sreset?token=%s
+	Une réinitialisation du mot de passe de votre compte Chimithèque {{.Email}} a été demandée.
+
+	Cliquez sur ce lien pour choisir un nouveau mot de passe, il est utilisable une fois pendant {{.Validity}} : {{.URL}}
 
-	Vous recevrez ensuite un nouveau mail avec un mot de passe temporaire.
+	Si vous n'êtes pas à l'origine de cette demande, ignorez ce mail, votre mot de passe n'a pas été changé.
 	'''
 [resetpassword_mailsubject2]
 	one = "Chimithèque lien de réinitialisation de mot de passe\r\n"
 [resetpassword_done]
-	one = "Un nouveau mot de passe temporaire a été envoyé à %s"
+	one = "votre mot de passe a été changé, veuillez vous connecter"
+[resetpassword_invalid_token]
+	one = "lien de réinitialisation invalide ou expiré, veuillez en demander un nouveau"
+[resetpassword_newpassword_text]
+	one = "choisissez un nouveau mot de passe"
+[password_policy_length]
+	one = "le mot de passe doit contenir au moins {{.Length}} caractères"
+[password_policy_classes]
+	one = "le mot de passe doit contenir au moins {{.Classes}} types de caractères parmi minuscules, majuscules, chiffres et symboles"
+
+[savedsearch_mailsubject]
+	one = "Chimithèque : nouveaux résultats pour la recherche \"%s\"\r\n"
+[savedsearch_mailbody]
+	one = '''
+	De nouveaux produits et stockages correspondent à votre recherche enregistrée "%s" :
+
+	%s
+
+	%s
+	'''
+
+[recall_mailsubject]
+	one = "Chimithèque rappel de lot : %s %s\r\n"
+[recall_mailbody]
+	one = '''
+	Le lot %s du produit %s (fournisseur : %s) fait l'objet d'un rappel.
+
+	%s
+
+	Les stockages suivants des entités que vous gérez sont concernés :
+
+	%s
+
+	Merci de prendre connaissance du rappel dans Chimithèque : %s
+	'''
 
 [createperson_mailsubject]
 	one = "Chimithèque nouveau compte\r\n"
@@ -211,11 +243,23 @@ var LOCALES_FR = []byte(`
 	one = "stockages empruntés"
 [s_storage_to_destroy]
 	one = "stockages à détruire"
+[s_query]
+	one = "requête de recherche"
+[s_query_help]
+	one = "ex. (H225 OR H226) AND location:\"bâtiment B\" AND NOT is:archived - qualificatifs : name: cas: ce: formula: hs: ps: tag: category: state: location: entity: batch: barecode: supplier: quantity: entrydate: exitdate: openingdate: expirationdate: is:(cmr|restricted|radioactive|archived|todestroy|borrowed) - intervalles : 10..100, >=10, 2020-01-01..2020-12-31"
+[s_savedsearch_name]
+	one = "nom de la recherche enregistrée"
+[s_savedsearch_subscribed]
+	one = "me prévenir par mail des nouveaux produits et stockages correspondants"
+[savesearch_text]
+	one = "enregistrer la recherche"
 
 [menu_home]
 	one = "accueil"
 [menu_bookmark]
 	one = "favoris"
+[menu_savedsearches]
+	one = "recherches enregistrées"
 [menu_scanqr]
 	one = "scanner"
 [menu_borrow]
@@ -450,6 +494,16 @@ var LOCALES_FR = []byte(`
 	one = "nombre d'unités par carton"
 [product_number_per_bag_title]
 	one = "nombre d'unités par sachet"
+[product_un_number_title]
+	one = "numéro ONU"
+[adrclass_label_title]
+	one = "classe de danger (ADR)"
+[product_packing_group_title]
+	one = "groupe d'emballage"
+[product_hazard_labels_title]
+	one = "étiquettes de danger"
+[product_transport_category_title]
+	one = "catégorie de transport"
 [producer_label_title]
 	one = "fabriquant"
 [producerref_label_title]
@@ -518,6 +572,8 @@ var LOCALES_FR = []byte(`
 	one = "sélectionnez ou entrez un ou plusieurs tag(s)"
 [product_category_placeholder]
 	one = "sélectionnez ou entrez une catégorie"
+[product_adrclass_placeholder]
+	one = "sélectionnez une classe ADR"
 [product_unit_placeholder]
 	one = "sélectionnez une unité"
 [product_deleted_message]
@@ -559,12 +615,26 @@ var LOCALES_FR = []byte(`
 	one = "sélectionner tous les 'aucune permission'"
 [person_select_all_r_storage]
 	one = "sélectionner tous les 'voir seulement'"
+[person_select_all_b_storage]
+	one = "sélectionner tous les 'voir et emprunter'"
 [person_select_all_rw_storage]
 	one = "sélectionner tous les 'voir, modifier, créer et supprimer'"
 [person_show_password]
   	one = "afficher le champs mot de passe"
 [person_qrcode_regenerate]
 	one = "générer un nouveau QRcode"
+[person_devicetoken_name]
+	one = "nom de l'appareil"
+[person_devicetoken_lastused]
+	one = "dernière utilisation"
+[person_devicetoken_expiration]
+	one = "expiration"
+[person_devicetoken_revoke]
+	one = "révoquer"
+[person_devicetoken_once]
+	one = "ce QR code n'est affiché qu'une fois, scannez-le maintenant avec l'appareil"
+[person_devicetoken_none]
+	one = "aucun appareil"
 
 [permission_product]
 	one = "produits"
@@ -576,6 +646,8 @@ var LOCALES_FR = []byte(`
 	one = "aucune permission"
 [permission_read]
 	one = "voir seulement"
+[permission_borrow]
+	one = "voir et emprunter"
 [permission_crud]
 	one = "voir, modifier, créer et supprimer"
 
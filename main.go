@@ -1,6 +1,6 @@
 //go:build go1.21 && linux && amd64
 
-//go:generate jade -writer -basedir static/templates -d ./static/jade welcomeannounce/index.jade home/index.jade login/index.jade about/index.jade entity/index.jade entity/create.jade product/index.jade product/create.jade storage/index.jade storage/create.jade storelocation/index.jade storelocation/create.jade person/index.jade person/create.jade person/password.jade person/qrcode.jade search.jade menu.jade
+//go:generate jade -writer -basedir static/templates -d ./static/jade welcomeannounce/index.jade home/index.jade login/index.jade about/index.jade entity/index.jade entity/create.jade product/index.jade product/create.jade storage/index.jade storage/create.jade storelocation/index.jade storelocation/create.jade person/index.jade person/create.jade person/password.jade person/qrcode.jade reset/index.jade search.jade menu.jade
 //go:generate go run . -genlocalejs
 package main
 
@@ -9,12 +9,14 @@ package main
 import (
 	"database/sql"
 	"embed"
+	"encoding/hex"
 	"flag"
 	"fmt"
 	"net/http"
 	"os"
 	"path"
 	"strings"
+	"time"
 
 	"github.com/gorilla/mux"
 	"github.com/sirupsen/logrus"
@@ -35,6 +37,9 @@ var (
 	paramDBPath,
 	paramAdminList,
 	paramLogFile,
+	paramTokenSignKey,
+	paramReportSignKey,
+	paramTrustedProxies,
 	commandImportFrom,
 	commandMailTest,
 	commandLDAPSearchUserTest,
@@ -45,7 +50,18 @@ var (
 	paramDebug,
 	commandVersion,
 	commandGenLocaleJS,
-	paramDisableCache *bool
+	paramMultiTenant,
+	paramDisableCache,
+	paramTOTPAdmins *bool
+	paramSavedSearchesNotifyInterval,
+	paramAccessTokenTTL,
+	paramSessionTTL,
+	paramDeviceTokenTTL,
+	paramLoginCaptchaFailures,
+	paramLoginLockoutFailures,
+	paramLoginLockoutDuration,
+	paramPasswordMinLength,
+	paramPasswordMinClasses *int
 	BuildID string
 
 	//go:embed wasm/*
@@ -70,6 +86,8 @@ func init() {
 	flagDBPath := flag.String("dbpath", "./", "the application sqlite directory path")
 	flagAppURL := flag.String("appurl", "http://localhost:8081", "the application url (without the path), with NO trailing /")
 	flagAppPath := flag.String("apppath", "/", "the application path with the trailing /")
+	flagCORSOrigins := flag.String("corsorigins", "", "the additional origins allowed to send cross origin requests (comma separated, ex: https://foo.local,https://bar.local) (optional)")
+	flagTrustedProxies := flag.String("trustedproxies", "", "the reverse proxies IP addresses or networks (comma separated, ex: 127.0.0.1,10.0.0.0/8) whose X-Real-IP and X-Forwarded-For headers give the client IP (optional)")
 	flagDockerPort := flag.Int("dockerport", 0, "application listen port while running in docker")
 
 	flagMailServerAddress := flag.String("mailserveraddress", "localhost", "the mail server address")
@@ -78,6 +96,8 @@ func init() {
 	flagMailServerUseTLS := flag.Bool("mailserverusetls", false, "use SMTP TLS? (optional)")
 	flagMailServerTLSSkipVerify := flag.Bool("mailservertlsskipverify", false, "skip SMTP TLS verification? (optional)")
 	flagPublicProductsEndpoint := flag.Bool("enablepublicproductsendpoint", false, "enable public products endpoint (optional)")
+	flagMultiTenant := flag.Bool("multitenant", false, "isolate the entities product cards, suppliers and producers, except the shared catalog ones (optional)")
+	flagSavedSearchesNotifyInterval := flag.Int("savedsearchesnotifyinterval", 60, "saved searches subscribers notification interval in minutes, 0 to disable (optional)")
 
 	flagLDAPServerURL := flag.String("ldapserverurl", "", "the LDAP server address - ex: ldaps://192.168.1.50:636/ou=users,dc=foo,dc=local")
 	flagLDAPServerUsername := flag.String("ldapserverusername", "", "the LDAP server username - ex: CN=adminro,OU=FOO,OU=local,OU=users,DC=foo,DC=local")
@@ -87,6 +107,17 @@ func init() {
 	flagLDAPUserSearchBaseDN := flag.String("ldapusersearchbasedn", "", "the LDAP user search base DN - ex: OU=users,DC=foo,DC=local")
 	flagLDAPUserSearchFilter := flag.String("ldapusersearchfilter", "", "the LDAP user search filter - ex: (&(mail=%s)(objectclass=user))")
 	flagAutoCreateUser := flag.Bool("autocreateuser", false, "auto create user if proxy authentication is used")
+	flagTokenSignKey := flag.String("tokensignkey", "", "the hex encoded JWT signing key, generated and stored in the dbpath token.key file if not set (optional)")
+	flagReportSignKey := flag.String("reportsignkey", "", "the hex encoded controlled registers reports signing key, generated and stored in the dbpath report.key file if not set (optional)")
+	flagAccessTokenTTL := flag.Int("accesstokenttl", 15, "access token lifetime in minutes (optional)")
+	flagSessionTTL := flag.Int("sessionttl", 168, "lifetime in hours of a session not refreshed (optional)")
+	flagDeviceTokenTTL := flag.Int("devicetokenttl", 90, "lifetime in days of the devices QR code login tokens (optional)")
+	flagLoginCaptchaFailures := flag.Int("logincaptchafailures", 3, "failed logins of an account before requiring a captcha, 4 times more for a client IP (optional)")
+	flagLoginLockoutFailures := flag.Int("loginlockoutfailures", 5, "failed logins of an account before locking it out, 4 times more for a client IP (optional)")
+	flagPasswordMinLength := flag.Int("passwordminlength", 8, "minimum length of the local accounts passwords (optional)")
+	flagPasswordMinClasses := flag.Int("passwordminclasses", 2, "minimum number of characters classes (lowercase, uppercase, digits, symbols) of the local accounts passwords (optional)")
+	flagTOTPAdmins := flag.Bool("totpadmins", false, "require a TOTP second factor for the admins (optional)")
+	flagLoginLockoutDuration := flag.Int("loginlockoutduration", 1, "first lockout duration in minutes, doubled with each new failure (optional)")
 
 	flagAdminList := flag.String("admins", "", "the additional admins (comma separated email adresses) (optional) ")
 	flagLogFile := flag.String("logfile", "", "log to the given file (optional)")
@@ -108,6 +139,7 @@ func init() {
 
 	env.AppURL = *flagAppURL
 	env.AppPath = *flagAppPath
+	env.CORSOrigins = handlers.ParseOrigins(*flagCORSOrigins)
 	env.DockerPort = *flagDockerPort
 	env.AutoCreateUser = *flagAutoCreateUser
 	ldap.LDAPServerURL = *flagLDAPServerURL
@@ -124,10 +156,24 @@ func init() {
 	mailer.MailServerUseTLS = *flagMailServerUseTLS
 	mailer.MailServerTLSSkipVerify = *flagMailServerTLSSkipVerify
 	paramPublicProductsEndpoint = flagPublicProductsEndpoint
+	paramMultiTenant = flagMultiTenant
 	paramAdminList = flagAdminList
 	paramLogFile = flagLogFile
 	paramDebug = flagDebug
 	paramDisableCache = flagDisableCache
+	paramSavedSearchesNotifyInterval = flagSavedSearchesNotifyInterval
+	paramTokenSignKey = flagTokenSignKey
+	paramReportSignKey = flagReportSignKey
+	paramTrustedProxies = flagTrustedProxies
+	paramAccessTokenTTL = flagAccessTokenTTL
+	paramSessionTTL = flagSessionTTL
+	paramDeviceTokenTTL = flagDeviceTokenTTL
+	paramLoginCaptchaFailures = flagLoginCaptchaFailures
+	paramLoginLockoutFailures = flagLoginLockoutFailures
+	paramLoginLockoutDuration = flagLoginLockoutDuration
+	paramTOTPAdmins = flagTOTPAdmins
+	paramPasswordMinLength = flagPasswordMinLength
+	paramPasswordMinClasses = flagPasswordMinClasses
 
 	commandResetAdminPassword = flagResetAdminPassword
 	commandUpdateQRCode = flagUpdateQRCode
@@ -202,9 +248,57 @@ func initDB() {
 	logger.Log.Info("- running maintenance job")
 	datastore.Maintenance()
 
+	datastore.SetMultiTenant(*paramMultiTenant)
+
 	env.DB = datastore
 }
 
+func initAuth() {
+	var err error
+
+	env.AccessTokenTTL = time.Duration(*paramAccessTokenTTL) * time.Minute
+	env.SessionTTL = time.Duration(*paramSessionTTL) * time.Hour
+	env.DeviceTokenTTL = time.Duration(*paramDeviceTokenTTL) * 24 * time.Hour
+	env.LoginCaptchaFailures = *paramLoginCaptchaFailures
+	env.LoginLockoutFailures = *paramLoginLockoutFailures
+	env.LoginLockoutDuration = time.Duration(*paramLoginLockoutDuration) * time.Minute
+	env.TOTPAdmins = *paramTOTPAdmins
+	env.PasswordMinLength = *paramPasswordMinLength
+	env.PasswordMinClasses = *paramPasswordMinClasses
+
+	if env.TrustedProxies, err = handlers.ParseTrustedProxies(*paramTrustedProxies); err != nil {
+		logger.Log.Fatal(err)
+	}
+
+	env.TokenSignKey = loadSignKey(*paramTokenSignKey, "token.key")
+	env.ReportSignKey = loadSignKey(*paramReportSignKey, "report.key")
+}
+
+// loadSignKey returns the hex encoded signing key hexKey if set,
+// or the key stored in the file name of the database directory.
+func loadSignKey(hexKey string, name string) []byte {
+	var (
+		k   []byte
+		err error
+	)
+
+	if hexKey != "" {
+		if k, err = hex.DecodeString(hexKey); err != nil {
+			logger.Log.Fatal(err)
+		}
+
+		return k
+	}
+
+	keyfile := path.Join(*paramDBPath, name)
+	logger.Log.Info("- loading signing key from " + keyfile)
+	if k, err = handlers.LoadSignKey(keyfile); err != nil {
+		logger.Log.Fatal(err)
+	}
+
+	return k
+}
+
 func initAdmins() {
 	var (
 		err           error
@@ -306,6 +400,8 @@ func main() {
 
 	initDB()
 
+	initAuth()
+
 	initLDAP()
 
 	// Advanced commands.
@@ -402,6 +498,10 @@ func main() {
 
 	env.Enforcer = casbin.InitCasbinPolicy(env.DB)
 
+	if *paramSavedSearchesNotifyInterval > 0 {
+		go env.RunSavedSearchesNotifier(time.Duration(*paramSavedSearchesNotifyInterval) * time.Minute)
+	}
+
 	var listenAddr string
 	if env.DockerPort != 0 {
 		listenAddr = fmt.Sprintf(":%d", env.DockerPort)
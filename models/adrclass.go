@@ -0,0 +1,33 @@
+package models
+
+import "database/sql"
+
+// AdrClass is a product transport (ADR) hazard class.
+type AdrClass struct {
+	C                   int            `db:"c" json:"c"` // not stored in db but db:"c" set for sqlx
+	AdrClassID          sql.NullInt64  `db:"adrclass_id" json:"adrclass_id" schema:"adrclass_id" `
+	AdrClassLabel       sql.NullString `db:"adrclass_label" json:"adrclass_label" schema:"adrclass_label" `
+	AdrClassDescription sql.NullString `db:"adrclass_description" json:"adrclass_description" schema:"adrclass_description" `
+}
+
+func (adrclass AdrClass) SetC(count int) Searchable {
+	adrclass.C = count
+
+	return adrclass
+}
+
+func (adrclass AdrClass) GetTableName() string {
+	return ("adrclass")
+}
+
+func (adrclass AdrClass) GetIDFieldName() string {
+	return ("adrclass_id")
+}
+
+func (adrclass AdrClass) GetTextFieldName() string {
+	return ("adrclass_label")
+}
+
+func (adrclass AdrClass) GetID() int64 {
+	return adrclass.AdrClassID.Int64
+}
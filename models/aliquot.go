@@ -0,0 +1,23 @@
+package models
+
+import "database/sql"
+
+// Aliquot is a part of a storage to be split into a new storage.
+type Aliquot struct {
+	StorageQuantity float64 `json:"storage_quantity"` // in the source storage unit
+	StoreLocationID int64   `json:"storelocation_id"`
+}
+
+// StorageLineage is a storage with the aliquots split from it.
+type StorageLineage struct {
+	StorageID             int64             `db:"storage_id" json:"storage_id"`
+	StorageParentID       sql.NullInt64     `db:"storage_parent" json:"storage_parent"`
+	StorageBarecode       sql.NullString    `db:"storage_barecode" json:"storage_barecode"`
+	StorageBatchNumber    sql.NullString    `db:"storage_batchnumber" json:"storage_batchnumber"`
+	StorageQuantity       sql.NullFloat64   `db:"storage_quantity" json:"storage_quantity"`
+	StorageArchive        sql.NullBool      `db:"storage_archive" json:"storage_archive"`
+	UnitLabel             sql.NullString    `db:"unit_label" json:"unit_label"`
+	StoreLocationFullPath sql.NullString    `db:"storelocation_fullpath" json:"storelocation_fullpath"`
+	StorageCurrent        bool              `db:"-" json:"storage_current"` // the requested storage
+	Children              []*StorageLineage `db:"-" json:"children"`
+}
@@ -0,0 +1,14 @@
+package models
+
+import "time"
+
+// AuditLog is a security event.
+type AuditLog struct {
+	AuditLogID          int       `db:"auditlog_id" json:"auditlog_id"`
+	AuditLogDate        time.Time `db:"auditlog_date" json:"auditlog_date"`
+	AuditLogEvent       string    `db:"auditlog_event" json:"auditlog_event"`             // login_lockout, login_unlock...
+	AuditLogPersonEmail string    `db:"auditlog_personemail" json:"auditlog_personemail"` // the concerned account if any
+	AuditLogIP          string    `db:"auditlog_ip" json:"auditlog_ip"`
+	AuditLogDetails     string    `db:"auditlog_details" json:"auditlog_details"`
+	AuditLogAuthor      string    `db:"auditlog_author" json:"auditlog_author"` // the email of the person who triggered the event if any
+}
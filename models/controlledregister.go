@@ -0,0 +1,124 @@
+package models
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Products regulatory classifications requiring a controlled substances register.
+const (
+	RegulationPrecursor1   = "precursor1" // drug precursors categories
+	RegulationPrecursor2   = "precursor2"
+	RegulationPrecursor3   = "precursor3"
+	RegulationCWC1         = "cwc1" // chemical weapons convention schedules
+	RegulationCWC2         = "cwc2"
+	RegulationCWC3         = "cwc3"
+	RegulationNarcotic     = "narcotic"
+	RegulationPsychotropic = "psychotropic"
+)
+
+// ProductRegulations are the products regulatory classifications.
+var ProductRegulations = []string{
+	RegulationPrecursor1,
+	RegulationPrecursor2,
+	RegulationPrecursor3,
+	RegulationCWC1,
+	RegulationCWC2,
+	RegulationCWC3,
+	RegulationNarcotic,
+	RegulationPsychotropic,
+}
+
+// Controlled substances register events.
+const (
+	RegisterAcquisition = "acquisition"
+	RegisterUse         = "use"
+	RegisterAdjustment  = "adjustment"
+	RegisterTransfer    = "transfer"
+	RegisterArchive     = "archive"
+	RegisterRestore     = "restore"
+	RegisterDestruction = "destruction"
+	RegisterSplit       = "split"
+	RegisterPreparation = "preparation"
+	RegisterMerge       = "merge"
+	RegisterInventory   = "inventory" // storages of a newly classified product
+)
+
+// ControlledRegisterEntry is an entry of the append-only controlled substances
+// register of an entity, chained to the previous entry of the entity by its hash.
+type ControlledRegisterEntry struct {
+	ControlledRegisterID           int            `db:"controlledregister_id" json:"controlledregister_id"`
+	ControlledRegisterSequence     int            `db:"controlledregister_sequence" json:"controlledregister_sequence"` // from 1 for each entity
+	ControlledRegisterDate         time.Time      `db:"controlledregister_date" json:"controlledregister_date"`
+	ControlledRegisterEvent        string         `db:"controlledregister_event" json:"controlledregister_event"`
+	EntityID                       int            `db:"controlledregister_entity" json:"entity_id"`
+	EntityName                     string         `db:"controlledregister_entityname" json:"entity_name"`
+	StorageID                      int64          `db:"controlledregister_storage" json:"storage_id"` // the storage may have been deleted
+	StorageBarecode                sql.NullString `db:"controlledregister_barecode" json:"storage_barecode"`
+	ProductID                      int            `db:"controlledregister_product" json:"product_id"`
+	ProductName                    string         `db:"controlledregister_productname" json:"product_name"`
+	ProductRegulation              string         `db:"controlledregister_regulation" json:"product_regulation"`
+	ControlledRegisterQuantity     float64        `db:"controlledregister_quantity" json:"controlledregister_quantity"` // negative for an outgoing quantity
+	UnitLabel                      string         `db:"controlledregister_unit" json:"unit_label"`
+	ControlledRegisterBalance      float64        `db:"controlledregister_balance" json:"controlledregister_balance"` // of the product in the unit in the entity
+	PersonEmail                    string         `db:"controlledregister_personemail" json:"person_email"`
+	ControlledRegisterPreviousHash string         `db:"controlledregister_previoushash" json:"controlledregister_previoushash"`
+	ControlledRegisterHash         string         `db:"controlledregister_hash" json:"controlledregister_hash"`
+}
+
+// ControlledRegisterBalance is the balance of a product in a unit in an entity register.
+type ControlledRegisterBalance struct {
+	ProductID         int     `db:"controlledregister_product" json:"product_id"`
+	ProductName       string  `db:"controlledregister_productname" json:"product_name"`
+	ProductRegulation string  `db:"controlledregister_regulation" json:"product_regulation"`
+	UnitLabel         string  `db:"controlledregister_unit" json:"unit_label"`
+	Balance           float64 `db:"controlledregister_balance" json:"balance"`
+}
+
+// ControlledRegisterCheck is the result of the verification of the hash chain of an entity register.
+type ControlledRegisterCheck struct {
+	Valid          bool   `json:"valid"`
+	Entries        int    `json:"entries"`
+	BrokenSequence int    `json:"broken_sequence,omitempty"` // the first invalid entry
+	LastHash       string `json:"last_hash"`
+}
+
+// IsProductRegulation returns true if r is a known regulatory classification.
+func IsProductRegulation(r string) bool {
+	for _, pr := range ProductRegulations {
+		if pr == r {
+			return true
+		}
+	}
+
+	return false
+}
+
+// ComputeHash returns the hex encoded SHA-256 of the entry fields and previous hash.
+func (e ControlledRegisterEntry) ComputeHash() string {
+	fields := []string{
+		e.ControlledRegisterPreviousHash,
+		strconv.Itoa(e.ControlledRegisterSequence),
+		e.ControlledRegisterDate.UTC().Format(time.RFC3339Nano),
+		e.ControlledRegisterEvent,
+		strconv.Itoa(e.EntityID),
+		e.EntityName,
+		strconv.FormatInt(e.StorageID, 10),
+		e.StorageBarecode.String,
+		strconv.Itoa(e.ProductID),
+		e.ProductName,
+		e.ProductRegulation,
+		strconv.FormatFloat(e.ControlledRegisterQuantity, 'f', -1, 64),
+		e.UnitLabel,
+		strconv.FormatFloat(e.ControlledRegisterBalance, 'f', -1, 64),
+		e.PersonEmail,
+	}
+
+	h := sha256.Sum256([]byte(strings.Join(fields, "\x1f")))
+
+	return hex.EncodeToString(h[:])
+}
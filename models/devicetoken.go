@@ -0,0 +1,24 @@
+package models
+
+import (
+	"database/sql"
+	"time"
+)
+
+// DeviceToken is a signed login token of a person device,
+// shown as a QR code and scanned by the mobile application.
+type DeviceToken struct {
+	DeviceTokenID             int          `db:"devicetoken_id" json:"devicetoken_id"`
+	DeviceTokenUID            string       `db:"devicetoken_uid" json:"-"`  // the token prefix
+	DeviceTokenHash           string       `db:"devicetoken_hash" json:"-"` // sha256 of the token secret
+	DeviceTokenName           string       `db:"devicetoken_name" json:"devicetoken_name"`
+	DeviceTokenCreationDate   time.Time    `db:"devicetoken_creationdate" json:"devicetoken_creationdate"`
+	DeviceTokenExpirationDate time.Time    `db:"devicetoken_expirationdate" json:"devicetoken_expirationdate"`
+	DeviceTokenLastUsedDate   sql.NullTime `db:"devicetoken_lastuseddate" json:"devicetoken_lastuseddate"`
+	Person                    `db:"person" json:"person"`
+}
+
+// IsExpired returns true if the token can not be used anymore.
+func (t DeviceToken) IsExpired() bool {
+	return time.Now().After(t.DeviceTokenExpirationDate)
+}
@@ -0,0 +1,21 @@
+package models
+
+import (
+	"database/sql"
+	"time"
+)
+
+// LoginFailure is the count of the failed authentications
+// of an account or of a client IP.
+type LoginFailure struct {
+	LoginFailureKind        string       `db:"loginfailure_kind" json:"loginfailure_kind"` // "email" or "ip"
+	LoginFailureValue       string       `db:"loginfailure_value" json:"loginfailure_value"`
+	LoginFailureCount       int          `db:"loginfailure_count" json:"loginfailure_count"`
+	LoginFailureLastDate    time.Time    `db:"loginfailure_lastdate" json:"loginfailure_lastdate"`
+	LoginFailureLockedUntil sql.NullTime `db:"loginfailure_lockeduntil" json:"loginfailure_lockeduntil"`
+}
+
+// IsLocked returns true if the account or client IP is locked out at the time t.
+func (f LoginFailure) IsLocked(t time.Time) bool {
+	return f.LoginFailureLockedUntil.Valid && t.Before(f.LoginFailureLockedUntil.Time)
+}
@@ -28,3 +28,7 @@ func (name Name) GetTextFieldName() string {
 func (name Name) GetID() int64 {
 	return int64(name.NameID)
 }
+
+func (name Name) GetFTSTableName() string {
+	return ("namefts")
+}
@@ -0,0 +1,16 @@
+package models
+
+import "time"
+
+// PasswordReset is a single use password reset link of a person.
+type PasswordReset struct {
+	PasswordResetID             int       `db:"passwordreset_id" json:"passwordreset_id"`
+	PasswordResetHash           string    `db:"passwordreset_hash" json:"-"` // sha256 of the link token
+	PasswordResetExpirationDate time.Time `db:"passwordreset_expirationdate" json:"passwordreset_expirationdate"`
+	PersonID                    int       `db:"person" json:"person_id"`
+}
+
+// IsExpired returns true if the link can not be used anymore.
+func (pr PasswordReset) IsExpired() bool {
+	return time.Now().After(pr.PasswordResetExpirationDate)
+}
@@ -15,3 +15,13 @@ func (p1 Permission) Equal(p2 Permission) bool {
 		p1.PermissionItemName == p2.PermissionItemName &&
 		p1.PermissionEntityID == p2.PermissionEntityID)
 }
+
+// PermissionCheck is a permission asked for by the UI
+// and the decision.
+type PermissionCheck struct {
+	Action  string `json:"action"`           // r, w (create/update), d (delete) or b (borrow)
+	Item    string `json:"item"`             // ex: storages
+	ItemID  string `json:"item_id"`          // an int, -1, -2 or ""
+	Allowed bool   `json:"allowed"`          // set by the server
+	Reason  string `json:"reason,omitempty"` // set by the server if not allowed
+}
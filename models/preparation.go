@@ -0,0 +1,37 @@
+package models
+
+import (
+	"database/sql"
+	"time"
+)
+
+// Preparation is a solution prepared from source storages,
+// the prepared storage holds the final volume and concentration.
+type Preparation struct {
+	PreparationID      int            `db:"preparation_id" json:"preparation_id"`
+	PreparationDate    time.Time      `db:"preparation_date" json:"preparation_date"`
+	PreparationSolvent string         `db:"preparation_solvent" json:"preparation_solvent"`
+	PreparationComment sql.NullString `db:"preparation_comment" json:"preparation_comment"`
+	StorageID          int64          `db:"storage" json:"storage_id"` // the prepared storage
+	Person             `db:"person" json:"person"`
+	Sources            []PreparationSource `db:"-" json:"sources"`
+
+	// hazards of the sources products, the signal word is the most severe
+	Symbols                 []Symbol                 `db:"-" json:"symbols"`
+	HazardStatements        []HazardStatement        `db:"-" json:"hazardstatements"`
+	PrecautionaryStatements []PrecautionaryStatement `db:"-" json:"precautionarystatements"`
+	SignalWord              SignalWord               `db:"-" json:"signalword"`
+}
+
+// PreparationSource is a storage quantity used for a preparation,
+// described by value as the storage may be deleted.
+type PreparationSource struct {
+	PreparationSourceID          int           `db:"preparationsource_id" json:"preparationsource_id"`
+	PreparationSourceQuantity    float64       `db:"preparationsource_quantity" json:"preparationsource_quantity"` // in the storage unit
+	PreparationSourceUnit        string        `db:"preparationsource_unit" json:"preparationsource_unit"`
+	PreparationSourceBarecode    string        `db:"preparationsource_barecode" json:"preparationsource_barecode"`
+	PreparationSourceBatchNumber string        `db:"preparationsource_batchnumber" json:"preparationsource_batchnumber"`
+	PreparationSourceProductName string        `db:"preparationsource_productname" json:"preparationsource_productname"`
+	StorageID                    sql.NullInt64 `db:"storage" json:"storage_id"`
+	ProductID                    sql.NullInt64 `db:"product" json:"product_id"`
+}
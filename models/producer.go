@@ -4,7 +4,30 @@ import "database/sql"
 
 // Producer is a product producer.
 type Producer struct {
-	C             int            `db:"c" json:"c"` // not stored in db but db:"c" set for sqlx
-	ProducerID    sql.NullInt64  `db:"producer_id" json:"producer_id" schema:"producer_id" `
-	ProducerLabel sql.NullString `db:"producer_label" json:"producer_label" schema:"producer_label" `
+	C              int            `db:"c" json:"c"` // not stored in db but db:"c" set for sqlx
+	ProducerID     sql.NullInt64  `db:"producer_id" json:"producer_id" schema:"producer_id" `
+	ProducerLabel  sql.NullString `db:"producer_label" json:"producer_label" schema:"producer_label" `
+	ProducerTenant sql.NullInt64  `db:"producer_tenant" json:"producer_tenant" schema:"producer_tenant" ` // multi-tenant mode: owner entity id, NULL for the shared catalog
+}
+
+func (producer Producer) SetC(count int) Searchable {
+	producer.C = count
+
+	return producer
+}
+
+func (producer Producer) GetTableName() string {
+	return ("producer")
+}
+
+func (producer Producer) GetIDFieldName() string {
+	return ("producer_id")
+}
+
+func (producer Producer) GetTextFieldName() string {
+	return ("producer_label")
+}
+
+func (producer Producer) GetID() int64 {
+	return producer.ProducerID.Int64
 }
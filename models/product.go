@@ -7,6 +7,7 @@ import (
 	"strconv"
 	"strings"
 
+	"github.com/tbellembois/gochimitheque/formula"
 	"github.com/tbellembois/gochimitheque/logger"
 )
 
@@ -37,8 +38,35 @@ type Product struct {
 	Name                   `db:"name" json:"name" schema:"name"`
 	ProducerRef            `db:"producerref" json:"producerref" schema:"producerref"`
 	Category               `db:"category" json:"category" schema:"category"`
+	AdrClass               `db:"adrclass" json:"adrclass" schema:"adrclass"`
 	UnitTemperature        Unit `db:"unit_temperature" json:"unit_temperature" schema:"unit_temperature"`
 
+	// transport informations
+	ProductUNNumber          sql.NullString `db:"product_un_number" json:"product_un_number" schema:"product_un_number" `
+	ProductPackingGroup      sql.NullString `db:"product_packing_group" json:"product_packing_group" schema:"product_packing_group" `
+	ProductHazardLabels      sql.NullString `db:"product_hazard_labels" json:"product_hazard_labels" schema:"product_hazard_labels" `
+	ProductTransportCategory sql.NullInt64  `db:"product_transport_category" json:"product_transport_category" schema:"product_transport_category" `
+
+	// physical properties, for the units conversions
+	ProductDensity   sql.NullFloat64 `db:"product_density" json:"product_density" schema:"product_density" `       // g/mL
+	ProductMolarMass sql.NullFloat64 `db:"product_molarmass" json:"product_molarmass" schema:"product_molarmass" ` // g/mol
+
+	// chemical structure identifiers
+	ProductSMILES          sql.NullString `db:"product_smiles" json:"product_smiles" schema:"product_smiles" `
+	ProductCanonicalSMILES sql.NullString `db:"product_canonicalsmiles" json:"product_canonicalsmiles" schema:"product_canonicalsmiles" `
+	ProductInChI           sql.NullString `db:"product_inchi" json:"product_inchi" schema:"product_inchi" `
+	ProductInChIKey        sql.NullString `db:"product_inchikey" json:"product_inchikey" schema:"product_inchikey" `
+
+	// regulatory classification, precursor1, cwc2, narcotic...
+	// the storages of the classified products are recorded in the controlled substances register
+	ProductRegulation sql.NullString `db:"product_regulation" json:"product_regulation" schema:"product_regulation" `
+
+	// formulas inconsistencies found when saving the product
+	ProductWarnings []string `db:"-" json:"product_warnings,omitempty" schema:"-"`
+
+	// multi-tenant mode: owner entity id, NULL for the shared catalog
+	ProductTenant sql.NullInt64 `db:"product_tenant" json:"product_tenant" schema:"product_tenant" `
+
 	ClassOfCompound         []ClassOfCompound        `db:"-" schema:"classofcompound" json:"classofcompound"`
 	Synonyms                []Name                   `db:"-" schema:"synonyms" json:"synonyms"`
 	Symbols                 []Symbol                 `db:"-" schema:"symbols" json:"symbols"`
@@ -124,6 +152,40 @@ func (p Product) ProductToStringSlice() []string {
 	ret = append(ret, strconv.FormatBool(p.ProductRestricted.Bool))
 	ret = append(ret, strconv.FormatBool(p.ProductRadioactive.Bool))
 
+	ret = append(ret, p.ProductUNNumber.String)
+	ret = append(ret, p.AdrClassLabel.String)
+	ret = append(ret, p.ProductPackingGroup.String)
+	ret = append(ret, p.ProductHazardLabels.String)
+
+	if p.ProductTransportCategory.Valid {
+		ret = append(ret, strconv.FormatInt(p.ProductTransportCategory.Int64, 10))
+	} else {
+		ret = append(ret, "")
+	}
+
+	if p.ProductDensity.Valid {
+		ret = append(ret, strconv.FormatFloat(p.ProductDensity.Float64, 'f', -1, 64))
+	} else {
+		ret = append(ret, "")
+	}
+
+	if p.ProductMolarMass.Valid {
+		ret = append(ret, strconv.FormatFloat(p.ProductMolarMass.Float64, 'f', -1, 64))
+	} else {
+		ret = append(ret, "")
+	}
+
+	if c, err := formula.Parse(p.EmpiricalFormulaLabel.String); err == nil {
+		ret = append(ret, c.Hill())
+	} else {
+		ret = append(ret, "")
+	}
+
+	ret = append(ret, p.ProductSMILES.String)
+	ret = append(ret, p.ProductInChI.String)
+	ret = append(ret, p.ProductInChIKey.String)
+	ret = append(ret, p.ProductRegulation.String)
+
 	return ret
 }
 
@@ -151,6 +213,18 @@ func ProductsToCSV(prs []Product) string {
 		"disposal_comment",
 		"restricted?",
 		"radioactive?",
+		"un_number",
+		"adr_class",
+		"packing_group",
+		"hazard_labels",
+		"transport_category",
+		"density",
+		"molar_mass",
+		"hill_formula",
+		"smiles",
+		"inchi",
+		"inchikey",
+		"regulation",
 	}
 
 	// create a temp file
@@ -0,0 +1,35 @@
+package models
+
+import (
+	"database/sql"
+	"time"
+)
+
+// ProductDuplicate is a pair of products that may be duplicates,
+// with the criteria they match.
+type ProductDuplicate struct {
+	ProductID            int            `db:"product_id" json:"product_id"`
+	NameLabel            string         `db:"name_label" json:"name_label"`
+	ProductSpecificity   sql.NullString `db:"product_specificity" json:"product_specificity"`
+	CasNumberLabel       sql.NullString `db:"casnumber_label" json:"casnumber_label"`
+	DuplicateID          int            `db:"duplicate_id" json:"duplicate_id"`
+	DuplicateNameLabel   string         `db:"duplicate_name_label" json:"duplicate_name_label"`
+	DuplicateCasNumber   sql.NullString `db:"duplicate_casnumber_label" json:"duplicate_casnumber_label"`
+	DuplicateCriteriaCSV string         `db:"duplicate_criteria" json:"-"`
+	// name, synonym, casnumber, empiricalformula, producerref
+	DuplicateCriteria []string `db:"-" json:"duplicate_criteria"`
+}
+
+// ProductMerge is the record of a product merged into another one.
+type ProductMerge struct {
+	ProductMergeID                 int            `db:"productmerge_id" json:"productmerge_id"`
+	ProductMergeDate               time.Time      `db:"productmerge_date" json:"productmerge_date"`
+	ProductMergeMergedID           int            `db:"productmerge_mergedid" json:"productmerge_mergedid"`
+	ProductMergeMergedName         string         `db:"productmerge_mergedname" json:"productmerge_mergedname"`
+	ProductMergeMergedCasNumber    string         `db:"productmerge_mergedcasnumber" json:"productmerge_mergedcasnumber"`
+	ProductMergeMergedSpecificity  string         `db:"productmerge_mergedspecificity" json:"productmerge_mergedspecificity"`
+	ProductMergeMergedStorageCount int            `db:"productmerge_mergedstoragecount" json:"productmerge_mergedstoragecount"`
+	ProductID                      sql.NullInt64  `db:"product" json:"product_id"` // the surviving product, null if deleted since
+	NameLabel                      sql.NullString `db:"name_label" json:"name_label"`
+	Person                         `db:"person" json:"person"`
+}
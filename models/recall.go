@@ -0,0 +1,48 @@
+package models
+
+import (
+	"database/sql"
+	"time"
+)
+
+// Recall is a supplier batch recall of a product,
+// flagging the matching active storages of all the entities.
+type Recall struct {
+	RecallID          int            `db:"recall_id" json:"recall_id"`
+	RecallDate        time.Time      `db:"recall_date" json:"recall_date"`
+	RecallBatchNumber string         `db:"recall_batchnumber" json:"recall_batchnumber"`
+	RecallComment     sql.NullString `db:"recall_comment" json:"recall_comment"`
+	ProductID         sql.NullInt64  `db:"product" json:"product_id"` // null if the product has been deleted
+	ProductName       sql.NullString `db:"name_label" json:"name_label"`
+	SupplierID        sql.NullInt64  `db:"supplier" json:"supplier_id"` // null to recall the batch of all the suppliers
+	SupplierLabel     sql.NullString `db:"supplier_label" json:"supplier_label"`
+	Person            `db:"person" json:"person"`
+
+	RecallStorageCount         int `db:"recall_storagecount" json:"recall_storagecount"`
+	RecallAcknowledgedCount    int `db:"recall_acknowledgedcount" json:"recall_acknowledgedcount"`
+	RecallAcknowledgementCount int `db:"recall_acknowledgementcount" json:"recall_acknowledgementcount"`
+
+	Storages         []RecallStorage         `db:"-" json:"storages"`
+	Acknowledgements []RecallAcknowledgement `db:"-" json:"acknowledgements"`
+}
+
+// RecallStorage is a storage flagged by a recall.
+type RecallStorage struct {
+	StorageID             int64           `db:"storage_id" json:"storage_id"`
+	StorageBarecode       sql.NullString  `db:"storage_barecode" json:"storage_barecode"`
+	StorageQuantity       sql.NullFloat64 `db:"storage_quantity" json:"storage_quantity"`
+	UnitLabel             sql.NullString  `db:"unit_label" json:"unit_label"`
+	StoreLocationFullPath string          `db:"storelocation_fullpath" json:"storelocation_fullpath"`
+	EntityID              int             `db:"entity_id" json:"entity_id"`
+	EntityName            string          `db:"entity_name" json:"entity_name"`
+}
+
+// RecallAcknowledgement is the acknowledgement of a recall
+// by a manager of an entity of the recalled storages.
+type RecallAcknowledgement struct {
+	RecallAcknowledgementDate sql.NullTime `db:"recallacknowledgement_date" json:"recallacknowledgement_date"` // null until acknowledged
+	EntityID                  int          `db:"entity_id" json:"entity_id"`
+	EntityName                string       `db:"entity_name" json:"entity_name"`
+	PersonID                  int          `db:"person_id" json:"person_id"`
+	PersonEmail               string       `db:"person_email" json:"person_email"`
+}
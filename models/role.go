@@ -0,0 +1,46 @@
+package models
+
+// Role is a named set of permissions
+// assigned to people for a given entity.
+type Role struct {
+	RoleID          int               `db:"role_id" json:"role_id" schema:"role_id"`
+	RoleName        string            `db:"role_name" json:"role_name" schema:"role_name"`
+	RoleRequireTOTP bool              `db:"role_requiretotp" json:"role_requiretotp" schema:"role_requiretotp"` // assignees must use a second factor
+	RolePermissions []*RolePermission `db:"-" json:"role_permissions" schema:"role_permissions"`
+}
+
+// RolePermission is an item/perm pair of a role.
+type RolePermission struct {
+	RolePermissionPermName string `db:"rolepermission_perm_name" json:"rolepermission_perm_name" schema:"rolepermission_perm_name"` // ex: r
+	RolePermissionItemName string `db:"rolepermission_item_name" json:"rolepermission_item_name" schema:"rolepermission_item_name"` // ex: storages
+}
+
+// PersonRole is a role assigned to a person for an entity.
+type PersonRole struct {
+	PersonRoleEntityID int `db:"personrole_entity_id" json:"personrole_entity_id" schema:"personrole_entity_id"` // ex: 8
+	Role               `db:"role" json:"role" schema:"role"`
+}
+
+// RolePermissionItems are the items a role can give permissions on,
+// managers and admins permissions are not role ones.
+var RolePermissionItems = []string{"products", "rproducts", "storages", "entities", "people"}
+
+// IsValid returns true if the role permission perm and item are allowed.
+func (rp RolePermission) IsValid() bool {
+	switch rp.RolePermissionPermName {
+	case "r", "w":
+	case "b":
+		// borrowing is a storages permission
+		return rp.RolePermissionItemName == "storages"
+	default:
+		return false
+	}
+
+	for _, item := range RolePermissionItems {
+		if rp.RolePermissionItemName == item {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,16 @@
+package models
+
+import "database/sql"
+
+// SavedSearch is a person named search
+// the person can subscribe to.
+type SavedSearch struct {
+	SavedSearchID         sql.NullInt64 `db:"savedsearch_id" json:"savedsearch_id" schema:"savedsearch_id"`
+	SavedSearchName       string        `db:"savedsearch_name" json:"savedsearch_name" schema:"savedsearch_name"`
+	SavedSearchQuery      string        `db:"savedsearch_query" json:"savedsearch_query" schema:"savedsearch_query"` // URL query string of the search, ex: casnumber_cmr=true&entity=1
+	SavedSearchSubscribed bool          `db:"savedsearch_subscribed" json:"savedsearch_subscribed" schema:"savedsearch_subscribed"`
+	// last product and storage ids seen while notifying the subscription
+	SavedSearchLastProductID int64 `db:"savedsearch_lastproduct_id" json:"-"`
+	SavedSearchLastStorageID int64 `db:"savedsearch_laststorage_id" json:"-"`
+	Person                   `db:"person" json:"person" schema:"person"`
+}
@@ -7,3 +7,10 @@ type Searchable interface {
 	GetTextFieldName() string
 	GetID() int64
 }
+
+// FullTextSearchable is a Searchable with a FTS5 full text search index
+// whose rowid is the Searchable id.
+type FullTextSearchable interface {
+	Searchable
+	GetFTSTableName() string
+}
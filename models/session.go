@@ -0,0 +1,23 @@
+package models
+
+import "time"
+
+// Session is a server side session of a person
+// created on authentication and extended by the refresh token.
+type Session struct {
+	SessionID             int       `db:"session_id" json:"session_id"`
+	SessionUID            string    `db:"session_uid" json:"-"`         // the access token sid claim and refresh token prefix
+	SessionRefreshHash    string    `db:"session_refreshhash" json:"-"` // sha256 of the refresh token secret
+	SessionCreationDate   time.Time `db:"session_creationdate" json:"session_creationdate"`
+	SessionLastSeenDate   time.Time `db:"session_lastseendate" json:"session_lastseendate"` // last refresh
+	SessionExpirationDate time.Time `db:"session_expirationdate" json:"session_expirationdate"`
+	SessionUserAgent      string    `db:"session_useragent" json:"session_useragent"`
+	SessionIP             string    `db:"session_ip" json:"session_ip"`
+	SessionCurrent        bool      `db:"-" json:"session_current"` // the session of the request
+	Person                `db:"person" json:"person"`
+}
+
+// IsExpired returns true if the session can not be refreshed anymore.
+func (s Session) IsExpired() bool {
+	return time.Now().After(s.SessionExpirationDate)
+}
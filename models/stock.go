@@ -5,4 +5,6 @@ type Stock struct {
 	Total   float64 `json:"total"`
 	Current float64 `json:"current"`
 	Unit    Unit    `json:"unit"`
+	// number of storages which quantity could not be converted into the unit
+	Unconverted int `json:"unconverted"`
 }
@@ -34,6 +34,8 @@ type Storage struct {
 	StorageNumberOfUnit      sql.NullInt64   `db:"storage_number_of_unit" json:"storage_number_of_unit" schema:"storage_number_of_unit" `
 	StorageNumberOfBag       sql.NullInt64   `db:"storage_number_of_bag" json:"storage_number_of_bag" schema:"storage_number_of_bag" `
 	StorageNumberOfCarton    sql.NullInt64   `db:"storage_number_of_carton" json:"storage_number_of_carton" schema:"storage_number_of_carton" `
+	StorageParentID          sql.NullInt64   `db:"storage_parent" json:"storage_parent" schema:"storage_parent" ` // storage the aliquot has been split from
+	StorageRecallID          sql.NullInt64   `db:"storage_recall" json:"storage_recall" schema:"storage_recall" ` // batch recall of the storage
 	Person                   `db:"person" json:"person" schema:"person"`
 	Product                  `db:"product" json:"product" schema:"product"`
 	StoreLocation            `db:"storelocation" json:"storelocation" schema:"storelocation"`
@@ -45,6 +47,10 @@ type Storage struct {
 
 	// storage history count
 	StorageHC int `db:"storage_hc" json:"storage_hc" schema:"storage_hc"` // not in db but sqlx requires the "db" entry
+
+	// quantity converted into the unit requested by the filter, not in db
+	StorageConvertedQuantity sql.NullFloat64 `db:"-" json:"storage_convertedquantity" schema:"-"`
+	UnitConverted            Unit            `db:"-" json:"unit_converted" schema:"-"`
 }
 
 func (s Storage) StorageToStringSlice() []string {
@@ -76,6 +82,14 @@ func (s Storage) StorageToStringSlice() []string {
 	ret = append(ret, strconv.FormatBool(s.StorageToDestroy.Bool))
 	ret = append(ret, strconv.FormatBool(s.StorageArchive.Bool))
 
+	if s.StorageConvertedQuantity.Valid {
+		ret = append(ret, strconv.FormatFloat(s.StorageConvertedQuantity.Float64, 'E', -1, 64))
+	} else {
+		ret = append(ret, "")
+	}
+
+	ret = append(ret, s.UnitConverted.UnitLabel.String)
+
 	return ret
 }
 
@@ -108,6 +122,8 @@ func StoragesToCSV(sts []Storage) (string, error) {
 		"batch_number",
 		"to_destroy?",
 		"archive?",
+		"converted_quantity",
+		"converted_unit",
 	}
 
 	// create a temp file
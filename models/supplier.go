@@ -4,7 +4,30 @@ import "database/sql"
 
 // Supplier is a product supplier.
 type Supplier struct {
-	C             int            `db:"c" json:"c"` // not stored in db but db:"c" set for sqlx
-	SupplierID    sql.NullInt64  `db:"supplier_id" json:"supplier_id" schema:"supplier_id" `
-	SupplierLabel sql.NullString `db:"supplier_label" json:"supplier_label" schema:"supplier_label" `
+	C              int            `db:"c" json:"c"` // not stored in db but db:"c" set for sqlx
+	SupplierID     sql.NullInt64  `db:"supplier_id" json:"supplier_id" schema:"supplier_id" `
+	SupplierLabel  sql.NullString `db:"supplier_label" json:"supplier_label" schema:"supplier_label" `
+	SupplierTenant sql.NullInt64  `db:"supplier_tenant" json:"supplier_tenant" schema:"supplier_tenant" ` // multi-tenant mode: owner entity id, NULL for the shared catalog
+}
+
+func (supplier Supplier) SetC(count int) Searchable {
+	supplier.C = count
+
+	return supplier
+}
+
+func (supplier Supplier) GetTableName() string {
+	return ("supplier")
+}
+
+func (supplier Supplier) GetIDFieldName() string {
+	return ("supplier_id")
+}
+
+func (supplier Supplier) GetTextFieldName() string {
+	return ("supplier_label")
+}
+
+func (supplier Supplier) GetID() int64 {
+	return supplier.SupplierID.Int64
 }
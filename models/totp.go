@@ -0,0 +1,10 @@
+package models
+
+// PersonTOTP is the TOTP second factor of a person,
+// pending until a first code is validated.
+type PersonTOTP struct {
+	PersonID           int    `db:"person" json:"-"`
+	PersonTOTPSecret   string `db:"persontotp_secret" json:"-"`
+	PersonTOTPEnabled  bool   `db:"persontotp_enabled" json:"persontotp_enabled"`
+	PersonTOTPLastStep int64  `db:"persontotp_laststep" json:"-"` // the last validated time step, to reject replays
+}
@@ -8,7 +8,7 @@ type Unit struct {
 	UnitLabel      sql.NullString `db:"unit_label" json:"unit_label" schema:"unit_label" `
 	UnitType       sql.NullString `db:"unit_type" json:"unit_type" schema:"unit_type" `
 	Unit           *Unit          `db:"unit" json:"unit" schema:"unit"` // reference unit
-	UnitMultiplier int            `db:"unit_multiplier" json:"-" schema:"-"`
+	UnitMultiplier float64        `db:"unit_multiplier" json:"-" schema:"-"`
 }
 
 type UnitsResp struct {
@@ -0,0 +1,146 @@
+// Writing of plain text documents as PDF, in a monospaced font
+// on landscape A4 pages.
+package pdf
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/charmap"
+)
+
+const (
+	pageWidth  = 842 // landscape A4, in points
+	pageHeight = 595
+	margin     = 36
+	fontSize   = 8
+	leading    = 10
+
+	// LineWidth is the number of characters of a line, longer lines are wrapped.
+	LineWidth = (pageWidth - 2*margin) * 10 / (fontSize * 6) // Courier glyphs are 0.6 em wide
+	// PageLines is the number of lines of a page.
+	PageLines = (pageHeight - 2*margin) / leading
+)
+
+// Write writes the PDF document of the text lines to w.
+// The characters out of the Windows-1252 charset are replaced by ?.
+func Write(w io.Writer, title string, lines []string) error {
+	var (
+		wrapped []string
+		pages   [][]string
+	)
+
+	for _, l := range lines {
+		r := []rune(l)
+
+		for len(r) > LineWidth {
+			wrapped = append(wrapped, string(r[:LineWidth]))
+			r = r[LineWidth:]
+		}
+
+		wrapped = append(wrapped, string(r))
+	}
+
+	for len(wrapped) > PageLines {
+		pages = append(pages, wrapped[:PageLines])
+		wrapped = wrapped[PageLines:]
+	}
+
+	pages = append(pages, wrapped)
+
+	// objects 1: catalog, 2: pages, 3: font, 4: info,
+	// then a page and its content for each page
+	objects := make([][]byte, 4, 4+2*len(pages))
+
+	kids := make([]string, len(pages))
+	for i := range pages {
+		kids[i] = fmt.Sprintf("%d 0 R", 5+2*i)
+	}
+
+	objects[0] = []byte("<< /Type /Catalog /Pages 2 0 R >>")
+	objects[1] = []byte(fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", strings.Join(kids, " "), len(pages)))
+	objects[2] = []byte("<< /Type /Font /Subtype /Type1 /BaseFont /Courier /Encoding /WinAnsiEncoding >>")
+	objects[3] = append(append([]byte("<< /Title "), literal(title)...), []byte(" /Producer (Chimitheque) >>")...)
+
+	for i, p := range pages {
+		var content bytes.Buffer
+
+		fmt.Fprintf(&content, "BT\n/F1 %d Tf\n%d TL\n%d %d Td\n", fontSize, leading, margin, pageHeight-margin-fontSize)
+
+		for _, l := range p {
+			content.Write(literal(l))
+			content.WriteString(" '\n")
+		}
+
+		// page number
+		fmt.Fprintf(&content, "ET\nBT\n/F1 %d Tf\n%d %d Td\n", fontSize, pageWidth-margin-10*fontSize, margin/2)
+		content.Write(literal(fmt.Sprintf("%d/%d", i+1, len(pages))))
+		content.WriteString(" Tj\nET\n")
+
+		objects = append(objects,
+			[]byte(fmt.Sprintf("<< /Type /Page /Parent 2 0 R /MediaBox [0 0 %d %d] /Resources << /Font << /F1 3 0 R >> >> /Contents %d 0 R >>", pageWidth, pageHeight, 6+2*i)),
+			append([]byte(fmt.Sprintf("<< /Length %d >>\nstream\n", content.Len())), append(content.Bytes(), []byte("endstream")...)...),
+		)
+	}
+
+	var (
+		b       bytes.Buffer
+		offsets = make([]int, len(objects))
+	)
+
+	b.WriteString("%PDF-1.4\n%\xe2\xe3\xcf\xd3\n")
+
+	for i, o := range objects {
+		offsets[i] = b.Len()
+		fmt.Fprintf(&b, "%d 0 obj\n", i+1)
+		b.Write(o)
+		b.WriteString("\nendobj\n")
+	}
+
+	xref := b.Len()
+
+	fmt.Fprintf(&b, "xref\n0 %d\n0000000000 65535 f \n", len(objects)+1)
+
+	for _, o := range offsets {
+		fmt.Fprintf(&b, "%010d 00000 n \n", o)
+	}
+
+	fmt.Fprintf(&b, "trailer\n<< /Size %d /Root 1 0 R /Info 4 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(objects)+1, xref)
+
+	_, err := w.Write(b.Bytes())
+
+	return err
+}
+
+// literal returns the PDF literal string of s in the Windows-1252 charset.
+func literal(s string) []byte {
+	encoded, err := encoding.ReplaceUnsupported(charmap.Windows1252.NewEncoder()).Bytes([]byte(s))
+	if err != nil {
+		encoded = []byte(s)
+	}
+
+	var b bytes.Buffer
+
+	b.WriteByte('(')
+
+	for _, c := range encoded {
+		switch c {
+		case '(', ')', '\\':
+			b.WriteByte('\\')
+			b.WriteByte(c)
+		case '\r', '\n', '\t':
+			b.WriteByte(' ')
+		case '\x1a': // the encoder replacement character
+			b.WriteByte('?')
+		default:
+			b.WriteByte(c)
+		}
+	}
+
+	b.WriteByte(')')
+
+	return b.Bytes()
+}
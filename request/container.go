@@ -13,6 +13,7 @@ type Container struct {
 	PersonEmail    string `json:"PersonEmail"`
 	PersonLanguage string `json:"PersonLanguage"`
 	PersonID       int    `json:"PersonID"`
+	SessionUID     string `json:"-"`
 	AppURL         string `json:"AppURL"`
 	AppPath        string `json:"AppPath"`
 	BuildID        string `json:"BuildID"`
@@ -6,6 +6,7 @@ import (
 	"strings"
 
 	"github.com/tbellembois/gochimitheque/models"
+	"github.com/tbellembois/gochimitheque/smiles"
 )
 
 // type paramType int
@@ -26,6 +27,7 @@ type Filter struct {
 	Offset         uint64
 	Limit          uint64
 
+	AdrClass                int // id
 	Bookmark                bool
 	Borrowing               bool
 	CasNumber               int // id
@@ -37,18 +39,24 @@ type Filter struct {
 	HazardStatements        []int // ids
 	History                 bool
 	Ids                     []int // FIXME: Storage_id
-	Name                    int   // id
+	InChIKey                string
+	MolarMassMin            float64
+	MolarMassMax            float64
+	Name                    int // id
+	PackingGroup            string
 	Permission              string
 	PrecautionaryStatements []int // ids
 	Producer                int
 	ProducerRef             int // id
 	Product                 int // id
 	ProductSpecificity      string
+	Query                   *QueryNode
 	ShowBio                 bool
 	ShowChem                bool
 	ShowConsu               bool
-	SignalWord              int // id
-	Storage                 int // id
+	SignalWord              int    // id
+	SMILES                  string // canonical
+	Storage                 int    // id
 	StorageArchive          bool
 	StorageBarecode         string
 	StorageBatchNumber      string
@@ -58,6 +66,8 @@ type Filter struct {
 	Supplier                int
 	Symbols                 []int // ids
 	Tags                    []int
+	UNNumber                string
+	Unit                    int // id, unit of the converted quantities
 	UnitType                string
 }
 
@@ -74,6 +84,7 @@ type Filter struct {
 // 	filterMap["limit"] = Int
 // 	filterMap["export"] = None
 
+// 	filterMap["adrclass"] = Int
 // 	filterMap["bookmark"] = Bool
 // 	filterMap["borrowing"] = Bool
 // 	filterMap["casnumber_cmr"] = Bool
@@ -86,17 +97,23 @@ type Filter struct {
 // 	filterMap["history"] = Bool
 // 	// FIXME: storage_id[]
 // 	filterMap["ids"] = SliceOfInt
+// 	filterMap["inchikey"] = String
+// 	filterMap["molarmass_min"] = Float
+// 	filterMap["molarmass_max"] = Float
 // 	filterMap["name"] = Int
+// 	filterMap["packing_group"] = String
 // 	filterMap["permission"] = None
 // 	filterMap["precautionarystatements[]"] = SliceOfInt
 // 	filterMap["producer"] = Int
 // 	filterMap["producerref"] = Int
 // 	filterMap["product_specificity"] = String
 // 	filterMap["product"] = Int
+// 	filterMap["query"] = String
 // 	filterMap["showbio"] = Bool
 // 	filterMap["showchem"] = Bool
 // 	filterMap["showconsu"] = Bool
 // 	filterMap["signalword"] = Int
+// 	filterMap["smiles"] = String
 // 	filterMap["storage"] = Int
 // 	filterMap["storage_barecode"] = String
 // 	filterMap["storage_batchnumber"] = String
@@ -107,6 +124,8 @@ type Filter struct {
 // 	filterMap["supplier"] = Int
 // 	filterMap["symbols[]"] = SliceOfInt
 // 	filterMap["tags[]"] = SliceOfInt
+// 	filterMap["un_number"] = String
+// 	filterMap["unit"] = Int
 // 	filterMap["unit_type"] = String
 
 // }
@@ -123,10 +142,13 @@ func NewFilter(r *http.Request, f func(string) (string, error)) (filter *Filter,
 		Offset:         0,
 		Limit:          ^uint64(0),
 
+		AdrClass:         -1,
 		CasNumber:        -1,
 		Category:         -1,
 		EmpiricalFormula: -1,
 		Entity:           -1,
+		MolarMassMin:     -1,
+		MolarMassMax:     -1,
 		Name:             -1,
 		Permission:       "r",
 		Producer:         -1,
@@ -136,6 +158,7 @@ func NewFilter(r *http.Request, f func(string) (string, error)) (filter *Filter,
 		Storage:          -1,
 		Storelocation:    -1,
 		Supplier:         -1,
+		Unit:             -1,
 	}
 
 	if r == nil {
@@ -365,6 +388,48 @@ func NewFilter(r *http.Request, f func(string) (string, error)) (filter *Filter,
 		filter.ProductSpecificity = product_specificity[0]
 	}
 
+	if un_number, ok := r.URL.Query()["un_number"]; ok {
+		filter.UNNumber = strings.TrimPrefix(strings.ToUpper(strings.TrimSpace(un_number[0])), "UN")
+	}
+
+	if inchikey, ok := r.URL.Query()["inchikey"]; ok {
+		filter.InChIKey = strings.ToUpper(strings.TrimSpace(inchikey[0]))
+	}
+
+	if smi, ok := r.URL.Query()["smiles"]; ok {
+		if filter.SMILES, err = smiles.CanonicalSMILES(smi[0]); err != nil {
+			return nil, &models.AppError{
+				OriginalError: err,
+				Code:          http.StatusBadRequest,
+				Message:       "smiles parsing: " + err.Error(),
+			}
+		}
+	}
+
+	if query, ok := r.URL.Query()["query"]; ok {
+		if filter.Query, err = ParseQuery(query[0]); err != nil {
+			return nil, &models.AppError{
+				OriginalError: err,
+				Code:          http.StatusBadRequest,
+				Message:       "query parsing: " + err.Error(),
+			}
+		}
+	}
+
+	if packing_group, ok := r.URL.Query()["packing_group"]; ok {
+		filter.PackingGroup = strings.ToUpper(packing_group[0])
+	}
+
+	if adrclassid, ok := r.URL.Query()["adrclass"]; ok {
+		if filter.AdrClass, err = strconv.Atoi(adrclassid[0]); err != nil {
+			return nil, &models.AppError{
+				OriginalError: err,
+				Code:          http.StatusInternalServerError,
+				Message:       "adrclass atoi conversion",
+			}
+		}
+	}
+
 	if casnumber_cmr, ok := r.URL.Query()["casnumber_cmr"]; ok {
 		if filter.CasNumberCmr, err = strconv.ParseBool(casnumber_cmr[0]); err != nil {
 			return nil, &models.AppError{
@@ -505,6 +570,36 @@ func NewFilter(r *http.Request, f func(string) (string, error)) (filter *Filter,
 		filter.UnitType = unitType[0]
 	}
 
+	if mmin, ok := r.URL.Query()["molarmass_min"]; ok {
+		if filter.MolarMassMin, err = strconv.ParseFloat(mmin[0], 64); err != nil {
+			return nil, &models.AppError{
+				OriginalError: err,
+				Code:          http.StatusBadRequest,
+				Message:       "molarmass_min float conversion",
+			}
+		}
+	}
+
+	if mmax, ok := r.URL.Query()["molarmass_max"]; ok {
+		if filter.MolarMassMax, err = strconv.ParseFloat(mmax[0], 64); err != nil {
+			return nil, &models.AppError{
+				OriginalError: err,
+				Code:          http.StatusBadRequest,
+				Message:       "molarmass_max float conversion",
+			}
+		}
+	}
+
+	if unitid, ok := r.URL.Query()["unit"]; ok {
+		if filter.Unit, err = strconv.Atoi(unitid[0]); err != nil {
+			return nil, &models.AppError{
+				OriginalError: err,
+				Code:          http.StatusInternalServerError,
+				Message:       "unit atoi conversion",
+			}
+		}
+	}
+
 	if producerid, ok := r.URL.Query()["producer"]; ok {
 		if filter.Producer, err = strconv.Atoi(producerid[0]); err != nil {
 			return nil, &models.AppError{
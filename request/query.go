@@ -0,0 +1,410 @@
+package request
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// QueryOperator is the operator of a QueryNode.
+type QueryOperator int
+
+const (
+	QueryTerm QueryOperator = iota
+	QueryAnd
+	QueryOr
+	QueryNot
+)
+
+// QueryDateFormat is the format of the dates in the query ranges.
+const QueryDateFormat = "2006-01-02"
+
+// QueryNode is a node of a parsed search query such as:
+//
+//	(hs:H225 OR hs:H226) AND location:"building B" AND NOT is:archived
+//	cas:64-17-5 quantity:>=100 expirationdate:2020-01-01..2020-12-31
+//
+// Terms are combined with AND, OR and NOT (uppercase), with the usual
+// precedence NOT > AND > OR. Adjacent terms are implicitly ANDed.
+type QueryNode struct {
+	Operator QueryOperator
+	Children []*QueryNode // operands of QueryAnd, QueryOr and QueryNot
+
+	// QueryTerm only
+	Qualifier string      // one of the QueryQualifiers keys
+	Value     string      // * is a wildcard
+	Range     *QueryRange // set for the QueryNumber and QueryDate qualifiers
+}
+
+// QueryRange is an interval, an empty bound is open.
+type QueryRange struct {
+	Min          string
+	Max          string
+	MinExclusive bool
+	MaxExclusive bool
+}
+
+// QueryValueKind is the kind of value expected by a qualifier.
+type QueryValueKind int
+
+const (
+	QueryText QueryValueKind = iota
+	QueryFlag
+	QueryNumber
+	QueryDate
+)
+
+// QueryQualifiers are the supported term qualifiers.
+var QueryQualifiers = map[string]QueryValueKind{
+	// product
+	"name":      QueryText, // name or synonym
+	"cas":       QueryText,
+	"ce":        QueryText,
+	"formula":   QueryText, // empirical formula
+	"hs":        QueryText, // hazard statement reference
+	"ps":        QueryText, // precautionary statement reference
+	"tag":       QueryText,
+	"category":  QueryText,
+	"state":     QueryText, // physical state
+	"molarmass": QueryNumber,
+	// storage
+	"location":       QueryText, // store location full path
+	"entity":         QueryText,
+	"batch":          QueryText,
+	"barecode":       QueryText,
+	"supplier":       QueryText,
+	"quantity":       QueryNumber,
+	"entrydate":      QueryDate,
+	"exitdate":       QueryDate,
+	"openingdate":    QueryDate,
+	"expirationdate": QueryDate,
+	// product or storage
+	"is": QueryFlag,
+}
+
+// QueryFlags are the values of the "is:" qualifier.
+var QueryFlags = []string{"cmr", "restricted", "radioactive", "controlled", "archived", "todestroy", "borrowed"}
+
+var (
+	queryHazardStatementRegex        = regexp.MustCompile(`^(?i)(EU)?H[0-9]{3}`)
+	queryPrecautionaryStatementRegex = regexp.MustCompile(`^(?i)P[0-9]{3}`)
+	queryCasNumberRegex              = regexp.MustCompile(`^[0-9]{2,7}-[0-9]{2}-[0-9]$`)
+)
+
+type queryToken struct {
+	text   string
+	quoted bool // the token contains a quoted part
+}
+
+type queryParser struct {
+	tokens []queryToken
+	pos    int
+}
+
+// ParseQuery parses the search query q.
+// It returns nil for an empty query.
+func ParseQuery(q string) (*QueryNode, error) {
+	var (
+		tokens []queryToken
+		err    error
+	)
+
+	if tokens, err = tokenizeQuery(q); err != nil {
+		return nil, err
+	}
+
+	if len(tokens) == 0 {
+		return nil, nil
+	}
+
+	p := queryParser{tokens: tokens}
+
+	n, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+
+	if p.pos < len(p.tokens) {
+		return nil, fmt.Errorf("unexpected %q", p.tokens[p.pos].text)
+	}
+
+	return n, nil
+}
+
+// tokenizeQuery splits q into words, quoted words and parenthesis.
+func tokenizeQuery(q string) ([]queryToken, error) {
+	var (
+		tokens  []queryToken
+		current strings.Builder
+		quoted  bool
+		inQuote bool
+	)
+
+	flush := func() {
+		if current.Len() > 0 || quoted {
+			tokens = append(tokens, queryToken{text: current.String(), quoted: quoted})
+		}
+
+		current.Reset()
+
+		quoted = false
+	}
+
+	for _, r := range q {
+		switch {
+		case inQuote && r == '"':
+			inQuote = false
+		case inQuote:
+			current.WriteRune(r)
+		case r == '"':
+			inQuote = true
+			quoted = true
+		case r == '(' || r == ')':
+			flush()
+
+			tokens = append(tokens, queryToken{text: string(r)})
+		case unicode.IsSpace(r):
+			flush()
+		default:
+			current.WriteRune(r)
+		}
+	}
+
+	if inQuote {
+		return nil, fmt.Errorf("unterminated quote")
+	}
+
+	flush()
+
+	return tokens, nil
+}
+
+func (p *queryParser) peek() (queryToken, bool) {
+	if p.pos >= len(p.tokens) {
+		return queryToken{}, false
+	}
+
+	return p.tokens[p.pos], true
+}
+
+func (p *queryParser) isOperator(t queryToken, op string) bool {
+	return !t.quoted && t.text == op
+}
+
+// parseOr parses: and ("OR" and)*
+func (p *queryParser) parseOr() (*QueryNode, error) {
+	n, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+
+	children := []*QueryNode{n}
+
+	for {
+		t, ok := p.peek()
+		if !ok || !p.isOperator(t, "OR") {
+			break
+		}
+
+		p.pos++
+
+		if n, err = p.parseAnd(); err != nil {
+			return nil, err
+		}
+
+		children = append(children, n)
+	}
+
+	if len(children) == 1 {
+		return children[0], nil
+	}
+
+	return &QueryNode{Operator: QueryOr, Children: children}, nil
+}
+
+// parseAnd parses: not (["AND"] not)*
+func (p *queryParser) parseAnd() (*QueryNode, error) {
+	n, err := p.parseNot()
+	if err != nil {
+		return nil, err
+	}
+
+	children := []*QueryNode{n}
+
+	for {
+		t, ok := p.peek()
+		if !ok || p.isOperator(t, "OR") || p.isOperator(t, ")") {
+			break
+		}
+
+		if p.isOperator(t, "AND") {
+			p.pos++
+		}
+
+		if n, err = p.parseNot(); err != nil {
+			return nil, err
+		}
+
+		children = append(children, n)
+	}
+
+	if len(children) == 1 {
+		return children[0], nil
+	}
+
+	return &QueryNode{Operator: QueryAnd, Children: children}, nil
+}
+
+// parseNot parses: "NOT" not | primary
+func (p *queryParser) parseNot() (*QueryNode, error) {
+	t, ok := p.peek()
+	if ok && p.isOperator(t, "NOT") {
+		p.pos++
+
+		n, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+
+		return &QueryNode{Operator: QueryNot, Children: []*QueryNode{n}}, nil
+	}
+
+	return p.parsePrimary()
+}
+
+// parsePrimary parses: "(" or ")" | term
+func (p *queryParser) parsePrimary() (*QueryNode, error) {
+	t, ok := p.peek()
+	if !ok {
+		return nil, fmt.Errorf("unexpected end of query")
+	}
+
+	switch {
+	case p.isOperator(t, "("):
+		p.pos++
+
+		n, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+
+		if t, ok = p.peek(); !ok || !p.isOperator(t, ")") {
+			return nil, fmt.Errorf("missing closing parenthesis")
+		}
+
+		p.pos++
+
+		return n, nil
+	case p.isOperator(t, ")"), p.isOperator(t, "AND"), p.isOperator(t, "OR"):
+		return nil, fmt.Errorf("unexpected %q", t.text)
+	}
+
+	p.pos++
+
+	return parseQueryTerm(t)
+}
+
+// parseQueryTerm parses a [qualifier:]value term.
+// Unqualified terms are guessed from their value:
+// hazard and precautionary statement references, CAS numbers
+// and otherwise names.
+func parseQueryTerm(t queryToken) (*QueryNode, error) {
+	var (
+		kind QueryValueKind
+		ok   bool
+		err  error
+	)
+
+	n := &QueryNode{Operator: QueryTerm, Value: t.text}
+
+	if i := strings.Index(t.text, ":"); i > 0 {
+		n.Qualifier = strings.ToLower(t.text[:i])
+		n.Value = t.text[i+1:]
+
+		if kind, ok = QueryQualifiers[n.Qualifier]; !ok {
+			return nil, fmt.Errorf("unknown qualifier %q", n.Qualifier)
+		}
+	} else {
+		switch {
+		case queryHazardStatementRegex.MatchString(n.Value):
+			n.Qualifier = "hs"
+		case queryPrecautionaryStatementRegex.MatchString(n.Value):
+			n.Qualifier = "ps"
+		case queryCasNumberRegex.MatchString(n.Value):
+			n.Qualifier = "cas"
+		default:
+			n.Qualifier = "name"
+		}
+	}
+
+	if n.Value == "" {
+		return nil, fmt.Errorf("empty value for %q", n.Qualifier)
+	}
+
+	switch kind {
+	case QueryFlag:
+		n.Value = strings.ToLower(n.Value)
+
+		for _, flag := range QueryFlags {
+			if n.Value == flag {
+				return n, nil
+			}
+		}
+
+		return nil, fmt.Errorf("unknown flag %q", n.Value)
+	case QueryNumber, QueryDate:
+		if n.Range, err = parseQueryRange(n.Value, kind); err != nil {
+			return nil, fmt.Errorf("%s: %w", n.Qualifier, err)
+		}
+	}
+
+	return n, nil
+}
+
+// parseQueryRange parses min..max, min.., ..max, >v, >=v, <v, <=v or v.
+func parseQueryRange(s string, kind QueryValueKind) (*QueryRange, error) {
+	r := &QueryRange{}
+
+	switch {
+	case strings.Contains(s, ".."):
+		bounds := strings.SplitN(s, "..", 2)
+		r.Min, r.Max = bounds[0], bounds[1]
+	case strings.HasPrefix(s, ">="):
+		r.Min = s[2:]
+	case strings.HasPrefix(s, "<="):
+		r.Max = s[2:]
+	case strings.HasPrefix(s, ">"):
+		r.Min, r.MinExclusive = s[1:], true
+	case strings.HasPrefix(s, "<"):
+		r.Max, r.MaxExclusive = s[1:], true
+	default:
+		r.Min, r.Max = s, s
+	}
+
+	if r.Min == "" && r.Max == "" {
+		return nil, fmt.Errorf("empty range %q", s)
+	}
+
+	for _, b := range []string{r.Min, r.Max} {
+		if b == "" {
+			continue
+		}
+
+		var err error
+
+		if kind == QueryDate {
+			_, err = time.Parse(QueryDateFormat, b)
+		} else {
+			_, err = strconv.ParseFloat(b, 64)
+		}
+
+		if err != nil {
+			return nil, fmt.Errorf("invalid bound %q", b)
+		}
+	}
+
+	return r, nil
+}
@@ -0,0 +1,117 @@
+package request
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// render returns a compact representation of the query tree n.
+func render(n *QueryNode) string {
+	if n == nil {
+		return "<nil>"
+	}
+
+	switch n.Operator {
+	case QueryAnd, QueryOr, QueryNot:
+		op := map[QueryOperator]string{QueryAnd: "AND", QueryOr: "OR", QueryNot: "NOT"}[n.Operator]
+
+		children := make([]string, len(n.Children))
+		for i, c := range n.Children {
+			children[i] = render(c)
+		}
+
+		return "(" + op + " " + strings.Join(children, " ") + ")"
+	}
+
+	if n.Range != nil {
+		return fmt.Sprintf("%s:[%s,%s,%t,%t]", n.Qualifier, n.Range.Min, n.Range.Max, n.Range.MinExclusive, n.Range.MaxExclusive)
+	}
+
+	return n.Qualifier + ":" + n.Value
+}
+
+func TestParseQuery(t *testing.T) {
+	tests := []struct {
+		query string
+		want  string
+	}{
+		{"", "<nil>"},
+		{"   ", "<nil>"},
+		{"ethanol", "name:ethanol"},
+		{"eth*", "name:eth*"},
+		{"NAME:ethanol", "name:ethanol"},
+		// unqualified terms guessed from their value
+		{"H225", "hs:H225"},
+		{"euh014", "hs:euh014"},
+		{"P210", "ps:P210"},
+		{"64-17-5", "cas:64-17-5"},
+		// quoting
+		{`location:"building B"`, "location:building B"},
+		{`"building B"`, "name:building B"},
+		{`name:"a OR b"`, "name:a OR b"},
+		{`"OR"`, "name:OR"},
+		{`name:"(x)"`, "name:(x)"},
+		// operators and precedence
+		{"a b", "(AND name:a name:b)"},
+		{"a AND b", "(AND name:a name:b)"},
+		{"a OR b c", "(OR name:a (AND name:b name:c))"},
+		{"(a OR b) c", "(AND (OR name:a name:b) name:c)"},
+		{"NOT is:archived", "(NOT is:archived)"},
+		{"NOT NOT a", "(NOT (NOT name:a))"},
+		{"a or b", "(AND name:a name:or name:b)"},
+		{"(hs:H225 OR hs:H226) AND location:\"building B\" AND NOT is:archived", "(AND (OR hs:H225 hs:H226) location:building B (NOT is:archived))"},
+		// flags
+		{"is:CMR", "is:cmr"},
+		{"is:controlled", "is:controlled"},
+		// ranges
+		{"quantity:>=100", "quantity:[100,,false,false]"},
+		{"quantity:>100", "quantity:[100,,true,false]"},
+		{"quantity:<5.5", "quantity:[,5.5,false,true]"},
+		{"quantity:<=5", "quantity:[,5,false,false]"},
+		{"quantity:10..20", "quantity:[10,20,false,false]"},
+		{"quantity:10..", "quantity:[10,,false,false]"},
+		{"quantity:42", "quantity:[42,42,false,false]"},
+		{"expirationdate:2020-01-01..2020-12-31", "expirationdate:[2020-01-01,2020-12-31,false,false]"},
+		{"molarmass:..100", "molarmass:[,100,false,false]"},
+	}
+
+	for _, tt := range tests {
+		n, err := ParseQuery(tt.query)
+		if err != nil {
+			t.Errorf("ParseQuery(%q) error: %s", tt.query, err)
+			continue
+		}
+
+		if got := render(n); got != tt.want {
+			t.Errorf("ParseQuery(%q) = %s, want %s", tt.query, got, tt.want)
+		}
+	}
+}
+
+func TestParseQueryErrors(t *testing.T) {
+	tests := []string{
+		`name:"ethanol`,
+		"(a OR b",
+		"a OR b)",
+		"a OR",
+		"AND a",
+		"NOT",
+		"()",
+		"foo:bar",
+		"name:",
+		`name:""`,
+		"is:unknown",
+		"quantity:abc",
+		"quantity:..",
+		"quantity:>",
+		"expirationdate:2020-13-01",
+		"entrydate:yesterday",
+	}
+
+	for _, q := range tests {
+		if n, err := ParseQuery(q); err == nil {
+			t.Errorf("ParseQuery(%q) = %s, want an error", q, render(n))
+		}
+	}
+}
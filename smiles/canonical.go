@@ -0,0 +1,444 @@
+package smiles
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Canonical returns the canonical SMILES of the molecule, the same for all
+// the SMILES of the molecule written with the same aromaticity.
+// Stereochemistry and atom classes are not written.
+func (m *Molecule) Canonical() string {
+	h := m.withoutHydrogens()
+	ranks := h.ranks()
+
+	w := writer{
+		m:        h,
+		ranks:    ranks,
+		adj:      h.adjacency(),
+		visited:  make([]bool, len(h.Atoms)),
+		used:     make([]bool, len(h.Bonds)),
+		children: make([][]int, len(h.Atoms)),
+		rings:    make([][]int, len(h.Atoms)),
+		digits:   make(map[int]int),
+	}
+
+	// sorting the neighbors by rank
+	for a := range w.adj {
+		sort.Slice(w.adj[a], func(i, j int) bool {
+			return ranks[h.other(h.Bonds[w.adj[a][i]], a)] < ranks[h.other(h.Bonds[w.adj[a][j]], a)]
+		})
+	}
+
+	// components starting with their lowest ranked atom
+	order := make([]int, len(h.Atoms))
+	for i := range order {
+		order[i] = i
+	}
+
+	sort.Slice(order, func(i, j int) bool { return ranks[order[i]] < ranks[order[j]] })
+
+	var components []string
+
+	for _, a := range order {
+		if w.visited[a] {
+			continue
+		}
+
+		w.visit(a)
+		w.b.Reset()
+		w.write(a, -1)
+		components = append(components, w.b.String())
+	}
+
+	return strings.Join(components, ".")
+}
+
+// CanonicalSMILES returns the canonical SMILES of the SMILES s.
+func CanonicalSMILES(s string) (string, error) {
+	m, err := Parse(s)
+	if err != nil {
+		return "", err
+	}
+
+	return m.Canonical(), nil
+}
+
+// withoutHydrogens returns a copy of the molecule with the explicit hydrogen
+// atoms, as in [H]C(=O)O, counted in the hydrogens of their neighbor.
+func (m *Molecule) withoutHydrogens() *Molecule {
+	h := &Molecule{}
+	index := make([]int, len(m.Atoms))
+	removed := make([]bool, len(m.Atoms))
+
+	for i, a := range m.Atoms {
+		if a.Symbol != "H" || a.Isotope != 0 || a.Charge != 0 || a.HCount != 0 {
+			continue
+		}
+
+		var bonds []Bond
+
+		for _, b := range m.Bonds {
+			if b.A == i || b.B == i {
+				bonds = append(bonds, b)
+			}
+		}
+
+		if len(bonds) == 1 && bonds[0].Order == Single && m.Atoms[m.other(bonds[0], i)].Symbol != "H" {
+			removed[i] = true
+		}
+	}
+
+	for i, a := range m.Atoms {
+		if removed[i] {
+			continue
+		}
+
+		index[i] = len(h.Atoms)
+		h.Atoms = append(h.Atoms, a)
+	}
+
+	for _, b := range m.Bonds {
+		switch {
+		case removed[b.A]:
+			h.Atoms[index[b.B]].HCount++
+		case removed[b.B]:
+			h.Atoms[index[b.A]].HCount++
+		default:
+			h.Bonds = append(h.Bonds, Bond{A: index[b.A], B: index[b.B], Order: b.Order})
+		}
+	}
+
+	return h
+}
+
+// other returns the atom bonded to the atom a by the bond b.
+func (m *Molecule) other(b Bond, a int) int {
+	if b.A == a {
+		return b.B
+	}
+
+	return b.A
+}
+
+// adjacency returns the bonds indexes of each atom.
+func (m *Molecule) adjacency() [][]int {
+	adj := make([][]int, len(m.Atoms))
+
+	for i, b := range m.Bonds {
+		adj[b.A] = append(adj[b.A], i)
+		adj[b.B] = append(adj[b.B], i)
+	}
+
+	return adj
+}
+
+// ranks returns the canonical rank of each atom, from 0.
+// Atoms are first ranked by their invariants and then by the ranks
+// of their neighbors until stable, ties are then broken one at a time.
+func (m *Molecule) ranks() []int {
+	adj := m.adjacency()
+	keys := make([][]int, len(m.Atoms))
+
+	for i, a := range m.Atoms {
+		aromatic := 0
+		if a.Aromatic {
+			aromatic = 1
+		}
+
+		keys[i] = []int{elementRank(a.Symbol), len(adj[i]), a.HCount, a.Charge, a.Isotope, aromatic}
+	}
+
+	ranks := denseRanks(keys)
+
+	for {
+		ranks = m.refine(ranks, adj)
+
+		// breaking the first tie
+		tie := -1
+
+		for r := 0; r < len(ranks) && tie == -1; r++ {
+			n := 0
+
+			for i := range ranks {
+				if ranks[i] == r {
+					if n++; n == 2 {
+						tie = r
+					}
+				}
+			}
+		}
+
+		if tie == -1 {
+			return ranks
+		}
+
+		for i := range ranks {
+			keys[i] = []int{ranks[i], 1}
+		}
+
+		for i := range ranks {
+			if ranks[i] == tie {
+				keys[i][1] = 0
+
+				break
+			}
+		}
+
+		ranks = denseRanks(keys)
+	}
+}
+
+// refine ranks the atoms by their rank and the sorted ranks and bond orders
+// of their neighbors until the number of ranks is stable.
+func (m *Molecule) refine(ranks []int, adj [][]int) []int {
+	count := distinct(ranks)
+
+	for {
+		keys := make([][]int, len(ranks))
+
+		for i := range ranks {
+			var neighbors []int
+
+			for _, b := range adj[i] {
+				neighbors = append(neighbors, ranks[m.other(m.Bonds[b], i)]*8+int(m.Bonds[b].Order))
+			}
+
+			sort.Ints(neighbors)
+			keys[i] = append([]int{ranks[i]}, neighbors...)
+		}
+
+		next := denseRanks(keys)
+
+		n := distinct(next)
+		if n == count {
+			return ranks
+		}
+
+		ranks, count = next, n
+	}
+}
+
+// denseRanks returns the rank of each key in the lexicographic order of the keys.
+func denseRanks(keys [][]int) []int {
+	order := make([]int, len(keys))
+	for i := range order {
+		order[i] = i
+	}
+
+	less := func(a, b []int) bool {
+		for i := 0; i < len(a) && i < len(b); i++ {
+			if a[i] != b[i] {
+				return a[i] < b[i]
+			}
+		}
+
+		return len(a) < len(b)
+	}
+
+	sort.SliceStable(order, func(i, j int) bool { return less(keys[order[i]], keys[order[j]]) })
+
+	ranks := make([]int, len(keys))
+
+	for i, r := 0, 0; i < len(order); i++ {
+		if i > 0 && less(keys[order[i-1]], keys[order[i]]) {
+			r++
+		}
+
+		ranks[order[i]] = r
+	}
+
+	return ranks
+}
+
+// distinct returns the number of distinct ranks.
+func distinct(ranks []int) int {
+	seen := make(map[int]bool)
+	for _, r := range ranks {
+		seen[r] = true
+	}
+
+	return len(seen)
+}
+
+// elementRank orders carbon first, as in the Hill notation, and then
+// the elements by symbol.
+func elementRank(symbol string) int {
+	if symbol == "C" {
+		return 0
+	}
+
+	r := 0
+	for _, c := range symbol {
+		r = r*128 + int(c)
+	}
+
+	return r
+}
+
+// writer writes the canonical SMILES of a molecule.
+type writer struct {
+	m        *Molecule
+	ranks    []int
+	adj      [][]int // bonds of each atom, sorted by neighbor rank
+	visited  []bool
+	used     []bool
+	children [][]int // tree bonds of each atom
+	rings    [][]int // ring bonds of each atom
+	digits   map[int]int
+	b        strings.Builder
+}
+
+// visit walks the component of the atom a depth first, lowest ranked
+// neighbors first, and splits the bonds between tree and ring bonds.
+func (w *writer) visit(a int) {
+	w.visited[a] = true
+
+	for _, b := range w.adj[a] {
+		if w.used[b] {
+			continue
+		}
+
+		w.used[b] = true
+		o := w.m.other(w.m.Bonds[b], a)
+
+		if w.visited[o] {
+			w.rings[o] = append(w.rings[o], b)
+			w.rings[a] = append(w.rings[a], b)
+
+			continue
+		}
+
+		w.children[a] = append(w.children[a], b)
+		w.visit(o)
+	}
+}
+
+// write writes the atom a reached by the bond from, -1 for the first atom,
+// its ring bonds and its branches.
+func (w *writer) write(a int, from int) {
+	if from != -1 {
+		w.bond(w.m.Bonds[from])
+	}
+
+	w.atom(a)
+
+	var closed []int
+
+	for _, b := range w.rings[a] {
+		if d, ok := w.digits[b]; ok {
+			// closing
+			w.digit(d)
+			closed = append(closed, d)
+			delete(w.digits, b)
+
+			continue
+		}
+
+		// opening with the lowest free digit
+		d := 1
+		for w.inUse(d) || contains(closed, d) {
+			d++
+		}
+
+		w.digits[b] = d
+		w.bond(w.m.Bonds[b])
+		w.digit(d)
+	}
+
+	for i, b := range w.children[a] {
+		if i < len(w.children[a])-1 {
+			w.b.WriteByte('(')
+			w.write(w.m.other(w.m.Bonds[b], a), b)
+			w.b.WriteByte(')')
+		} else {
+			w.write(w.m.other(w.m.Bonds[b], a), b)
+		}
+	}
+}
+
+// inUse returns true if the ring digit d is open.
+func (w *writer) inUse(d int) bool {
+	for _, o := range w.digits {
+		if o == d {
+			return true
+		}
+	}
+
+	return false
+}
+
+func contains(s []int, v int) bool {
+	for _, e := range s {
+		if e == v {
+			return true
+		}
+	}
+
+	return false
+}
+
+// digit writes the ring bond number d.
+func (w *writer) digit(d int) {
+	if d > 9 {
+		w.b.WriteString("%" + strconv.Itoa(d))
+	} else {
+		w.b.WriteString(strconv.Itoa(d))
+	}
+}
+
+// bond writes the symbol of the bond b if it is not the default one.
+func (w *writer) bond(b Bond) {
+	if b.Order == w.m.defaultOrder(b.A, b.B) {
+		return
+	}
+
+	w.b.WriteString(map[BondOrder]string{Single: "-", Double: "=", Triple: "#", Quadruple: "$", Aromatic: ":"}[b.Order])
+}
+
+// atom writes the atom a, between brackets if it is not in the organic
+// subset or if its hydrogens are not the implicit ones.
+func (w *writer) atom(a int) {
+	at := w.m.Atoms[a]
+
+	symbol := at.Symbol
+	if at.Aromatic {
+		symbol = strings.ToLower(symbol)
+	}
+
+	if _, ok := organic[at.Symbol]; ok && at.Isotope == 0 && at.Charge == 0 && at.HCount == w.m.implicitHCount(a) {
+		w.b.WriteString(symbol)
+
+		return
+	}
+
+	w.b.WriteByte('[')
+
+	if at.Isotope != 0 {
+		w.b.WriteString(strconv.Itoa(at.Isotope))
+	}
+
+	w.b.WriteString(symbol)
+
+	if at.HCount > 0 {
+		w.b.WriteByte('H')
+
+		if at.HCount > 1 {
+			w.b.WriteString(strconv.Itoa(at.HCount))
+		}
+	}
+
+	switch {
+	case at.Charge == 1:
+		w.b.WriteByte('+')
+	case at.Charge == -1:
+		w.b.WriteByte('-')
+	case at.Charge > 1:
+		w.b.WriteString("+" + strconv.Itoa(at.Charge))
+	case at.Charge < -1:
+		w.b.WriteString(strconv.Itoa(at.Charge))
+	}
+
+	w.b.WriteByte(']')
+}
@@ -0,0 +1,472 @@
+// Reading of SMILES chemical structures, derivation of their
+// empirical formula and writing of their canonical SMILES.
+package smiles
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/tbellembois/gochimitheque/formula"
+)
+
+// ErrInvalidSMILES is returned for the SMILES that can not be parsed.
+var ErrInvalidSMILES = errors.New("invalid SMILES")
+
+// BondOrder is the order of a bond.
+type BondOrder int
+
+const (
+	Single BondOrder = iota + 1
+	Double
+	Triple
+	Quadruple
+	Aromatic
+)
+
+// Atom is an atom of a molecule.
+type Atom struct {
+	Symbol   string // element symbol, capitalized
+	Aromatic bool
+	Isotope  int // mass number, 0 if not set
+	Charge   int
+	HCount   int  // number of hydrogens, explicit for the bracket atoms or implicit
+	Bracket  bool // written between brackets
+}
+
+// Bond is a bond between the atoms A and B of a molecule.
+type Bond struct {
+	A     int
+	B     int
+	Order BondOrder
+}
+
+// Molecule is the graph of a SMILES, that can be made of several
+// disconnected components.
+type Molecule struct {
+	Atoms []Atom
+	Bonds []Bond
+}
+
+// organic are the normal valences of the organic subset elements,
+// that can be written without brackets.
+var organic = map[string][]int{
+	"B": {3}, "C": {4}, "N": {3, 5}, "O": {2}, "P": {3, 5}, "S": {2, 4, 6},
+	"F": {1}, "Cl": {1}, "Br": {1}, "I": {1},
+}
+
+// aromatic are the elements that can be written in lowercase.
+var aromatic = map[string]bool{
+	"B": true, "C": true, "N": true, "O": true, "P": true, "S": true, "Se": true, "As": true, "Te": true,
+}
+
+// valence returns the contribution of the bond order o to the atoms valences.
+func (o BondOrder) valence() int {
+	if o == Aromatic {
+		return 1
+	}
+
+	return int(o)
+}
+
+// parser parses a SMILES.
+type parser struct {
+	smiles string
+	pos    int
+	m      *Molecule
+}
+
+// ring is an open ring bond.
+type ring struct {
+	atom  int
+	order BondOrder // 0 if not set
+}
+
+// Parse returns the molecule of the SMILES s, as CCO or c1ccccc1C(=O)O.
+// Stereochemistry is read but discarded.
+func Parse(s string) (*Molecule, error) {
+	s = strings.TrimSpace(s)
+
+	// anything after a space is the molecule name
+	if i := strings.IndexAny(s, " \t"); i != -1 {
+		s = s[:i]
+	}
+
+	p := parser{smiles: s, m: &Molecule{}}
+	if err := p.parse(); err != nil {
+		return nil, err
+	}
+
+	for i := range p.m.Atoms {
+		if !p.m.Atoms[i].Bracket {
+			p.m.Atoms[i].HCount = p.m.implicitHCount(i)
+		}
+	}
+
+	return p.m, nil
+}
+
+// errorf returns an ErrInvalidSMILES error at the current position.
+func (p *parser) errorf(format string, a ...interface{}) error {
+	return fmt.Errorf("%w: %s at position %d of %s", ErrInvalidSMILES, fmt.Sprintf(format, a...), p.pos, p.smiles)
+}
+
+func (p *parser) parse() error {
+	var (
+		prev     = -1
+		pending  BondOrder
+		branches []int
+		rings    = make(map[int]ring)
+	)
+
+	if p.smiles == "" {
+		return fmt.Errorf("%w: empty", ErrInvalidSMILES)
+	}
+
+	for p.pos < len(p.smiles) {
+		c := p.smiles[p.pos]
+
+		switch {
+		case c == '(':
+			if prev == -1 {
+				return p.errorf("unexpected branch")
+			}
+
+			branches = append(branches, prev)
+			p.pos++
+		case c == ')':
+			if len(branches) == 0 || pending != 0 {
+				return p.errorf("unexpected branch closing")
+			}
+
+			prev = branches[len(branches)-1]
+			branches = branches[:len(branches)-1]
+			p.pos++
+		case strings.IndexByte("-=#$:/\\", c) != -1:
+			if pending != 0 || prev == -1 {
+				return p.errorf("unexpected bond %q", c)
+			}
+
+			pending = map[byte]BondOrder{'-': Single, '=': Double, '#': Triple, '$': Quadruple, ':': Aromatic, '/': Single, '\\': Single}[c]
+			p.pos++
+		case c == '.':
+			if pending != 0 || prev == -1 {
+				return p.errorf("unexpected dot")
+			}
+
+			prev = -1
+			p.pos++
+		case c == '%' || (c >= '0' && c <= '9'):
+			if prev == -1 {
+				return p.errorf("unexpected ring bond")
+			}
+
+			n, err := p.ringNumber()
+			if err != nil {
+				return err
+			}
+
+			if r, ok := rings[n]; ok {
+				order := pending
+				if r.order != 0 {
+					if order != 0 && order != r.order {
+						return p.errorf("conflicting ring bond %d", n)
+					}
+
+					order = r.order
+				}
+
+				if err = p.bond(r.atom, prev, order); err != nil {
+					return err
+				}
+
+				delete(rings, n)
+			} else {
+				rings[n] = ring{atom: prev, order: pending}
+			}
+
+			pending = 0
+		default:
+			a, err := p.atom()
+			if err != nil {
+				return err
+			}
+
+			p.m.Atoms = append(p.m.Atoms, a)
+
+			if prev != -1 {
+				if err = p.bond(prev, len(p.m.Atoms)-1, pending); err != nil {
+					return err
+				}
+			}
+
+			prev = len(p.m.Atoms) - 1
+			pending = 0
+		}
+	}
+
+	switch {
+	case pending != 0:
+		return p.errorf("missing atom after bond")
+	case len(branches) != 0:
+		return p.errorf("missing branch closing")
+	case len(rings) != 0:
+		return p.errorf("unclosed ring")
+	case len(p.m.Atoms) == 0:
+		return p.errorf("no atom")
+	}
+
+	return nil
+}
+
+// bond adds a bond between the atoms a and b, of the default order if o is 0.
+func (p *parser) bond(a, b int, o BondOrder) error {
+	if a == b {
+		return p.errorf("atom bonded to itself")
+	}
+
+	for _, bd := range p.m.Bonds {
+		if (bd.A == a && bd.B == b) || (bd.A == b && bd.B == a) {
+			return p.errorf("duplicate bond")
+		}
+	}
+
+	if o == 0 {
+		o = p.m.defaultOrder(a, b)
+	}
+
+	p.m.Bonds = append(p.m.Bonds, Bond{A: a, B: b, Order: o})
+
+	return nil
+}
+
+// ringNumber parses a ring bond number, a digit or % followed by two digits.
+func (p *parser) ringNumber() (int, error) {
+	if p.smiles[p.pos] != '%' {
+		p.pos++
+
+		return int(p.smiles[p.pos-1] - '0'), nil
+	}
+
+	if p.pos+3 > len(p.smiles) {
+		return 0, p.errorf("invalid ring bond number")
+	}
+
+	n, err := strconv.Atoi(p.smiles[p.pos+1 : p.pos+3])
+	if err != nil || n < 0 {
+		return 0, p.errorf("invalid ring bond number")
+	}
+
+	p.pos += 3
+
+	return n, nil
+}
+
+// atom parses an organic subset or a bracket atom.
+func (p *parser) atom() (Atom, error) {
+	if p.smiles[p.pos] == '[' {
+		return p.bracketAtom()
+	}
+
+	// two letters elements first
+	for _, s := range []string{"Cl", "Br", "B", "C", "N", "O", "P", "S", "F", "I"} {
+		if strings.HasPrefix(p.smiles[p.pos:], s) {
+			p.pos += len(s)
+
+			return Atom{Symbol: s}, nil
+		}
+	}
+
+	if c := p.smiles[p.pos]; strings.IndexByte("bcnops", c) != -1 {
+		p.pos++
+
+		return Atom{Symbol: strings.ToUpper(string(c)), Aromatic: true}, nil
+	}
+
+	return Atom{}, p.errorf("unexpected %q", p.smiles[p.pos])
+}
+
+// bracketAtom parses an atom as [13CH4], [nH], [O-] or [Fe+2].
+func (p *parser) bracketAtom() (Atom, error) {
+	a := Atom{Bracket: true}
+
+	end := strings.IndexByte(p.smiles[p.pos:], ']')
+	if end == -1 {
+		return a, p.errorf("missing ]")
+	}
+
+	s := p.smiles[p.pos+1 : p.pos+end]
+	i := 0
+
+	// isotope
+	for i < len(s) && s[i] >= '0' && s[i] <= '9' {
+		i++
+	}
+
+	if i > 0 {
+		a.Isotope, _ = strconv.Atoi(s[:i])
+	}
+
+	// symbol, the longest known element
+	switch {
+	case i < len(s) && s[i] >= 'A' && s[i] <= 'Z':
+		a.Symbol = s[i : i+1]
+		if i+1 < len(s) && s[i+1] >= 'a' && s[i+1] <= 'z' {
+			if _, ok := formula.AtomicWeights[s[i:i+2]]; ok {
+				a.Symbol = s[i : i+2]
+			}
+		}
+	case i < len(s) && s[i] >= 'a' && s[i] <= 'z':
+		a.Aromatic = true
+		a.Symbol = strings.ToUpper(s[i : i+1])
+		if i+1 < len(s) && s[i+1] >= 'a' && s[i+1] <= 'z' && aromatic[a.Symbol+s[i+1:i+2]] {
+			a.Symbol += s[i+1 : i+2]
+		}
+	}
+
+	if _, ok := formula.AtomicWeights[a.Symbol]; !ok || (a.Aromatic && !aromatic[a.Symbol]) {
+		return a, p.errorf("unknown element in [%s]", s)
+	}
+
+	i += len(a.Symbol)
+
+	// chirality, discarded
+	chiral := i < len(s) && s[i] == '@'
+	for i < len(s) && s[i] == '@' {
+		i++
+	}
+
+	if chiral && i+1 < len(s) && strings.Contains("TH AL SP TB OH", s[i:i+2]) {
+		i += 2
+		for i < len(s) && s[i] >= '0' && s[i] <= '9' {
+			i++
+		}
+	}
+
+	// hydrogens
+	if i < len(s) && s[i] == 'H' {
+		i++
+		a.HCount = 1
+
+		if i < len(s) && s[i] >= '0' && s[i] <= '9' {
+			a.HCount = int(s[i] - '0')
+			i++
+		}
+	}
+
+	// charge, as +, ++, +2 or -
+	if i < len(s) && (s[i] == '+' || s[i] == '-') {
+		sign := 1
+		if s[i] == '-' {
+			sign = -1
+		}
+
+		j := i + 1
+		for j < len(s) && s[j] >= '0' && s[j] <= '9' {
+			j++
+		}
+
+		if j > i+1 {
+			n, _ := strconv.Atoi(s[i+1 : j])
+			a.Charge = sign * n
+			i = j
+		} else {
+			for i < len(s) && s[i] == s[j-1] {
+				a.Charge += sign
+				i++
+			}
+		}
+	}
+
+	// atom class, discarded
+	if i < len(s) && s[i] == ':' {
+		i++
+		for i < len(s) && s[i] >= '0' && s[i] <= '9' {
+			i++
+		}
+	}
+
+	if i != len(s) {
+		return a, p.errorf("unexpected %q in [%s]", s[i], s)
+	}
+
+	p.pos += end + 1
+
+	return a, nil
+}
+
+// defaultOrder returns the order of a bond without symbol between the atoms a and b.
+func (m *Molecule) defaultOrder(a, b int) BondOrder {
+	if m.Atoms[a].Aromatic && m.Atoms[b].Aromatic {
+		return Aromatic
+	}
+
+	return Single
+}
+
+// bondValence returns the sum of the orders of the bonds of the atom a.
+func (m *Molecule) bondValence(a int) int {
+	v := 0
+
+	for _, b := range m.Bonds {
+		if b.A == a || b.B == a {
+			v += b.Order.valence()
+		}
+	}
+
+	return v
+}
+
+// implicitHCount returns the number of hydrogens of the organic subset
+// atom a filling up its lowest normal valence. Aromatic atoms have
+// one more bond to the aromatic system.
+func (m *Molecule) implicitHCount(a int) int {
+	valences, ok := organic[m.Atoms[a].Symbol]
+	if !ok {
+		return 0
+	}
+
+	v := m.bondValence(a)
+
+	if m.Atoms[a].Aromatic {
+		if h := valences[0] - v - 1; h > 0 {
+			return h
+		}
+
+		return 0
+	}
+
+	for _, n := range valences {
+		if n >= v {
+			return n - v
+		}
+	}
+
+	return 0
+}
+
+// Composition returns the empirical formula of the molecule.
+func (m *Molecule) Composition() formula.Composition {
+	c := make(formula.Composition)
+
+	for _, a := range m.Atoms {
+		c[a.Symbol]++
+
+		if a.HCount > 0 {
+			c["H"] += a.HCount
+		}
+	}
+
+	return c
+}
+
+// Formula returns the empirical formula of the SMILES s in the Hill notation.
+func Formula(s string) (string, error) {
+	m, err := Parse(s)
+	if err != nil {
+		return "", err
+	}
+
+	return m.Composition().Hill(), nil
+}
@@ -0,0 +1,177 @@
+package smiles
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestFormula(t *testing.T) {
+	tests := []struct {
+		smiles  string
+		formula string
+	}{
+		{"C", "CH4"},
+		{"CCO", "C2H6O"},
+		{"[CH3][CH2][OH]", "C2H6O"},
+		{"CC#N", "C2H3N"},
+		{"c1ccccc1", "C6H6"},
+		{"C1=CC=CC=C1", "C6H6"},
+		{"c1ccccc1C(=O)O", "C7H6O2"},
+		{"c1cc[nH]c1", "C4H5N"},
+		{"[H]C(=O)O", "CH2O2"},
+		{"N[C@@H](C)C(=O)O", "C3H7NO2"},
+		{"C%10CC%10", "C3H6"},
+		// charges
+		{"[NH4+]", "H4N"},
+		{"CC(=O)[O-]", "C2H3O2"},
+		{"[NH3+]CC([O-])=O", "C2H5NO2"},
+		{"C[N+](C)(C)C", "C4H12N"},
+		{"[Na+].[Cl-]", "ClNa"},
+		{"[Cu+2].[O-]S(=O)(=O)[O-]", "CuO4S"},
+		// isotopes
+		{"[13CH4]", "CH4"},
+		{"[2H]O[2H]", "H2O"},
+	}
+
+	for _, tt := range tests {
+		f, err := Formula(tt.smiles)
+		if err != nil {
+			t.Errorf("Formula(%q) error: %s", tt.smiles, err)
+			continue
+		}
+
+		if f != tt.formula {
+			t.Errorf("Formula(%q) = %s, want %s", tt.smiles, f, tt.formula)
+		}
+	}
+}
+
+func TestParseAtoms(t *testing.T) {
+	tests := []struct {
+		smiles string
+		atom   Atom
+	}{
+		{"C", Atom{Symbol: "C", HCount: 4}},
+		{"c1ccccc1", Atom{Symbol: "C", Aromatic: true, HCount: 1}},
+		{"[13CH4]", Atom{Symbol: "C", Isotope: 13, HCount: 4, Bracket: true}},
+		{"[2H]", Atom{Symbol: "H", Isotope: 2, Bracket: true}},
+		{"[O-]", Atom{Symbol: "O", Charge: -1, Bracket: true}},
+		{"[NH4+]", Atom{Symbol: "N", Charge: 1, HCount: 4, Bracket: true}},
+		{"[Fe+2]", Atom{Symbol: "Fe", Charge: 2, Bracket: true}},
+		{"[Fe++]", Atom{Symbol: "Fe", Charge: 2, Bracket: true}},
+		{"[C@@H](F)(Cl)Br", Atom{Symbol: "C", HCount: 1, Bracket: true}},
+	}
+
+	for _, tt := range tests {
+		m, err := Parse(tt.smiles)
+		if err != nil {
+			t.Errorf("Parse(%q) error: %s", tt.smiles, err)
+			continue
+		}
+
+		if m.Atoms[0] != tt.atom {
+			t.Errorf("Parse(%q) first atom = %+v, want %+v", tt.smiles, m.Atoms[0], tt.atom)
+		}
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []string{
+		"",
+		"X",
+		"(C)",
+		".C",
+		"C(",
+		"C)",
+		"C(=O",
+		"C==C",
+		"C1CC",
+		"c1ccccc",
+		"[C",
+		"[Qq]",
+		"[13]",
+	}
+
+	for _, s := range tests {
+		if _, err := Parse(s); !errors.Is(err, ErrInvalidSMILES) {
+			t.Errorf("Parse(%q) error = %v, want %v", s, err, ErrInvalidSMILES)
+		}
+
+		if _, err := CanonicalSMILES(s); !errors.Is(err, ErrInvalidSMILES) {
+			t.Errorf("CanonicalSMILES(%q) error = %v, want %v", s, err, ErrInvalidSMILES)
+		}
+	}
+}
+
+func TestCanonicalSMILES(t *testing.T) {
+	// each line is the same molecule written in different ways
+	tests := []struct {
+		smiles    []string
+		canonical string
+	}{
+		{[]string{"CCO", "OCC", "C(O)C", "[CH3][CH2][OH]"}, "CCO"},
+		{[]string{"Cc1ccccc1", "c1ccc(C)cc1", "c1ccc(cc1)C"}, "Cc1ccccc1"},
+		{[]string{"c1ccccc1C(=O)O", "OC(=O)c1ccccc1"}, "c1ccc(cc1)C(=O)O"},
+		{[]string{"C1=CC=CC=C1", "C=1C=CC=CC=1", "C1C=CC=CC=1"}, "C=1C=CC=CC1"},
+		{[]string{"C1CC1", "C%10CC%10"}, "C1CC1"},
+		{[]string{"OC=O", "[H]C(=O)O"}, "C(=O)O"},
+		{[]string{"c1cc[nH]c1", "[nH]1cccc1"}, "c1cc[nH]c1"},
+		// stereochemistry is discarded
+		{[]string{"N[C@@H](C)C(=O)O", "N[C@H](C)C(=O)O"}, "CC(C(=O)O)N"},
+		// charges
+		{[]string{"CC(=O)[O-]", "[O-]C(=O)C"}, "CC([O-])=O"},
+		{[]string{"[NH3+]CC([O-])=O", "[O-]C(=O)C[NH3+]"}, "C(C([O-])=O)[NH3+]"},
+		{[]string{"[Fe+2]", "[Fe++]"}, "[Fe+2]"},
+		{[]string{"[Na+].[Cl-]", "[Cl-].[Na+]"}, "[Cl-].[Na+]"},
+		// isotopes
+		{[]string{"[13CH3]CO", "OC[13CH3]"}, "[13CH3]CO"},
+		{[]string{"[2H]O[2H]"}, "[2H]O[2H]"},
+	}
+
+	for _, tt := range tests {
+		for _, s := range tt.smiles {
+			c, err := CanonicalSMILES(s)
+			if err != nil {
+				t.Errorf("CanonicalSMILES(%q) error: %s", s, err)
+				continue
+			}
+
+			if c != tt.canonical {
+				t.Errorf("CanonicalSMILES(%q) = %s, want %s", s, c, tt.canonical)
+			}
+
+			// the canonical SMILES is its own canonical SMILES
+			if cc, err := CanonicalSMILES(c); err != nil || cc != c {
+				t.Errorf("CanonicalSMILES(%q) = %s, %v, want %s", c, cc, err, c)
+			}
+		}
+	}
+}
+
+func TestCanonicalSMILESDistinct(t *testing.T) {
+	// isomers and isotopologues must not share their canonical SMILES
+	tests := [][2]string{
+		{"CCO", "COC"},
+		{"CC(=O)O", "COC=O"},
+		{"[13CH4]", "C"},
+		{"[2H]O[2H]", "O"},
+		{"[NH4+]", "N"},
+		{"CC(=O)[O-]", "CC(=O)O"},
+	}
+
+	for _, tt := range tests {
+		a, err := CanonicalSMILES(tt[0])
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		b, err := CanonicalSMILES(tt[1])
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if a == b {
+			t.Errorf("CanonicalSMILES(%q) = CanonicalSMILES(%q) = %s", tt[0], tt[1], a)
+		}
+	}
+}
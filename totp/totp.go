@@ -0,0 +1,105 @@
+// RFC 6238 time-based one-time passwords, compatible with the
+// common authenticator applications (SHA1, 6 digits, 30 seconds).
+package totp
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/binary"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	// Period is the validity of a code in seconds.
+	Period = 30
+	// Digits is the number of digits of a code.
+	Digits = 6
+	// Skew is the number of periods before and after the current one
+	// also accepted to allow clock drifts.
+	Skew = 1
+)
+
+var b32 = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// GenerateSecret returns a random base32 encoded secret.
+func GenerateSecret() (secret string, err error) {
+	k := make([]byte, 20)
+	if _, err = rand.Read(k); err != nil {
+		return
+	}
+
+	secret = b32.EncodeToString(k)
+
+	return
+}
+
+// Step returns the time step of the time t.
+func Step(t time.Time) int64 {
+	return t.Unix() / Period
+}
+
+// Code returns the code of the secret for the time step.
+func Code(secret string, step int64) (code string, err error) {
+	var key []byte
+	if key, err = b32.DecodeString(strings.ToUpper(strings.TrimRight(secret, "="))); err != nil {
+		return
+	}
+
+	msg := make([]byte, 8)
+	binary.BigEndian.PutUint64(msg, uint64(step))
+
+	mac := hmac.New(sha1.New, key)
+	mac.Write(msg)
+	sum := mac.Sum(nil)
+
+	// dynamic truncation
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+
+	code = fmt.Sprintf("%0*d", Digits, value%1000000)
+
+	return
+}
+
+// Validate returns the time step of the code if it is valid for the secret at the time t.
+// The step should be stored and the codes of previous steps rejected to prevent replays.
+func Validate(secret string, code string, t time.Time) (step int64, ok bool) {
+	code = strings.ReplaceAll(code, " ", "")
+	if len(code) != Digits {
+		return 0, false
+	}
+
+	current := Step(t)
+
+	for s := current - Skew; s <= current+Skew; s++ {
+		c, err := Code(secret, s)
+		if err != nil {
+			return 0, false
+		}
+
+		if subtle.ConstantTimeCompare([]byte(c), []byte(code)) == 1 {
+			return s, true
+		}
+	}
+
+	return 0, false
+}
+
+// URL returns the otpauth URL of the secret for the account
+// to be displayed as a QR code.
+func URL(issuer string, account string, secret string) string {
+	v := url.Values{}
+	v.Set("secret", secret)
+	v.Set("issuer", issuer)
+	v.Set("algorithm", "SHA1")
+	v.Set("digits", fmt.Sprint(Digits))
+	v.Set("period", fmt.Sprint(Period))
+
+	return "otpauth://totp/" + url.PathEscape(issuer+":"+account) + "?" + v.Encode()
+}
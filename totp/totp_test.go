@@ -0,0 +1,91 @@
+package totp
+
+import (
+	"testing"
+	"time"
+)
+
+// rfcSecret is the SHA1 key of the RFC 6238 test vectors, "12345678901234567890".
+const rfcSecret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+func TestCode(t *testing.T) {
+	// RFC 6238 appendix B, truncated to the last 6 digits
+	tests := []struct {
+		time int64
+		code string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1111111111, "050471"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+		{20000000000, "353130"},
+	}
+
+	for _, tt := range tests {
+		code, err := Code(rfcSecret, Step(time.Unix(tt.time, 0)))
+		if err != nil {
+			t.Errorf("Code(%d) error: %s", tt.time, err)
+			continue
+		}
+
+		if code != tt.code {
+			t.Errorf("Code(%d) = %s, want %s", tt.time, code, tt.code)
+		}
+	}
+}
+
+func TestCodeSecret(t *testing.T) {
+	tests := []struct {
+		secret string
+		valid  bool
+	}{
+		{rfcSecret, true},
+		{"gezdgnbvgy3tqojqgezdgnbvgy3tqojq", true},
+		{"GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ====", true},
+		{"not a secret!", false},
+	}
+
+	for _, tt := range tests {
+		code, err := Code(tt.secret, 1)
+		if (err == nil) != tt.valid {
+			t.Errorf("Code(%q) error = %v, want valid %t", tt.secret, err, tt.valid)
+			continue
+		}
+
+		if tt.valid && code != "287082" {
+			t.Errorf("Code(%q) = %s, want 287082", tt.secret, code)
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	// code of the step 1 (time 30 to 59),
+	// 081804 is the code of the step 37037036 (time 1111111080 to 1111111109)
+	const code = "287082"
+
+	tests := []struct {
+		name string
+		code string
+		time int64
+		step int64
+		ok   bool
+	}{
+		{"current step", code, 59, 1, true},
+		{"spaces", "287 082", 45, 1, true},
+		{"previous step within skew", code, 60, 1, true},
+		{"next step within skew", code, 29, 1, true},
+		{"two steps later", code, 90, 0, false},
+		{"two steps earlier", "081804", 1111111049, 0, false},
+		{"wrong code", "287083", 59, 0, false},
+		{"short code", "28708", 59, 0, false},
+		{"long code", "2870820", 59, 0, false},
+	}
+
+	for _, tt := range tests {
+		step, ok := Validate(rfcSecret, tt.code, time.Unix(tt.time, 0))
+		if ok != tt.ok || step != tt.step {
+			t.Errorf("%s: Validate(%q, %d) = %d, %t, want %d, %t", tt.name, tt.code, tt.time, step, ok, tt.step, tt.ok)
+		}
+	}
+}
@@ -0,0 +1,174 @@
+// Conversion of quantities and concentrations between units,
+// across mass, volume and amount of substance with the density
+// and molar mass of the substance.
+package units
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Reference units labels, the units without reference unit of the unit table.
+const (
+	Gram         = "g"
+	Liter        = "L"
+	Mole         = "mol"
+	GramPerLiter = "g/L"
+	Molar        = "M"
+	Kelvin       = "°K"
+)
+
+var (
+	// ErrIncompatibleUnits is returned when converting between units of different dimensions.
+	ErrIncompatibleUnits = errors.New("incompatible units")
+	// ErrMissingDensity is returned when converting between mass and volume without density.
+	ErrMissingDensity = errors.New("the product density is required")
+	// ErrMissingMolarMass is returned when converting to or from amount of substance without molar mass.
+	ErrMissingMolarMass = errors.New("the product molar mass is required")
+)
+
+// Unit is a unit defined by its reference unit and multiplier:
+// a quantity q in the unit is q*Multiplier in the reference unit.
+type Unit struct {
+	Label      string
+	Reference  string  // the reference unit label, Label for a reference unit
+	Multiplier float64 // 1 for a reference unit
+}
+
+// Substance are the properties of the converted substance, 0 if unknown.
+type Substance struct {
+	Density   float64 // g/mL
+	MolarMass float64 // g/mol
+}
+
+// toGram returns the quantity q in the reference unit ref in grams.
+func toGram(q float64, ref string, s Substance) (float64, error) {
+	switch ref {
+	case Gram:
+		return q, nil
+	case Liter:
+		if s.Density <= 0 {
+			return 0, ErrMissingDensity
+		}
+
+		return q * 1000 * s.Density, nil
+	case Mole:
+		if s.MolarMass <= 0 {
+			return 0, ErrMissingMolarMass
+		}
+
+		return q * s.MolarMass, nil
+	}
+
+	return 0, ErrIncompatibleUnits
+}
+
+// fromGram returns the quantity q in grams in the reference unit ref.
+func fromGram(q float64, ref string, s Substance) (float64, error) {
+	switch ref {
+	case Gram:
+		return q, nil
+	case Liter:
+		if s.Density <= 0 {
+			return 0, ErrMissingDensity
+		}
+
+		return q / 1000 / s.Density, nil
+	case Mole:
+		if s.MolarMass <= 0 {
+			return 0, ErrMissingMolarMass
+		}
+
+		return q / s.MolarMass, nil
+	}
+
+	return 0, ErrIncompatibleUnits
+}
+
+// toGramPerLiter returns the concentration c in the reference unit ref in g/L.
+func toGramPerLiter(c float64, ref string, s Substance) (float64, error) {
+	switch ref {
+	case GramPerLiter:
+		return c, nil
+	case Molar:
+		if s.MolarMass <= 0 {
+			return 0, ErrMissingMolarMass
+		}
+
+		return c * s.MolarMass, nil
+	}
+
+	return 0, ErrIncompatibleUnits
+}
+
+// fromGramPerLiter returns the concentration c in g/L in the reference unit ref.
+func fromGramPerLiter(c float64, ref string, s Substance) (float64, error) {
+	switch ref {
+	case GramPerLiter:
+		return c, nil
+	case Molar:
+		if s.MolarMass <= 0 {
+			return 0, ErrMissingMolarMass
+		}
+
+		return c / s.MolarMass, nil
+	}
+
+	return 0, ErrIncompatibleUnits
+}
+
+// isQuantity returns true for the reference units of mass, volume and amount of substance.
+func isQuantity(ref string) bool {
+	return ref == Gram || ref == Liter || ref == Mole
+}
+
+// isConcentration returns true for the reference units of mass and molar concentrations.
+func isConcentration(ref string) bool {
+	return ref == GramPerLiter || ref == Molar
+}
+
+// Convert returns the quantity q in the unit from converted into the unit to.
+// Units with the same reference unit are always convertible, mass, volume and
+// amount of substance are convertible with the density and molar mass of s,
+// as mass and molar concentrations with its molar mass.
+func Convert(q float64, from Unit, to Unit, s Substance) (float64, error) {
+	var (
+		base float64
+		err  error
+	)
+
+	if from.Multiplier == 0 || to.Multiplier == 0 {
+		return 0, fmt.Errorf("%w: %s to %s", ErrIncompatibleUnits, from.Label, to.Label)
+	}
+
+	base = q * from.Multiplier
+
+	switch {
+	case from.Label == to.Label:
+		return q, nil
+	case from.Reference == Kelvin:
+		// temperature scales have offsets
+		return 0, fmt.Errorf("%w: %s to %s", ErrIncompatibleUnits, from.Label, to.Label)
+	case from.Reference == to.Reference:
+	case isQuantity(from.Reference) && isQuantity(to.Reference):
+		if base, err = toGram(base, from.Reference, s); err != nil {
+			return 0, err
+		}
+
+		if base, err = fromGram(base, to.Reference, s); err != nil {
+			return 0, err
+		}
+	case isConcentration(from.Reference) && isConcentration(to.Reference):
+		if base, err = toGramPerLiter(base, from.Reference, s); err != nil {
+			return 0, err
+		}
+
+		if base, err = fromGramPerLiter(base, to.Reference, s); err != nil {
+			return 0, err
+		}
+	default:
+		return 0, fmt.Errorf("%w: %s to %s", ErrIncompatibleUnits, from.Label, to.Label)
+	}
+
+	return base / to.Multiplier, nil
+}
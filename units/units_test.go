@@ -0,0 +1,104 @@
+package units
+
+import (
+	"errors"
+	"math"
+	"testing"
+)
+
+var (
+	g   = Unit{Label: "g", Reference: Gram, Multiplier: 1}
+	mg  = Unit{Label: "mg", Reference: Gram, Multiplier: 0.001}
+	kg  = Unit{Label: "kg", Reference: Gram, Multiplier: 1000}
+	l   = Unit{Label: "L", Reference: Liter, Multiplier: 1}
+	ml  = Unit{Label: "mL", Reference: Liter, Multiplier: 0.001}
+	mol = Unit{Label: "mol", Reference: Mole, Multiplier: 1}
+	mmo = Unit{Label: "mmol", Reference: Mole, Multiplier: 0.001}
+	gpl = Unit{Label: "g/L", Reference: GramPerLiter, Multiplier: 1}
+	mgl = Unit{Label: "mg/L", Reference: GramPerLiter, Multiplier: 0.001}
+	m   = Unit{Label: "M", Reference: Molar, Multiplier: 1}
+	mm  = Unit{Label: "mM", Reference: Molar, Multiplier: 0.001}
+	k   = Unit{Label: "°K", Reference: Kelvin, Multiplier: 1}
+	c   = Unit{Label: "°C", Reference: Kelvin, Multiplier: 1}
+)
+
+func TestConvert(t *testing.T) {
+	ethanol := Substance{Density: 0.789, MolarMass: 46.07}
+	water := Substance{Density: 1, MolarMass: 18.015}
+	unknown := Substance{}
+
+	tests := []struct {
+		q    float64
+		from Unit
+		to   Unit
+		s    Substance
+		want float64
+	}{
+		// same dimension
+		{5, g, g, unknown, 5},
+		{1500, mg, g, unknown, 1.5},
+		{2.5, kg, mg, unknown, 2500000},
+		{250, ml, l, unknown, 0.25},
+		{3, mmo, mol, unknown, 0.003},
+		{100, mgl, gpl, unknown, 0.1},
+		{5, m, mm, unknown, 5000},
+		{20, c, c, unknown, 20},
+		// mass and volume with the density
+		{100, ml, g, ethanol, 78.9},
+		{78.9, g, ml, ethanol, 100},
+		{1, l, kg, water, 1},
+		// mass and amount of substance with the molar mass
+		{46.07, g, mol, ethanol, 1},
+		{2, mmo, mg, water, 36.03},
+		// volume and amount of substance with the density and molar mass
+		{1, mol, ml, ethanol, 46.07 / 0.789},
+		{18.015, ml, mol, water, 1},
+		// mass and molar concentrations with the molar mass
+		{1, m, gpl, water, 18.015},
+		{46.07, gpl, mm, ethanol, 1000},
+	}
+
+	for _, tt := range tests {
+		got, err := Convert(tt.q, tt.from, tt.to, tt.s)
+		if err != nil {
+			t.Errorf("Convert(%g %s to %s) error: %s", tt.q, tt.from.Label, tt.to.Label, err)
+			continue
+		}
+
+		if math.Abs(got-tt.want) > 1e-9*math.Max(1, math.Abs(tt.want)) {
+			t.Errorf("Convert(%g %s to %s) = %g, want %g", tt.q, tt.from.Label, tt.to.Label, got, tt.want)
+		}
+	}
+}
+
+func TestConvertErrors(t *testing.T) {
+	ethanol := Substance{Density: 0.789, MolarMass: 46.07}
+	noDensity := Substance{MolarMass: 46.07}
+	noMolarMass := Substance{Density: 0.789}
+
+	tests := []struct {
+		from Unit
+		to   Unit
+		s    Substance
+		want error
+	}{
+		{g, ml, noDensity, ErrMissingDensity},
+		{l, kg, noDensity, ErrMissingDensity},
+		{mol, l, noDensity, ErrMissingDensity},
+		{g, mol, noMolarMass, ErrMissingMolarMass},
+		{mmo, mg, noMolarMass, ErrMissingMolarMass},
+		{m, gpl, noMolarMass, ErrMissingMolarMass},
+		{gpl, mm, noMolarMass, ErrMissingMolarMass},
+		{g, gpl, ethanol, ErrIncompatibleUnits},
+		{m, mol, ethanol, ErrIncompatibleUnits},
+		{k, c, ethanol, ErrIncompatibleUnits},
+		{k, g, ethanol, ErrIncompatibleUnits},
+		{g, Unit{Label: "?"}, ethanol, ErrIncompatibleUnits},
+	}
+
+	for _, tt := range tests {
+		if _, err := Convert(1, tt.from, tt.to, tt.s); !errors.Is(err, tt.want) {
+			t.Errorf("Convert(%s to %s) error = %v, want %v", tt.from.Label, tt.to.Label, err, tt.want)
+		}
+	}
+}